@@ -2,19 +2,104 @@ package config
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
+// JWTKey is a rotated signing key, loaded from the database at startup.
+type JWTKey struct {
+	ID      string
+	Purpose string
+	Secret  string
+}
+
+// OAuthProvider is an upstream identity provider users can sign in with.
+// Type "oidc" reads the endpoints from the issuer's discovery document,
+// "github" uses the GitHub OAuth endpoints. Set endpoints override both.
+type OAuthProvider struct {
+	Name         string   `mapstructure:"name"`
+	Type         string   `mapstructure:"type"`
+	Issuer       string   `mapstructure:"issuer"`
+	ClientID     string   `mapstructure:"client_id"`
+	ClientSecret string   `mapstructure:"client_secret"`
+	Scopes       []string `mapstructure:"scopes"`
+	AuthURL      string   `mapstructure:"auth_url"`
+	TokenURL     string   `mapstructure:"token_url"`
+	UserInfoURL  string   `mapstructure:"userinfo_url"`
+
+	// LinkVerifiedEmail signs a new identity into the account with the same
+	// email when the provider and the account both verified it. Accounts
+	// created before migration 0012 count as verified only after a
+	// password reset.
+	// ProvisionUsers creates an account for an identity that matches none.
+	LinkVerifiedEmail bool `mapstructure:"link_verified_email"`
+	ProvisionUsers    bool `mapstructure:"provision_users"`
+}
+
 type Config struct {
 	AppPort       string
+	AppBaseURL    string
+	DBDriver      string
+	DBPath        string
 	DBUser        string
 	DBPass        string
 	DBHost        string
 	DBName        string
 	DBSSLMode     string
+	DBAutoMigrate bool
 	JWTSecretKey  string
 	JWTRefreshKey string
+	JWTKeys       []JWTKey
+	SMTPHost      string
+	SMTPPort      int
+	SMTPUser      string
+	SMTPPass      string
+	SMTPFrom      string
+
+	AuditCheckpointInterval time.Duration
+	OutboxSinks             []string
+	OutboxPollInterval      time.Duration
+
+	// Checkpoints are signed with a key derived from AuditCheckpointKey, or
+	// from jwt.secret_key when unset. Retired keys still verify the
+	// checkpoints signed before a rotation.
+	AuditCheckpointKey         string
+	AuditRetiredCheckpointKeys []string
+
+	// Deleted accounts can be restored until the grace period ends
+	UserDeletionGracePeriod time.Duration
+	UserPurgeInterval       time.Duration
+
+	ErasurePollInterval time.Duration
+
+	// Blob storage for uploads, local keeps files under BlobLocalDir
+	BlobDriver      string
+	BlobLocalDir    string
+	BlobPublicURL   string
+	BlobS3Endpoint  string
+	BlobS3Region    string
+	BlobS3Bucket    string
+	BlobS3AccessKey string
+	BlobS3SecretKey string
+	BlobS3PathStyle bool
+	AvatarMaxBytes  int64
+
+	// Browser sessions keep the tokens in cookies, see /auth/session
+	SessionCookies   bool
+	SessionSecure    bool
+	SessionSameSite  string
+	SessionDomain    string
+	SessionAccessTTL time.Duration
+
+	// Hosted pages on top of the browser session, the templates and static
+	// files can be replaced to theme them
+	WebEnabled      bool
+	WebTemplatesDir string
+	WebStaticDir    string
+	WebTitle        string
+
+	OAuthProviders []OAuthProvider
 }
 
 func InitConfig(fileName string) (*Config, error) {
@@ -23,26 +108,112 @@ func InitConfig(fileName string) (*Config, error) {
 	viper.AddConfigPath(".")
 
 	viper.SetDefault("app.port", 8080)
+	viper.SetDefault("app.base_url", "http://localhost:8080")
+	viper.SetDefault("db.driver", "postgres")
+	viper.SetDefault("db.path", "authen.db")
 	viper.SetDefault("db.user", "postgres")
 	viper.SetDefault("db.password", "")
 	viper.SetDefault("db.host", "localhost:5432")
 	viper.SetDefault("db.name", "auth_system")
 	viper.SetDefault("db.ssl_mode", "disable")
+	viper.SetDefault("db.auto_migrate", false)
 	viper.SetDefault("jwt.secret_key", "secret_key")
 	viper.SetDefault("jwt.refresh_key", "refresh_key")
+	viper.SetDefault("smtp.host", "")
+	viper.SetDefault("smtp.port", 587)
+	viper.SetDefault("smtp.username", "")
+	viper.SetDefault("smtp.password", "")
+	viper.SetDefault("smtp.from", "no-reply@localhost")
+	viper.SetDefault("audit.checkpoint_interval", "1h")
+	viper.SetDefault("audit.checkpoint_key", "")
+	viper.SetDefault("audit.retired_checkpoint_keys", []string{})
+	viper.SetDefault("outbox.sinks", []string{"webhook"})
+	viper.SetDefault("outbox.poll_interval", "1s")
+	viper.SetDefault("users.deletion_grace_period", "720h")
+	viper.SetDefault("users.purge_interval", "1h")
+	viper.SetDefault("privacy.erasure_poll_interval", "10s")
+	viper.SetDefault("blob.driver", "local")
+	viper.SetDefault("blob.local_dir", "uploads")
+	viper.SetDefault("blob.public_url", "")
+	viper.SetDefault("blob.s3.endpoint", "")
+	viper.SetDefault("blob.s3.region", "us-east-1")
+	viper.SetDefault("blob.s3.bucket", "")
+	viper.SetDefault("blob.s3.access_key", "")
+	viper.SetDefault("blob.s3.secret_key", "")
+	viper.SetDefault("blob.s3.path_style", true)
+	viper.SetDefault("avatar.max_bytes", 5<<20)
+	viper.SetDefault("session.cookies", false)
+	viper.SetDefault("session.secure", true)
+	viper.SetDefault("session.same_site", "strict")
+	viper.SetDefault("session.domain", "")
+	viper.SetDefault("session.access_token_ttl", "10m")
+	viper.SetDefault("web.enabled", false)
+	viper.SetDefault("web.templates_dir", "templates/web")
+	viper.SetDefault("web.static_dir", "static")
+	viper.SetDefault("web.title", "Auth System")
 
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("reading config failed: %w", err)
 	}
 
+	var providers []OAuthProvider
+	if err := viper.UnmarshalKey("oauth.providers", &providers); err != nil {
+		return nil, fmt.Errorf("reading oauth.providers failed: %w", err)
+	}
+
 	return &Config{
 		AppPort:       viper.GetString("app.port"),
+		AppBaseURL:    viper.GetString("app.base_url"),
+		DBDriver:      viper.GetString("db.driver"),
+		DBPath:        viper.GetString("db.path"),
 		DBUser:        viper.GetString("db.user"),
 		DBPass:        viper.GetString("db.password"),
 		DBHost:        viper.GetString("db.host"),
 		DBName:        viper.GetString("db.name"),
 		DBSSLMode:     viper.GetString("db.ssl_mode"),
+		DBAutoMigrate: viper.GetBool("db.auto_migrate"),
 		JWTSecretKey:  viper.GetString("jwt.secret_key"),
 		JWTRefreshKey: viper.GetString("jwt.refresh_key"),
+		SMTPHost:      viper.GetString("smtp.host"),
+		SMTPPort:      viper.GetInt("smtp.port"),
+		SMTPUser:      viper.GetString("smtp.username"),
+		SMTPPass:      viper.GetString("smtp.password"),
+		SMTPFrom:      viper.GetString("smtp.from"),
+
+		AuditCheckpointInterval: viper.GetDuration("audit.checkpoint_interval"),
+		OutboxSinks:             viper.GetStringSlice("outbox.sinks"),
+		OutboxPollInterval:      viper.GetDuration("outbox.poll_interval"),
+
+		AuditCheckpointKey:         viper.GetString("audit.checkpoint_key"),
+		AuditRetiredCheckpointKeys: viper.GetStringSlice("audit.retired_checkpoint_keys"),
+
+		UserDeletionGracePeriod: viper.GetDuration("users.deletion_grace_period"),
+		UserPurgeInterval:       viper.GetDuration("users.purge_interval"),
+
+		ErasurePollInterval: viper.GetDuration("privacy.erasure_poll_interval"),
+
+		BlobDriver:      viper.GetString("blob.driver"),
+		BlobLocalDir:    viper.GetString("blob.local_dir"),
+		BlobPublicURL:   viper.GetString("blob.public_url"),
+		BlobS3Endpoint:  viper.GetString("blob.s3.endpoint"),
+		BlobS3Region:    viper.GetString("blob.s3.region"),
+		BlobS3Bucket:    viper.GetString("blob.s3.bucket"),
+		BlobS3AccessKey: viper.GetString("blob.s3.access_key"),
+		BlobS3SecretKey: viper.GetString("blob.s3.secret_key"),
+		BlobS3PathStyle: viper.GetBool("blob.s3.path_style"),
+		AvatarMaxBytes:  viper.GetInt64("avatar.max_bytes"),
+
+		SessionCookies:   viper.GetBool("session.cookies"),
+		SessionSecure:    viper.GetBool("session.secure"),
+		SessionSameSite:  viper.GetString("session.same_site"),
+		SessionDomain:    viper.GetString("session.domain"),
+		SessionAccessTTL: viper.GetDuration("session.access_token_ttl"),
+
+		WebEnabled:      viper.GetBool("web.enabled"),
+		WebTemplatesDir: viper.GetString("web.templates_dir"),
+		WebStaticDir:    viper.GetString("web.static_dir"),
+		WebTitle:        viper.GetString("web.title"),
+
+		OAuthProviders: providers,
 	}, nil
 }
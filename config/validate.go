@@ -0,0 +1,179 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+// Sinks the server knows how to build, see server.outboxSinks.
+var outboxSinkNames = []string{"webhook", "log", "memory"}
+
+// Storage drivers, see db.NewDatabaseConnection.
+var dbDrivers = []string{"postgres", "sqlite", "memory"}
+
+// SameSite modes of the session cookies.
+var sameSiteModes = []string{"strict", "lax", "none"}
+
+// Blob storage drivers, see server.blobStore.
+var blobDrivers = []string{"local", "s3"}
+
+// Identity provider types, see federation.newProvider.
+var oauthProviderTypes = []string{"oidc", "github"}
+
+// Provider names appear in the callback URL.
+var providerName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Validate reports every problem in the configuration at once.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if port, err := strconv.Atoi(c.AppPort); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("app.port: invalid port %q", c.AppPort))
+	}
+
+	if u, err := url.Parse(c.AppBaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, fmt.Errorf("app.base_url: must be an absolute URL, got %q", c.AppBaseURL))
+	}
+
+	switch c.DBDriver {
+	case "postgres":
+		if c.DBHost == "" {
+			errs = append(errs, errors.New("db.host: is required"))
+		}
+		if c.DBName == "" {
+			errs = append(errs, errors.New("db.name: is required"))
+		}
+	case "sqlite":
+		if c.DBPath == "" {
+			errs = append(errs, errors.New("db.path: is required"))
+		}
+	}
+	if !slices.Contains(dbDrivers, c.DBDriver) {
+		errs = append(errs, fmt.Errorf("db.driver: unknown driver %q", c.DBDriver))
+	}
+
+	switch {
+	case c.JWTSecretKey == "" || c.JWTSecretKey == "secret_key":
+		errs = append(errs, errors.New("jwt.secret_key: must be set to a non-default value"))
+	case c.JWTSecretKey == c.JWTRefreshKey:
+		errs = append(errs, errors.New("jwt.refresh_key: must differ from jwt.secret_key"))
+	}
+	if c.JWTRefreshKey == "" || c.JWTRefreshKey == "refresh_key" {
+		errs = append(errs, errors.New("jwt.refresh_key: must be set to a non-default value"))
+	}
+
+	if c.SMTPHost != "" && (c.SMTPPort < 1 || c.SMTPPort > 65535) {
+		errs = append(errs, fmt.Errorf("smtp.port: invalid port %d", c.SMTPPort))
+	}
+
+	if c.AuditCheckpointInterval < 0 {
+		errs = append(errs, errors.New("audit.checkpoint_interval: must not be negative"))
+	}
+
+	for _, name := range c.OutboxSinks {
+		if !slices.Contains(outboxSinkNames, name) {
+			errs = append(errs, fmt.Errorf("outbox.sinks: unknown sink %q", name))
+		}
+	}
+	if c.OutboxPollInterval < 0 {
+		errs = append(errs, errors.New("outbox.poll_interval: must not be negative"))
+	}
+
+	if c.UserDeletionGracePeriod < 0 {
+		errs = append(errs, errors.New("users.deletion_grace_period: must not be negative"))
+	}
+	if c.UserPurgeInterval < 0 {
+		errs = append(errs, errors.New("users.purge_interval: must not be negative"))
+	}
+
+	if c.ErasurePollInterval < 0 {
+		errs = append(errs, errors.New("privacy.erasure_poll_interval: must not be negative"))
+	}
+
+	switch c.BlobDriver {
+	case "local":
+		if c.BlobLocalDir == "" {
+			errs = append(errs, errors.New("blob.local_dir: is required"))
+		}
+	case "s3":
+		if u, err := url.Parse(c.BlobS3Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("blob.s3.endpoint: must be an absolute URL, got %q", c.BlobS3Endpoint))
+		}
+		if c.BlobS3Bucket == "" {
+			errs = append(errs, errors.New("blob.s3.bucket: is required"))
+		}
+		if c.BlobS3Region == "" {
+			errs = append(errs, errors.New("blob.s3.region: is required"))
+		}
+	}
+	if !slices.Contains(blobDrivers, c.BlobDriver) {
+		errs = append(errs, fmt.Errorf("blob.driver: unknown driver %q", c.BlobDriver))
+	}
+	if c.BlobPublicURL != "" {
+		if u, err := url.Parse(c.BlobPublicURL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("blob.public_url: must be an absolute URL, got %q", c.BlobPublicURL))
+		}
+	}
+	if c.AvatarMaxBytes <= 0 {
+		errs = append(errs, errors.New("avatar.max_bytes: must be positive"))
+	}
+
+	if c.SessionCookies {
+		if !slices.Contains(sameSiteModes, c.SessionSameSite) {
+			errs = append(errs, fmt.Errorf("session.same_site: unknown mode %q", c.SessionSameSite))
+		}
+		if c.SessionSameSite == "none" && !c.SessionSecure {
+			errs = append(errs, errors.New("session.same_site: none requires session.secure"))
+		}
+		if c.SessionAccessTTL <= 0 {
+			errs = append(errs, errors.New("session.access_token_ttl: must be positive"))
+		}
+	}
+
+	if c.WebEnabled {
+		if !c.SessionCookies {
+			errs = append(errs, errors.New("web.enabled: requires session.cookies"))
+		}
+		if c.WebTemplatesDir == "" {
+			errs = append(errs, errors.New("web.templates_dir: is required"))
+		}
+	}
+
+	names := make(map[string]bool, len(c.OAuthProviders))
+	for i, p := range c.OAuthProviders {
+		key := fmt.Sprintf("oauth.providers[%d]", i)
+		if !providerName.MatchString(p.Name) {
+			errs = append(errs, fmt.Errorf("%s.name: must be lowercase letters, digits, '-' or '_', got %q", key, p.Name))
+		} else if names[p.Name] {
+			errs = append(errs, fmt.Errorf("%s.name: duplicate provider %q", key, p.Name))
+		}
+		names[p.Name] = true
+
+		if !slices.Contains(oauthProviderTypes, p.Type) {
+			errs = append(errs, fmt.Errorf("%s.type: unknown type %q", key, p.Type))
+		}
+		if p.ClientID == "" {
+			errs = append(errs, fmt.Errorf("%s.client_id: is required", key))
+		}
+		if p.Type == "oidc" {
+			if u, err := url.Parse(p.Issuer); err != nil || u.Scheme == "" || u.Host == "" {
+				errs = append(errs, fmt.Errorf("%s.issuer: must be an absolute URL, got %q", key, p.Issuer))
+			}
+		}
+		endpoints := [][2]string{{"auth_url", p.AuthURL}, {"token_url", p.TokenURL}, {"userinfo_url", p.UserInfoURL}}
+		for _, endpoint := range endpoints {
+			if endpoint[1] == "" {
+				continue
+			}
+			if u, err := url.Parse(endpoint[1]); err != nil || u.Scheme == "" || u.Host == "" {
+				errs = append(errs, fmt.Errorf("%s.%s: must be an absolute URL, got %q", key, endpoint[0], endpoint[1]))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
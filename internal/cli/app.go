@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/codepnw/go-authen-system/config"
+	"github.com/codepnw/go-authen-system/internal/db"
+	"github.com/codepnw/go-authen-system/internal/modules/audit"
+	"github.com/codepnw/go-authen-system/internal/modules/auth"
+	"github.com/codepnw/go-authen-system/internal/modules/group"
+	"github.com/codepnw/go-authen-system/internal/modules/organization"
+	"github.com/codepnw/go-authen-system/internal/modules/user"
+	"github.com/codepnw/go-authen-system/internal/storage"
+	"github.com/codepnw/go-authen-system/internal/utils/transaction"
+	"github.com/codepnw/go-authen-system/pkg/logger"
+	"github.com/codepnw/go-authen-system/pkg/mailer"
+	"gorm.io/gorm"
+)
+
+// app wires the usecases the same way the server routes do.
+type app struct {
+	cfg      *config.Config
+	db       *gorm.DB
+	tx       transaction.Manager
+	recorder audit.Recorder
+
+	userUsecase user.UserUsecase
+	authUsecase auth.AuthUsecase
+}
+
+// newApp connects to a database whose schema is current, applying pending
+// migrations only where the server would too.
+func newApp(cfg *config.Config) (*app, error) {
+	store, err := storage.Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+	conn := store.DB
+
+	if err = db.EnsureSchema(context.Background(), conn, storage.AutoMigrate(cfg)); err != nil {
+		return nil, err
+	}
+
+	if _, err = logger.Init(); err != nil {
+		return nil, err
+	}
+
+	tx := transaction.NewManager(conn)
+	recorder := audit.NewRecorder(audit.NewAuditRepository(conn))
+
+	userUsecase := user.NewUserUsecase(cfg, tx, store.Users, user.NewProfileSchemaRepository(conn), store.Tokens, recorder)
+	orgUsecase := organization.NewOrganizationUsecase(cfg, organization.NewOrganizationRepository(conn), userUsecase, mailer.NewLogMailer(), recorder)
+	groupUsecase := group.NewGroupUsecase(group.NewGroupRepository(conn), userUsecase, recorder)
+	authUsecase := auth.NewAuthUsecase(cfg, tx, store.Tokens, userUsecase, orgUsecase, groupUsecase, recorder)
+
+	return &app{
+		cfg:         cfg,
+		db:          conn,
+		tx:          tx,
+		recorder:    recorder,
+		userUsecase: userUsecase,
+		authUsecase: authUsecase,
+	}, nil
+}
+
+// findUser resolves a user given by ID or email.
+func (a *app) findUser(ctx context.Context, ref string) (*user.User, error) {
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		return a.userUsecase.GetProfile(ctx, id)
+	}
+
+	found, err := a.userUsecase.GetUserByEmail(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, errors.New("user not found")
+	}
+	return found, nil
+}
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/codepnw/go-authen-system/config"
+	"github.com/codepnw/go-authen-system/internal/modules/audit"
+)
+
+// auditCommand runs "audit verify", which prints the chain report and exits
+// non-zero on a broken link.
+func auditCommand(cfg *config.Config, args []string) error {
+	name, _, err := subcommand("audit", args)
+	if err != nil {
+		return err
+	}
+	if name != "verify" {
+		return fmt.Errorf("%w: unknown audit command %q", errUsage, name)
+	}
+
+	a, err := newApp(cfg)
+	if err != nil {
+		return err
+	}
+
+	uc := audit.NewAuditUsecase(cfg, audit.NewAuditRepository(a.db))
+
+	report, err := uc.Verify(commandContext())
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(report); err != nil {
+		return err
+	}
+
+	if !report.Valid {
+		os.Exit(1)
+	}
+	return nil
+}
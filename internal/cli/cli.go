@@ -0,0 +1,142 @@
+// Package cli implements the service binary: the HTTP server and the admin
+// commands operators run against the same database.
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/codepnw/go-authen-system/config"
+	"github.com/codepnw/go-authen-system/internal/modules/audit"
+	"github.com/codepnw/go-authen-system/internal/server"
+	"github.com/codepnw/go-authen-system/internal/utils/security"
+)
+
+const configFileName = "config"
+
+const usage = `usage: authen <command> [arguments]
+
+commands:
+  serve                                   start the HTTP server (default)
+  migrate up|down [steps]|status          manage the database schema
+  user create --email E --username U [--password P] [--admin]
+  user disable <id|email>                 suspend the account and revoke its sessions
+  user enable <id|email>                  restore a suspended, deactivated or pending deletion account
+  user delete <id|email>                  schedule the account for deletion after the grace period
+  user reset-password <id|email> [--password P]
+  sessions revoke --user <id|email>       sign the user out everywhere
+  keys rotate [--purpose access|refresh]  create new JWT signing keys
+  config validate                         check the configuration
+  audit verify                            walk the audit hash chain
+`
+
+// errUsage is returned for malformed commands, Run prints the usage for it.
+var errUsage = errors.New("invalid command")
+
+// Run executes the command in args, os.Args without the program name.
+func Run(args []string) error {
+	cfg, err := config.InitConfig(configFileName)
+	if err != nil {
+		return err
+	}
+
+	err = run(cfg, args)
+	if errors.Is(err, errUsage) {
+		fmt.Fprint(os.Stderr, usage)
+	}
+	return err
+}
+
+func run(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return server.Run(cfg)
+	}
+
+	command, args := args[0], args[1:]
+
+	switch command {
+	case "serve":
+		return server.Run(cfg)
+	case "migrate":
+		return migrate(cfg, args)
+	case "user":
+		return userCommand(cfg, args)
+	case "sessions":
+		return sessionsCommand(cfg, args)
+	case "keys":
+		return keysCommand(cfg, args)
+	case "config":
+		return configCommand(cfg, args)
+	case "audit":
+		return auditCommand(cfg, args)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return nil
+	}
+
+	return fmt.Errorf("%w: unknown command %q", errUsage, command)
+}
+
+// subcommand splits "<name> [arguments]" for command groups.
+func subcommand(group string, args []string) (string, []string, error) {
+	if len(args) == 0 {
+		return "", nil, fmt.Errorf("%w: %s needs a subcommand", errUsage, group)
+	}
+	return args[0], args[1:], nil
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// parseFlags accepts flags before and after positional arguments, the
+// standard flag package stops at the first positional one.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", errUsage, fs.Name(), err)
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// commandContext attributes audit events of admin commands to the system.
+func commandContext() context.Context {
+	ctx := security.ContextWithUser(context.Background(), &security.TokenUser{
+		Type: security.PrincipalSystem,
+	})
+
+	return audit.ContextWithRequest(ctx, &audit.RequestInfo{
+		UserAgent: "authen-cli",
+	})
+}
+
+func configCommand(cfg *config.Config, args []string) error {
+	name, _, err := subcommand("config", args)
+	if err != nil {
+		return err
+	}
+	if name != "validate" {
+		return fmt.Errorf("%w: unknown config command %q", errUsage, name)
+	}
+
+	if err = cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	fmt.Println("configuration is valid")
+	return nil
+}
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/codepnw/go-authen-system/config"
+	"github.com/codepnw/go-authen-system/internal/modules/keys"
+	"github.com/codepnw/go-authen-system/internal/utils/security"
+)
+
+// keysCommand runs "keys rotate [--purpose access|refresh]", both purposes
+// rotate when none is given.
+func keysCommand(cfg *config.Config, args []string) error {
+	name, args, err := subcommand("keys", args)
+	if err != nil {
+		return err
+	}
+	if name != "rotate" {
+		return fmt.Errorf("%w: unknown keys command %q", errUsage, name)
+	}
+
+	fs := newFlagSet("keys rotate")
+	purpose := fs.String("purpose", "", "access or refresh")
+	if _, err = parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	purposes := []string{security.KeyPurposeAccess, security.KeyPurposeRefresh}
+	if *purpose != "" {
+		purposes = []string{*purpose}
+	}
+
+	a, err := newApp(cfg)
+	if err != nil {
+		return err
+	}
+
+	uc := keys.NewKeyUsecase(keys.NewKeyRepository(a.db), a.recorder)
+	ctx := commandContext()
+
+	for _, p := range purposes {
+		key, err := uc.Rotate(ctx, p)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("rotated %s key, kid %s\n", key.Purpose, key.ID)
+	}
+
+	fmt.Println("restart the servers to sign with the new keys")
+	return nil
+}
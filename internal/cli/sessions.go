@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/codepnw/go-authen-system/config"
+)
+
+// sessionsCommand runs "sessions revoke --user <id|email>".
+func sessionsCommand(cfg *config.Config, args []string) error {
+	name, args, err := subcommand("sessions", args)
+	if err != nil {
+		return err
+	}
+	if name != "revoke" {
+		return fmt.Errorf("%w: unknown sessions command %q", errUsage, name)
+	}
+
+	fs := newFlagSet("sessions revoke")
+	ref := fs.String("user", "", "user ID or email")
+	if _, err = parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *ref == "" {
+		return fmt.Errorf("%w: sessions revoke needs --user", errUsage)
+	}
+
+	a, err := newApp(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx := commandContext()
+
+	found, err := a.findUser(ctx, *ref)
+	if err != nil {
+		return err
+	}
+
+	revoked, err := a.authUsecase.RevokeSessions(ctx, found.ID, "admin")
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("revoked %d session(s) of user %d\n", revoked, found.ID)
+	return nil
+}
@@ -0,0 +1,200 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/codepnw/go-authen-system/config"
+	"github.com/codepnw/go-authen-system/internal/modules/audit"
+	"github.com/codepnw/go-authen-system/internal/modules/user"
+	"github.com/codepnw/go-authen-system/internal/utils/security"
+)
+
+// userCommand runs the "user" subcommands.
+func userCommand(cfg *config.Config, args []string) error {
+	name, args, err := subcommand("user", args)
+	if err != nil {
+		return err
+	}
+
+	switch name {
+	case "create":
+		return userCreate(cfg, args)
+	case "disable":
+		return userSetStatus(cfg, "user disable", args, user.StatusSuspended)
+	case "enable":
+		return userSetStatus(cfg, "user enable", args, user.StatusActive)
+	case "delete":
+		return userSetStatus(cfg, "user delete", args, user.StatusPendingDeletion)
+	case "reset-password":
+		return userResetPassword(cfg, args)
+	}
+
+	return fmt.Errorf("%w: unknown user command %q", errUsage, name)
+}
+
+// userCreate bootstraps accounts, including the first admin. Without
+// --password a random one is generated and printed once.
+func userCreate(cfg *config.Config, args []string) error {
+	fs := newFlagSet("user create")
+	email := fs.String("email", "", "email address")
+	username := fs.String("username", "", "username")
+	password := fs.String("password", "", "password, generated when empty")
+	admin := fs.Bool("admin", false, "grant the admin role")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *email == "" || *username == "" {
+		return fmt.Errorf("%w: user create needs --email and --username", errUsage)
+	}
+
+	generated, err := passwordOrRandom(password)
+	if err != nil {
+		return err
+	}
+
+	a, err := newApp(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx := commandContext()
+	var created *user.User
+
+	err = a.tx.Do(ctx, func(ctx context.Context) error {
+		created, err = a.userUsecase.CreateUser(ctx, &user.CreateUserRequest{
+			Username:        *username,
+			Email:           *email,
+			Password:        *password,
+			ConfirmPassword: *password,
+		})
+		if err != nil {
+			return err
+		}
+
+		if *admin {
+			return a.userUsecase.SetRole(ctx, created.ID, security.RoleAdmin)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	a.recorder.Record(ctx, &audit.Event{
+		Type:       audit.EventUserCreate,
+		TargetID:   created.ID,
+		TargetType: audit.KindUser,
+		Outcome:    audit.OutcomeSuccess,
+		Metadata:   audit.Metadata{"admin": *admin},
+	})
+
+	fmt.Printf("created user %d <%s>\n", created.ID, created.Email)
+	if generated {
+		fmt.Printf("password: %s\n", *password)
+	}
+	return nil
+}
+
+// userSetStatus moves an account to another state. Leaving the active state
+// also revokes every session so existing refresh tokens stop working at once.
+func userSetStatus(cfg *config.Config, command string, args []string, status string) error {
+	ref, err := userRef(command, args)
+	if err != nil {
+		return err
+	}
+
+	a, err := newApp(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx := commandContext()
+
+	found, err := a.findUser(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	if err = a.userUsecase.SetStatus(ctx, found.ID, status); err != nil {
+		return err
+	}
+
+	fmt.Printf("user %d is %s\n", found.ID, status)
+	return nil
+}
+
+// userResetPassword sets a new password and signs the user out everywhere.
+func userResetPassword(cfg *config.Config, args []string) error {
+	fs := newFlagSet("user reset-password")
+	password := fs.String("password", "", "new password, generated when empty")
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("%w: user reset-password needs a user ID or email", errUsage)
+	}
+
+	generated, err := passwordOrRandom(password)
+	if err != nil {
+		return err
+	}
+
+	a, err := newApp(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx := commandContext()
+
+	found, err := a.findUser(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+
+	err = a.tx.Do(ctx, func(ctx context.Context) error {
+		if err := a.userUsecase.ResetPassword(ctx, found.ID, *password); err != nil {
+			return err
+		}
+
+		_, err := a.authUsecase.RevokeSessions(ctx, found.ID, "password_reset")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("password of user %d reset, sessions revoked\n", found.ID)
+	if generated {
+		fmt.Printf("password: %s\n", *password)
+	}
+	return nil
+}
+
+func userRef(command string, args []string) (string, error) {
+	positional, err := parseFlags(newFlagSet(command), args)
+	if err != nil {
+		return "", err
+	}
+	if len(positional) != 1 {
+		return "", fmt.Errorf("%w: %s needs a user ID or email", errUsage, command)
+	}
+	return positional[0], nil
+}
+
+// passwordOrRandom fills an empty password and reports whether it did.
+func passwordOrRandom(password *string) (bool, error) {
+	if *password != "" {
+		return false, nil
+	}
+
+	random, err := security.RandomToken(12)
+	if err != nil {
+		return false, err
+	}
+
+	*password = random
+	return true, nil
+}
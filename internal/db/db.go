@@ -2,15 +2,39 @@ package db
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/codepnw/go-authen-system/config"
-	"github.com/codepnw/go-authen-system/internal/modules/auth"
-	"github.com/codepnw/go-authen-system/internal/modules/user"
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
+// Storage drivers selected with db.driver.
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+	// DriverMemory keeps users and sessions in process memory and everything
+	// else in an in-memory SQLite database. Nothing survives a restart.
+	DriverMemory = "memory"
+)
+
+// NewDatabaseConnection opens the database. The schema is managed by the
+// versioned migrations in migrations/, see Migrator.
 func NewDatabaseConnection(cfg *config.Config) (*gorm.DB, error) {
+	switch cfg.DBDriver {
+	case DriverPostgres, "":
+		return openPostgres(cfg)
+	case DriverSQLite:
+		return openSQLite("file:" + cfg.DBPath + "?_pragma=journal_mode(WAL)")
+	case DriverMemory:
+		return openSQLite("file:/authen?vfs=memdb")
+	}
+
+	return nil, fmt.Errorf("unknown database driver %q", cfg.DBDriver)
+}
+
+func openPostgres(cfg *config.Config) (*gorm.DB, error) {
 	dsn := fmt.Sprintf(
 		"postgres://%s:%s@%s/%s?sslmode=%s",
 		cfg.DBUser,
@@ -25,13 +49,21 @@ func NewDatabaseConnection(cfg *config.Config) (*gorm.DB, error) {
 		return nil, err
 	}
 
-	// Migrate Entities
-	err = db.AutoMigrate(
-		&user.User{},
-		&auth.RefreshToken{},
-	)
+	return db, nil
+}
+
+// openSQLite serializes writers: transactions take the write lock up front
+// and other connections wait for it instead of failing with SQLITE_BUSY.
+// Times are stored as text and compared as such, the process should run in
+// a single time zone (UTC).
+func openSQLite(dsn string) (*gorm.DB, error) {
+	dsn += "&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)&_txlock=immediate"
+
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		NowFunc: func() time.Time { return time.Now().UTC() },
+	})
 	if err != nil {
-		return nil, fmt.Errorf("auto migrate failed: %w", err)
+		return nil, err
 	}
 
 	return db, nil
@@ -0,0 +1,181 @@
+-- Baseline of the schema previously created by AutoMigrate. IF NOT EXISTS
+-- lets databases created that way adopt the migration history.
+
+CREATE TABLE IF NOT EXISTS users (
+    id          BIGSERIAL PRIMARY KEY,
+    username    TEXT NOT NULL CONSTRAINT uni_users_username UNIQUE,
+    email       TEXT NOT NULL CONSTRAINT uni_users_email UNIQUE,
+    password    TEXT,
+    role        TEXT NOT NULL DEFAULT 'user',
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id             BIGSERIAL PRIMARY KEY,
+    user_id        BIGINT NOT NULL,
+    refresh_token  TEXT NOT NULL,
+    expires_at     TIMESTAMPTZ,
+    created_at     TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS service_accounts (
+    id             BIGSERIAL PRIMARY KEY,
+    name           TEXT NOT NULL CONSTRAINT uni_service_accounts_name UNIQUE,
+    description    TEXT,
+    owner_id       BIGINT,
+    team           TEXT,
+    role           TEXT NOT NULL DEFAULT 'user',
+    client_id      TEXT NOT NULL CONSTRAINT uni_service_accounts_client_id UNIQUE,
+    client_secret  TEXT NOT NULL,
+    disabled       BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at     TIMESTAMPTZ,
+    updated_at     TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS organizations (
+    id          BIGSERIAL PRIMARY KEY,
+    name        TEXT NOT NULL,
+    slug        TEXT NOT NULL CONSTRAINT uni_organizations_slug UNIQUE,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS memberships (
+    id               BIGSERIAL PRIMARY KEY,
+    organization_id  BIGINT NOT NULL CONSTRAINT fk_memberships_organization REFERENCES organizations (id) ON DELETE CASCADE,
+    user_id          BIGINT NOT NULL,
+    role             TEXT NOT NULL DEFAULT 'member',
+    created_at       TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_memberships_org_user ON memberships (organization_id, user_id);
+
+CREATE TABLE IF NOT EXISTS invitations (
+    id               BIGSERIAL PRIMARY KEY,
+    organization_id  BIGINT NOT NULL CONSTRAINT fk_invitations_organization REFERENCES organizations (id) ON DELETE CASCADE,
+    email            TEXT NOT NULL,
+    role             TEXT NOT NULL DEFAULT 'member',
+    status           TEXT NOT NULL DEFAULT 'pending',
+    invited_by       BIGINT NOT NULL,
+    nonce            TEXT NOT NULL,
+    expires_at       TIMESTAMPTZ,
+    created_at       TIMESTAMPTZ,
+    updated_at       TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_invitations_email ON invitations (email);
+CREATE INDEX IF NOT EXISTS idx_invitations_organization_id ON invitations (organization_id);
+
+CREATE TABLE IF NOT EXISTS groups (
+    id           BIGSERIAL PRIMARY KEY,
+    name         TEXT NOT NULL CONSTRAINT uni_groups_name UNIQUE,
+    description  TEXT,
+    created_at   TIMESTAMPTZ,
+    updated_at   TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS group_members (
+    id               BIGSERIAL PRIMARY KEY,
+    group_id         BIGINT NOT NULL CONSTRAINT fk_group_members_group REFERENCES groups (id) ON DELETE CASCADE,
+    user_id          BIGINT,
+    member_group_id  BIGINT CONSTRAINT fk_group_members_member_group REFERENCES groups (id) ON DELETE CASCADE,
+    created_at       TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_group_members_member_group_id ON group_members (member_group_id);
+CREATE INDEX IF NOT EXISTS idx_group_members_user_id ON group_members (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_group_members_group ON group_members (group_id, member_group_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_group_members_user ON group_members (group_id, user_id);
+
+CREATE TABLE IF NOT EXISTS group_roles (
+    id          BIGSERIAL PRIMARY KEY,
+    group_id    BIGINT NOT NULL CONSTRAINT fk_group_roles_group REFERENCES groups (id) ON DELETE CASCADE,
+    role        TEXT NOT NULL,
+    created_at  TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_group_roles_group_role ON group_roles (group_id, role);
+
+CREATE TABLE IF NOT EXISTS audit_events (
+    id           BIGSERIAL PRIMARY KEY,
+    type         TEXT NOT NULL,
+    actor_id     BIGINT,
+    actor_type   TEXT NOT NULL,
+    target_id    BIGINT,
+    target_type  TEXT,
+    ip           TEXT,
+    user_agent   TEXT,
+    outcome      TEXT NOT NULL,
+    reason       TEXT,
+    metadata     TEXT,
+    created_at   TIMESTAMPTZ NOT NULL,
+    prev_hash    VARCHAR(64),
+    hash         VARCHAR(64)
+);
+CREATE INDEX IF NOT EXISTS idx_audit_events_type ON audit_events (type);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events (actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_target_id ON audit_events (target_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events (created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_hash ON audit_events (hash);
+
+CREATE TABLE IF NOT EXISTS audit_checkpoints (
+    id          BIGSERIAL PRIMARY KEY,
+    event_id    BIGINT NOT NULL,
+    hash        VARCHAR(64) NOT NULL,
+    signature   VARCHAR(64) NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_audit_checkpoints_event_id ON audit_checkpoints (event_id);
+
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id           BIGSERIAL PRIMARY KEY,
+    url          TEXT NOT NULL,
+    description  TEXT,
+    event_types  TEXT NOT NULL,
+    secret       TEXT NOT NULL,
+    active       BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at   TIMESTAMPTZ,
+    updated_at   TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id                BIGSERIAL PRIMARY KEY,
+    subscription_id   BIGINT NOT NULL,
+    event_id          TEXT NOT NULL,
+    event_type        TEXT NOT NULL,
+    payload           TEXT NOT NULL,
+    status            TEXT NOT NULL,
+    attempts          BIGINT NOT NULL DEFAULT 0,
+    next_attempt_at   TIMESTAMPTZ,
+    last_status_code  BIGINT,
+    last_error        TEXT,
+    created_at        TIMESTAMPTZ,
+    updated_at        TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_subscription_id ON webhook_deliveries (subscription_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_event_id ON webhook_deliveries (event_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status ON webhook_deliveries (status);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_next_attempt_at ON webhook_deliveries (next_attempt_at);
+
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+    id           BIGSERIAL PRIMARY KEY,
+    delivery_id  BIGINT NOT NULL,
+    status_code  BIGINT,
+    error        TEXT,
+    response     TEXT,
+    duration_ms  BIGINT,
+    created_at   TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_delivery_attempts_delivery_id ON webhook_delivery_attempts (delivery_id);
+
+CREATE TABLE IF NOT EXISTS outbox_messages (
+    id               BIGSERIAL PRIMARY KEY,
+    aggregate_type   TEXT NOT NULL,
+    aggregate_id     BIGINT NOT NULL,
+    event_type       TEXT NOT NULL,
+    payload          TEXT NOT NULL,
+    attempts         BIGINT NOT NULL DEFAULT 0,
+    last_error       TEXT,
+    next_attempt_at  TIMESTAMPTZ,
+    published_at     TIMESTAMPTZ,
+    created_at       TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_outbox_aggregate ON outbox_messages (aggregate_type, aggregate_id);
+CREATE INDEX IF NOT EXISTS idx_outbox_messages_published_at ON outbox_messages (published_at);
@@ -0,0 +1,4 @@
+-- pg_trgm stays installed, other schemas may use it.
+DROP INDEX IF EXISTS idx_users_email_trgm;
+DROP INDEX IF EXISTS idx_users_username_trgm;
+DROP INDEX IF EXISTS idx_users_search;
@@ -0,0 +1,20 @@
+-- Full-text search over the fields GET /admin/users/search matches.
+CREATE INDEX IF NOT EXISTS idx_users_search ON users
+    USING GIN (to_tsvector('simple', username || ' ' || email));
+
+-- Trigram similarity needs pg_trgm, which the migration role may not be
+-- allowed to install. Search then ranks by full-text and LIKE matches only.
+DO $$
+BEGIN
+    CREATE EXTENSION IF NOT EXISTS pg_trgm;
+EXCEPTION WHEN insufficient_privilege OR undefined_file THEN
+    RAISE NOTICE 'pg_trgm is not available: %', SQLERRM;
+END $$;
+
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm') THEN
+        CREATE INDEX IF NOT EXISTS idx_users_username_trgm ON users USING GIN (LOWER(username) gin_trgm_ops);
+        CREATE INDEX IF NOT EXISTS idx_users_email_trgm ON users USING GIN (LOWER(email) gin_trgm_ops);
+    END IF;
+END $$;
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS erasure_jobs;
+
+ALTER TABLE audit_events DROP COLUMN IF EXISTS pseudonymized_at;
+ALTER TABLE audit_events DROP COLUMN IF EXISTS pii_digest;
+ALTER TABLE audit_events DROP COLUMN IF EXISTS pii_salt;
+ALTER TABLE audit_events DROP COLUMN IF EXISTS hash_version;
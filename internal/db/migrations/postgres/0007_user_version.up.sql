@@ -0,0 +1,3 @@
+-- Optimistic concurrency: every update bumps the version and only applies
+-- when the version read is still current.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS idx_users_display_name_trgm;
+DROP INDEX IF EXISTS idx_users_search;
+CREATE INDEX IF NOT EXISTS idx_users_search ON users
+    USING GIN (to_tsvector('simple', username || ' ' || email));
+
+DROP TABLE IF EXISTS profile_schemas;
+ALTER TABLE users DROP COLUMN attributes;
+ALTER TABLE users DROP COLUMN phone;
+ALTER TABLE users DROP COLUMN time_zone;
+ALTER TABLE users DROP COLUMN locale;
+ALTER TABLE users DROP COLUMN avatar_url;
+ALTER TABLE users DROP COLUMN display_name;
@@ -0,0 +1,27 @@
+-- Standard profile fields and custom attributes. The attributes are checked
+-- against the newest profile_schemas row before they are written.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locale TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS time_zone TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS attributes JSONB NOT NULL DEFAULT '{}';
+
+CREATE TABLE IF NOT EXISTS profile_schemas (
+    id          BIGSERIAL PRIMARY KEY,
+    document    JSONB NOT NULL,
+    created_by  BIGINT,
+    created_at  TIMESTAMPTZ
+);
+
+-- Admin search matches the display name too.
+DROP INDEX IF EXISTS idx_users_search;
+CREATE INDEX IF NOT EXISTS idx_users_search ON users
+    USING GIN (to_tsvector('simple', username || ' ' || email || ' ' || display_name));
+
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm') THEN
+        CREATE INDEX IF NOT EXISTS idx_users_display_name_trgm ON users USING GIN (LOWER(display_name) gin_trgm_ops);
+    END IF;
+END $$;
@@ -0,0 +1,14 @@
+-- Identities at upstream providers linked to a user. A provider subject
+-- belongs to one user, a user may link several providers.
+CREATE TABLE IF NOT EXISTS user_identities (
+    id             BIGSERIAL PRIMARY KEY,
+    user_id        BIGINT NOT NULL,
+    provider       TEXT NOT NULL,
+    subject        TEXT NOT NULL,
+    email          TEXT NOT NULL DEFAULT '',
+    last_login_at  TIMESTAMPTZ,
+    created_at     TIMESTAMPTZ,
+    updated_at     TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_identities_provider_subject ON user_identities (provider, subject);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities (user_id);
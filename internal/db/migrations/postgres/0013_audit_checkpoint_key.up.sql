@@ -0,0 +1,3 @@
+-- The key a checkpoint was signed with, so signing keys can be rotated.
+-- Existing checkpoints keep an empty ID, they were signed with jwt.secret_key.
+ALTER TABLE audit_checkpoints ADD COLUMN IF NOT EXISTS key_id VARCHAR(16) NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS signing_keys (
+    id          TEXT PRIMARY KEY,
+    purpose     TEXT NOT NULL,
+    secret      TEXT NOT NULL,
+    created_at  DATETIME NOT NULL,
+    retired_at  DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_signing_keys_purpose ON signing_keys (purpose, created_at);
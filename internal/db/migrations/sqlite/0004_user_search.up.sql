@@ -0,0 +1,3 @@
+-- SQLite has no trigram support, user search matches in memory. The version
+-- is kept so both dialects share one migration history.
+SELECT 1;
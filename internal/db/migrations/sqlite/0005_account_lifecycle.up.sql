@@ -0,0 +1,6 @@
+-- Soft delete: accounts wait in pending_deletion until purge_after, then the
+-- purge job anonymizes the row and leaves a deleted tombstone.
+ALTER TABLE users ADD COLUMN status_changed_at DATETIME;
+ALTER TABLE users ADD COLUMN purge_after DATETIME;
+
+CREATE INDEX IF NOT EXISTS idx_users_purge_after ON users (purge_after) WHERE purge_after IS NOT NULL;
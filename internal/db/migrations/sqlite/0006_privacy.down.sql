@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS erasure_jobs;
+
+ALTER TABLE audit_events DROP COLUMN pseudonymized_at;
+ALTER TABLE audit_events DROP COLUMN pii_digest;
+ALTER TABLE audit_events DROP COLUMN pii_salt;
+ALTER TABLE audit_events DROP COLUMN hash_version;
@@ -0,0 +1,21 @@
+-- Sealed audit events chain a salted digest of their personal data, so
+-- erasure can pseudonymize it without breaking the hash chain.
+ALTER TABLE audit_events ADD COLUMN hash_version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE audit_events ADD COLUMN pii_salt VARCHAR(32);
+ALTER TABLE audit_events ADD COLUMN pii_digest VARCHAR(64);
+ALTER TABLE audit_events ADD COLUMN pseudonymized_at DATETIME;
+
+CREATE TABLE IF NOT EXISTS erasure_jobs (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id       BIGINT NOT NULL,
+    reason        TEXT NOT NULL,
+    requested_by  BIGINT,
+    status        TEXT NOT NULL DEFAULT 'pending',
+    steps         TEXT,
+    error         TEXT,
+    created_at    DATETIME,
+    started_at    DATETIME,
+    completed_at  DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_erasure_jobs_user_id ON erasure_jobs (user_id);
+CREATE INDEX IF NOT EXISTS idx_erasure_jobs_status ON erasure_jobs (status);
@@ -0,0 +1,16 @@
+-- Pending email changes, the users table keeps the current address until the
+-- new one is confirmed so its unique constraint is never bypassed.
+CREATE TABLE IF NOT EXISTS email_changes (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id       BIGINT NOT NULL,
+    old_email     TEXT NOT NULL,
+    new_email     TEXT NOT NULL,
+    status        TEXT NOT NULL DEFAULT 'pending',
+    requested_by  BIGINT,
+    nonce         TEXT NOT NULL,
+    expires_at    DATETIME,
+    confirmed_at  DATETIME,
+    created_at    DATETIME,
+    updated_at    DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_email_changes_user_id ON email_changes (user_id);
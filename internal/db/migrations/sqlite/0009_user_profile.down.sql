@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS profile_schemas;
+ALTER TABLE users DROP COLUMN attributes;
+ALTER TABLE users DROP COLUMN phone;
+ALTER TABLE users DROP COLUMN time_zone;
+ALTER TABLE users DROP COLUMN locale;
+ALTER TABLE users DROP COLUMN avatar_url;
+ALTER TABLE users DROP COLUMN display_name;
@@ -0,0 +1,15 @@
+-- Standard profile fields and custom attributes. The attributes are checked
+-- against the newest profile_schemas row before they are written.
+ALTER TABLE users ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN avatar_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN locale TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN time_zone TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN phone TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN attributes TEXT NOT NULL DEFAULT '{}';
+
+CREATE TABLE IF NOT EXISTS profile_schemas (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    document    TEXT NOT NULL,
+    created_by  BIGINT,
+    created_at  DATETIME
+);
@@ -0,0 +1,4 @@
+-- Uploaded avatars. avatar_key is the blob key prefix of the stored files,
+-- avatars maps each resized variant to its URL.
+ALTER TABLE users ADD COLUMN avatars TEXT NOT NULL DEFAULT '{}';
+ALTER TABLE users ADD COLUMN avatar_key TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- When the user last proved the email is theirs, by a link sent to it or a
+-- provider that verified it. Accounts are only linked by email once set.
+-- Existing accounts start unverified, link_verified_email skips them until
+-- their owner resets the password.
+ALTER TABLE users ADD COLUMN email_verified_at DATETIME;
@@ -0,0 +1 @@
+ALTER TABLE audit_checkpoints DROP COLUMN key_id;
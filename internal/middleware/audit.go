@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"github.com/codepnw/go-authen-system/internal/modules/audit"
+	"github.com/gin-gonic/gin"
+)
+
+// RequestInfoMiddleware puts the client IP and user agent on the request
+// context for the audit recorder.
+func RequestInfoMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := audit.ContextWithRequest(c.Request.Context(), &audit.RequestInfo{
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+		})
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+	}
+}
+
+// ImpersonationAuditMiddleware records every request made with an
+// impersonation token once it has been handled.
+func ImpersonationAuditMiddleware(recorder audit.Recorder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		user, ok := CurrentUser(c)
+		if !ok || !user.IsImpersonated() {
+			return
+		}
+
+		outcome := audit.OutcomeSuccess
+		if c.Writer.Status() >= 400 {
+			outcome = audit.OutcomeFailure
+		}
+
+		recorder.Record(c, &audit.Event{
+			Type:       audit.EventImpersonationUse,
+			ActorID:    user.Actor.ID,
+			ActorType:  audit.KindUser,
+			TargetID:   user.ID,
+			TargetType: audit.KindUser,
+			Outcome:    outcome,
+			Metadata: audit.Metadata{
+				"method": c.Request.Method,
+				"path":   c.Request.URL.Path,
+				"status": c.Writer.Status(),
+			},
+		})
+	}
+}
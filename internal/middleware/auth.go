@@ -1,27 +1,64 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/codepnw/go-authen-system/config"
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
 	"github.com/codepnw/go-authen-system/internal/utils/security"
+	"github.com/codepnw/go-authen-system/pkg/logger"
 	"github.com/gin-gonic/gin"
 )
 
-const UserContextKey = "user"
+const (
+	UserContextKey  = "user"
+	ActorContextKey = "actor"
+)
+
+// scopedRoutes lists the routes a scoped token may use, anything else is
+// refused. Impersonation lets support staff see the app as the user, they
+// cannot change anything on the user's behalf.
+var scopedRoutes = map[string][]string{
+	security.ScopeImpersonation: {
+		"GET /auth/profile",
+		"GET /users/me/profile",
+		"GET /users/me/email",
+		"GET /users/me/identities",
+		"GET /orgs/",
+		"GET /orgs/:id/members",
+		"GET /orgs/:id/members/:userID",
+		"GET /orgs/:id/invitations",
+	},
+}
+
+// AccountChecker tells whether a user account may still be used, see
+// user.UserUsecase.CheckActive.
+type AccountChecker interface {
+	CheckActive(ctx context.Context, userID int64) error
+}
 
-func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
+// AuthMiddleware verifies the access token and refuses users whose account
+// is no longer active, tokens issued before a suspension stop working at once.
+// With session cookies enabled the token may come from the session cookie,
+// unsafe requests made that way need a CSRF token.
+func AuthMiddleware(cfg *config.Config, accounts AccountChecker) gin.HandlerFunc {
 	tokenCfg := security.NewJWTToken(cfg)
 
 	return func(ctx *gin.Context) {
-		authHeader := ctx.GetHeader("Authorization")
-		if authHeader == "" {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "header is missing"})
-			return
-		}
+		tokenStr, fromCookie := sessionToken(ctx, cfg)
+		if !fromCookie {
+			authHeader := ctx.GetHeader("Authorization")
+			if authHeader == "" {
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "header is missing"})
+				return
+			}
 
-		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
+			tokenStr = strings.TrimPrefix(authHeader, "Bearer ")
+		}
 
 		user, err := tokenCfg.VerifyAccessToken(tokenStr)
 		if err != nil {
@@ -29,7 +66,154 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 			return
 		}
 
+		if fromCookie {
+			if err := VerifyCSRF(ctx, cfg, user.ID); err != nil {
+				ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": err.Error()})
+				return
+			}
+		}
+
+		// Service accounts are checked when they request a token
+		if user.Type == security.PrincipalUser {
+			ids := []int64{user.ID}
+			if user.IsImpersonated() {
+				ids = append(ids, user.Actor.ID)
+			}
+
+			for _, id := range ids {
+				if err := accounts.CheckActive(ctx, id); err != nil {
+					status := http.StatusUnauthorized
+					if errors.Is(err, errs.ErrAccountDisabled) {
+						status = http.StatusForbidden
+					}
+					ctx.AbortWithStatusJSON(status, gin.H{"message": err.Error()})
+					return
+				}
+			}
+		}
+
 		ctx.Set(UserContextKey, user)
+		ctx.Request = ctx.Request.WithContext(security.ContextWithUser(ctx.Request.Context(), user))
+
+		// Every request made with an impersonation token is recorded
+		if user.IsImpersonated() {
+			ctx.Set(ActorContextKey, user.Actor)
+			logger.Info("IMPERSONATE-USE", "impersonation token used", gin.H{
+				"actor_id":  user.Actor.ID,
+				"target_id": user.ID,
+				"method":    ctx.Request.Method,
+				"path":      ctx.Request.URL.Path,
+			})
+		}
+
+		if !scopeAllows(ctx, user) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "not allowed with this token scope"})
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// RequireRole must run after AuthMiddleware.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, ok := CurrentUser(ctx)
+		if !ok {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "unauthorized"})
+			return
+		}
+
+		if !slices.ContainsFunc(roles, user.HasRole) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "permission denied"})
+			return
+		}
+
 		ctx.Next()
 	}
 }
+
+// RequirePermission checks the permission against the roles in the token.
+// It must run after AuthMiddleware.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, ok := CurrentUser(ctx)
+		if !ok {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "unauthorized"})
+			return
+		}
+
+		if !user.HasPermission(permission) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "permission denied"})
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// RequirePrincipal restricts a route to the given principal types,
+// e.g. keeping service accounts away from session endpoints.
+func RequirePrincipal(types ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, ok := CurrentUser(ctx)
+		if !ok {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "unauthorized"})
+			return
+		}
+
+		if !slices.Contains(types, user.Type) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "principal not allowed"})
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// DenyImpersonation keeps impersonation tokens out of sensitive routes such as
+// admin endpoints and session management. AuthMiddleware already refuses them
+// outside scopedRoutes, this guards routes that must never be listed there.
+func DenyImpersonation() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if user, ok := CurrentUser(ctx); ok && user.IsImpersonated() {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "not allowed while impersonating"})
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// scopeAllows checks the route against the token scope. Impersonation tokens
+// are scoped even if the claim is missing, an unknown scope allows nothing.
+func scopeAllows(ctx *gin.Context, user *security.TokenUser) bool {
+	scope := user.Scope
+	if user.IsImpersonated() {
+		scope = security.ScopeImpersonation
+	}
+	if scope == "" {
+		return true
+	}
+	return slices.Contains(scopedRoutes[scope], ctx.Request.Method+" "+ctx.FullPath())
+}
+
+func CurrentUser(ctx *gin.Context) (*security.TokenUser, bool) {
+	value, ok := ctx.Get(UserContextKey)
+	if !ok {
+		return nil, false
+	}
+
+	user, ok := value.(*security.TokenUser)
+	return user, ok
+}
+
+// CurrentActor returns the admin really acting behind an impersonation token.
+func CurrentActor(ctx *gin.Context) (*security.TokenActor, bool) {
+	value, ok := ctx.Get(ActorContextKey)
+	if !ok {
+		return nil, false
+	}
+
+	actor, ok := value.(*security.TokenActor)
+	return actor, ok
+}
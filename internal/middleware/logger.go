@@ -14,12 +14,25 @@ func LoggerMiddleware() gin.HandlerFunc {
 
 		duration := time.Since(time.Now())
 
-		logger.InfoMiddleware("request",
+		fields := []zap.Field{
 			zap.String("method", c.Request.Method),
 			zap.String("path", c.Request.URL.Path),
 			zap.Int("status", c.Writer.Status()),
 			zap.Duration("latency", duration),
 			zap.String("client_ip", c.ClientIP()),
-		)
+		}
+
+		// Principal
+		if user, ok := CurrentUser(c); ok {
+			fields = append(fields,
+				zap.String("principal_type", user.Type),
+				zap.Int64("principal_id", user.ID),
+			)
+		}
+		if actor, ok := CurrentActor(c); ok {
+			fields = append(fields, zap.Int64("actor_id", actor.ID))
+		}
+
+		logger.InfoMiddleware("request", fields...)
 	}
 }
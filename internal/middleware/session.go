@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/codepnw/go-authen-system/config"
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+	"github.com/codepnw/go-authen-system/internal/utils/security"
+	"github.com/gin-gonic/gin"
+)
+
+// Browser session cookies. The refresh token is only sent to the refresh
+// endpoint, the CSRF token is readable by scripts so they can echo it in
+// CSRFHeader. HTML forms send it in the CSRFField form field instead.
+const (
+	SessionCookie = "session"
+	RefreshCookie = "refresh_token"
+	CSRFCookie    = "csrf_token"
+	CSRFHeader    = "X-CSRF-Token"
+	CSRFField     = "csrf_token"
+
+	RefreshCookiePath = "/auth/session/refresh"
+)
+
+// SessionTokens are the values SetSessionCookies stores, an empty refresh
+// token leaves the refresh cookie as it is.
+type SessionTokens struct {
+	AccessToken  string
+	RefreshToken string
+	CSRFToken    string
+}
+
+func SetSessionCookies(c *gin.Context, cfg *config.Config, tokens *SessionTokens) {
+	setCookie(c, cfg, SessionCookie, tokens.AccessToken, "/", cfg.SessionAccessTTL, true)
+	if tokens.RefreshToken != "" {
+		setCookie(c, cfg, RefreshCookie, tokens.RefreshToken, RefreshCookiePath, security.RefreshTokenDuration, true)
+	}
+	setCookie(c, cfg, CSRFCookie, tokens.CSRFToken, "/", security.RefreshTokenDuration, false)
+}
+
+// SetCSRFCookie stores a CSRF token without a session, e.g. the token of a
+// sign in form.
+func SetCSRFCookie(c *gin.Context, cfg *config.Config, token string) {
+	setCookie(c, cfg, CSRFCookie, token, "/", security.RefreshTokenDuration, false)
+}
+
+func ClearSessionCookies(c *gin.Context, cfg *config.Config) {
+	setCookie(c, cfg, SessionCookie, "", "/", -1, true)
+	setCookie(c, cfg, RefreshCookie, "", RefreshCookiePath, -1, true)
+	setCookie(c, cfg, CSRFCookie, "", "/", -1, false)
+}
+
+// VerifyCSRF checks that CSRFHeader, or the CSRFField of a form, repeats
+// the CSRF cookie and that the token was issued to subject. Safe methods
+// need no token.
+func VerifyCSRF(c *gin.Context, cfg *config.Config, subject int64) error {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return nil
+	}
+
+	submitted := c.GetHeader(CSRFHeader)
+	if submitted == "" {
+		submitted = c.PostForm(CSRFField)
+	}
+
+	cookie, err := c.Cookie(CSRFCookie)
+	if err != nil || cookie == "" || submitted != cookie {
+		return errs.ErrInvalidCSRFToken
+	}
+	if !security.VerifyCSRFToken(cfg.JWTSecretKey, cookie, subject) {
+		return errs.ErrInvalidCSRFToken
+	}
+	return nil
+}
+
+// sessionToken returns the access token of a browser session, the
+// Authorization header always wins over the cookie.
+func sessionToken(c *gin.Context, cfg *config.Config) (string, bool) {
+	if !cfg.SessionCookies || c.GetHeader("Authorization") != "" {
+		return "", false
+	}
+
+	token, err := c.Cookie(SessionCookie)
+	if err != nil || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+func setCookie(c *gin.Context, cfg *config.Config, name, value, path string, maxAge time.Duration, httpOnly bool) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   cfg.SessionDomain,
+		MaxAge:   int(maxAge / time.Second),
+		Secure:   cfg.SessionSecure,
+		HttpOnly: httpOnly,
+		SameSite: sameSite(cfg.SessionSameSite),
+	}
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(c.Writer, cookie)
+}
+
+func sameSite(mode string) http.SameSite {
+	switch mode {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteStrictMode
+	}
+}
@@ -0,0 +1,20 @@
+package audit
+
+import "context"
+
+type requestContextKey struct{}
+
+// RequestInfo describes the client behind the current request.
+type RequestInfo struct {
+	IP        string
+	UserAgent string
+}
+
+func ContextWithRequest(ctx context.Context, info *RequestInfo) context.Context {
+	return context.WithValue(ctx, requestContextKey{}, info)
+}
+
+func RequestFromContext(ctx context.Context) (*RequestInfo, bool) {
+	info, ok := ctx.Value(requestContextKey{}).(*RequestInfo)
+	return info, ok
+}
@@ -0,0 +1,46 @@
+package audit
+
+import "time"
+
+type ListAuditRequest struct {
+	UserID int64      `form:"user_id"`
+	Type   string     `form:"type"`
+	From   *time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To     *time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Page   int        `form:"page" validate:"omitempty,min=1"`
+	Limit  int        `form:"limit" validate:"omitempty,min=1,max=500"`
+	Format string     `form:"format" validate:"omitempty,oneof=json csv"`
+}
+
+type ListAuditResponseDTO struct {
+	Events []*Event `json:"events"`
+	Page   int      `json:"page"`
+	Limit  int      `json:"limit"`
+	Total  int64    `json:"total"`
+}
+
+type VerifyReportDTO struct {
+	Valid       bool           `json:"valid"`
+	Events      int64          `json:"events"`
+	Legacy      int64          `json:"legacy_events"`
+	Checkpoints int            `json:"checkpoints"`
+	Head        string         `json:"head,omitempty"`
+	BrokenLink  *BrokenLinkDTO `json:"broken_link,omitempty"`
+}
+
+// BrokenLinkDTO is the first event at which the chain stops verifying.
+type BrokenLinkDTO struct {
+	EventID int64  `json:"event_id"`
+	Reason  string `json:"reason"`
+}
+
+// PseudonymizeResultDTO counts the events rewritten for a user.
+type PseudonymizeResultDTO struct {
+	Events int64 `json:"events"`
+}
+
+func (r *VerifyReportDTO) broken(eventID int64, reason string) *VerifyReportDTO {
+	r.Valid = false
+	r.BrokenLink = &BrokenLinkDTO{EventID: eventID, Reason: reason}
+	return r
+}
@@ -0,0 +1,135 @@
+package audit
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	EventUserRegister       = "user.register"
+	EventUserCreate         = "user.create"
+	EventUserUpdate         = "user.update"
+	EventUserDelete         = "user.delete"
+	EventUserStatus         = "user.status"
+	EventPasswordChange     = "user.password_change"
+	EventEmailChange        = "user.email_change"
+	EventIdentityLink       = "user.identity_link"
+	EventIdentityUnlink     = "user.identity_unlink"
+	EventUserExport         = "user.export"
+	EventUserErase          = "user.erase"
+	EventLogin              = "auth.login"
+	EventRefresh            = "auth.refresh"
+	EventLogout             = "auth.logout"
+	EventTenantSwitch       = "auth.tenant_switch"
+	EventClientCredentials  = "auth.client_credentials"
+	EventRoleGrant          = "role.grant"
+	EventRoleRevoke         = "role.revoke"
+	EventImpersonate        = "admin.impersonate"
+	EventImpersonationUse   = "admin.impersonation_use"
+	EventServiceAccount     = "admin.service_account"
+	EventGroup              = "admin.group"
+	EventOrganization       = "org.organization"
+	EventOrganizationMember = "org.member"
+	EventOrganizationInvite = "org.invitation"
+	EventKeyRotate          = "admin.key_rotate"
+	EventProfileSchema      = "admin.profile_schema"
+)
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Principal and target kinds
+const (
+	KindUser           = "user"
+	KindService        = "service"
+	KindSystem         = "system"
+	KindAnonymous      = "anonymous"
+	KindGroup          = "group"
+	KindOrganization   = "organization"
+	KindServiceAccount = "service_account"
+	KindInvitation     = "invitation"
+)
+
+// Event is one security relevant action. Zero IDs mean "none".
+type Event struct {
+	ID         int64     `json:"id" gorm:"primaryKey"`
+	Type       string    `json:"type" gorm:"not null;index"`
+	ActorID    int64     `json:"actor_id,omitempty" gorm:"index"`
+	ActorType  string    `json:"actor_type" gorm:"not null"`
+	TargetID   int64     `json:"target_id,omitempty" gorm:"index"`
+	TargetType string    `json:"target_type,omitempty"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	Outcome    string    `json:"outcome" gorm:"not null"`
+	Reason     string    `json:"reason,omitempty"`
+	Metadata   Metadata  `json:"metadata,omitempty" gorm:"type:text"`
+	CreatedAt  time.Time `json:"created_at" gorm:"not null;index"`
+
+	// Hash chain, see ComputeHash
+	PrevHash    string `json:"prev_hash" gorm:"size:64"`
+	Hash        string `json:"hash" gorm:"size:64;index"`
+	HashVersion int    `json:"hash_version" gorm:"not null;default:1"`
+
+	// Sealed events chain a salted digest of their personal data instead of
+	// the data itself, so it can be pseudonymized without breaking the chain.
+	PIISalt         string     `json:"-" gorm:"column:pii_salt;size:32"`
+	PIIDigest       string     `json:"pii_digest,omitempty" gorm:"column:pii_digest;size:64"`
+	PseudonymizedAt *time.Time `json:"pseudonymized_at,omitempty"`
+}
+
+func (Event) TableName() string {
+	return "audit_events"
+}
+
+// Checkpoint pins the chain head at EventID, signed with the service key so
+// truncating the chain or rewriting it wholesale is detectable. KeyID names
+// the signing key, it is empty for checkpoints signed with the JWT secret.
+type Checkpoint struct {
+	ID        int64     `json:"id" gorm:"primaryKey"`
+	EventID   int64     `json:"event_id" gorm:"not null;index"`
+	Hash      string    `json:"hash" gorm:"size:64;not null"`
+	Signature string    `json:"signature" gorm:"size:64;not null"`
+	KeyID     string    `json:"key_id" gorm:"size:16;not null;default:''"`
+	CreatedAt time.Time `json:"created_at" gorm:"not null"`
+}
+
+func (Checkpoint) TableName() string {
+	return "audit_checkpoints"
+}
+
+// Metadata is stored as JSON text so it works on every storage backend.
+type Metadata map[string]any
+
+func (m Metadata) Value() (driver.Value, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (m *Metadata) Scan(value any) error {
+	var b []byte
+
+	switch v := value.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return errors.New("audit: unsupported metadata type")
+	}
+
+	return json.Unmarshal(b, m)
+}
@@ -0,0 +1,205 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type AuditRepository interface {
+	Append(ctx context.Context, input *Event) error
+	List(ctx context.Context, query *ListAuditRequest, offset, limit int) ([]*Event, int64, error)
+	ListAfter(ctx context.Context, afterID int64, limit int) ([]*Event, error)
+	FindByID(ctx context.Context, id int64) (*Event, error)
+	LastEvent(ctx context.Context) (*Event, error)
+	// ListPersonal returns events after afterID that the user acted in or
+	// that mention the email, in insert order.
+	ListPersonal(ctx context.Context, userID int64, email string, afterID int64, limit int) ([]*Event, error)
+	Pseudonymize(ctx context.Context, input *Event) error
+
+	CreateCheckpoint(ctx context.Context, input *Checkpoint) error
+	LastCheckpoint(ctx context.Context) (*Checkpoint, error)
+	ListCheckpoints(ctx context.Context) ([]*Checkpoint, error)
+}
+
+type auditRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditRepository(db *gorm.DB) AuditRepository {
+	return &auditRepository{db: db}
+}
+
+// chainLock is the postgres advisory lock key serializing chain writers.
+const chainLock = 0x61756469 // "audi"
+
+// Append links the event to the current chain head and inserts it. Writers
+// queue behind each other, in every process, before reading the head.
+// Locking the head row alone does not do, the first event has none and a
+// writer that waited would still read the old head.
+func (r *auditRepository) Append(ctx context.Context, input *Event) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// SQLite allows a single writer at a time
+		if tx.Dialector.Name() == "postgres" {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", chainLock).Error; err != nil {
+				return err
+			}
+		}
+
+		head := new(Event)
+		err := tx.Where("hash <> ''").
+			Order("id DESC").
+			Take(head).Error
+
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			input.PrevHash = ""
+		case err != nil:
+			return err
+		default:
+			input.PrevHash = head.Hash
+		}
+
+		if err := input.seal(); err != nil {
+			return err
+		}
+
+		hash, err := input.ComputeHash()
+		if err != nil {
+			return err
+		}
+		input.Hash = hash
+
+		return tx.Create(input).Error
+	})
+}
+
+// List filters by user (as actor or target), type and time range, newest first.
+func (r *auditRepository) List(ctx context.Context, query *ListAuditRequest, offset, limit int) (events []*Event, total int64, err error) {
+	tx := r.db.WithContext(ctx).Model(&Event{})
+
+	if query.UserID != 0 {
+		tx = tx.Where(
+			"(actor_id = ? AND actor_type = ?) OR (target_id = ? AND target_type = ?)",
+			query.UserID, KindUser, query.UserID, KindUser,
+		)
+	}
+	if query.Type != "" {
+		tx = tx.Where("type = ?", query.Type)
+	}
+	if query.From != nil {
+		tx = tx.Where("created_at >= ?", *query.From)
+	}
+	if query.To != nil {
+		tx = tx.Where("created_at < ?", *query.To)
+	}
+
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err = tx.Order("created_at DESC, id DESC").Offset(offset).Limit(limit).Find(&events).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return events, total, nil
+}
+
+// ListAfter returns the next events of the chain in insert order.
+func (r *auditRepository) ListAfter(ctx context.Context, afterID int64, limit int) ([]*Event, error) {
+	var events []*Event
+	err := r.db.WithContext(ctx).
+		Where("id > ?", afterID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *auditRepository) ListPersonal(ctx context.Context, userID int64, email string, afterID int64, limit int) ([]*Event, error) {
+	personal := r.db.Where("actor_id = ? AND actor_type = ?", userID, KindUser)
+	if email != "" {
+		quoted, err := json.Marshal(email)
+		if err != nil {
+			return nil, err
+		}
+		personal = personal.Or(`metadata LIKE ? ESCAPE '\'`, "%"+likeEscape(string(quoted))+"%")
+	}
+
+	var events []*Event
+	err := r.db.WithContext(ctx).
+		Where("id > ?", afterID).
+		Where(personal).
+		Order("id ASC").
+		Limit(limit).
+		Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Pseudonymize stores the rewritten personal data of a sealed event. The
+// chained fields are left alone.
+func (r *auditRepository) Pseudonymize(ctx context.Context, input *Event) error {
+	return r.db.WithContext(ctx).
+		Model(input).
+		Select("ip", "user_agent", "metadata", "pii_salt", "pseudonymized_at").
+		Updates(input).Error
+}
+
+func (r *auditRepository) FindByID(ctx context.Context, id int64) (*Event, error) {
+	event := new(Event)
+	if err := r.db.WithContext(ctx).First(event, id).Error; err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+func (r *auditRepository) LastEvent(ctx context.Context) (*Event, error) {
+	event := new(Event)
+	err := r.db.WithContext(ctx).Where("hash <> ''").Order("id DESC").Take(event).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return event, nil
+}
+
+func (r *auditRepository) CreateCheckpoint(ctx context.Context, input *Checkpoint) error {
+	return r.db.WithContext(ctx).Create(input).Error
+}
+
+func (r *auditRepository) LastCheckpoint(ctx context.Context) (*Checkpoint, error) {
+	checkpoint := new(Checkpoint)
+	err := r.db.WithContext(ctx).Order("id DESC").Take(checkpoint).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+func (r *auditRepository) ListCheckpoints(ctx context.Context) ([]*Checkpoint, error) {
+	var checkpoints []*Checkpoint
+	if err := r.db.WithContext(ctx).Order("id ASC").Find(&checkpoints).Error; err != nil {
+		return nil, err
+	}
+	return checkpoints, nil
+}
+
+// likeEscape escapes the LIKE wildcards in s, the pattern must use ESCAPE '\'.
+func likeEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
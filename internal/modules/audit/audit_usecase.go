@@ -0,0 +1,367 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/codepnw/go-authen-system/config"
+	"github.com/codepnw/go-authen-system/internal/utils/security"
+	"github.com/codepnw/go-authen-system/internal/utils/transaction"
+	"github.com/codepnw/go-authen-system/pkg/logger"
+)
+
+const (
+	queryTimeout = time.Second * 5
+
+	defaultLimit = 50
+	exportLimit  = 10000
+	verifyBatch  = 1000
+)
+
+// Recorder persists audit events. Recording never fails the caller, errors
+// are logged instead.
+type Recorder interface {
+	Record(ctx context.Context, event *Event)
+}
+
+type recorder struct {
+	mu   sync.Mutex
+	repo AuditRepository
+}
+
+func NewRecorder(repo AuditRepository) Recorder {
+	return &recorder{repo: repo}
+}
+
+// Record fills the actor and client details from the context when the
+// caller did not set them.
+func (r *recorder) Record(ctx context.Context, event *Event) {
+	if event.ActorType == "" {
+		event.ActorType = KindAnonymous
+
+		if user, ok := security.UserFromContext(ctx); ok {
+			event.ActorID = user.ID
+			event.ActorType = user.Type
+
+			// The admin behind an impersonation token is the real actor
+			if user.IsImpersonated() {
+				event.ActorID = user.Actor.ID
+				if event.Metadata == nil {
+					event.Metadata = Metadata{}
+				}
+				event.Metadata["impersonating"] = user.ID
+			}
+		}
+	}
+
+	if info, ok := RequestFromContext(ctx); ok {
+		if event.IP == "" {
+			event.IP = info.IP
+		}
+		if event.UserAgent == "" {
+			event.UserAgent = info.UserAgent
+		}
+	}
+
+	// Stored timestamps keep microseconds, the hash must match what is read back
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	event.CreatedAt = event.CreatedAt.UTC().Truncate(time.Microsecond)
+
+	// Inside a unit of work the event waits for the outcome, work that was
+	// rolled back did not succeed
+	transaction.OnFinish(ctx, func(committed bool) {
+		if !committed && event.Outcome == OutcomeSuccess {
+			return
+		}
+		r.append(ctx, event)
+	})
+}
+
+func (r *recorder) append(ctx context.Context, event *Event) {
+	// The request context may already be cancelled, the event must still land
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), queryTimeout)
+	defer cancel()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.repo.Append(ctx, event); err != nil {
+		logger.Error("AUDIT-001", "record audit event failed", err)
+	}
+}
+
+type AuditUsecase interface {
+	List(ctx context.Context, req *ListAuditRequest) (*ListAuditResponseDTO, error)
+	Export(ctx context.Context, req *ListAuditRequest) ([]*Event, error)
+	Checkpoint(ctx context.Context) (*Checkpoint, error)
+	Verify(ctx context.Context) (*VerifyReportDTO, error)
+	Pseudonymize(ctx context.Context, userID int64, email, pseudonym string) (*PseudonymizeResultDTO, error)
+}
+
+type auditUsecase struct {
+	repo       AuditRepository
+	signingKey checkpointKey
+	verifyKeys map[string][]byte
+	legacyKeys [][]byte
+}
+
+func NewAuditUsecase(cfg *config.Config, repo AuditRepository) AuditUsecase {
+	secret := cfg.AuditCheckpointKey
+	if secret == "" {
+		secret = cfg.JWTSecretKey
+	}
+
+	uc := &auditUsecase{
+		repo:       repo,
+		signingKey: deriveCheckpointKey(secret),
+		verifyKeys: map[string][]byte{},
+	}
+
+	// Checkpoints signed before a rotation still verify, and so do those
+	// signed with the raw JWT secret before checkpoints had a key ID
+	for _, old := range append([]string{secret, cfg.JWTSecretKey}, cfg.AuditRetiredCheckpointKeys...) {
+		key := deriveCheckpointKey(old)
+		uc.verifyKeys[key.id] = key.key
+		uc.legacyKeys = append(uc.legacyKeys, []byte(old))
+	}
+	return uc
+}
+
+func (uc *auditUsecase) List(ctx context.Context, req *ListAuditRequest) (*ListAuditResponseDTO, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	page := max(req.Page, 1)
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultLimit
+	}
+
+	events, total, err := uc.repo.List(ctx, req, (page-1)*limit, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListAuditResponseDTO{
+		Events: events,
+		Page:   page,
+		Limit:  limit,
+		Total:  total,
+	}, nil
+}
+
+// Export returns every matching event up to exportLimit.
+func (uc *auditUsecase) Export(ctx context.Context, req *ListAuditRequest) ([]*Event, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout*6)
+	defer cancel()
+
+	events, _, err := uc.repo.List(ctx, req, 0, exportLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// Checkpoint signs the current chain head. Nothing is written when the head
+// is already checkpointed.
+func (uc *auditUsecase) Checkpoint(ctx context.Context) (*Checkpoint, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	head, err := uc.repo.LastEvent(ctx)
+	if err != nil || head == nil {
+		return nil, err
+	}
+
+	last, err := uc.repo.LastCheckpoint(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if last != nil && last.EventID == head.ID {
+		return nil, nil
+	}
+
+	checkpoint := &Checkpoint{
+		EventID:   head.ID,
+		Hash:      head.Hash,
+		KeyID:     uc.signingKey.id,
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+	checkpoint.Signature = checkpoint.Sign(uc.signingKey.key)
+
+	if err = uc.repo.CreateCheckpoint(ctx, checkpoint); err != nil {
+		logger.Error("AUDIT-CHECKPOINT-001", "create audit checkpoint failed", err)
+		return nil, err
+	}
+
+	logger.Info("AUDIT-CHECKPOINT-002", "audit checkpoint created", checkpoint)
+	return checkpoint, nil
+}
+
+// Verify walks the whole chain in insert order, recomputing every hash, and
+// checks each checkpoint against the event it pins. It stops at the first
+// broken link. Events recorded before chaining existed are counted as legacy.
+func (uc *auditUsecase) Verify(ctx context.Context) (*VerifyReportDTO, error) {
+	checkpoints, err := uc.repo.ListCheckpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &VerifyReportDTO{Valid: true, Checkpoints: len(checkpoints)}
+
+	pinned := make(map[int64]*Checkpoint, len(checkpoints))
+	for _, cp := range checkpoints {
+		if !uc.verifyCheckpoint(cp) {
+			return report.broken(cp.EventID, fmt.Sprintf("checkpoint %d has an invalid signature", cp.ID)), nil
+		}
+		pinned[cp.EventID] = cp
+	}
+
+	var prev *Event
+	var afterID int64
+
+	for {
+		events, err := uc.repo.ListAfter(ctx, afterID, verifyBatch)
+		if err != nil {
+			return nil, err
+		}
+		if len(events) == 0 {
+			break
+		}
+
+		for _, e := range events {
+			afterID = e.ID
+
+			if e.Hash == "" {
+				if prev == nil {
+					report.Legacy++
+					continue
+				}
+				return report.broken(e.ID, "event has no hash"), nil
+			}
+
+			expectedPrev := ""
+			if prev != nil {
+				expectedPrev = prev.Hash
+			}
+			if e.PrevHash != expectedPrev {
+				return report.broken(e.ID, "previous hash does not match, an event before it was removed or inserted"), nil
+			}
+
+			hash, err := e.ComputeHash()
+			if err != nil {
+				return nil, err
+			}
+			if hash != e.Hash {
+				return report.broken(e.ID, "event content does not match its hash"), nil
+			}
+
+			ok, err := e.verifyPII()
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return report.broken(e.ID, "event personal data does not match its digest"), nil
+			}
+
+			if cp, ok := pinned[e.ID]; ok {
+				if cp.Hash != e.Hash {
+					return report.broken(e.ID, fmt.Sprintf("event does not match checkpoint %d", cp.ID)), nil
+				}
+				delete(pinned, e.ID)
+			}
+
+			report.Events++
+			prev = e
+		}
+	}
+
+	// Checkpoints left over point past the end of the chain
+	for _, cp := range checkpoints {
+		if _, ok := pinned[cp.EventID]; ok {
+			return report.broken(cp.EventID, fmt.Sprintf("event pinned by checkpoint %d is missing", cp.ID)), nil
+		}
+	}
+
+	if prev != nil {
+		report.Head = prev.Hash
+	}
+	return report, nil
+}
+
+// Pseudonymize strips the personal data of a user from the events they
+// acted in and replaces their email wherever metadata mentions it. Chained
+// events stay in the chain and keep verifying, dropping the salt leaves their
+// digest unusable. Events recorded before chaining have no hash to keep.
+func (uc *auditUsecase) Pseudonymize(ctx context.Context, userID int64, email, pseudonym string) (*PseudonymizeResultDTO, error) {
+	result := new(PseudonymizeResultDTO)
+	now := time.Now().UTC()
+
+	var afterID int64
+	for {
+		events, err := uc.repo.ListPersonal(ctx, userID, email, afterID, verifyBatch)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range events {
+			afterID = e.ID
+
+			if e.PseudonymizedAt != nil {
+				continue
+			}
+
+			if e.ActorID == userID && e.ActorType == KindUser {
+				e.IP = ""
+				e.UserAgent = ""
+			}
+			for key, value := range e.Metadata {
+				if value == email {
+					e.Metadata[key] = pseudonym
+				}
+			}
+			e.PIISalt = ""
+			e.PseudonymizedAt = &now
+
+			if err = uc.repo.Pseudonymize(ctx, e); err != nil {
+				return nil, err
+			}
+			result.Events++
+		}
+
+		if len(events) < verifyBatch {
+			return result, nil
+		}
+	}
+}
+
+// verifyCheckpoint checks the signature with the key the checkpoint names.
+func (uc *auditUsecase) verifyCheckpoint(cp *Checkpoint) bool {
+	if cp.KeyID == "" {
+		return slices.ContainsFunc(uc.legacyKeys, cp.Verify)
+	}
+
+	key, ok := uc.verifyKeys[cp.KeyID]
+	return ok && cp.Verify(key)
+}
+
+// RunCheckpoints signs the chain head every interval until ctx is done.
+func RunCheckpoints(ctx context.Context, uc AuditUsecase, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, _ = uc.Checkpoint(ctx)
+		}
+	}
+}
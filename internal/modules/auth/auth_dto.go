@@ -1,6 +1,11 @@
 package auth
 
-import "github.com/codepnw/go-authen-system/internal/modules/user"
+import (
+	"time"
+
+	"github.com/codepnw/go-authen-system/internal/modules/user"
+	"github.com/codepnw/go-authen-system/internal/utils/security"
+)
 
 type AuthResponseDTO struct {
 	User         *user.User `json:"user"`
@@ -11,6 +16,11 @@ type AuthResponseDTO struct {
 type LoginRequestDTO struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	TenantID *int64 `json:"tenant_id"`
+}
+
+type SwitchTenantRequestDTO struct {
+	TenantID int64 `json:"tenant_id" validate:"required"`
 }
 
 type RefreshTokenRequestDTO struct {
@@ -21,3 +31,37 @@ type RefreshTokenResponseDTO struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
 }
+
+type ImpersonateRequestDTO struct {
+	Reason string `json:"reason" validate:"required"`
+}
+
+type ImpersonateResponseDTO struct {
+	User        *user.User           `json:"user"`
+	Actor       *security.TokenActor `json:"actor"`
+	AccessToken string               `json:"access_token"`
+	ExpiresIn   int64                `json:"expires_in"`
+}
+
+type InvitationRegisterRequestDTO struct {
+	Token           string `json:"token" validate:"required"`
+	Username        string `json:"username" validate:"required"`
+	Password        string `json:"password" validate:"required,min=4"`
+	ConfirmPassword string `json:"confirm_password" validate:"required"`
+}
+
+// SessionResponseDTO answers the browser session endpoints, the tokens
+// themselves are only in cookies.
+type SessionResponseDTO struct {
+	User      *user.User `json:"user,omitempty"`
+	CSRFToken string     `json:"csrf_token"`
+	ExpiresIn int64      `json:"expires_in"`
+}
+
+// SessionDTO is a signed in session, the refresh token stays private.
+type SessionDTO struct {
+	ID        int64     `json:"id"`
+	Current   bool      `json:"current"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
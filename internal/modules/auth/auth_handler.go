@@ -1,8 +1,12 @@
 package auth
 
 import (
+	"errors"
+	"strconv"
+
 	"github.com/codepnw/go-authen-system/internal/middleware"
 	"github.com/codepnw/go-authen-system/internal/modules/user"
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
 	"github.com/codepnw/go-authen-system/internal/utils/response"
 	"github.com/codepnw/go-authen-system/internal/utils/security"
 	"github.com/gin-gonic/gin"
@@ -57,6 +61,10 @@ func (h *authHandler) Login(c *gin.Context) {
 	}
 
 	result, err := h.uc.Login(c, req)
+	if errors.Is(err, errs.ErrNotOrgMember) || errors.Is(err, errs.ErrAccountDisabled) {
+		response.Forbidden(c, err)
+		return
+	}
 	if err != nil {
 		response.InternalServerError(c, err)
 		return
@@ -65,10 +73,12 @@ func (h *authHandler) Login(c *gin.Context) {
 	response.Success(c, "", result)
 }
 
+// Profile returns the token principal. While impersonating, Actor holds the
+// admin who is really acting.
 func (h *authHandler) Profile(c *gin.Context) {
-	user, ok := c.Get(middleware.UserContextKey)
+	user, ok := middleware.CurrentUser(c)
 	if !ok {
-		response.Unauthorized(c, nil)
+		response.Unauthorized(c, errs.ErrInvalidToken)
 		return
 	}
 
@@ -93,7 +103,7 @@ func (h *authHandler) RefreshToken(c *gin.Context) {
 		response.InternalServerError(c, err)
 		return
 	}
-	
+
 	res := &RefreshTokenResponseDTO{
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
@@ -111,10 +121,124 @@ func (h *authHandler) Logout(c *gin.Context) {
 
 	u := user.(*security.TokenUser)
 
-	if err := h.uc.Logout(c, u.ID); err != nil {
+	if err := h.uc.Logout(c, u.ID, u.SessionID); err != nil {
 		response.InternalServerError(c, err)
 		return
 	}
 
 	response.Success(c, "logout success", nil)
 }
+
+// Sessions lists the caller's signed in sessions, logout ends the one of the
+// access token.
+func (h *authHandler) Sessions(c *gin.Context) {
+	current, ok := middleware.CurrentUser(c)
+	if !ok {
+		response.Unauthorized(c, errs.ErrInvalidToken)
+		return
+	}
+
+	sessions, err := h.uc.ListSessions(c, current.ID, current.SessionID)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, "", sessions)
+}
+
+func (h *authHandler) Impersonate(c *gin.Context) {
+	actor, ok := middleware.CurrentUser(c)
+	if !ok {
+		response.Unauthorized(c, errs.ErrInvalidToken)
+		return
+	}
+
+	targetID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid id", err)
+		return
+	}
+
+	req := new(ImpersonateRequestDTO)
+
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	data, err := h.uc.Impersonate(c, actor, targetID, req)
+	if errors.Is(err, errs.ErrImpersonationNotAllowed) || errors.Is(err, errs.ErrAccountDisabled) {
+		response.Forbidden(c, err)
+		return
+	}
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Created(c, data)
+}
+
+func (h *authHandler) SwitchTenant(c *gin.Context) {
+	current, ok := middleware.CurrentUser(c)
+	if !ok {
+		response.Unauthorized(c, errs.ErrInvalidToken)
+		return
+	}
+
+	req := new(SwitchTenantRequestDTO)
+
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	data, err := h.uc.SwitchTenant(c, current, req.TenantID)
+	if errors.Is(err, errs.ErrNotOrgMember) {
+		response.Forbidden(c, err)
+		return
+	}
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, "", data)
+}
+
+func (h *authHandler) RegisterWithInvitation(c *gin.Context) {
+	req := new(InvitationRegisterRequestDTO)
+
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	data, err := h.uc.RegisterWithInvitation(c, req)
+	if errors.Is(err, errs.ErrInvalidInvitation) {
+		response.BadRequest(c, "", err)
+		return
+	}
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Created(c, data)
+}
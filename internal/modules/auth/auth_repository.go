@@ -3,15 +3,23 @@ package auth
 import (
 	"context"
 	"errors"
+	"time"
 
+	"github.com/codepnw/go-authen-system/internal/modules/outbox"
+	"github.com/codepnw/go-authen-system/internal/utils/transaction"
 	"gorm.io/gorm"
 )
 
 type AuthRepository interface {
 	SaveRefreshToken(ctx context.Context, input *RefreshToken) error
-	UpdateRefreshToken(ctx context.Context, input *RefreshToken) error
-	IsRefreshToken(ctx context.Context, refreshToken string) bool
-	DeleteRefreshToken(ctx context.Context, userID int64) error
+	// UpdateRefreshToken rotates the session holding the presented token.
+	UpdateRefreshToken(ctx context.Context, presented string, input *RefreshToken) error
+	// FindRefreshToken returns the session holding the token, nil when the
+	// token is unknown or expired.
+	FindRefreshToken(ctx context.Context, refreshToken string) (*RefreshToken, error)
+	ListRefreshTokens(ctx context.Context, userID int64) ([]*RefreshToken, error)
+	DeleteRefreshToken(ctx context.Context, userID int64, events ...*outbox.Event) (int64, error)
+	DeleteSession(ctx context.Context, userID, sessionID int64, events ...*outbox.Event) (int64, error)
 }
 
 type authRepository struct {
@@ -23,14 +31,16 @@ func NewAuthRepository(db *gorm.DB) AuthRepository {
 }
 
 func (r *authRepository) SaveRefreshToken(ctx context.Context, input *RefreshToken) error {
-	if err := r.db.WithContext(ctx).Create(input).Error; err != nil {
+	if err := transaction.DB(ctx, r.db).Create(input).Error; err != nil {
 		return err
 	}
 	return nil
 }
 
-func (r *authRepository) UpdateRefreshToken(ctx context.Context, input *RefreshToken) error {
-	res := r.db.WithContext(ctx).Where("user_id = ?", input.UserID).Updates(input)
+func (r *authRepository) UpdateRefreshToken(ctx context.Context, presented string, input *RefreshToken) error {
+	res := transaction.DB(ctx, r.db).
+		Where("user_id = ? AND refresh_token = ?", input.UserID, presented).
+		Updates(input)
 	if res.Error != nil {
 		return res.Error
 	}
@@ -43,25 +53,59 @@ func (r *authRepository) UpdateRefreshToken(ctx context.Context, input *RefreshT
 	return nil
 }
 
-func (r *authRepository) IsRefreshToken(ctx context.Context, refreshToken string) bool {
-	err := r.db.WithContext(ctx).First(&RefreshToken{}, "refresh_token = ? AND expires_at > NOW()", refreshToken).Error
+func (r *authRepository) FindRefreshToken(ctx context.Context, refreshToken string) (*RefreshToken, error) {
+	token := new(RefreshToken)
+
+	err := transaction.DB(ctx, r.db).First(token, "refresh_token = ? AND expires_at > ?", refreshToken, time.Now()).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return false
+		return nil, nil
 	}
-
-	return err == nil
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
 }
 
-func (r *authRepository) DeleteRefreshToken(ctx context.Context, userID int64) error {
-	res := r.db.Delete(&RefreshToken{}, "user_id = ?", userID)
-	if res.Error != nil {
-		return res.Error
+// ListRefreshTokens returns the sessions of the user, oldest first.
+func (r *authRepository) ListRefreshTokens(ctx context.Context, userID int64) (tokens []*RefreshToken, err error) {
+	err = transaction.DB(ctx, r.db).Where("user_id = ?", userID).Order("id").Find(&tokens).Error
+	if err != nil {
+		return nil, err
 	}
+	return tokens, nil
+}
 
-	rows := res.RowsAffected
-	if rows == 0 {
-		return errors.New("user id not found")
-	}
+// DeleteRefreshToken removes every session of the user and returns how many
+// there were. Events are only written when a session was removed.
+func (r *authRepository) DeleteRefreshToken(ctx context.Context, userID int64, events ...*outbox.Event) (int64, error) {
+	return r.delete(ctx, []any{"user_id = ?", userID}, events)
+}
 
-	return nil
+// DeleteSession removes one session of the user, the other sessions are
+// kept. Events are only written when the session was removed.
+func (r *authRepository) DeleteSession(ctx context.Context, userID, sessionID int64, events ...*outbox.Event) (int64, error) {
+	return r.delete(ctx, []any{"id = ? AND user_id = ?", sessionID, userID}, events)
+}
+
+// delete removes the matching sessions and writes the events with them.
+func (r *authRepository) delete(ctx context.Context, conds []any, events []*outbox.Event) (int64, error) {
+	var rows int64
+
+	err := transaction.DB(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		res := tx.Delete(&RefreshToken{}, conds...)
+		if res.Error != nil {
+			return res.Error
+		}
+
+		rows = res.RowsAffected
+		if rows == 0 {
+			return nil
+		}
+
+		return outbox.Write(tx, events...)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
 }
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/codepnw/go-authen-system/internal/modules/outbox"
+)
+
+type memoryAuthRepository struct {
+	mu     sync.RWMutex
+	tokens []*RefreshToken
+	nextID int64
+
+	events outbox.Writer
+}
+
+// NewMemoryAuthRepository keeps sessions in process memory, for tests and
+// demos. Writes do not take part in transactions, events are dropped when
+// events is nil.
+func NewMemoryAuthRepository(events outbox.Writer) AuthRepository {
+	return &memoryAuthRepository{events: events}
+}
+
+func (r *memoryAuthRepository) SaveRefreshToken(ctx context.Context, input *RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	input.ID = r.nextID
+	if input.CreatedAt.IsZero() {
+		input.CreatedAt = time.Now()
+	}
+
+	token := *input
+	r.tokens = append(r.tokens, &token)
+	return nil
+}
+
+func (r *memoryAuthRepository) UpdateRefreshToken(ctx context.Context, presented string, input *RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var rows int
+	for _, token := range r.tokens {
+		if token.UserID != input.UserID || token.RefreshToken != presented {
+			continue
+		}
+		if input.RefreshToken != "" {
+			token.RefreshToken = input.RefreshToken
+		}
+		if !input.ExpiresAt.IsZero() {
+			token.ExpiresAt = input.ExpiresAt
+		}
+		rows++
+	}
+
+	if rows == 0 {
+		return errors.New("refresh token not found")
+	}
+	return nil
+}
+
+func (r *memoryAuthRepository) FindRefreshToken(ctx context.Context, refreshToken string) (*RefreshToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	for _, token := range r.tokens {
+		if token.RefreshToken == refreshToken && token.ExpiresAt.After(now) {
+			c := *token
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryAuthRepository) ListRefreshTokens(ctx context.Context, userID int64) ([]*RefreshToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var tokens []*RefreshToken
+	for _, token := range r.tokens {
+		if token.UserID == userID {
+			c := *token
+			tokens = append(tokens, &c)
+		}
+	}
+	return tokens, nil
+}
+
+func (r *memoryAuthRepository) DeleteRefreshToken(ctx context.Context, userID int64, events ...*outbox.Event) (int64, error) {
+	return r.delete(ctx, func(token *RefreshToken) bool {
+		return token.UserID == userID
+	}, events)
+}
+
+func (r *memoryAuthRepository) DeleteSession(ctx context.Context, userID, sessionID int64, events ...*outbox.Event) (int64, error) {
+	return r.delete(ctx, func(token *RefreshToken) bool {
+		return token.ID == sessionID && token.UserID == userID
+	}, events)
+}
+
+func (r *memoryAuthRepository) delete(ctx context.Context, match func(*RefreshToken) bool, events []*outbox.Event) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.tokens[:0]
+	for _, token := range r.tokens {
+		if !match(token) {
+			kept = append(kept, token)
+		}
+	}
+
+	rows := int64(len(r.tokens) - len(kept))
+	r.tokens = kept
+
+	if rows == 0 || r.events == nil || len(events) == 0 {
+		return rows, nil
+	}
+	return rows, r.events(ctx, events...)
+}
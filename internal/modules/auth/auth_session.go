@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"errors"
+
+	"github.com/codepnw/go-authen-system/config"
+	"github.com/codepnw/go-authen-system/internal/middleware"
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+	"github.com/codepnw/go-authen-system/internal/utils/response"
+	"github.com/codepnw/go-authen-system/internal/utils/security"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// sessionHandler serves browser sessions. Tokens go into HttpOnly cookies
+// instead of the response body and access tokens are short lived.
+type sessionHandler struct {
+	cfg         *config.Config
+	uc          AuthUsecase
+	tokenConfig *security.TokenConfig
+	validate    *validator.Validate
+}
+
+func NewSessionHandler(cfg *config.Config, uc AuthUsecase) *sessionHandler {
+	return &sessionHandler{
+		cfg:         cfg,
+		uc:          uc,
+		tokenConfig: security.NewJWTToken(cfg),
+		validate:    validator.New(),
+	}
+}
+
+func (h *sessionHandler) Login(c *gin.Context) {
+	req := new(LoginRequestDTO)
+
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	h.shortLived(c)
+	result, err := h.uc.Login(c, req)
+	if errors.Is(err, errs.ErrNotOrgMember) || errors.Is(err, errs.ErrAccountDisabled) {
+		response.Forbidden(c, err)
+		return
+	}
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	h.start(c, result)
+}
+
+// Refresh rotates the session tokens. The refresh cookie only reaches this
+// path, the CSRF token must come along.
+func (h *sessionHandler) Refresh(c *gin.Context) {
+	refreshToken, err := c.Cookie(middleware.RefreshCookie)
+	if err != nil || refreshToken == "" {
+		response.Unauthorized(c, errs.ErrInvalidToken)
+		return
+	}
+
+	claims, err := h.tokenConfig.VerifyRefreshToken(refreshToken)
+	if err != nil {
+		middleware.ClearSessionCookies(c, h.cfg)
+		response.Unauthorized(c, errs.ErrInvalidToken)
+		return
+	}
+
+	if err = middleware.VerifyCSRF(c, h.cfg, claims.ID); err != nil {
+		response.Forbidden(c, err)
+		return
+	}
+
+	h.shortLived(c)
+	accessToken, newRefreshToken, err := h.uc.RefreshToken(c, refreshToken)
+	switch {
+	case errors.Is(err, errs.ErrInvalidToken):
+		middleware.ClearSessionCookies(c, h.cfg)
+		response.Unauthorized(c, err)
+		return
+	case errors.Is(err, errs.ErrAccountDisabled), errors.Is(err, errs.ErrNotOrgMember):
+		middleware.ClearSessionCookies(c, h.cfg)
+		response.Forbidden(c, err)
+		return
+	case err != nil:
+		response.InternalServerError(c, err)
+		return
+	}
+
+	// The CSRF token is bound to the user, not to the tokens, and stays
+	csrfToken, _ := c.Cookie(middleware.CSRFCookie)
+	middleware.SetSessionCookies(c, h.cfg, &middleware.SessionTokens{
+		AccessToken:  accessToken,
+		RefreshToken: newRefreshToken,
+		CSRFToken:    csrfToken,
+	})
+
+	response.Success(c, "", &SessionResponseDTO{
+		CSRFToken: csrfToken,
+		ExpiresIn: int64(h.cfg.SessionAccessTTL.Seconds()),
+	})
+}
+
+func (h *sessionHandler) SwitchTenant(c *gin.Context) {
+	current, ok := middleware.CurrentUser(c)
+	if !ok {
+		response.Unauthorized(c, errs.ErrInvalidToken)
+		return
+	}
+
+	req := new(SwitchTenantRequestDTO)
+
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	h.shortLived(c)
+	result, err := h.uc.SwitchTenant(c, current, req.TenantID)
+	if errors.Is(err, errs.ErrNotOrgMember) {
+		response.Forbidden(c, err)
+		return
+	}
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	h.start(c, result)
+}
+
+func (h *sessionHandler) Logout(c *gin.Context) {
+	current, ok := middleware.CurrentUser(c)
+	if !ok {
+		response.Unauthorized(c, errs.ErrInvalidToken)
+		return
+	}
+
+	if err := h.uc.Logout(c, current.ID, current.SessionID); err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	middleware.ClearSessionCookies(c, h.cfg)
+	response.Success(c, "logout success", nil)
+}
+
+// start stores the tokens of a new session with a fresh CSRF token.
+func (h *sessionHandler) start(c *gin.Context, result *AuthResponseDTO) {
+	csrfToken, err := security.CSRFToken(h.cfg.JWTSecretKey, result.User.ID)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	middleware.SetSessionCookies(c, h.cfg, &middleware.SessionTokens{
+		AccessToken:  result.AccessToken,
+		RefreshToken: result.RefreshToken,
+		CSRFToken:    csrfToken,
+	})
+
+	response.Success(c, "", &SessionResponseDTO{
+		User:      result.User,
+		CSRFToken: csrfToken,
+		ExpiresIn: int64(h.cfg.SessionAccessTTL.Seconds()),
+	})
+}
+
+// shortLived makes the usecase issue session length access tokens.
+func (h *sessionHandler) shortLived(c *gin.Context) {
+	c.Request = c.Request.WithContext(security.ContextWithAccessTTL(c.Request.Context(), h.cfg.SessionAccessTTL))
+}
@@ -2,12 +2,19 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/codepnw/go-authen-system/config"
+	"github.com/codepnw/go-authen-system/internal/modules/audit"
+	"github.com/codepnw/go-authen-system/internal/modules/group"
+	"github.com/codepnw/go-authen-system/internal/modules/organization"
+	"github.com/codepnw/go-authen-system/internal/modules/outbox"
 	"github.com/codepnw/go-authen-system/internal/modules/user"
+	"github.com/codepnw/go-authen-system/internal/modules/webhook"
 	"github.com/codepnw/go-authen-system/internal/utils/errs"
 	"github.com/codepnw/go-authen-system/internal/utils/security"
+	"github.com/codepnw/go-authen-system/internal/utils/transaction"
 	"github.com/codepnw/go-authen-system/pkg/logger"
 )
 
@@ -16,47 +23,88 @@ const queryTimeout = time.Second * 5
 type AuthUsecase interface {
 	Register(ctx context.Context, req *user.CreateUserRequest) (*AuthResponseDTO, error)
 	Login(ctx context.Context, req *LoginRequestDTO) (*AuthResponseDTO, error)
+	LoginWithIdentity(ctx context.Context, user *user.User, provider string) (*AuthResponseDTO, error)
 	RefreshToken(ctx context.Context, refreshToken string) (string, string, error)
-	Logout(ctx context.Context, userID int64) error
+	// Logout ends one session, RevokeSessions ends them all.
+	Logout(ctx context.Context, userID, sessionID int64) error
+	RevokeSessions(ctx context.Context, userID int64, reason string) (int64, error)
+	// ListSessions marks the session of currentSessionID as the current one.
+	ListSessions(ctx context.Context, userID, currentSessionID int64) ([]*SessionDTO, error)
+	Impersonate(ctx context.Context, actor *security.TokenUser, targetID int64, req *ImpersonateRequestDTO) (*ImpersonateResponseDTO, error)
+	SwitchTenant(ctx context.Context, current *security.TokenUser, tenantID int64) (*AuthResponseDTO, error)
+	RegisterWithInvitation(ctx context.Context, req *InvitationRegisterRequestDTO) (*AuthResponseDTO, error)
 }
 
 type authUsecase struct {
-	authRepo    AuthRepository
-	userUsecase user.UserUsecase
-	tokenConfig *security.TokenConfig
+	tx           transaction.Manager
+	authRepo     AuthRepository
+	userUsecase  user.UserUsecase
+	orgUsecase   organization.OrganizationUsecase
+	groupUsecase group.GroupUsecase
+	recorder     audit.Recorder
+	tokenConfig  *security.TokenConfig
 }
 
-func NewAuthUsecase(cfg *config.Config, authRepo AuthRepository, userUsecase user.UserUsecase) AuthUsecase {
+func NewAuthUsecase(
+	cfg *config.Config,
+	tx transaction.Manager,
+	authRepo AuthRepository,
+	userUsecase user.UserUsecase,
+	orgUsecase organization.OrganizationUsecase,
+	groupUsecase group.GroupUsecase,
+	recorder audit.Recorder,
+) AuthUsecase {
 	return &authUsecase{
-		authRepo:    authRepo,
-		userUsecase: userUsecase,
-		tokenConfig: security.NewJWTToken(cfg),
+		tx:           tx,
+		authRepo:     authRepo,
+		userUsecase:  userUsecase,
+		orgUsecase:   orgUsecase,
+		groupUsecase: groupUsecase,
+		recorder:     recorder,
+		tokenConfig:  security.NewJWTToken(cfg),
 	}
 }
 
+// Register creates the user and its first session in one transaction, so a
+// failure never leaves an account without a usable refresh token.
 func (uc *authUsecase) Register(ctx context.Context, req *user.CreateUserRequest) (*AuthResponseDTO, error) {
 	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 
-	// Create User
-	user, err := uc.userUsecase.CreateUser(ctx, req)
-	if err != nil {
-		logger.Error("REGIS-001", "create user failed", err)
-		return nil, err
-	}
-
-	tokenUser := uc.tokenUser(user)
-
-	// Generate Token
-	accessToken, refreshToken, err := uc.generateToken(tokenUser)
+	var response *AuthResponseDTO
+
+	err := uc.tx.Do(ctx, func(ctx context.Context) error {
+		// Create User
+		user, err := uc.userUsecase.CreateUser(ctx, req)
+		if err != nil {
+			logger.Error("REGIS-001", "create user failed", err)
+			return err
+		}
+
+		tokenUser, err := uc.tokenUser(ctx, user)
+		if err != nil {
+			logger.Error("REGIS-004", "resolve roles failed", err)
+			return err
+		}
+
+		// Start Session
+		accessToken, refreshToken, err := uc.startSession(ctx, tokenUser)
+		if err != nil {
+			logger.Error("REGIS-002", "start session failed", err)
+			return err
+		}
+
+		response, err = uc.authResponse(ctx, user, accessToken, refreshToken)
+		return err
+	})
 	if err != nil {
-		logger.Error("REGIS-002", "generate token failed", err)
+		uc.recordFailure(ctx, audit.EventUserRegister, 0, err.Error(), audit.Metadata{"email": req.Email})
 		return nil, err
 	}
 
 	// Data Response
-	response := uc.authResponse(user, accessToken, refreshToken)
 	logger.Info("REGIS-003", "register success", response)
+	uc.recordSuccess(ctx, audit.EventUserRegister, response.User.ID, nil)
 
 	return response, nil
 }
@@ -67,40 +115,89 @@ func (uc *authUsecase) Login(ctx context.Context, req *LoginRequestDTO) (*AuthRe
 
 	// Check User By Email
 	user, err := uc.userUsecase.GetUserByEmail(ctx, req.Email)
-	if err != nil {
+	if err != nil || user == nil {
 		logger.Error("LOGIN-001", "get user email failed", err)
+		uc.recordFailure(ctx, audit.EventLogin, 0, "unknown email", audit.Metadata{"email": req.Email})
 		return nil, errs.ErrInvalidEmailOrPassword
 	}
 
 	// Check Password
 	if ok := security.VerifyPassword(user.Password, req.Password); !ok {
 		logger.Error("LOGIN-002", "verify password failed", err)
+		uc.recordFailure(ctx, audit.EventLogin, user.ID, "invalid password", nil)
 		return nil, errs.ErrInvalidEmailOrPassword
 	}
 
-	tokenUser := uc.tokenUser(user)
+	if !user.IsActive() {
+		logger.Error("LOGIN-008", "account is not active", errs.ErrAccountDisabled)
+		uc.recordFailure(ctx, audit.EventLogin, user.ID, "account "+user.Status, nil)
+		return nil, errs.ErrAccountDisabled
+	}
 
-	// Generate Token
-	accessToken, refreshToken, err := uc.generateToken(tokenUser)
+	tokenUser, err := uc.tokenUser(ctx, user)
 	if err != nil {
-		logger.Error("LOGIN-003", "generate token failed", err)
-		return nil, errs.ErrGenerateToken
+		logger.Error("LOGIN-007", "resolve roles failed", err)
+		return nil, err
 	}
 
-	// Save Refresh Token
-	err = uc.authRepo.SaveRefreshToken(ctx, &RefreshToken{
-		UserID:       user.ID,
-		RefreshToken: refreshToken,
-		ExpiresAt:    time.Now().Add(security.RefreshTokenDuration),
-	})
+	// Target Tenant
+	if req.TenantID != nil {
+		if err = uc.withTenant(ctx, tokenUser, *req.TenantID); err != nil {
+			logger.Error("LOGIN-006", "check tenant membership failed", err)
+			uc.recordFailure(ctx, audit.EventLogin, user.ID, "not a tenant member", audit.Metadata{"tenant_id": *req.TenantID})
+			return nil, errs.ErrNotOrgMember
+		}
+	}
+
+	// Start Session
+	accessToken, refreshToken, err := uc.startSession(ctx, tokenUser)
 	if err != nil {
-		logger.Error("LOGIN-004", "save refresh token failed", err)
-		return nil, errs.ErrSaveToken
+		logger.Error("LOGIN-003", "start session failed", err)
+		return nil, err
 	}
 
 	// Data Response
-	response := uc.authResponse(user, accessToken, refreshToken)
+	response, err := uc.authResponse(ctx, user, accessToken, refreshToken)
+	if err != nil {
+		return nil, err
+	}
 	logger.Info("LOGIN-005", "login success", response)
+	uc.recordSuccess(ctx, audit.EventLogin, user.ID, audit.Metadata{"tenant_id": tokenUser.TenantID})
+
+	return response, nil
+}
+
+// LoginWithIdentity starts a session for a user the identity provider
+// authenticated, the provider checked the credentials.
+func (uc *authUsecase) LoginWithIdentity(ctx context.Context, user *user.User, provider string) (*AuthResponseDTO, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	if !user.IsActive() {
+		logger.Error("LOGIN-009", "account is not active", errs.ErrAccountDisabled)
+		uc.recordFailure(ctx, audit.EventLogin, user.ID, "account "+user.Status, audit.Metadata{"provider": provider})
+		return nil, errs.ErrAccountDisabled
+	}
+
+	tokenUser, err := uc.tokenUser(ctx, user)
+	if err != nil {
+		logger.Error("LOGIN-010", "resolve roles failed", err)
+		return nil, err
+	}
+
+	// Start Session
+	accessToken, refreshToken, err := uc.startSession(ctx, tokenUser)
+	if err != nil {
+		logger.Error("LOGIN-011", "start session failed", err)
+		return nil, err
+	}
+
+	response, err := uc.authResponse(ctx, user, accessToken, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("LOGIN-013", "identity login success", map[string]any{"user_id": user.ID, "provider": provider})
+	uc.recordSuccess(ctx, audit.EventLogin, user.ID, audit.Metadata{"provider": provider})
 
 	return response, nil
 }
@@ -110,21 +207,51 @@ func (uc *authUsecase) RefreshToken(ctx context.Context, refreshToken string) (s
 	defer cancel()
 
 	// Verify Refresh Token
-	user, err := uc.tokenConfig.VerifyRefreshToken(refreshToken)
+	claims, err := uc.tokenConfig.VerifyRefreshToken(refreshToken)
 	if err != nil {
 		logger.Error("REFRESH-001", "verify token failed", err)
+		uc.recordFailure(ctx, audit.EventRefresh, 0, "invalid token", nil)
 		return "", "", errs.ErrInvalidToken
 	}
 
 	// Check Refresh Token in DB
-	valid := uc.authRepo.IsRefreshToken(ctx, refreshToken)
-	if !valid {
+	session, err := uc.authRepo.FindRefreshToken(ctx, refreshToken)
+	if err != nil || session == nil || session.UserID != claims.ID {
 		logger.Error("REFRESH-002", "check token failed", err)
+		uc.recordFailure(ctx, audit.EventRefresh, claims.ID, "unknown or expired token", nil)
 		return "", "", errs.ErrInvalidToken
 	}
 
-	// Generate New Access Token
-	newAccessToken, err := uc.tokenConfig.GenerateAccessToken(user)
+	// Roles and membership may have changed since the token was issued
+	found, err := uc.userUsecase.GetProfile(ctx, claims.ID)
+	if err != nil {
+		logger.Error("REFRESH-008", "get user failed", err)
+		return "", "", errs.ErrInvalidToken
+	}
+
+	if !found.IsActive() {
+		logger.Error("REFRESH-010", "account is not active", errs.ErrAccountDisabled)
+		uc.recordFailure(ctx, audit.EventRefresh, found.ID, "account "+found.Status, nil)
+		return "", "", errs.ErrAccountDisabled
+	}
+
+	user, err := uc.tokenUser(ctx, found)
+	if err != nil {
+		logger.Error("REFRESH-009", "resolve roles failed", err)
+		return "", "", err
+	}
+
+	if claims.TenantID != 0 {
+		if err = uc.withTenant(ctx, user, claims.TenantID); err != nil {
+			logger.Error("REFRESH-007", "check tenant membership failed", err)
+			uc.recordFailure(ctx, audit.EventRefresh, claims.ID, "not a tenant member", audit.Metadata{"tenant_id": claims.TenantID})
+			return "", "", errs.ErrNotOrgMember
+		}
+	}
+
+	// Generate New Access Token, the session stays the same
+	user.SessionID = session.ID
+	newAccessToken, err := uc.tokenConfig.GenerateAccessTokenFor(user, security.AccessTTLFromContext(ctx))
 	if err != nil {
 		logger.Error("REFRESH-003", "generate access token failed", err)
 		return "", "", errs.ErrGenerateToken
@@ -137,8 +264,8 @@ func (uc *authUsecase) RefreshToken(ctx context.Context, refreshToken string) (s
 		return "", "", errs.ErrGenerateToken
 	}
 
-	// Update New Refresh Token
-	err = uc.authRepo.UpdateRefreshToken(ctx, &RefreshToken{
+	// Rotate the presented token, the other sessions keep theirs
+	err = uc.authRepo.UpdateRefreshToken(ctx, refreshToken, &RefreshToken{
 		UserID:       user.ID,
 		RefreshToken: newRefreshToken,
 		ExpiresAt:    time.Now().Add(security.RefreshTokenDuration),
@@ -149,51 +276,370 @@ func (uc *authUsecase) RefreshToken(ctx context.Context, refreshToken string) (s
 	}
 
 	logger.Info("REFRESH-006", "refresh token success", nil)
+	uc.recordSuccess(ctx, audit.EventRefresh, user.ID, nil)
 	return newAccessToken, newRefreshToken, nil
 }
 
-func (uc *authUsecase) Logout(ctx context.Context, userID int64) error {
+func (uc *authUsecase) Logout(ctx context.Context, userID, sessionID int64) error {
 	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 
-	if err := uc.authRepo.DeleteRefreshToken(ctx, userID); err != nil {
+	rows, err := uc.authRepo.DeleteSession(ctx, userID, sessionID)
+	if err == nil && rows == 0 {
+		err = errors.New("session not found")
+	}
+	if err != nil {
 		logger.Error("LOGOUT-001", "delete token failed", err)
+		uc.recordFailure(ctx, audit.EventLogout, userID, err.Error(), nil)
 		return errs.ErrInvalidToken
 	}
 
-	logger.Info("LOGOUT-002", "logout success", nil)
+	logger.Info("LOGOUT-002", "logout success", map[string]any{"user_id": userID, "session_id": sessionID})
+	uc.recordSuccess(ctx, audit.EventLogout, userID, audit.Metadata{"session_id": sessionID})
 	return nil
 }
 
+// RevokeSessions signs the user out everywhere on behalf of an admin or an
+// account change. Having no session is not an error.
+func (uc *authUsecase) RevokeSessions(ctx context.Context, userID int64, reason string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := uc.authRepo.DeleteRefreshToken(ctx, userID, sessionsRevoked(userID, reason))
+	if err != nil {
+		logger.Error("REVOKE-001", "delete tokens failed", err)
+		return 0, err
+	}
+
+	logger.Info("REVOKE-002", "sessions revoked", map[string]any{
+		"user_id":  userID,
+		"sessions": rows,
+		"reason":   reason,
+	})
+	uc.recorder.Record(ctx, &audit.Event{
+		Type:       audit.EventLogout,
+		TargetID:   userID,
+		TargetType: audit.KindUser,
+		Outcome:    audit.OutcomeSuccess,
+		Metadata:   audit.Metadata{"reason": reason, "sessions": rows},
+	})
+	return rows, nil
+}
+
+// ListSessions returns the user's signed in sessions without their tokens.
+func (uc *authUsecase) ListSessions(ctx context.Context, userID, currentSessionID int64) ([]*SessionDTO, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	tokens, err := uc.authRepo.ListRefreshTokens(ctx, userID)
+	if err != nil {
+		logger.Error("SESSIONS-001", "list tokens failed", err)
+		return nil, err
+	}
+
+	sessions := make([]*SessionDTO, 0, len(tokens))
+	for _, token := range tokens {
+		sessions = append(sessions, &SessionDTO{
+			ID:        token.ID,
+			Current:   token.ID == currentSessionID,
+			CreatedAt: token.CreatedAt,
+			ExpiresAt: token.ExpiresAt,
+		})
+	}
+	return sessions, nil
+}
+
+// Impersonate lets an admin act as another user. The issued token is
+// short-lived, carries the admin in its "act" claim and has no refresh token.
+func (uc *authUsecase) Impersonate(ctx context.Context, actor *security.TokenUser, targetID int64, req *ImpersonateRequestDTO) (*ImpersonateResponseDTO, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	// No chained impersonation and no impersonating yourself
+	if actor.Type != security.PrincipalUser || actor.IsImpersonated() || actor.ID == targetID {
+		logger.Error("IMPERSONATE-001", "invalid actor", errs.ErrImpersonationNotAllowed)
+		uc.recordFailure(ctx, audit.EventImpersonate, targetID, "invalid actor", audit.Metadata{"reason": req.Reason})
+		return nil, errs.ErrImpersonationNotAllowed
+	}
+
+	target, err := uc.userUsecase.GetProfile(ctx, targetID)
+	if err != nil {
+		logger.Error("IMPERSONATE-002", "get target user failed", err)
+		return nil, err
+	}
+	if !target.IsActive() {
+		logger.Error("IMPERSONATE-007", "target account is not active", errs.ErrAccountDisabled)
+		return nil, errs.ErrAccountDisabled
+	}
+
+	targetUser, err := uc.tokenUser(ctx, target)
+	if err != nil {
+		logger.Error("IMPERSONATE-006", "resolve roles failed", err)
+		return nil, err
+	}
+
+	// Privileges can not be borrowed
+	if targetUser.Role != security.RoleUser {
+		logger.Error("IMPERSONATE-003", "target is privileged", errs.ErrImpersonationNotAllowed)
+		uc.recordFailure(ctx, audit.EventImpersonate, targetID, "target is privileged", audit.Metadata{"reason": req.Reason})
+		return nil, errs.ErrImpersonationNotAllowed
+	}
+
+	tokenActor := &security.TokenActor{ID: actor.ID, Email: actor.Email}
+
+	accessToken, err := uc.tokenConfig.GenerateImpersonationToken(targetUser, tokenActor)
+	if err != nil {
+		logger.Error("IMPERSONATE-004", "generate token failed", err)
+		return nil, errs.ErrGenerateToken
+	}
+
+	logger.Info("IMPERSONATE-005", "impersonation token issued", map[string]any{
+		"actor_id":  actor.ID,
+		"target_id": target.ID,
+		"reason":    req.Reason,
+	})
+	uc.recordSuccess(ctx, audit.EventImpersonate, target.ID, audit.Metadata{"reason": req.Reason})
+
+	return &ImpersonateResponseDTO{
+		User:        target,
+		Actor:       tokenActor,
+		AccessToken: accessToken,
+		ExpiresIn:   int64(security.ImpersonationTokenDuration.Seconds()),
+	}, nil
+}
+
+// SwitchTenant issues a new session bound to another organization of the user.
+func (uc *authUsecase) SwitchTenant(ctx context.Context, current *security.TokenUser, tenantID int64) (*AuthResponseDTO, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	user, err := uc.userUsecase.GetProfile(ctx, current.ID)
+	if err != nil {
+		logger.Error("SWITCH-001", "get user failed", err)
+		return nil, err
+	}
+
+	tokenUser, err := uc.tokenUser(ctx, user)
+	if err != nil {
+		logger.Error("SWITCH-006", "resolve roles failed", err)
+		return nil, err
+	}
+
+	if err = uc.withTenant(ctx, tokenUser, tenantID); err != nil {
+		logger.Error("SWITCH-002", "check tenant membership failed", err)
+		uc.recordFailure(ctx, audit.EventTenantSwitch, user.ID, "not a tenant member", audit.Metadata{"tenant_id": tenantID})
+		return nil, errs.ErrNotOrgMember
+	}
+
+	// Start Session
+	accessToken, refreshToken, err := uc.startSession(ctx, tokenUser)
+	if err != nil {
+		logger.Error("SWITCH-003", "start session failed", err)
+		return nil, err
+	}
+
+	response, err := uc.authResponse(ctx, user, accessToken, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("SWITCH-005", "switch tenant success", map[string]any{
+		"user_id":   user.ID,
+		"tenant_id": tenantID,
+	})
+	uc.recordSuccess(ctx, audit.EventTenantSwitch, user.ID, audit.Metadata{"tenant_id": tenantID})
+
+	return response, nil
+}
+
+// RegisterWithInvitation creates the account for the invited email, joins the
+// organization and starts a session bound to it.
+func (uc *authUsecase) RegisterWithInvitation(ctx context.Context, req *InvitationRegisterRequestDTO) (*AuthResponseDTO, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	invitation, err := uc.orgUsecase.GetInvitationByToken(ctx, req.Token)
+	if err != nil {
+		logger.Error("INVREG-001", "get invitation failed", err)
+		uc.recordFailure(ctx, audit.EventUserRegister, 0, err.Error(), audit.Metadata{"via": "invitation"})
+		return nil, err
+	}
+
+	var response *AuthResponseDTO
+	var membership *organization.Membership
+
+	// User, membership and session are created together or not at all
+	err = uc.tx.Do(ctx, func(ctx context.Context) error {
+		// Email comes from the invitation, the link proves ownership
+		user, err := uc.userUsecase.CreateUser(ctx, &user.CreateUserRequest{
+			Username:        req.Username,
+			Email:           invitation.Email,
+			Password:        req.Password,
+			ConfirmPassword: req.ConfirmPassword,
+			EmailVerified:   true,
+		})
+		if err != nil {
+			logger.Error("INVREG-002", "create user failed", err)
+			return err
+		}
+
+		membership, err = uc.orgUsecase.AcceptInvitation(ctx, req.Token, user.ID)
+		if err != nil {
+			logger.Error("INVREG-003", "accept invitation failed", err)
+			return err
+		}
+
+		tokenUser, err := uc.tokenUser(ctx, user)
+		if err != nil {
+			logger.Error("INVREG-007", "resolve roles failed", err)
+			return err
+		}
+		tokenUser.TenantID = membership.OrganizationID
+		tokenUser.TenantRole = membership.Role
+
+		// Start Session
+		accessToken, refreshToken, err := uc.startSession(ctx, tokenUser)
+		if err != nil {
+			logger.Error("INVREG-004", "start session failed", err)
+			return err
+		}
+
+		response, err = uc.authResponse(ctx, user, accessToken, refreshToken)
+		return err
+	})
+	if err != nil {
+		uc.recordFailure(ctx, audit.EventUserRegister, 0, err.Error(), audit.Metadata{"via": "invitation"})
+		return nil, err
+	}
+
+	logger.Info("INVREG-006", "register with invitation success", response)
+	uc.recordSuccess(ctx, audit.EventUserRegister, response.User.ID, audit.Metadata{
+		"via":             "invitation",
+		"organization_id": membership.OrganizationID,
+	})
+
+	return response, nil
+}
+
 // ------------- Private -------------
-func (uc *authUsecase) tokenUser(user *user.User) *security.TokenUser {
-	return &security.TokenUser{
-		ID:    user.ID,
-		Email: user.Email,
-		Role:  "user", // TODO: change later
+
+// recordSuccess stores an event about the user. Before a session exists the
+// user is also the actor.
+func (uc *authUsecase) recordSuccess(ctx context.Context, eventType string, userID int64, metadata audit.Metadata) {
+	event := &audit.Event{
+		Type:       eventType,
+		TargetID:   userID,
+		TargetType: audit.KindUser,
+		Outcome:    audit.OutcomeSuccess,
+		Metadata:   metadata,
+	}
+
+	if _, ok := security.UserFromContext(ctx); !ok {
+		event.ActorID = userID
+		event.ActorType = audit.KindUser
+	}
+
+	uc.recorder.Record(ctx, event)
+}
+
+func (uc *authUsecase) recordFailure(ctx context.Context, eventType string, userID int64, reason string, metadata audit.Metadata) {
+	event := &audit.Event{
+		Type:     eventType,
+		Outcome:  audit.OutcomeFailure,
+		Reason:   reason,
+		Metadata: metadata,
+	}
+
+	if userID != 0 {
+		event.TargetID = userID
+		event.TargetType = audit.KindUser
 	}
+
+	uc.recorder.Record(ctx, event)
 }
 
-func (uc *authUsecase) generateToken(user *security.TokenUser) (string, string, error) {
-	// Generate Access Token
-	accessToken, err := uc.tokenConfig.GenerateAccessToken(user)
+func (uc *authUsecase) withTenant(ctx context.Context, tokenUser *security.TokenUser, tenantID int64) error {
+	membership, err := uc.orgUsecase.GetMembership(ctx, tenantID, tokenUser.ID)
 	if err != nil {
-		return "", "", err
+		return err
 	}
 
-	// Generate Refresh Token
+	tokenUser.TenantID = membership.OrganizationID
+	tokenUser.TenantRole = membership.Role
+	return nil
+}
+
+// tokenUser resolves the effective roles, including those inherited through
+// groups, into the token claims.
+func (uc *authUsecase) tokenUser(ctx context.Context, user *user.User) (*security.TokenUser, error) {
+	roles, err := uc.groupUsecase.EffectiveRoles(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := uc.userUsecase.ProfileClaims(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &security.TokenUser{
+		ID:     user.ID,
+		Email:  user.Email,
+		Role:   security.PrimaryRole(roles),
+		Roles:  roles,
+		Type:   security.PrincipalUser,
+		Claims: claims,
+	}, nil
+}
+
+// startSession saves a new refresh token and issues the access token of its
+// session, with the lifetime the request asked for, see
+// security.ContextWithAccessTTL.
+func (uc *authUsecase) startSession(ctx context.Context, user *security.TokenUser) (string, string, error) {
 	refreshToken, err := uc.tokenConfig.GenerateRefreshToken(user)
 	if err != nil {
-		return "", "", err
+		logger.Error("SESSION-001", "generate refresh token failed", err)
+		return "", "", errs.ErrGenerateToken
+	}
+
+	session := &RefreshToken{
+		UserID:       user.ID,
+		RefreshToken: refreshToken,
+		ExpiresAt:    time.Now().Add(security.RefreshTokenDuration),
+	}
+	if err = uc.authRepo.SaveRefreshToken(ctx, session); err != nil {
+		logger.Error("SESSION-002", "save refresh token failed", err)
+		return "", "", errs.ErrSaveToken
+	}
+
+	// Logout ends the session the access token belongs to
+	user.SessionID = session.ID
+	accessToken, err := uc.tokenConfig.GenerateAccessTokenFor(user, security.AccessTTLFromContext(ctx))
+	if err != nil {
+		logger.Error("SESSION-003", "generate access token failed", err)
+		return "", "", errs.ErrGenerateToken
 	}
 
 	return accessToken, refreshToken, nil
 }
 
-func (uc *authUsecase) authResponse(user *user.User, accessToken, refreshToken string) *AuthResponseDTO {
+func sessionsRevoked(userID int64, reason string) *outbox.Event {
+	return outbox.NewEvent(outbox.AggregateUser, userID, webhook.EventSessionsRevoked, map[string]any{
+		"user_id": userID,
+		"reason":  reason,
+	})
+}
+
+// authResponse returns the user as its owner sees it, private attributes
+// stay out of the response.
+func (uc *authUsecase) authResponse(ctx context.Context, user *user.User, accessToken, refreshToken string) (*AuthResponseDTO, error) {
+	view, err := uc.userUsecase.OwnerView(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
 	return &AuthResponseDTO{
-		User:         user,
+		User:         view,
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
-	}
+	}, nil
 }
@@ -0,0 +1,87 @@
+package avatar
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/codepnw/go-authen-system/internal/middleware"
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+	"github.com/codepnw/go-authen-system/internal/utils/response"
+	"github.com/gin-gonic/gin"
+)
+
+// Room for the multipart headers around the file
+const multipartOverhead = 64 << 10
+
+type avatarHandler struct {
+	uc       AvatarUsecase
+	maxBytes int64
+}
+
+func NewAvatarHandler(uc AvatarUsecase, maxBytes int64) *avatarHandler {
+	return &avatarHandler{
+		uc:       uc,
+		maxBytes: maxBytes,
+	}
+}
+
+// UploadMine replaces the caller's avatar. The image is the request body, or
+// the "avatar" field of a multipart form.
+func (h *avatarHandler) UploadMine(c *gin.Context) {
+	current, ok := middleware.CurrentUser(c)
+	if !ok {
+		response.Unauthorized(c, errs.ErrInvalidToken)
+		return
+	}
+
+	data, err := h.read(c)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		response.RequestEntityTooLarge(c, errs.ErrAvatarTooLarge)
+		return
+	}
+	if err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	u, err := h.uc.Upload(c, current.ID, data)
+	switch {
+	case errors.Is(err, errs.ErrAvatarTooLarge):
+		response.RequestEntityTooLarge(c, err)
+	case errors.Is(err, errs.ErrAvatarType):
+		response.UnsupportedMediaType(c, err)
+	case errors.Is(err, errs.ErrInvalidAvatar):
+		response.BadRequest(c, "", err)
+	case errors.Is(err, errs.ErrAccountDeleted), errors.Is(err, errs.ErrVersionConflict):
+		response.Conflict(c, err)
+	case err != nil:
+		response.InternalServerError(c, err)
+	default:
+		c.Header("ETag", u.ETag())
+		response.Success(c, "avatar updated", u)
+	}
+}
+
+// read returns at most maxBytes+1 bytes, the usecase rejects larger files.
+func (h *avatarHandler) read(c *gin.Context) ([]byte, error) {
+	if !strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		return io.ReadAll(io.LimitReader(c.Request.Body, h.maxBytes+1))
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxBytes+multipartOverhead)
+	header, err := c.FormFile("avatar")
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(io.LimitReader(file, h.maxBytes+1))
+}
@@ -0,0 +1,151 @@
+package avatar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"slices"
+	"testing"
+
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+)
+
+func TestDecodeImageSniffsType(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		wantType string
+		wantErr  error
+	}{
+		{"jpeg", encodeTestImage(t, "jpeg"), "image/jpeg", nil},
+		{"png", encodeTestImage(t, "png"), "image/png", nil},
+		{"gif", encodeTestImage(t, "gif"), "image/gif", nil},
+		{"text", []byte("hello world"), "", errs.ErrAvatarType},
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), "", errs.ErrAvatarType},
+		{"html", []byte("<html><script>alert(1)</script></html>"), "", errs.ErrAvatarType},
+		{"broken png", append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 64)...), "", errs.ErrInvalidAvatar},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, contentType, err := decodeImage(tt.data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if contentType != tt.wantType {
+				t.Fatalf("type = %q, want %q", contentType, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestReencodeDropsMetadata(t *testing.T) {
+	// Orientation 6, the camera was turned a quarter clockwise
+	data := exifJPEG(t, 300, 200, 6)
+	if !slices.Contains(jpegMarkers(t, data), 0xE1) {
+		t.Fatal("test image has no APP1 segment")
+	}
+
+	img, contentType, err := decodeImage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w, h := img.Bounds().Dx(), img.Bounds().Dy(); w != 200 || h != 300 {
+		t.Fatalf("orientation not applied, image is %dx%d", w, h)
+	}
+
+	encoded, encodedType, err := encodeImage(img, contentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encodedType != "image/jpeg" {
+		t.Fatalf("encoded as %s", encodedType)
+	}
+
+	if slices.Contains(jpegMarkers(t, encoded), 0xE1) {
+		t.Fatal("APP1 segment survived re-encoding")
+	}
+	if bytes.Contains(encoded, []byte("Exif")) || bytes.Contains(encoded, []byte("GPS")) {
+		t.Fatal("EXIF data survived re-encoding")
+	}
+}
+
+func encodeTestImage(t *testing.T, format string) []byte {
+	t.Helper()
+
+	img := image.NewPaletted(image.Rect(0, 0, 32, 32), color.Palette{color.White, color.Black})
+	var buf bytes.Buffer
+	var err error
+
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "png":
+		err = png.Encode(&buf, img)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// exifJPEG returns a JPEG with an EXIF segment right after SOI holding the
+// orientation and a GPS marker string.
+func exifJPEG(t *testing.T, width, height int, orientation uint16) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	plain := buf.Bytes()
+
+	// Big endian TIFF header, IFD0 with the orientation as its only entry
+	tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, 1}
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3)
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	tiff = append(tiff, "GPS 52.3676N 4.9041E"...)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	out := append([]byte{}, plain[:2]...)
+	out = append(out, app1...)
+	return append(out, plain[2:]...)
+}
+
+// jpegMarkers lists the segment markers before the image data.
+func jpegMarkers(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		t.Fatal("not a JPEG")
+	}
+
+	var markers []byte
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			t.Fatalf("no marker at %d", i)
+		}
+		marker := data[i+1]
+		markers = append(markers, marker)
+		if marker == 0xDA {
+			break
+		}
+		i += 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+	}
+	return markers
+}
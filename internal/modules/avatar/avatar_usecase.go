@@ -0,0 +1,121 @@
+package avatar
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/codepnw/go-authen-system/config"
+	"github.com/codepnw/go-authen-system/internal/modules/user"
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+	"github.com/codepnw/go-authen-system/internal/utils/security"
+	"github.com/codepnw/go-authen-system/pkg/blob"
+	"github.com/codepnw/go-authen-system/pkg/logger"
+)
+
+// Resizing and storing every variant takes longer than a query
+const uploadTimeout = time.Second * 30
+
+type AvatarUsecase interface {
+	Upload(ctx context.Context, userID int64, data []byte) (*user.User, error)
+	// RemoveFiles deletes the stored files of the user's avatar and returns
+	// how many there were.
+	RemoveFiles(ctx context.Context, u *user.User) (int64, error)
+}
+
+type avatarUsecase struct {
+	store       blob.Store
+	userUsecase user.UserUsecase
+	maxBytes    int64
+}
+
+func NewAvatarUsecase(cfg *config.Config, store blob.Store, userUsecase user.UserUsecase) AvatarUsecase {
+	return &avatarUsecase{
+		store:       store,
+		userUsecase: userUsecase,
+		maxBytes:    cfg.AvatarMaxBytes,
+	}
+}
+
+// Upload stores the resized variants under a new key, so cached URLs of the
+// previous avatar never show the new one, then removes the previous files.
+func (uc *avatarUsecase) Upload(ctx context.Context, userID int64, data []byte) (*user.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, uploadTimeout)
+	defer cancel()
+
+	if int64(len(data)) > uc.maxBytes {
+		return nil, errs.ErrAvatarTooLarge
+	}
+
+	u, err := uc.userUsecase.GetProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if u.IsDeleted() {
+		return nil, errs.ErrAccountDeleted
+	}
+
+	img, contentType, err := decodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := security.RandomToken(8)
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("avatars/%d/%s", userID, nonce)
+
+	urls := make(user.AvatarVariants, len(variants))
+	for _, variant := range variants {
+		encoded, encodedType, err := encodeImage(squareThumbnail(img, variant.Size), contentType)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = uc.store.Put(ctx, key+"/"+variant.Name, encoded, encodedType); err != nil {
+			logger.Error("AVATAR-001", "store avatar failed", err)
+			uc.removeFiles(ctx, key)
+			return nil, err
+		}
+		urls[variant.Name] = uc.store.URL(key + "/" + variant.Name)
+	}
+
+	updated, err := uc.userUsecase.SetAvatar(ctx, userID, key, urls[variants[len(variants)-1].Name], urls)
+	if err != nil {
+		uc.removeFiles(ctx, key)
+		return nil, err
+	}
+
+	// The new avatar is saved, leftover files are only wasted space
+	if u.AvatarKey != "" {
+		if _, err = uc.removeFiles(ctx, u.AvatarKey); err != nil {
+			logger.Error("AVATAR-002", "remove previous avatar failed", err)
+		}
+	}
+
+	logger.Info("AVATAR-003", "avatar uploaded", map[string]any{
+		"user_id": userID,
+		"type":    contentType,
+		"bytes":   len(data),
+	})
+	return uc.userUsecase.OwnerView(ctx, updated)
+}
+
+func (uc *avatarUsecase) RemoveFiles(ctx context.Context, u *user.User) (int64, error) {
+	if u.AvatarKey == "" {
+		return 0, nil
+	}
+	return uc.removeFiles(ctx, u.AvatarKey)
+}
+
+func (uc *avatarUsecase) removeFiles(ctx context.Context, key string) (int64, error) {
+	var removed int64
+	for _, variant := range variants {
+		if err := uc.store.Delete(ctx, key+"/"+variant.Name); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
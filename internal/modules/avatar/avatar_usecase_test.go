@@ -0,0 +1,177 @@
+package avatar
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/codepnw/go-authen-system/config"
+	"github.com/codepnw/go-authen-system/internal/middleware"
+	"github.com/codepnw/go-authen-system/internal/modules/user"
+	"github.com/codepnw/go-authen-system/internal/storage/storagetest"
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+	"github.com/codepnw/go-authen-system/internal/utils/security"
+	"github.com/codepnw/go-authen-system/pkg/blob"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	testMaxBytes = 256 << 10
+	testBaseURL  = "https://auth.example.com/uploads"
+)
+
+func TestUpload(t *testing.T) {
+	dir, uc, u := setupUpload(t)
+	ctx := context.Background()
+
+	updated, err := uc.Upload(ctx, u.ID, exifJPEG(t, 600, 400, 6))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := storedFiles(t, dir)
+	if len(files) != len(variants) {
+		t.Fatalf("stored %d files, want %d variants", len(files), len(variants))
+	}
+	for key, data := range files {
+		if contentType := http.DetectContentType(data); contentType != "image/jpeg" {
+			t.Fatalf("%s stored as %s", key, contentType)
+		}
+		if slices.Contains(jpegMarkers(t, data), 0xE1) || bytes.Contains(data, []byte("GPS")) {
+			t.Fatalf("%s keeps the EXIF segment", key)
+		}
+	}
+	if !strings.HasPrefix(updated.AvatarURL, testBaseURL+"/avatars/") {
+		t.Fatalf("avatar_url = %s", updated.AvatarURL)
+	}
+
+	// A new upload replaces the files of the previous one
+	if _, err = uc.Upload(ctx, u.ID, encodeTestImage(t, "png")); err != nil {
+		t.Fatal(err)
+	}
+	for key, data := range storedFiles(t, dir) {
+		if _, ok := files[key]; ok {
+			t.Fatalf("previous file %s not removed", key)
+		}
+		if contentType := http.DetectContentType(data); contentType != "image/png" {
+			t.Fatalf("%s stored as %s", key, contentType)
+		}
+	}
+}
+
+func TestUploadRejects(t *testing.T) {
+	dir, uc, u := setupUpload(t)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{"not an image", []byte("<html><body>hello</body></html>"), errs.ErrAvatarType},
+		{"too large", make([]byte, testMaxBytes+1), errs.ErrAvatarTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := uc.Upload(context.Background(), u.ID, tt.data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if len(storedFiles(t, dir)) != 0 {
+				t.Fatal("rejected upload reached the store")
+			}
+		})
+	}
+}
+
+func TestUploadMineSizeLimit(t *testing.T) {
+	_, uc, u := setupUpload(t)
+
+	r := gin.New()
+	r.PUT("/avatar", func(c *gin.Context) {
+		c.Set(middleware.UserContextKey, &security.TokenUser{ID: u.ID, Type: security.PrincipalUser})
+	}, NewAvatarHandler(uc, testMaxBytes).UploadMine)
+
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	fw, _ := mw.CreateFormFile("avatar", "avatar.png")
+	fw.Write(make([]byte, 2*testMaxBytes))
+	mw.Close()
+
+	tests := []struct {
+		name        string
+		body        []byte
+		contentType string
+		want        int
+	}{
+		{"raw", make([]byte, testMaxBytes+1), "image/png", http.StatusRequestEntityTooLarge},
+		{"multipart", form.Bytes(), mw.FormDataContentType(), http.StatusRequestEntityTooLarge},
+		{"not an image", []byte("hello world"), "image/png", http.StatusUnsupportedMediaType},
+		{"image", encodeTestImage(t, "gif"), "image/gif", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/avatar", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func setupUpload(t *testing.T) (string, AvatarUsecase, *user.User) {
+	t.Helper()
+
+	cfg := &config.Config{AvatarMaxBytes: testMaxBytes}
+	env := storagetest.Setup(t, cfg)
+
+	u, err := env.Users.CreateUser(context.Background(), &user.CreateUserRequest{
+		Username:        "alice",
+		Email:           "alice@example.com",
+		Password:        "password1",
+		ConfirmPassword: "password1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	return dir, NewAvatarUsecase(cfg, blob.NewLocalStore(dir, testBaseURL), env.Users), u
+}
+
+// storedFiles reads every file of the store in dir by key.
+func storedFiles(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+
+	files := map[string][]byte{}
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		key, _ := filepath.Rel(dir, name)
+		files[filepath.ToSlash(key)] = data
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
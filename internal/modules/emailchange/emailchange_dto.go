@@ -0,0 +1,9 @@
+package emailchange
+
+type ChangeEmailRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type TokenRequest struct {
+	Token string `json:"token" validate:"required"`
+}
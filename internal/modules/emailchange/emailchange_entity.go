@@ -0,0 +1,35 @@
+package emailchange
+
+import "time"
+
+// Email change states
+const (
+	StatusPending    = "pending"
+	StatusConfirmed  = "confirmed"
+	StatusCancelled  = "cancelled"
+	StatusSuperseded = "superseded"
+)
+
+// EmailChange holds a new address until it is confirmed. Nonce is embedded
+// in both the confirm and the cancel token, a newer request supersedes it.
+type EmailChange struct {
+	ID          int64      `json:"id" gorm:"primaryKey"`
+	UserID      int64      `json:"user_id" gorm:"not null;index"`
+	OldEmail    string     `json:"old_email" gorm:"not null"`
+	NewEmail    string     `json:"new_email" gorm:"not null"`
+	Status      string     `json:"status" gorm:"not null;default:pending"`
+	RequestedBy int64      `json:"requested_by,omitempty"`
+	Nonce       string     `json:"-" gorm:"not null"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	ConfirmedAt *time.Time `json:"confirmed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   *time.Time `json:"updated_at"`
+}
+
+func (EmailChange) TableName() string {
+	return "email_changes"
+}
+
+func (e *EmailChange) IsExpired() bool {
+	return time.Now().After(e.ExpiresAt)
+}
@@ -0,0 +1,144 @@
+package emailchange
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/codepnw/go-authen-system/internal/middleware"
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+	"github.com/codepnw/go-authen-system/internal/utils/response"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type emailChangeHandler struct {
+	validate *validator.Validate
+	uc       EmailChangeUsecase
+}
+
+func NewEmailChangeHandler(uc EmailChangeUsecase) *emailChangeHandler {
+	return &emailChangeHandler{
+		validate: validator.New(),
+		uc:       uc,
+	}
+}
+
+// RequestMine starts a change of the caller's email.
+func (h *emailChangeHandler) RequestMine(c *gin.Context) {
+	current, ok := middleware.CurrentUser(c)
+	if !ok {
+		response.Unauthorized(c, errs.ErrInvalidToken)
+		return
+	}
+
+	h.request(c, current.ID)
+}
+
+// GetMine returns the caller's pending email change, if any.
+func (h *emailChangeHandler) GetMine(c *gin.Context) {
+	current, ok := middleware.CurrentUser(c)
+	if !ok {
+		response.Unauthorized(c, errs.ErrInvalidToken)
+		return
+	}
+
+	change, err := h.uc.GetPending(c, current.ID)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, "", change)
+}
+
+// Request lets an admin start a change, it is confirmed by the user all the same.
+func (h *emailChangeHandler) Request(c *gin.Context) {
+	id, err := getIntParamID(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid id", err)
+		return
+	}
+
+	h.request(c, id)
+}
+
+func (h *emailChangeHandler) Confirm(c *gin.Context) {
+	req := new(TokenRequest)
+
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	user, err := h.uc.Confirm(c, req.Token)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response.Success(c, "email changed", user)
+}
+
+func (h *emailChangeHandler) Cancel(c *gin.Context) {
+	req := new(TokenRequest)
+
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.uc.Cancel(c, req.Token); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response.Success(c, "email change cancelled", nil)
+}
+
+func (h *emailChangeHandler) request(c *gin.Context, userID int64) {
+	req := new(ChangeEmailRequest)
+
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	change, err := h.uc.Request(c, userID, req)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "confirmation sent to the new email", "data": change})
+}
+
+func handleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errs.ErrInvalidEmailLink), errors.Is(err, errs.ErrEmailUnchanged):
+		response.BadRequest(c, "", err)
+	case errors.Is(err, errs.ErrEmailTaken), errors.Is(err, errs.ErrAccountDeleted):
+		response.Conflict(c, err)
+	default:
+		response.InternalServerError(c, err)
+	}
+}
+
+func getIntParamID(key string) (int64, error) {
+	return strconv.ParseInt(key, 10, 64)
+}
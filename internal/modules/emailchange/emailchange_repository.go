@@ -0,0 +1,78 @@
+package emailchange
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/codepnw/go-authen-system/internal/utils/transaction"
+	"gorm.io/gorm"
+)
+
+type EmailChangeRepository interface {
+	Create(ctx context.Context, input *EmailChange) error
+	FindByID(ctx context.Context, id int64) (*EmailChange, error)
+	FindPending(ctx context.Context, userID int64) (*EmailChange, error)
+	Update(ctx context.Context, input *EmailChange) error
+	// SupersedePending retires the pending changes of the user, their links
+	// stop working.
+	SupersedePending(ctx context.Context, userID int64) (int64, error)
+}
+
+type emailChangeRepository struct {
+	db *gorm.DB
+}
+
+func NewEmailChangeRepository(db *gorm.DB) EmailChangeRepository {
+	return &emailChangeRepository{db: db}
+}
+
+func (r *emailChangeRepository) Create(ctx context.Context, input *EmailChange) error {
+	return transaction.DB(ctx, r.db).Create(input).Error
+}
+
+func (r *emailChangeRepository) FindByID(ctx context.Context, id int64) (change *EmailChange, err error) {
+	err = transaction.DB(ctx, r.db).First(&change, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+func (r *emailChangeRepository) FindPending(ctx context.Context, userID int64) (change *EmailChange, err error) {
+	err = transaction.DB(ctx, r.db).
+		Order("id DESC").
+		First(&change, "user_id = ? AND status = ?", userID, StatusPending).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+func (r *emailChangeRepository) Update(ctx context.Context, input *EmailChange) error {
+	res := transaction.DB(ctx, r.db).Save(input)
+	if res.Error != nil {
+		return res.Error
+	}
+
+	rows := res.RowsAffected
+	if rows == 0 {
+		return errors.New("email change not found")
+	}
+
+	return nil
+}
+
+func (r *emailChangeRepository) SupersedePending(ctx context.Context, userID int64) (int64, error) {
+	res := transaction.DB(ctx, r.db).
+		Model(&EmailChange{}).
+		Where("user_id = ? AND status = ?", userID, StatusPending).
+		Updates(map[string]any{"status": StatusSuperseded, "updated_at": time.Now()})
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	return res.RowsAffected, nil
+}
@@ -0,0 +1,272 @@
+package emailchange
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/codepnw/go-authen-system/config"
+	"github.com/codepnw/go-authen-system/internal/modules/audit"
+	"github.com/codepnw/go-authen-system/internal/modules/user"
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+	"github.com/codepnw/go-authen-system/internal/utils/security"
+	"github.com/codepnw/go-authen-system/pkg/logger"
+	"github.com/codepnw/go-authen-system/pkg/mailer"
+)
+
+const (
+	queryTimeout        = time.Second * 5
+	emailChangeDuration = time.Hour * 24
+)
+
+type EmailChangeUsecase interface {
+	Request(ctx context.Context, userID int64, req *ChangeEmailRequest) (*EmailChange, error)
+	GetPending(ctx context.Context, userID int64) (*EmailChange, error)
+	Confirm(ctx context.Context, token string) (*user.User, error)
+	Cancel(ctx context.Context, token string) error
+}
+
+type emailChangeUsecase struct {
+	repo        EmailChangeRepository
+	userUsecase user.UserUsecase
+	mailer      mailer.Mailer
+	recorder    audit.Recorder
+	tokenConfig *security.TokenConfig
+	baseURL     string
+}
+
+func NewEmailChangeUsecase(cfg *config.Config, repo EmailChangeRepository, userUsecase user.UserUsecase, mail mailer.Mailer, recorder audit.Recorder) EmailChangeUsecase {
+	return &emailChangeUsecase{
+		repo:        repo,
+		userUsecase: userUsecase,
+		mailer:      mail,
+		recorder:    recorder,
+		tokenConfig: security.NewJWTToken(cfg),
+		baseURL:     strings.TrimRight(cfg.AppBaseURL, "/"),
+	}
+}
+
+// Request starts a change to a new address. The confirm link goes to the
+// new address and a notice with a cancel link to the current one. Earlier
+// pending changes of the user stop working.
+func (uc *emailChangeUsecase) Request(ctx context.Context, userID int64, req *ChangeEmailRequest) (*EmailChange, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	u, err := uc.userUsecase.GetProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if u.IsDeleted() {
+		return nil, errs.ErrAccountDeleted
+	}
+
+	email := strings.TrimSpace(req.Email)
+	if strings.EqualFold(email, u.Email) {
+		return nil, errs.ErrEmailUnchanged
+	}
+
+	taken, err := uc.userUsecase.GetUserByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if taken != nil {
+		return nil, errs.ErrEmailTaken
+	}
+
+	nonce, err := security.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = uc.repo.SupersedePending(ctx, u.ID); err != nil {
+		logger.Error("EMAIL-CHANGE-001", "supersede email changes failed", err)
+		return nil, err
+	}
+
+	change := &EmailChange{
+		UserID:    u.ID,
+		OldEmail:  u.Email,
+		NewEmail:  email,
+		Status:    StatusPending,
+		Nonce:     nonce,
+		ExpiresAt: time.Now().Add(emailChangeDuration),
+	}
+	if actor, ok := security.UserFromContext(ctx); ok && actor.Type == security.PrincipalUser {
+		change.RequestedBy = actor.ID
+		if actor.IsImpersonated() {
+			change.RequestedBy = actor.Actor.ID
+		}
+	}
+
+	if err = uc.repo.Create(ctx, change); err != nil {
+		logger.Error("EMAIL-CHANGE-002", "create email change failed", err)
+		return nil, err
+	}
+
+	// Delivery problems should not lose the change, it can be requested again
+	if err = uc.sendConfirmation(ctx, change); err != nil {
+		logger.Error("EMAIL-CHANGE-003", "send email change confirmation failed", err)
+	}
+	if err = uc.sendNotice(ctx, change); err != nil {
+		logger.Error("EMAIL-CHANGE-004", "send email change notice failed", err)
+	}
+
+	uc.record(ctx, change, "request")
+	return change, nil
+}
+
+func (uc *emailChangeUsecase) GetPending(ctx context.Context, userID int64) (*EmailChange, error) {
+	return uc.repo.FindPending(ctx, userID)
+}
+
+// Confirm swaps in the new address. A change whose account moved to another
+// address in the meantime is superseded instead.
+func (uc *emailChangeUsecase) Confirm(ctx context.Context, token string) (*user.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	change, err := uc.findByToken(ctx, token, security.PurposeEmailChange)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := uc.userUsecase.GetProfile(ctx, change.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if u.Email != change.OldEmail {
+		if err = uc.finish(ctx, change, StatusSuperseded); err != nil {
+			return nil, err
+		}
+		return nil, errs.ErrInvalidEmailLink
+	}
+
+	u, err = uc.userUsecase.ChangeEmail(ctx, change.UserID, change.NewEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	change.ConfirmedAt = &now
+	if err = uc.finish(ctx, change, StatusConfirmed); err != nil {
+		return nil, err
+	}
+
+	uc.record(ctx, change, "confirm")
+	return uc.userUsecase.OwnerView(ctx, u)
+}
+
+// Cancel drops a pending change from the link sent to the current address.
+func (uc *emailChangeUsecase) Cancel(ctx context.Context, token string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	change, err := uc.findByToken(ctx, token, security.PurposeEmailChangeCancel)
+	if err != nil {
+		return err
+	}
+
+	if err = uc.finish(ctx, change, StatusCancelled); err != nil {
+		return err
+	}
+
+	uc.record(ctx, change, "cancel")
+	return nil
+}
+
+// ------------- Private -------------
+func (uc *emailChangeUsecase) findByToken(ctx context.Context, token, purpose string) (*EmailChange, error) {
+	action, err := uc.tokenConfig.VerifyActionToken(token, purpose)
+	if err != nil {
+		return nil, errs.ErrInvalidEmailLink
+	}
+
+	change, err := uc.repo.FindByID(ctx, action.Subject)
+	if err != nil {
+		return nil, errs.ErrInvalidEmailLink
+	}
+
+	if change.Nonce != action.Nonce || change.Status != StatusPending || change.IsExpired() {
+		return nil, errs.ErrInvalidEmailLink
+	}
+
+	return change, nil
+}
+
+func (uc *emailChangeUsecase) finish(ctx context.Context, change *EmailChange, status string) error {
+	now := time.Now()
+	change.Status = status
+	change.UpdatedAt = &now
+
+	if err := uc.repo.Update(ctx, change); err != nil {
+		logger.Error("EMAIL-CHANGE-005", "update email change failed", err)
+		return err
+	}
+	return nil
+}
+
+// record leaves the addresses out, the audit log outlives them.
+func (uc *emailChangeUsecase) record(ctx context.Context, change *EmailChange, action string) {
+	logger.Info("EMAIL-CHANGE-006", "email change "+action, map[string]any{
+		"change_id": change.ID,
+		"user_id":   change.UserID,
+		"status":    change.Status,
+	})
+	uc.recorder.Record(ctx, &audit.Event{
+		Type:       audit.EventEmailChange,
+		TargetID:   change.UserID,
+		TargetType: audit.KindUser,
+		Outcome:    audit.OutcomeSuccess,
+		Metadata:   audit.Metadata{"action": action, "change_id": change.ID},
+	})
+}
+
+func (uc *emailChangeUsecase) sendConfirmation(ctx context.Context, change *EmailChange) error {
+	link, err := uc.link(change, security.PurposeEmailChange, "confirm")
+	if err != nil {
+		return err
+	}
+
+	return uc.mailer.Send(ctx, &mailer.Message{
+		To:      change.NewEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf(
+			"A change of your account email to this address was requested.\n\nConfirm the change here:\n%s\n\nThis link expires on %s. If you did not ask for it, ignore this email.",
+			link,
+			change.ExpiresAt.Format(time.RFC1123),
+		),
+	})
+}
+
+func (uc *emailChangeUsecase) sendNotice(ctx context.Context, change *EmailChange) error {
+	link, err := uc.link(change, security.PurposeEmailChangeCancel, "cancel")
+	if err != nil {
+		return err
+	}
+
+	return uc.mailer.Send(ctx, &mailer.Message{
+		To:      change.OldEmail,
+		Subject: "Your email address is about to change",
+		Body: fmt.Sprintf(
+			"A change of your account email to %s was requested. It takes effect once the new address is confirmed.\n\nIf you did not ask for it, cancel the change here and change your password:\n%s",
+			change.NewEmail,
+			link,
+		),
+	})
+}
+
+func (uc *emailChangeUsecase) link(change *EmailChange, purpose, path string) (string, error) {
+	token, err := uc.tokenConfig.GenerateActionToken(&security.ActionToken{
+		Purpose: purpose,
+		Subject: change.ID,
+		Nonce:   change.Nonce,
+	}, time.Until(change.ExpiresAt))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s/email-change/%s?token=%s", uc.baseURL, path, url.QueryEscape(token)), nil
+}
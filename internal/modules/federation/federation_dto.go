@@ -0,0 +1,44 @@
+package federation
+
+import "github.com/codepnw/go-authen-system/internal/modules/auth"
+
+// CallbackRequest is the provider's redirect back to the callback.
+type CallbackRequest struct {
+	Code             string `form:"code"`
+	State            string `form:"state"`
+	Error            string `form:"error"`
+	ErrorDescription string `form:"error_description"`
+}
+
+// CallbackResult is the session of the signed in user, or the identity a
+// signed in user linked, and the page the flow started from.
+type CallbackResult struct {
+	Auth     *auth.AuthResponseDTO
+	Identity *Identity
+	Next     string
+}
+
+// LinkRequest starts linking a provider account. Accounts with a password
+// confirm it, others must have signed in through a linked provider a moment
+// ago.
+type LinkRequest struct {
+	Password string `json:"password"`
+	Next     string `json:"next"`
+}
+
+// UnlinkRequest confirms removing a linked identity the way LinkRequest
+// does.
+type UnlinkRequest struct {
+	Password string `json:"password"`
+}
+
+// LinkResponseDTO is where the browser goes to sign in at the provider.
+type LinkResponseDTO struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// LoginMethodsDTO lists the ways a user can sign in.
+type LoginMethodsDTO struct {
+	Password   bool        `json:"password"`
+	Identities []*Identity `json:"identities"`
+}
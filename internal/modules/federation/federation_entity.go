@@ -0,0 +1,21 @@
+package federation
+
+import "time"
+
+// Identity links an account of an upstream identity provider to a user.
+// Subject is the provider's stable ID of the account, Email the address
+// the provider reported at the last sign in.
+type Identity struct {
+	ID          int64      `json:"id" gorm:"primaryKey"`
+	UserID      int64      `json:"user_id" gorm:"not null;index"`
+	Provider    string     `json:"provider" gorm:"not null"`
+	Subject     string     `json:"subject" gorm:"not null"`
+	Email       string     `json:"email,omitempty" gorm:"not null;default:''"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   *time.Time `json:"updated_at"`
+}
+
+func (Identity) TableName() string {
+	return "user_identities"
+}
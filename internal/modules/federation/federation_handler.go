@@ -0,0 +1,240 @@
+package federation
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codepnw/go-authen-system/config"
+	"github.com/codepnw/go-authen-system/internal/middleware"
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+	"github.com/codepnw/go-authen-system/internal/utils/response"
+	"github.com/codepnw/go-authen-system/internal/utils/security"
+	"github.com/gin-gonic/gin"
+)
+
+// The state cookie only reaches the sign in endpoints. It must survive the
+// cross-site redirect back from the provider, so it is SameSite=Lax.
+const (
+	StateCookie     = "oauth_state"
+	StateCookiePath = "/auth/oauth"
+)
+
+type federationHandler struct {
+	cfg *config.Config
+	uc  FederationUsecase
+}
+
+func NewFederationHandler(cfg *config.Config, uc FederationUsecase) *federationHandler {
+	return &federationHandler{cfg: cfg, uc: uc}
+}
+
+// Providers lists the names of the providers users can sign in with.
+func (h *federationHandler) Providers(c *gin.Context) {
+	response.Success(c, "", h.uc.Providers())
+}
+
+// Start redirects to the provider's sign in page. The optional next query
+// is the local page to return to with browser sessions.
+func (h *federationHandler) Start(c *gin.Context) {
+	authURL, stateToken, err := h.uc.Start(c, c.Param("provider"), safeNext(c.Query("next")))
+	if err != nil {
+		h.error(c, err)
+		return
+	}
+
+	h.setStateCookie(c, stateToken, stateDuration)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback finishes the sign in. Browser sessions get their cookies and go
+// on to the next page, API clients get the tokens.
+func (h *federationHandler) Callback(c *gin.Context) {
+	req := new(CallbackRequest)
+
+	if err := c.ShouldBindQuery(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	// The state is single use
+	stateToken, _ := c.Cookie(StateCookie)
+	h.setStateCookie(c, "", -1)
+
+	if h.cfg.SessionCookies {
+		c.Request = c.Request.WithContext(security.ContextWithAccessTTL(c.Request.Context(), h.cfg.SessionAccessTTL))
+	}
+
+	result, err := h.uc.Callback(c, c.Param("provider"), stateToken, req)
+	if err != nil {
+		h.error(c, err)
+		return
+	}
+
+	if result.Auth == nil {
+		h.linked(c, result)
+		return
+	}
+
+	if !h.cfg.SessionCookies {
+		response.Success(c, "", result.Auth)
+		return
+	}
+
+	csrfToken, err := security.CSRFToken(h.cfg.JWTSecretKey, result.Auth.User.ID)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	middleware.SetSessionCookies(c, h.cfg, &middleware.SessionTokens{
+		AccessToken:  result.Auth.AccessToken,
+		RefreshToken: result.Auth.RefreshToken,
+		CSRFToken:    csrfToken,
+	})
+
+	c.Redirect(http.StatusSeeOther, h.next(result))
+}
+
+// ListMine returns the ways the caller can sign in.
+func (h *federationHandler) ListMine(c *gin.Context) {
+	current, ok := middleware.CurrentUser(c)
+	if !ok {
+		response.Unauthorized(c, errs.ErrInvalidToken)
+		return
+	}
+
+	methods, err := h.uc.ListLoginMethods(c, current.ID)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, "", methods)
+}
+
+// LinkMine starts linking a provider account to the caller. The browser
+// follows the returned URL, the state cookie set here must come along.
+func (h *federationHandler) LinkMine(c *gin.Context) {
+	current, ok := middleware.CurrentUser(c)
+	if !ok {
+		response.Unauthorized(c, errs.ErrInvalidToken)
+		return
+	}
+
+	req := new(LinkRequest)
+
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+	req.Next = safeNext(req.Next)
+
+	authURL, stateToken, err := h.uc.StartLink(c, current.ID, c.Param("provider"), req)
+	if err != nil {
+		h.error(c, err)
+		return
+	}
+
+	h.setStateCookie(c, stateToken, stateDuration)
+	response.Success(c, "", &LinkResponseDTO{AuthorizationURL: authURL})
+}
+
+// UnlinkMine removes one of the caller's identities. Like LinkMine it needs
+// the password, or a recent provider sign in.
+func (h *federationHandler) UnlinkMine(c *gin.Context) {
+	current, ok := middleware.CurrentUser(c)
+	if !ok {
+		response.Unauthorized(c, errs.ErrInvalidToken)
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "invalid id", err)
+		return
+	}
+
+	req := new(UnlinkRequest)
+
+	if err = c.ShouldBindJSON(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err = h.uc.Unlink(c, current.ID, id, req); err != nil {
+		h.error(c, err)
+		return
+	}
+
+	response.Success(c, "identity unlinked", nil)
+}
+
+// linked finishes a link flow. The session is unchanged, browsers go back
+// to where they started.
+func (h *federationHandler) linked(c *gin.Context, result *CallbackResult) {
+	if !h.cfg.SessionCookies {
+		response.Success(c, "identity linked", result.Identity)
+		return
+	}
+	c.Redirect(http.StatusSeeOther, h.next(result))
+}
+
+func (h *federationHandler) next(result *CallbackResult) string {
+	if result.Next != "" {
+		return result.Next
+	}
+	// The hosted pages start at the account page
+	if h.cfg.WebEnabled {
+		return "/account"
+	}
+	return "/"
+}
+
+func (h *federationHandler) error(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errs.ErrUnknownProvider),
+		errors.Is(err, errs.ErrInvalidOAuthState),
+		errors.Is(err, errs.ErrIdentityLinked),
+		errors.Is(err, errs.ErrLastLoginMethod):
+		response.BadRequest(c, "", err)
+	case errors.Is(err, errs.ErrProviderSignIn):
+		response.Unauthorized(c, err)
+	case errors.Is(err, errs.ErrIdentityNotLinked),
+		errors.Is(err, errs.ErrIdentityEmailTaken),
+		errors.Is(err, errs.ErrReauthRequired),
+		errors.Is(err, errs.ErrAccountDisabled),
+		errors.Is(err, errs.ErrNotOrgMember):
+		response.Forbidden(c, err)
+	case errors.Is(err, errs.ErrIdentityNotFound):
+		response.NotFound(c, err)
+	default:
+		response.InternalServerError(c, err)
+	}
+}
+
+func (h *federationHandler) setStateCookie(c *gin.Context, value string, maxAge time.Duration) {
+	cookie := &http.Cookie{
+		Name:     StateCookie,
+		Value:    value,
+		Path:     StateCookiePath,
+		MaxAge:   int(maxAge / time.Second),
+		Secure:   h.cfg.SessionSecure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(c.Writer, cookie)
+}
+
+// safeNext keeps redirects on this site, anything else is dropped.
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return ""
+	}
+	return next
+}
@@ -0,0 +1,523 @@
+package federation
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codepnw/go-authen-system/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Provider responses larger than this are refused
+const maxResponseSize = 1 << 20
+
+// A key set is fetched again for an unknown key ID at most this often
+const keysRefetchInterval = time.Minute
+
+// Defaults of the "github" provider type
+const (
+	githubAuthURL     = "https://github.com/login/oauth/authorize"
+	githubTokenURL    = "https://github.com/login/oauth/access_token"
+	githubUserInfoURL = "https://api.github.com/user"
+)
+
+var (
+	oidcScopes   = []string{"openid", "email", "profile"}
+	githubScopes = []string{"read:user", "user:email"}
+)
+
+// ExternalIdentity is what the provider tells about the signed in account.
+type ExternalIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Username      string
+	Picture       string
+}
+
+// authRequest carries the values that bind a callback to its redirect.
+type authRequest struct {
+	RedirectURI string
+	State       string
+	Nonce       string
+	Challenge   string
+	Verifier    string
+}
+
+type provider interface {
+	// authURL is where the user signs in at the provider.
+	authURL(ctx context.Context, req *authRequest) (string, error)
+	// exchange redeems the authorization code for the user's identity.
+	exchange(ctx context.Context, req *authRequest, code string) (*ExternalIdentity, error)
+}
+
+func newProvider(cfg config.OAuthProvider, client *http.Client) provider {
+	if cfg.Type == "github" {
+		return &githubProvider{cfg: cfg, client: client}
+	}
+	return &oidcProvider{cfg: cfg, client: client}
+}
+
+// ------------- OpenID Connect -------------
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcClaims struct {
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     any    `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	Picture           string `json:"picture"`
+	jwt.RegisteredClaims
+}
+
+// oidcProvider reads its endpoints from the discovery document of the
+// issuer and checks ID tokens against the issuer's published keys.
+type oidcProvider struct {
+	cfg    config.OAuthProvider
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *discoveryDocument
+	keys      map[string]any
+	keysAt    time.Time
+}
+
+func (p *oidcProvider) authURL(ctx context.Context, req *authRequest) (string, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return buildAuthURL(doc.AuthorizationEndpoint, url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {req.RedirectURI},
+		"scope":                 {scopes(p.cfg.Scopes, oidcScopes)},
+		"state":                 {req.State},
+		"nonce":                 {req.Nonce},
+		"code_challenge":        {req.Challenge},
+		"code_challenge_method": {"S256"},
+	})
+}
+
+func (p *oidcProvider) exchange(ctx context.Context, req *authRequest, code string) (*ExternalIdentity, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := redeemCode(ctx, p.client, doc.TokenEndpoint, p.cfg, req, code)
+	if err != nil {
+		return nil, err
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	claims := new(oidcClaims)
+	_, err = jwt.ParseWithClaims(tokens.IDToken, claims, p.keyFunc(ctx),
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384"}),
+		jwt.WithIssuer(doc.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+	if claims.Subject == "" || claims.Nonce != req.Nonce {
+		return nil, errors.New("invalid id_token: subject or nonce mismatch")
+	}
+
+	identity := &ExternalIdentity{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: isTrue(claims.EmailVerified),
+		Name:          claims.Name,
+		Username:      claims.PreferredUsername,
+		Picture:       claims.Picture,
+	}
+
+	// Some providers keep the email out of the ID token
+	if identity.Email == "" && doc.UserInfoEndpoint != "" && tokens.AccessToken != "" {
+		info := new(oidcClaims)
+		if err = getJSON(ctx, p.client, doc.UserInfoEndpoint, tokens.AccessToken, info); err != nil {
+			return nil, err
+		}
+		if info.Subject != claims.Subject {
+			return nil, errors.New("userinfo subject mismatch")
+		}
+		identity.Email = info.Email
+		identity.EmailVerified = isTrue(info.EmailVerified)
+	}
+
+	return identity, nil
+}
+
+// discover fetches the discovery document once, configured endpoints
+// take precedence over it.
+func (p *oidcProvider) discover(ctx context.Context) (*discoveryDocument, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	doc := new(discoveryDocument)
+	issuer := strings.TrimRight(p.cfg.Issuer, "/")
+	if err := getJSON(ctx, p.client, issuer+"/.well-known/openid-configuration", "", doc); err != nil {
+		return nil, fmt.Errorf("discovery failed: %w", err)
+	}
+	if strings.TrimRight(doc.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("discovery issuer %q does not match %q", doc.Issuer, p.cfg.Issuer)
+	}
+
+	if p.cfg.AuthURL != "" {
+		doc.AuthorizationEndpoint = p.cfg.AuthURL
+	}
+	if p.cfg.TokenURL != "" {
+		doc.TokenEndpoint = p.cfg.TokenURL
+	}
+	if p.cfg.UserInfoURL != "" {
+		doc.UserInfoEndpoint = p.cfg.UserInfoURL
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("discovery document lacks required endpoints")
+	}
+
+	p.discovery = doc
+	return doc, nil
+}
+
+// keyFunc finds the signing key by key ID. An unknown ID fetches the key
+// set again, the issuer may have rotated its keys.
+func (p *oidcProvider) keyFunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		if key, ok := p.lookupKey(kid); ok {
+			return key, nil
+		}
+		if time.Since(p.keysAt) < keysRefetchInterval {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+
+		keys, err := fetchKeys(ctx, p.client, p.discovery.JWKSURI)
+		if err != nil {
+			return nil, err
+		}
+		p.keys, p.keysAt = keys, time.Now()
+
+		if key, ok := p.lookupKey(kid); ok {
+			return key, nil
+		}
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+}
+
+// lookupKey accepts a token without key ID when the set has a single key.
+func (p *oidcProvider) lookupKey(kid string) (any, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// fetchKeys reads the RSA and EC signing keys of a JWK set, others are
+// skipped.
+func fetchKeys(ctx context.Context, client *http.Client, jwksURL string) (map[string]any, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, client, jwksURL, "", &set); err != nil {
+		return nil, fmt.Errorf("fetch signing keys failed: %w", err)
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k *jsonWebKey) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() {
+			return nil, errors.New("rsa exponent too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("ec point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(raw), nil
+}
+
+// ------------- GitHub -------------
+
+// githubProvider signs in with GitHub OAuth apps. GitHub issues no ID
+// tokens, the identity comes from its user API.
+type githubProvider struct {
+	cfg    config.OAuthProvider
+	client *http.Client
+}
+
+func (p *githubProvider) authURL(ctx context.Context, req *authRequest) (string, error) {
+	return buildAuthURL(orDefault(p.cfg.AuthURL, githubAuthURL), url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {req.RedirectURI},
+		"scope":                 {scopes(p.cfg.Scopes, githubScopes)},
+		"state":                 {req.State},
+		"code_challenge":        {req.Challenge},
+		"code_challenge_method": {"S256"},
+	})
+}
+
+func (p *githubProvider) exchange(ctx context.Context, req *authRequest, code string) (*ExternalIdentity, error) {
+	tokens, err := redeemCode(ctx, p.client, orDefault(p.cfg.TokenURL, githubTokenURL), p.cfg, req, code)
+	if err != nil {
+		return nil, err
+	}
+	if tokens.AccessToken == "" {
+		return nil, errors.New("token response has no access_token")
+	}
+
+	userURL := orDefault(p.cfg.UserInfoURL, githubUserInfoURL)
+
+	var account struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		Name      string `json:"name"`
+		AvatarURL string `json:"avatar_url"`
+	}
+	if err = getJSON(ctx, p.client, userURL, tokens.AccessToken, &account); err != nil {
+		return nil, err
+	}
+	if account.ID == 0 {
+		return nil, errors.New("user response has no id")
+	}
+
+	// The profile email is optional and unverified, the emails API tells
+	// which address is verified
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err = getJSON(ctx, p.client, userURL+"/emails", tokens.AccessToken, &emails); err != nil {
+		return nil, err
+	}
+
+	identity := &ExternalIdentity{
+		Subject:  strconv.FormatInt(account.ID, 10),
+		Name:     account.Name,
+		Username: account.Login,
+		Picture:  account.AvatarURL,
+	}
+	for _, e := range emails {
+		if e.Primary {
+			identity.Email = e.Email
+			identity.EmailVerified = e.Verified
+		}
+	}
+
+	return identity, nil
+}
+
+// ------------- Shared -------------
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// redeemCode posts the code with the PKCE verifier to the token endpoint,
+// the client authenticates with client_secret_post.
+func redeemCode(ctx context.Context, client *http.Client, tokenURL string, cfg config.OAuthProvider, req *authRequest, code string) (*tokenResponse, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {req.RedirectURI},
+		"client_id":     {cfg.ClientID},
+		"code_verifier": {req.Verifier},
+	}
+	if cfg.ClientSecret != "" {
+		form.Set("client_secret", cfg.ClientSecret)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpReq.Header.Set("Accept", "application/json")
+
+	res, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	tokens := new(tokenResponse)
+	if err = json.NewDecoder(io.LimitReader(res.Body, maxResponseSize)).Decode(tokens); err != nil {
+		return nil, fmt.Errorf("token response status %d: %w", res.StatusCode, err)
+	}
+	if tokens.Error != "" {
+		return nil, fmt.Errorf("token request refused: %s %s", tokens.Error, tokens.ErrorDescription)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token response status %d", res.StatusCode)
+	}
+
+	return tokens, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, target, accessToken string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", target, res.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(res.Body, maxResponseSize)).Decode(out)
+}
+
+func buildAuthURL(endpoint string, params url.Values) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+func scopes(configured, defaults []string) string {
+	if len(configured) == 0 {
+		configured = defaults
+	}
+	return strings.Join(configured, " ")
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// isTrue reads email_verified, a few providers send it as a string.
+func isTrue(value any) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
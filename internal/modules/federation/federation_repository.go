@@ -0,0 +1,77 @@
+package federation
+
+import (
+	"context"
+	"errors"
+
+	"github.com/codepnw/go-authen-system/internal/utils/transaction"
+	"gorm.io/gorm"
+)
+
+type FederationRepository interface {
+	Create(ctx context.Context, input *Identity) error
+	// FindBySubject returns nil when the provider account is not linked.
+	FindBySubject(ctx context.Context, provider, subject string) (*Identity, error)
+	ListByUser(ctx context.Context, userID int64) ([]*Identity, error)
+	Update(ctx context.Context, input *Identity) error
+	Delete(ctx context.Context, input *Identity) error
+}
+
+type federationRepository struct {
+	db *gorm.DB
+}
+
+func NewFederationRepository(db *gorm.DB) FederationRepository {
+	return &federationRepository{db: db}
+}
+
+func (r *federationRepository) Create(ctx context.Context, input *Identity) error {
+	return transaction.DB(ctx, r.db).Create(input).Error
+}
+
+func (r *federationRepository) FindBySubject(ctx context.Context, provider, subject string) (identity *Identity, err error) {
+	err = transaction.DB(ctx, r.db).First(&identity, "provider = ? AND subject = ?", provider, subject).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+func (r *federationRepository) ListByUser(ctx context.Context, userID int64) (identities []*Identity, err error) {
+	err = transaction.DB(ctx, r.db).
+		Where("user_id = ?", userID).
+		Order("id").
+		Find(&identities).Error
+	return identities, err
+}
+
+func (r *federationRepository) Update(ctx context.Context, input *Identity) error {
+	res := transaction.DB(ctx, r.db).Save(input)
+	if res.Error != nil {
+		return res.Error
+	}
+
+	rows := res.RowsAffected
+	if rows == 0 {
+		return errors.New("identity not found")
+	}
+
+	return nil
+}
+
+func (r *federationRepository) Delete(ctx context.Context, input *Identity) error {
+	res := transaction.DB(ctx, r.db).Delete(input)
+	if res.Error != nil {
+		return res.Error
+	}
+
+	rows := res.RowsAffected
+	if rows == 0 {
+		return errors.New("identity not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package federation
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/codepnw/go-authen-system/internal/utils/security"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	statePurpose  = "oauth_state"
+	stateDuration = time.Minute * 10
+)
+
+// flowState travels in a signed cookie from the redirect to the provider
+// to the callback. It binds the callback to the browser that started the
+// sign in and keeps the PKCE verifier away from the provider's redirect.
+// LinkUserID is set when a signed in user links the identity instead.
+type flowState struct {
+	Purpose    string `json:"purpose"`
+	Provider   string `json:"provider"`
+	State      string `json:"state"`
+	Nonce      string `json:"nonce"`
+	Verifier   string `json:"verifier"`
+	Next       string `json:"next,omitempty"`
+	LinkUserID int64  `json:"link_user_id,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func newFlowState(provider, next string) (*flowState, error) {
+	flow := &flowState{Purpose: statePurpose, Provider: provider, Next: next}
+
+	var err error
+	if flow.State, err = security.RandomToken(16); err != nil {
+		return nil, err
+	}
+	if flow.Nonce, err = security.RandomToken(16); err != nil {
+		return nil, err
+	}
+	if flow.Verifier, err = security.RandomToken(32); err != nil {
+		return nil, err
+	}
+
+	flow.ExpiresAt = jwt.NewNumericDate(time.Now().Add(stateDuration))
+	return flow, nil
+}
+
+// challenge is the S256 PKCE challenge of the verifier.
+func (f *flowState) challenge() string {
+	sum := sha256.Sum256([]byte(f.Verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// The purpose claim keeps the token from passing as an access token.
+func sealFlowState(key string, flow *flowState) (string, error) {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, flow).SignedString([]byte(key))
+	if err != nil {
+		return "", fmt.Errorf("sign state failed: %w", err)
+	}
+	return token, nil
+}
+
+func openFlowState(key, token string) (*flowState, error) {
+	flow := new(flowState)
+	_, err := jwt.ParseWithClaims(token, flow, func(t *jwt.Token) (any, error) {
+		return []byte(key), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	if flow.Purpose != statePurpose {
+		return nil, errors.New("invalid state purpose")
+	}
+	return flow, nil
+}
@@ -0,0 +1,492 @@
+package federation
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/codepnw/go-authen-system/config"
+	"github.com/codepnw/go-authen-system/internal/modules/audit"
+	"github.com/codepnw/go-authen-system/internal/modules/auth"
+	"github.com/codepnw/go-authen-system/internal/modules/user"
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+	"github.com/codepnw/go-authen-system/internal/utils/security"
+	"github.com/codepnw/go-authen-system/internal/utils/transaction"
+	"github.com/codepnw/go-authen-system/pkg/logger"
+	"github.com/codepnw/go-authen-system/pkg/mailer"
+)
+
+const (
+	queryTimeout    = time.Second * 5
+	providerTimeout = time.Second * 10
+
+	// A provider sign in this recent counts as re-authentication
+	reauthWindow = time.Minute * 5
+)
+
+type FederationUsecase interface {
+	Providers() []string
+	// Start returns the provider's sign in URL and the state token the
+	// callback must present.
+	Start(ctx context.Context, providerName, next string) (string, string, error)
+	Callback(ctx context.Context, providerName, stateToken string, req *CallbackRequest) (*CallbackResult, error)
+	ListLoginMethods(ctx context.Context, userID int64) (*LoginMethodsDTO, error)
+	// StartLink is Start for a signed in user who re-authenticated, the
+	// callback links the provider account to the user.
+	StartLink(ctx context.Context, userID int64, providerName string, req *LinkRequest) (string, string, error)
+	// Unlink asks for the same re-authentication as StartLink.
+	Unlink(ctx context.Context, userID, identityID int64, req *UnlinkRequest) error
+	// Reauthenticate confirms a signed in user before a sensitive change.
+	Reauthenticate(ctx context.Context, userID int64, password string) error
+}
+
+type federationUsecase struct {
+	repo        FederationRepository
+	tx          transaction.Manager
+	userUsecase user.UserUsecase
+	authUsecase auth.AuthUsecase
+	mailer      mailer.Mailer
+	recorder    audit.Recorder
+	secretKey   string
+	baseURL     string
+	names       []string
+	configs     map[string]config.OAuthProvider
+	providers   map[string]provider
+}
+
+func NewFederationUsecase(cfg *config.Config, tx transaction.Manager, repo FederationRepository, userUsecase user.UserUsecase, authUsecase auth.AuthUsecase, mail mailer.Mailer, recorder audit.Recorder) FederationUsecase {
+	client := &http.Client{Timeout: providerTimeout}
+
+	uc := &federationUsecase{
+		repo:        repo,
+		tx:          tx,
+		userUsecase: userUsecase,
+		authUsecase: authUsecase,
+		mailer:      mail,
+		recorder:    recorder,
+		secretKey:   cfg.JWTSecretKey,
+		baseURL:     strings.TrimRight(cfg.AppBaseURL, "/"),
+		configs:     make(map[string]config.OAuthProvider, len(cfg.OAuthProviders)),
+		providers:   make(map[string]provider, len(cfg.OAuthProviders)),
+	}
+	for _, p := range cfg.OAuthProviders {
+		uc.names = append(uc.names, p.Name)
+		uc.configs[p.Name] = p
+		uc.providers[p.Name] = newProvider(p, client)
+	}
+	return uc
+}
+
+func (uc *federationUsecase) Providers() []string {
+	return uc.names
+}
+
+func (uc *federationUsecase) Start(ctx context.Context, providerName, next string) (string, string, error) {
+	if _, ok := uc.providers[providerName]; !ok {
+		return "", "", errs.ErrUnknownProvider
+	}
+
+	flow, err := newFlowState(providerName, next)
+	if err != nil {
+		return "", "", err
+	}
+
+	return uc.start(ctx, flow)
+}
+
+func (uc *federationUsecase) StartLink(ctx context.Context, userID int64, providerName string, req *LinkRequest) (string, string, error) {
+	if _, ok := uc.providers[providerName]; !ok {
+		return "", "", errs.ErrUnknownProvider
+	}
+
+	if err := uc.Reauthenticate(ctx, userID, req.Password); err != nil {
+		return "", "", err
+	}
+
+	flow, err := newFlowState(providerName, req.Next)
+	if err != nil {
+		return "", "", err
+	}
+	flow.LinkUserID = userID
+
+	return uc.start(ctx, flow)
+}
+
+// Callback signs in the owner of the provider account. A new identity is
+// linked to the account with the same email when both sides verified it,
+// or gets a new account, when the provider's configuration allows it. A
+// flow started by StartLink links the identity to its user instead.
+func (uc *federationUsecase) Callback(ctx context.Context, providerName, stateToken string, req *CallbackRequest) (*CallbackResult, error) {
+	p, ok := uc.providers[providerName]
+	if !ok {
+		return nil, errs.ErrUnknownProvider
+	}
+
+	flow, err := openFlowState(uc.secretKey, stateToken)
+	if err != nil || flow.Provider != providerName || subtle.ConstantTimeCompare([]byte(flow.State), []byte(req.State)) != 1 {
+		return nil, errs.ErrInvalidOAuthState
+	}
+
+	if req.Error != "" {
+		return nil, fmt.Errorf("%w: %s", errs.ErrProviderSignIn, req.Error)
+	}
+	if req.Code == "" {
+		return nil, errs.ErrProviderSignIn
+	}
+
+	exchangeCtx, cancel := context.WithTimeout(ctx, providerTimeout)
+	defer cancel()
+
+	external, err := p.exchange(exchangeCtx, uc.authRequest(flow), req.Code)
+	if err != nil {
+		logger.Error("FEDERATION-002", "provider code exchange failed", err)
+		return nil, errs.ErrProviderSignIn
+	}
+
+	if flow.LinkUserID != 0 {
+		identity, err := uc.linkSignedIn(ctx, flow.LinkUserID, providerName, external)
+		if err != nil {
+			return nil, err
+		}
+		return &CallbackResult{Identity: identity, Next: flow.Next}, nil
+	}
+
+	u, err := uc.resolve(ctx, providerName, external)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := uc.authUsecase.LoginWithIdentity(ctx, u, providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CallbackResult{Auth: result, Next: flow.Next}, nil
+}
+
+func (uc *federationUsecase) ListLoginMethods(ctx context.Context, userID int64) (*LoginMethodsDTO, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	u, err := uc.userUsecase.GetProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	identities, err := uc.repo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginMethodsDTO{Password: u.Password != "", Identities: identities}, nil
+}
+
+// Unlink removes a linked identity unless the user could no longer sign in
+// without it. Identities of providers no longer configured do not count.
+func (uc *federationUsecase) Unlink(ctx context.Context, userID, identityID int64, req *UnlinkRequest) error {
+	if err := uc.Reauthenticate(ctx, userID, req.Password); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	u, err := uc.userUsecase.GetProfile(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	identities, err := uc.repo.ListByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	var target *Identity
+	usable := 0
+	if u.Password != "" {
+		usable++
+	}
+	for _, identity := range identities {
+		if identity.ID == identityID {
+			target = identity
+			continue
+		}
+		if _, ok := uc.providers[identity.Provider]; ok {
+			usable++
+		}
+	}
+	if target == nil {
+		return errs.ErrIdentityNotFound
+	}
+	if usable == 0 {
+		return errs.ErrLastLoginMethod
+	}
+
+	if err = uc.repo.Delete(ctx, target); err != nil {
+		logger.Error("FEDERATION-008", "unlink identity failed", err)
+		return err
+	}
+
+	logger.Info("FEDERATION-009", "identity unlinked", map[string]any{"user_id": userID, "provider": target.Provider})
+	uc.record(ctx, audit.EventIdentityUnlink, userID, audit.Metadata{"provider": target.Provider, "identity_id": target.ID})
+	return nil
+}
+
+// Reauthenticate checks the password of an account that has one. Accounts
+// without a password must have signed in through a linked provider within
+// reauthWindow.
+func (uc *federationUsecase) Reauthenticate(ctx context.Context, userID int64, password string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	u, err := uc.userUsecase.GetProfile(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if u.Password != "" {
+		if !security.VerifyPassword(u.Password, password) {
+			return errs.ErrReauthRequired
+		}
+		return nil
+	}
+
+	identities, err := uc.repo.ListByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, identity := range identities {
+		if identity.LastLoginAt != nil && time.Since(*identity.LastLoginAt) < reauthWindow {
+			return nil
+		}
+	}
+	return errs.ErrReauthRequired
+}
+
+// ------------- Private -------------
+
+// resolve finds the user of the provider account, linking or provisioning
+// one by the rules of the provider.
+func (uc *federationUsecase) resolve(ctx context.Context, providerName string, external *ExternalIdentity) (*user.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	identity, err := uc.repo.FindBySubject(ctx, providerName, external.Subject)
+	if err != nil {
+		logger.Error("FEDERATION-003", "find identity failed", err)
+		return nil, err
+	}
+	if identity != nil {
+		return uc.touch(ctx, identity, external)
+	}
+
+	// Only an address the provider verified may claim an account
+	if external.Email == "" || !external.EmailVerified {
+		return nil, errs.ErrIdentityNotLinked
+	}
+
+	cfg := uc.configs[providerName]
+
+	existing, err := uc.userUsecase.GetUserByEmail(ctx, external.Email)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		// Anyone can register an address they do not own, the local
+		// account must have proved it too or this hands it to the provider
+		// account's owner
+		if !cfg.LinkVerifiedEmail || existing.EmailVerifiedAt == nil {
+			return nil, errs.ErrIdentityEmailTaken
+		}
+		if _, err = uc.link(ctx, existing.ID, providerName, external); err != nil {
+			return nil, err
+		}
+		uc.record(ctx, audit.EventIdentityLink, existing.ID, audit.Metadata{"provider": providerName, "via": "email"})
+		uc.notify(ctx, existing, providerName, external)
+		return existing, nil
+	}
+
+	if !cfg.ProvisionUsers {
+		return nil, errs.ErrIdentityNotLinked
+	}
+
+	var created *user.User
+	err = uc.tx.Do(ctx, func(ctx context.Context) error {
+		created, err = uc.userUsecase.ProvisionUser(ctx, &user.ProvisionUserRequest{
+			Username:    suggestUsername(external),
+			Email:       external.Email,
+			DisplayName: external.Name,
+			AvatarURL:   external.Picture,
+		})
+		if err != nil {
+			logger.Error("FEDERATION-004", "provision user failed", err)
+			return err
+		}
+		_, err = uc.link(ctx, created.ID, providerName, external)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("FEDERATION-005", "user provisioned", map[string]any{"user_id": created.ID, "provider": providerName})
+	uc.record(ctx, audit.EventUserRegister, created.ID, audit.Metadata{"provider": providerName, "via": "provider"})
+	return created, nil
+}
+
+// linkSignedIn links the provider account to the user who started the
+// flow. Linking an account the user already linked changes nothing.
+func (uc *federationUsecase) linkSignedIn(ctx context.Context, userID int64, providerName string, external *ExternalIdentity) (*Identity, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	existing, err := uc.repo.FindBySubject(ctx, providerName, external.Subject)
+	if err != nil {
+		logger.Error("FEDERATION-003", "find identity failed", err)
+		return nil, err
+	}
+	if existing != nil {
+		if existing.UserID != userID {
+			return nil, errs.ErrIdentityLinked
+		}
+		return existing, nil
+	}
+
+	u, err := uc.userUsecase.GetProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsActive() {
+		return nil, errs.ErrAccountDisabled
+	}
+
+	identity, err := uc.link(ctx, userID, providerName, external)
+	if err != nil {
+		return nil, err
+	}
+
+	uc.record(ctx, audit.EventIdentityLink, userID, audit.Metadata{"provider": providerName, "via": "account"})
+	uc.notify(ctx, u, providerName, external)
+	return identity, nil
+}
+
+func (uc *federationUsecase) link(ctx context.Context, userID int64, providerName string, external *ExternalIdentity) (*Identity, error) {
+	now := time.Now()
+	identity := &Identity{
+		UserID:      userID,
+		Provider:    providerName,
+		Subject:     external.Subject,
+		Email:       external.Email,
+		LastLoginAt: &now,
+	}
+
+	if err := uc.repo.Create(ctx, identity); err != nil {
+		logger.Error("FEDERATION-006", "link identity failed", err)
+		return nil, err
+	}
+	return identity, nil
+}
+
+// notify tells the user about a new way to sign in. Delivery problems do
+// not undo the link.
+func (uc *federationUsecase) notify(ctx context.Context, u *user.User, providerName string, external *ExternalIdentity) {
+	account := providerName
+	if external.Email != "" {
+		account = fmt.Sprintf("%s (%s)", providerName, external.Email)
+	}
+
+	err := uc.mailer.Send(ctx, &mailer.Message{
+		To:      u.Email,
+		Subject: "A new sign in method was added to your account",
+		Body: fmt.Sprintf(
+			"Your %s account can now be used to sign in to your account.\n\nIf you did not add it, remove it from your account and change your password.",
+			account,
+		),
+	})
+	if err != nil {
+		logger.Error("FEDERATION-010", "send identity link notice failed", err)
+	}
+}
+
+// touch keeps the email the provider reports and the time of the sign in.
+func (uc *federationUsecase) touch(ctx context.Context, identity *Identity, external *ExternalIdentity) (*user.User, error) {
+	u, err := uc.userUsecase.GetProfile(ctx, identity.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if external.Email != "" {
+		identity.Email = external.Email
+	}
+	identity.LastLoginAt = &now
+	identity.UpdatedAt = &now
+
+	if err = uc.repo.Update(ctx, identity); err != nil {
+		logger.Error("FEDERATION-007", "update identity failed", err)
+		return nil, err
+	}
+	return u, nil
+}
+
+// start returns the provider's sign in URL and the sealed flow state.
+func (uc *federationUsecase) start(ctx context.Context, flow *flowState) (string, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, providerTimeout)
+	defer cancel()
+
+	authURL, err := uc.providers[flow.Provider].authURL(ctx, uc.authRequest(flow))
+	if err != nil {
+		logger.Error("FEDERATION-001", "build provider sign in url failed", err)
+		return "", "", errs.ErrProviderSignIn
+	}
+
+	stateToken, err := sealFlowState(uc.secretKey, flow)
+	if err != nil {
+		return "", "", err
+	}
+
+	return authURL, stateToken, nil
+}
+
+func (uc *federationUsecase) authRequest(flow *flowState) *authRequest {
+	return &authRequest{
+		RedirectURI: fmt.Sprintf("%s/auth/oauth/%s/callback", uc.baseURL, url.PathEscape(flow.Provider)),
+		State:       flow.State,
+		Nonce:       flow.Nonce,
+		Challenge:   flow.challenge(),
+		Verifier:    flow.Verifier,
+	}
+}
+
+// record stores an event about the user, who is also the actor before a
+// session exists.
+func (uc *federationUsecase) record(ctx context.Context, eventType string, userID int64, metadata audit.Metadata) {
+	event := &audit.Event{
+		Type:       eventType,
+		TargetID:   userID,
+		TargetType: audit.KindUser,
+		Outcome:    audit.OutcomeSuccess,
+		Metadata:   metadata,
+	}
+
+	if _, ok := security.UserFromContext(ctx); !ok {
+		event.ActorID = userID
+		event.ActorType = audit.KindUser
+	}
+
+	uc.recorder.Record(ctx, event)
+}
+
+// suggestUsername prefers the provider's username over the local part of
+// the email.
+func suggestUsername(external *ExternalIdentity) string {
+	if external.Username != "" {
+		return external.Username
+	}
+	local, _, _ := strings.Cut(external.Email, "@")
+	return local
+}
@@ -0,0 +1,491 @@
+package federation
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codepnw/go-authen-system/config"
+	"github.com/codepnw/go-authen-system/internal/modules/auth"
+	"github.com/codepnw/go-authen-system/internal/modules/group"
+	"github.com/codepnw/go-authen-system/internal/modules/organization"
+	"github.com/codepnw/go-authen-system/internal/modules/user"
+	"github.com/codepnw/go-authen-system/internal/storage/storagetest"
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+	"github.com/codepnw/go-authen-system/pkg/mailer"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testBaseURL = "https://auth.example.com"
+
+func TestCallbackProvisions(t *testing.T) {
+	idp, uc, users := setupFederation(t)
+	ctx := context.Background()
+
+	idp.signIn(map[string]any{"sub": "s1", "email": "new@example.com", "email_verified": true, "name": "New Person"})
+	authURL, stateToken, err := uc.Start(ctx, "provision", "/account")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The authorization request binds the callback with state, nonce and PKCE
+	q := mustParse(t, authURL).Query()
+	if q.Get("state") == "" || q.Get("nonce") == "" || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Fatalf("authorization request lacks a binding: %s", authURL)
+	}
+	if q.Get("redirect_uri") != testBaseURL+"/auth/oauth/provision/callback" {
+		t.Fatalf("redirect_uri = %s", q.Get("redirect_uri"))
+	}
+
+	result, err := uc.Callback(ctx, "provision", stateToken, idp.authorize(t, authURL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Auth == nil || result.Auth.User.Email != "new@example.com" || result.Next != "/account" {
+		t.Fatalf("result = %+v", result)
+	}
+
+	// The provider verified the email of the new account
+	created, err := users.GetUserByEmail(ctx, "new@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.EmailVerifiedAt == nil {
+		t.Fatal("provisioned account has no verified email")
+	}
+
+	// The next sign in finds the linked identity
+	idp.signIn(map[string]any{"sub": "s1", "email": "changed@example.com", "email_verified": true})
+	authURL, stateToken, err = uc.Start(ctx, "provision", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err = uc.Callback(ctx, "provision", stateToken, idp.authorize(t, authURL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Auth.User.ID != created.ID {
+		t.Fatalf("signed in as %d, want %d", result.Auth.User.ID, created.ID)
+	}
+
+	if n := idp.discoveries(); n != 1 {
+		t.Fatalf("discovery fetched %d times, want once", n)
+	}
+}
+
+func TestCallbackBindsFlow(t *testing.T) {
+	idp, uc, _ := setupFederation(t)
+	ctx := context.Background()
+
+	idp.signIn(map[string]any{"sub": "s1", "email": "new@example.com", "email_verified": true})
+
+	start := func() (string, string) {
+		authURL, stateToken, err := uc.Start(ctx, "provision", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return authURL, stateToken
+	}
+
+	t.Run("forged state", func(t *testing.T) {
+		authURL, stateToken := start()
+		req := idp.authorize(t, authURL)
+		req.State = "forged"
+
+		if _, err := uc.Callback(ctx, "provision", stateToken, req); !errors.Is(err, errs.ErrInvalidOAuthState) {
+			t.Fatalf("err = %v", err)
+		}
+	})
+
+	t.Run("state of another browser", func(t *testing.T) {
+		authURL, _ := start()
+		_, otherState := start()
+
+		if _, err := uc.Callback(ctx, "provision", otherState, idp.authorize(t, authURL)); !errors.Is(err, errs.ErrInvalidOAuthState) {
+			t.Fatalf("err = %v", err)
+		}
+	})
+
+	t.Run("state of another provider", func(t *testing.T) {
+		authURL, stateToken := start()
+
+		if _, err := uc.Callback(ctx, "link", stateToken, idp.authorize(t, authURL)); !errors.Is(err, errs.ErrInvalidOAuthState) {
+			t.Fatalf("err = %v", err)
+		}
+	})
+
+	t.Run("code of another flow", func(t *testing.T) {
+		// The provider refuses the code, the verifier is not the one its
+		// challenge was made from
+		authURL, stateToken := start()
+		otherURL, _ := start()
+		req := idp.authorize(t, authURL)
+		req.Code = idp.authorize(t, otherURL).Code
+
+		if _, err := uc.Callback(ctx, "provision", stateToken, req); !errors.Is(err, errs.ErrProviderSignIn) {
+			t.Fatalf("err = %v", err)
+		}
+	})
+
+	t.Run("nonce mismatch", func(t *testing.T) {
+		authURL, stateToken := start()
+		idp.signIn(map[string]any{"sub": "s1", "email": "new@example.com", "email_verified": true, "nonce": "replayed"})
+		defer idp.signIn(map[string]any{"sub": "s1", "email": "new@example.com", "email_verified": true})
+
+		if _, err := uc.Callback(ctx, "provision", stateToken, idp.authorize(t, authURL)); !errors.Is(err, errs.ErrProviderSignIn) {
+			t.Fatalf("err = %v", err)
+		}
+	})
+}
+
+func TestCallbackLinkRules(t *testing.T) {
+	idp, uc, users := setupFederation(t)
+	ctx := context.Background()
+
+	local, err := users.CreateUser(ctx, &user.CreateUserRequest{
+		Username:        "alice",
+		Email:           "alice@example.com",
+		Password:        "password1",
+		ConfirmPassword: "password1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	callback := func(providerName string, claims map[string]any) (*CallbackResult, error) {
+		idp.signIn(claims)
+		authURL, stateToken, err := uc.Start(ctx, providerName, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return uc.Callback(ctx, providerName, stateToken, idp.authorize(t, authURL))
+	}
+
+	tests := []struct {
+		name     string
+		provider string
+		claims   map[string]any
+		wantErr  error
+	}{
+		{"unverified local email", "link", map[string]any{"sub": "s1", "email": "alice@example.com", "email_verified": true}, errs.ErrIdentityEmailTaken},
+		{"unverified provider email", "link", map[string]any{"sub": "s2", "email": "alice@example.com", "email_verified": false}, errs.ErrIdentityNotLinked},
+		{"linking disabled", "provision", map[string]any{"sub": "s3", "email": "alice@example.com", "email_verified": true}, errs.ErrIdentityEmailTaken},
+		{"provisioning disabled", "link", map[string]any{"sub": "s4", "email": "bob@example.com", "email_verified": true}, errs.ErrIdentityNotLinked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := callback(tt.provider, tt.claims); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// The reset link proves the local account owns the address
+	if err = users.ResetPassword(ctx, local.ID, "password2"); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := callback("link", map[string]any{"sub": "s1", "email": "alice@example.com", "email_verified": "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Auth.User.ID != local.ID {
+		t.Fatalf("signed in as %d, want %d", result.Auth.User.ID, local.ID)
+	}
+
+	methods, err := uc.ListLoginMethods(ctx, local.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(methods.Identities) != 1 || methods.Identities[0].Subject != "s1" {
+		t.Fatalf("identities = %+v", methods.Identities)
+	}
+}
+
+func TestUnlink(t *testing.T) {
+	idp, uc, users := setupFederation(t)
+	ctx := context.Background()
+
+	// A password-less account, signed in through the provider just now
+	idp.signIn(map[string]any{"sub": "s1", "email": "new@example.com", "email_verified": true})
+	authURL, stateToken, err := uc.Start(ctx, "provision", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := uc.Callback(ctx, "provision", stateToken, idp.authorize(t, authURL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner := result.Auth.User.ID
+
+	methods, err := uc.ListLoginMethods(ctx, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identityID := methods.Identities[0].ID
+
+	if err = uc.Unlink(ctx, owner, identityID, &UnlinkRequest{}); !errors.Is(err, errs.ErrLastLoginMethod) {
+		t.Fatalf("err = %v, want %v", err, errs.ErrLastLoginMethod)
+	}
+
+	// With a password the password is the confirmation
+	if err = users.ResetPassword(ctx, owner, "password1"); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := users.CreateUser(ctx, &user.CreateUserRequest{
+		Username:        "bob",
+		Email:           "bob@example.com",
+		Password:        "password1",
+		ConfirmPassword: "password1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		userID     int64
+		identityID int64
+		password   string
+		wantErr    error
+	}{
+		{"no password", owner, identityID, "", errs.ErrReauthRequired},
+		{"wrong password", owner, identityID, "password2", errs.ErrReauthRequired},
+		{"unknown identity", owner, identityID + 1, "password1", errs.ErrIdentityNotFound},
+		{"identity of another user", other.ID, identityID, "password1", errs.ErrIdentityNotFound},
+		{"unlinked", owner, identityID, "password1", nil},
+		{"unlinked twice", owner, identityID, "password1", errs.ErrIdentityNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := uc.Unlink(ctx, tt.userID, tt.identityID, &UnlinkRequest{Password: tt.password})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func setupFederation(t *testing.T) (*mockIdP, FederationUsecase, user.UserUsecase) {
+	t.Helper()
+
+	idp := newMockIdP(t)
+
+	cfg := &config.Config{
+		AppBaseURL:    testBaseURL,
+		JWTSecretKey:  "secret",
+		JWTRefreshKey: "refresh",
+		OAuthProviders: []config.OAuthProvider{
+			{Name: "provision", Type: "oidc", Issuer: idp.URL, ClientID: "provision-client", ClientSecret: "secret", ProvisionUsers: true},
+			{Name: "link", Type: "oidc", Issuer: idp.URL + "/", ClientID: "link-client", ClientSecret: "secret", LinkVerifiedEmail: true},
+		},
+	}
+	env := storagetest.Setup(t, cfg)
+	mail := mailer.NewLogMailer()
+
+	orgUsecase := organization.NewOrganizationUsecase(cfg, organization.NewOrganizationRepository(env.Store.DB), env.Users, mail, env.Recorder)
+	groupUsecase := group.NewGroupUsecase(group.NewGroupRepository(env.Store.DB), env.Users, env.Recorder)
+	authUsecase := auth.NewAuthUsecase(cfg, env.Tx, env.Store.Tokens, env.Users, orgUsecase, groupUsecase, env.Recorder)
+
+	uc := NewFederationUsecase(cfg, env.Tx, NewFederationRepository(env.Store.DB), env.Users, authUsecase, mail, env.Recorder)
+	return idp, uc, env.Users
+}
+
+func mustParse(t *testing.T, raw string) *url.URL {
+	t.Helper()
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// grant is an authorization code the mock provider issued.
+type grant struct {
+	clientID    string
+	redirectURI string
+	challenge   string
+	claims      jwt.MapClaims
+}
+
+// mockIdP is an OpenID provider that signs in whoever signIn names. It
+// checks the client, the redirect URI and the PKCE verifier when a code is
+// redeemed.
+type mockIdP struct {
+	*httptest.Server
+
+	key *rsa.PrivateKey
+
+	mu        sync.Mutex
+	claims    map[string]any
+	codes     map[string]*grant
+	discovery int
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &mockIdP{key: key, codes: map[string]*grant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", idp.serveDiscovery)
+	mux.HandleFunc("GET /jwks", idp.serveKeys)
+	mux.HandleFunc("GET /authorize", idp.serveAuthorize)
+	mux.HandleFunc("POST /token", idp.serveToken)
+
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// signIn sets the claims of the next ID tokens. A nonce claim replaces the
+// one of the authorization request.
+func (m *mockIdP) signIn(claims map[string]any) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.claims = claims
+}
+
+// authorize follows the authorization URL like a browser and returns the
+// redirect back to the callback.
+func (m *mockIdP) authorize(t *testing.T, authURL string) *CallbackRequest {
+	t.Helper()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("authorize status = %d", res.StatusCode)
+	}
+	q := mustParse(t, res.Header.Get("Location")).Query()
+	return &CallbackRequest{Code: q.Get("code"), State: q.Get("state")}
+}
+
+func (m *mockIdP) discoveries() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.discovery
+}
+
+func (m *mockIdP) serveDiscovery(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	m.discovery++
+	m.mu.Unlock()
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"issuer":                 m.URL,
+		"authorization_endpoint": m.URL + "/authorize",
+		"token_endpoint":         m.URL + "/token",
+		"jwks_uri":               m.URL + "/jwks",
+	})
+}
+
+func (m *mockIdP) serveKeys(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]any{
+		"keys": []map[string]any{{
+			"kty": "RSA",
+			"kid": "test",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (m *mockIdP) serveAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "unsupported request", http.StatusBadRequest)
+		return
+	}
+
+	claims := jwt.MapClaims{"nonce": q.Get("nonce")}
+
+	m.mu.Lock()
+	for k, v := range m.claims {
+		claims[k] = v
+	}
+	code := rand.Text()
+	m.codes[code] = &grant{
+		clientID:    q.Get("client_id"),
+		redirectURI: q.Get("redirect_uri"),
+		challenge:   q.Get("code_challenge"),
+		claims:      claims,
+	}
+	m.mu.Unlock()
+
+	target, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	target.RawQuery = url.Values{"code": {code}, "state": {q.Get("state")}}.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func (m *mockIdP) serveToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Codes are single use
+	m.mu.Lock()
+	g, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok ||
+		r.PostForm.Get("client_id") != g.clientID ||
+		r.PostForm.Get("client_secret") != "secret" ||
+		r.PostForm.Get("redirect_uri") != g.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss": m.URL,
+		"aud": g.clientID,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}
+	for k, v := range g.claims {
+		claims[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+
+	idToken, err := token.SignedString(m.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"access_token": "access", "id_token": idToken, "token_type": "Bearer"})
+}
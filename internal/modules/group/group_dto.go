@@ -0,0 +1,48 @@
+package group
+
+type CreateGroupRequest struct {
+	Name        string `json:"name" validate:"required"`
+	Description string `json:"description"`
+}
+
+type AddMemberRequest struct {
+	UserID  *int64 `json:"user_id" validate:"required_without=GroupID,excluded_with=GroupID"`
+	GroupID *int64 `json:"group_id" validate:"required_without=UserID,excluded_with=UserID"`
+}
+
+type GrantRoleRequest struct {
+	Role string `json:"role" validate:"required"`
+}
+
+type GroupDetailDTO struct {
+	*Group
+	Members []*GroupMember `json:"members"`
+	Roles   []string       `json:"roles"`
+}
+
+type GroupRefDTO struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// GrantDTO tells where a role comes from. Path runs from the group the user
+// is a direct member of up to the group holding the role.
+type GrantDTO struct {
+	Role   string         `json:"role"`
+	Source string         `json:"source"`
+	Path   []*GroupRefDTO `json:"path,omitempty"`
+}
+
+type AccessDTO struct {
+	UserID      int64       `json:"user_id"`
+	Roles       []string    `json:"roles"`
+	Permissions []string    `json:"permissions"`
+	Grants      []*GrantDTO `json:"grants"`
+}
+
+type PermissionExplanationDTO struct {
+	UserID     int64       `json:"user_id"`
+	Permission string      `json:"permission"`
+	Granted    bool        `json:"granted"`
+	Grants     []*GrantDTO `json:"grants"`
+}
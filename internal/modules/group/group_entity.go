@@ -0,0 +1,32 @@
+package group
+
+import "time"
+
+type Group struct {
+	ID          int64      `json:"id" gorm:"primaryKey"`
+	Name        string     `json:"name" gorm:"unique;not null"`
+	Description string     `json:"description"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   *time.Time `json:"updated_at"`
+}
+
+// GroupMember is either a user or a nested group, exactly one of UserID and
+// MemberGroupID is set.
+type GroupMember struct {
+	ID            int64     `json:"id" gorm:"primaryKey"`
+	GroupID       int64     `json:"group_id" gorm:"not null;uniqueIndex:idx_group_members_user;uniqueIndex:idx_group_members_group"`
+	UserID        *int64    `json:"user_id" gorm:"index;uniqueIndex:idx_group_members_user"`
+	MemberGroupID *int64    `json:"member_group_id" gorm:"index;uniqueIndex:idx_group_members_group"`
+	CreatedAt     time.Time `json:"created_at"`
+	Group         *Group    `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+	MemberGroup   *Group    `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+}
+
+// GroupRole grants a role to every direct and nested member of the group.
+type GroupRole struct {
+	ID        int64     `json:"id" gorm:"primaryKey"`
+	GroupID   int64     `json:"group_id" gorm:"not null;uniqueIndex:idx_group_roles_group_role"`
+	Role      string    `json:"role" gorm:"not null;uniqueIndex:idx_group_roles_group_role"`
+	CreatedAt time.Time `json:"created_at"`
+	Group     *Group    `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+}
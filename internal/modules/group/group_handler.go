@@ -0,0 +1,242 @@
+package group
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+	"github.com/codepnw/go-authen-system/internal/utils/response"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type groupHandler struct {
+	validate *validator.Validate
+	uc       GroupUsecase
+}
+
+func NewGroupHandler(uc GroupUsecase) *groupHandler {
+	return &groupHandler{
+		validate: validator.New(),
+		uc:       uc,
+	}
+}
+
+func (h *groupHandler) Create(c *gin.Context) {
+	req := new(CreateGroupRequest)
+
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	group, err := h.uc.Create(c, req)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Created(c, group)
+}
+
+func (h *groupHandler) List(c *gin.Context) {
+	groups, err := h.uc.List(c)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, "", groups)
+}
+
+func (h *groupHandler) Get(c *gin.Context) {
+	id, err := getIntParamID(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid id", err)
+		return
+	}
+
+	group, err := h.uc.Get(c, id)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, "", group)
+}
+
+func (h *groupHandler) Delete(c *gin.Context) {
+	id, err := getIntParamID(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid id", err)
+		return
+	}
+
+	if err = h.uc.Delete(c, id); err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, "group deleted", nil)
+}
+
+func (h *groupHandler) AddMember(c *gin.Context) {
+	id, err := getIntParamID(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid id", err)
+		return
+	}
+
+	req := new(AddMemberRequest)
+
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err = h.uc.AddMember(c, id, req); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response.Success(c, "member added", nil)
+}
+
+func (h *groupHandler) RemoveUser(c *gin.Context) {
+	id, err := getIntParamID(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid id", err)
+		return
+	}
+
+	userID, err := getIntParamID(c.Param("userID"))
+	if err != nil {
+		response.BadRequest(c, "invalid user id", err)
+		return
+	}
+
+	if err = h.uc.RemoveUser(c, id, userID); err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, "member removed", nil)
+}
+
+func (h *groupHandler) RemoveSubgroup(c *gin.Context) {
+	id, err := getIntParamID(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid id", err)
+		return
+	}
+
+	memberGroupID, err := getIntParamID(c.Param("groupID"))
+	if err != nil {
+		response.BadRequest(c, "invalid group id", err)
+		return
+	}
+
+	if err = h.uc.RemoveSubgroup(c, id, memberGroupID); err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, "member removed", nil)
+}
+
+func (h *groupHandler) GrantRole(c *gin.Context) {
+	id, err := getIntParamID(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid id", err)
+		return
+	}
+
+	req := new(GrantRoleRequest)
+
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err = h.uc.GrantRole(c, id, req.Role); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response.Success(c, "role granted", nil)
+}
+
+func (h *groupHandler) RevokeRole(c *gin.Context) {
+	id, err := getIntParamID(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid id", err)
+		return
+	}
+
+	if err = h.uc.RevokeRole(c, id, c.Param("role")); err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, "role revoked", nil)
+}
+
+func (h *groupHandler) GetAccess(c *gin.Context) {
+	userID, err := getIntParamID(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid id", err)
+		return
+	}
+
+	access, err := h.uc.GetAccess(c, userID)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, "", access)
+}
+
+func (h *groupHandler) ExplainPermission(c *gin.Context) {
+	userID, err := getIntParamID(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid id", err)
+		return
+	}
+
+	explanation, err := h.uc.ExplainPermission(c, userID, c.Param("permission"))
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, "", explanation)
+}
+
+func handleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errs.ErrGroupCycle), errors.Is(err, errs.ErrUnknownRole):
+		response.BadRequest(c, "", err)
+	default:
+		response.InternalServerError(c, err)
+	}
+}
+
+func getIntParamID(key string) (int64, error) {
+	return strconv.ParseInt(key, 10, 64)
+}
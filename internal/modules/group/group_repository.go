@@ -0,0 +1,180 @@
+package group
+
+import (
+	"context"
+	"errors"
+
+	"github.com/codepnw/go-authen-system/internal/utils/transaction"
+	"gorm.io/gorm"
+)
+
+type GroupRepository interface {
+	Create(ctx context.Context, input *Group) (*Group, error)
+	FindByID(ctx context.Context, id int64) (*Group, error)
+	FindByIDs(ctx context.Context, ids []int64) ([]*Group, error)
+	List(ctx context.Context) ([]*Group, error)
+	Delete(ctx context.Context, id int64) error
+
+	AddMember(ctx context.Context, input *GroupMember) error
+	RemoveUser(ctx context.Context, groupID, userID int64) error
+	RemoveSubgroup(ctx context.Context, groupID, memberGroupID int64) error
+	ListMembers(ctx context.Context, groupID int64) ([]*GroupMember, error)
+	ListUserGroupIDs(ctx context.Context, userID int64) ([]int64, error)
+	ListParentEdges(ctx context.Context, groupIDs []int64) ([]*GroupMember, error)
+
+	AddRole(ctx context.Context, input *GroupRole) error
+	RemoveRole(ctx context.Context, groupID int64, role string) error
+	ListRoles(ctx context.Context, groupIDs []int64) ([]*GroupRole, error)
+}
+
+type groupRepository struct {
+	db *gorm.DB
+}
+
+func NewGroupRepository(db *gorm.DB) GroupRepository {
+	return &groupRepository{db: db}
+}
+
+func (r *groupRepository) Create(ctx context.Context, input *Group) (*Group, error) {
+	if err := transaction.DB(ctx, r.db).Create(input).Error; err != nil {
+		return nil, err
+	}
+	return input, nil
+}
+
+func (r *groupRepository) FindByID(ctx context.Context, id int64) (group *Group, err error) {
+	if err = transaction.DB(ctx, r.db).First(&group, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+func (r *groupRepository) FindByIDs(ctx context.Context, ids []int64) (groups []*Group, err error) {
+	if err = transaction.DB(ctx, r.db).Where("id IN ?", ids).Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (r *groupRepository) List(ctx context.Context) (groups []*Group, err error) {
+	if err = transaction.DB(ctx, r.db).Order("name").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// Delete removes the group with its memberships, nested edges and grants.
+func (r *groupRepository) Delete(ctx context.Context, id int64) error {
+	return transaction.DB(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&GroupMember{}, "group_id = ? OR member_group_id = ?", id, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&GroupRole{}, "group_id = ?", id).Error; err != nil {
+			return err
+		}
+
+		res := tx.Delete(&Group{}, id)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("group not found")
+		}
+
+		return nil
+	})
+}
+
+func (r *groupRepository) AddMember(ctx context.Context, input *GroupMember) error {
+	return transaction.DB(ctx, r.db).Create(input).Error
+}
+
+func (r *groupRepository) RemoveUser(ctx context.Context, groupID, userID int64) error {
+	res := transaction.DB(ctx, r.db).Delete(&GroupMember{}, "group_id = ? AND user_id = ?", groupID, userID)
+	if res.Error != nil {
+		return res.Error
+	}
+
+	rows := res.RowsAffected
+	if rows == 0 {
+		return errors.New("group member not found")
+	}
+
+	return nil
+}
+
+func (r *groupRepository) RemoveSubgroup(ctx context.Context, groupID, memberGroupID int64) error {
+	res := transaction.DB(ctx, r.db).Delete(&GroupMember{}, "group_id = ? AND member_group_id = ?", groupID, memberGroupID)
+	if res.Error != nil {
+		return res.Error
+	}
+
+	rows := res.RowsAffected
+	if rows == 0 {
+		return errors.New("group member not found")
+	}
+
+	return nil
+}
+
+func (r *groupRepository) ListMembers(ctx context.Context, groupID int64) (members []*GroupMember, err error) {
+	if err = transaction.DB(ctx, r.db).Where("group_id = ?", groupID).Order("id").Find(&members).Error; err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// ListUserGroupIDs returns the groups the user is a direct member of.
+func (r *groupRepository) ListUserGroupIDs(ctx context.Context, userID int64) (ids []int64, err error) {
+	err = transaction.DB(ctx, r.db).
+		Model(&GroupMember{}).
+		Where("user_id = ?", userID).
+		Order("group_id").
+		Pluck("group_id", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// ListParentEdges returns the memberships that nest any of the given groups
+// inside another group.
+func (r *groupRepository) ListParentEdges(ctx context.Context, groupIDs []int64) (edges []*GroupMember, err error) {
+	err = transaction.DB(ctx, r.db).
+		Where("member_group_id IN ?", groupIDs).
+		Order("group_id").
+		Find(&edges).Error
+	if err != nil {
+		return nil, err
+	}
+	return edges, nil
+}
+
+func (r *groupRepository) AddRole(ctx context.Context, input *GroupRole) error {
+	return transaction.DB(ctx, r.db).Create(input).Error
+}
+
+func (r *groupRepository) RemoveRole(ctx context.Context, groupID int64, role string) error {
+	res := transaction.DB(ctx, r.db).Delete(&GroupRole{}, "group_id = ? AND role = ?", groupID, role)
+	if res.Error != nil {
+		return res.Error
+	}
+
+	rows := res.RowsAffected
+	if rows == 0 {
+		return errors.New("group role not found")
+	}
+
+	return nil
+}
+
+func (r *groupRepository) ListRoles(ctx context.Context, groupIDs []int64) (roles []*GroupRole, err error) {
+	err = transaction.DB(ctx, r.db).
+		Where("group_id IN ?", groupIDs).
+		Order("group_id, role").
+		Find(&roles).Error
+	if err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
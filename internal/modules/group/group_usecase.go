@@ -0,0 +1,408 @@
+package group
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/codepnw/go-authen-system/internal/modules/audit"
+	"github.com/codepnw/go-authen-system/internal/modules/user"
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+	"github.com/codepnw/go-authen-system/internal/utils/security"
+	"github.com/codepnw/go-authen-system/pkg/logger"
+)
+
+const queryTimeout = time.Second * 5
+
+const (
+	SourceDirect = "direct"
+	SourceGroup  = "group"
+)
+
+type GroupUsecase interface {
+	Create(ctx context.Context, req *CreateGroupRequest) (*Group, error)
+	List(ctx context.Context) ([]*Group, error)
+	Get(ctx context.Context, id int64) (*GroupDetailDTO, error)
+	Delete(ctx context.Context, id int64) error
+
+	AddMember(ctx context.Context, groupID int64, req *AddMemberRequest) error
+	RemoveUser(ctx context.Context, groupID, userID int64) error
+	RemoveSubgroup(ctx context.Context, groupID, memberGroupID int64) error
+	GrantRole(ctx context.Context, groupID int64, role string) error
+	RevokeRole(ctx context.Context, groupID int64, role string) error
+
+	EffectiveRoles(ctx context.Context, u *user.User) ([]string, error)
+	GetAccess(ctx context.Context, userID int64) (*AccessDTO, error)
+	ExplainPermission(ctx context.Context, userID int64, permission string) (*PermissionExplanationDTO, error)
+}
+
+type groupUsecase struct {
+	repo        GroupRepository
+	userUsecase user.UserUsecase
+	recorder    audit.Recorder
+}
+
+func NewGroupUsecase(repo GroupRepository, userUsecase user.UserUsecase, recorder audit.Recorder) GroupUsecase {
+	return &groupUsecase{
+		repo:        repo,
+		userUsecase: userUsecase,
+		recorder:    recorder,
+	}
+}
+
+func (uc *groupUsecase) Create(ctx context.Context, req *CreateGroupRequest) (*Group, error) {
+	group, err := uc.repo.Create(ctx, &Group{
+		Name:        req.Name,
+		Description: req.Description,
+	})
+	if err != nil {
+		logger.Error("GROUP-CREATE-001", "create group failed", err)
+		return nil, err
+	}
+
+	logger.Info("GROUP-CREATE-002", "group created", group)
+	uc.record(ctx, audit.EventGroup, group.ID, audit.Metadata{"action": "create"})
+	return group, nil
+}
+
+func (uc *groupUsecase) List(ctx context.Context) ([]*Group, error) {
+	return uc.repo.List(ctx)
+}
+
+func (uc *groupUsecase) Get(ctx context.Context, id int64) (*GroupDetailDTO, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	group, err := uc.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := uc.repo.ListMembers(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	grants, err := uc.repo.ListRoles(ctx, []int64{id})
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make([]string, 0, len(grants))
+	for _, g := range grants {
+		roles = append(roles, g.Role)
+	}
+
+	return &GroupDetailDTO{
+		Group:   group,
+		Members: members,
+		Roles:   roles,
+	}, nil
+}
+
+func (uc *groupUsecase) Delete(ctx context.Context, id int64) error {
+	if err := uc.repo.Delete(ctx, id); err != nil {
+		logger.Error("GROUP-DELETE-001", "delete group failed", err)
+		return err
+	}
+
+	logger.Info("GROUP-DELETE-002", "group deleted", id)
+	uc.record(ctx, audit.EventGroup, id, audit.Metadata{"action": "delete"})
+	return nil
+}
+
+func (uc *groupUsecase) AddMember(ctx context.Context, groupID int64, req *AddMemberRequest) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	if _, err := uc.repo.FindByID(ctx, groupID); err != nil {
+		return err
+	}
+
+	member := &GroupMember{GroupID: groupID}
+
+	switch {
+	case req.UserID != nil:
+		if _, err := uc.userUsecase.GetProfile(ctx, *req.UserID); err != nil {
+			return err
+		}
+		member.UserID = req.UserID
+
+	case req.GroupID != nil:
+		if _, err := uc.repo.FindByID(ctx, *req.GroupID); err != nil {
+			return err
+		}
+
+		// Nesting the group under one of its own descendants loops forever
+		cycle, err := uc.wouldCycle(ctx, groupID, *req.GroupID)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			logger.Error("GROUP-MEMBER-001", "nested group cycle", errs.ErrGroupCycle)
+			return errs.ErrGroupCycle
+		}
+		member.MemberGroupID = req.GroupID
+	}
+
+	if err := uc.repo.AddMember(ctx, member); err != nil {
+		logger.Error("GROUP-MEMBER-002", "add group member failed", err)
+		return err
+	}
+
+	logger.Info("GROUP-MEMBER-003", "group member added", member)
+	uc.record(ctx, audit.EventGroup, groupID, audit.Metadata{"action": "member_add", "user_id": req.UserID, "group_id": req.GroupID})
+	return nil
+}
+
+func (uc *groupUsecase) RemoveUser(ctx context.Context, groupID, userID int64) error {
+	if err := uc.repo.RemoveUser(ctx, groupID, userID); err != nil {
+		logger.Error("GROUP-MEMBER-004", "remove group user failed", err)
+		return err
+	}
+
+	logger.Info("GROUP-MEMBER-005", "group user removed", map[string]int64{"group_id": groupID, "user_id": userID})
+	uc.record(ctx, audit.EventGroup, groupID, audit.Metadata{"action": "member_remove", "user_id": userID})
+	return nil
+}
+
+func (uc *groupUsecase) RemoveSubgroup(ctx context.Context, groupID, memberGroupID int64) error {
+	if err := uc.repo.RemoveSubgroup(ctx, groupID, memberGroupID); err != nil {
+		logger.Error("GROUP-MEMBER-006", "remove nested group failed", err)
+		return err
+	}
+
+	logger.Info("GROUP-MEMBER-007", "nested group removed", map[string]int64{"group_id": groupID, "member_group_id": memberGroupID})
+	uc.record(ctx, audit.EventGroup, groupID, audit.Metadata{"action": "member_remove", "group_id": memberGroupID})
+	return nil
+}
+
+func (uc *groupUsecase) GrantRole(ctx context.Context, groupID int64, role string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	if !security.IsKnownRole(role) {
+		return errs.ErrUnknownRole
+	}
+
+	if _, err := uc.repo.FindByID(ctx, groupID); err != nil {
+		return err
+	}
+
+	grant := &GroupRole{GroupID: groupID, Role: role}
+	if err := uc.repo.AddRole(ctx, grant); err != nil {
+		logger.Error("GROUP-ROLE-001", "grant group role failed", err)
+		return err
+	}
+
+	logger.Info("GROUP-ROLE-002", "group role granted", grant)
+	uc.record(ctx, audit.EventRoleGrant, groupID, audit.Metadata{"role": role})
+	return nil
+}
+
+func (uc *groupUsecase) RevokeRole(ctx context.Context, groupID int64, role string) error {
+	if err := uc.repo.RemoveRole(ctx, groupID, role); err != nil {
+		logger.Error("GROUP-ROLE-003", "revoke group role failed", err)
+		return err
+	}
+
+	logger.Info("GROUP-ROLE-004", "group role revoked", map[string]any{"group_id": groupID, "role": role})
+	uc.record(ctx, audit.EventRoleRevoke, groupID, audit.Metadata{"role": role})
+	return nil
+}
+
+// EffectiveRoles merges the user's own role with every role granted to the
+// groups they belong to, directly or through nesting.
+func (uc *groupUsecase) EffectiveRoles(ctx context.Context, u *user.User) ([]string, error) {
+	grants, err := uc.resolveGrants(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	return rolesOf(grants), nil
+}
+
+func (uc *groupUsecase) GetAccess(ctx context.Context, userID int64) (*AccessDTO, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	u, err := uc.userUsecase.GetProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	grants, err := uc.resolveGrants(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := rolesOf(grants)
+
+	return &AccessDTO{
+		UserID:      u.ID,
+		Roles:       roles,
+		Permissions: security.Permissions(roles),
+		Grants:      grants,
+	}, nil
+}
+
+// ExplainPermission lists every grant path that gives the user the permission.
+func (uc *groupUsecase) ExplainPermission(ctx context.Context, userID int64, permission string) (*PermissionExplanationDTO, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	u, err := uc.userUsecase.GetProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	grants, err := uc.resolveGrants(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make([]*GrantDTO, 0)
+	for _, g := range grants {
+		if security.RoleGrants(g.Role, permission) {
+			matched = append(matched, g)
+		}
+	}
+
+	return &PermissionExplanationDTO{
+		UserID:     u.ID,
+		Permission: permission,
+		Granted:    len(matched) > 0,
+		Grants:     matched,
+	}, nil
+}
+
+// ------------- Private -------------
+func (uc *groupUsecase) record(ctx context.Context, eventType string, groupID int64, metadata audit.Metadata) {
+	uc.recorder.Record(ctx, &audit.Event{
+		Type:       eventType,
+		TargetID:   groupID,
+		TargetType: audit.KindGroup,
+		Outcome:    audit.OutcomeSuccess,
+		Metadata:   metadata,
+	})
+}
+
+// resolveGrants walks from the user's groups up through every parent group.
+// Each group is visited once, so cycles in the data can not loop, and the
+// first (shortest) path to a group is the one reported.
+func (uc *groupUsecase) resolveGrants(ctx context.Context, u *user.User) ([]*GrantDTO, error) {
+	grants := []*GrantDTO{{Role: u.Role, Source: SourceDirect}}
+
+	direct, err := uc.repo.ListUserGroupIDs(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[int64][]int64, len(direct))
+	frontier := make([]int64, 0, len(direct))
+	for _, id := range direct {
+		paths[id] = []int64{id}
+		frontier = append(frontier, id)
+	}
+
+	for len(frontier) > 0 {
+		edges, err := uc.repo.ListParentEdges(ctx, frontier)
+		if err != nil {
+			return nil, err
+		}
+
+		next := make([]int64, 0)
+		for _, e := range edges {
+			child := *e.MemberGroupID
+			if _, seen := paths[e.GroupID]; seen {
+				if slices.Contains(paths[child], e.GroupID) {
+					logger.Error("GROUP-RESOLVE-001", "nested group cycle skipped", errs.ErrGroupCycle)
+				}
+				continue
+			}
+
+			paths[e.GroupID] = append(slices.Clone(paths[child]), e.GroupID)
+			next = append(next, e.GroupID)
+		}
+		frontier = next
+	}
+
+	if len(paths) == 0 {
+		return grants, nil
+	}
+
+	ids := make([]int64, 0, len(paths))
+	for id := range paths {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	groupRoles, err := uc.repo.ListRoles(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := uc.repo.FindByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[int64]string, len(groups))
+	for _, g := range groups {
+		names[g.ID] = g.Name
+	}
+
+	for _, gr := range groupRoles {
+		path := make([]*GroupRefDTO, 0, len(paths[gr.GroupID]))
+		for _, id := range paths[gr.GroupID] {
+			path = append(path, &GroupRefDTO{ID: id, Name: names[id]})
+		}
+
+		grants = append(grants, &GrantDTO{
+			Role:   gr.Role,
+			Source: SourceGroup,
+			Path:   path,
+		})
+	}
+
+	return grants, nil
+}
+
+// wouldCycle reports whether nesting child under parent makes parent its own
+// descendant, i.e. child is already parent or one of parent's ancestors.
+func (uc *groupUsecase) wouldCycle(ctx context.Context, parentID, childID int64) (bool, error) {
+	visited := map[int64]bool{parentID: true}
+	frontier := []int64{parentID}
+
+	for len(frontier) > 0 {
+		if visited[childID] {
+			return true, nil
+		}
+
+		edges, err := uc.repo.ListParentEdges(ctx, frontier)
+		if err != nil {
+			return false, err
+		}
+
+		next := make([]int64, 0)
+		for _, e := range edges {
+			if !visited[e.GroupID] {
+				visited[e.GroupID] = true
+				next = append(next, e.GroupID)
+			}
+		}
+		frontier = next
+	}
+
+	return visited[childID], nil
+}
+
+func rolesOf(grants []*GrantDTO) []string {
+	roles := make([]string, 0, len(grants))
+	for _, g := range grants {
+		if g.Role != "" && !slices.Contains(roles, g.Role) {
+			roles = append(roles, g.Role)
+		}
+	}
+	slices.Sort(roles)
+	return roles
+}
@@ -0,0 +1,17 @@
+package keys
+
+import "time"
+
+// SigningKey signs JWTs of one purpose. The newest key of a purpose signs new
+// tokens, retired keys keep verifying until tokens signed with them expire.
+type SigningKey struct {
+	ID        string     `json:"kid" gorm:"primaryKey"`
+	Purpose   string     `json:"purpose" gorm:"not null;index"`
+	Secret    string     `json:"-" gorm:"not null"`
+	CreatedAt time.Time  `json:"created_at" gorm:"not null"`
+	RetiredAt *time.Time `json:"retired_at"`
+}
+
+func (SigningKey) TableName() string {
+	return "signing_keys"
+}
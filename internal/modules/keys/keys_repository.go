@@ -0,0 +1,47 @@
+package keys
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type KeyRepository interface {
+	// Rotate stores the new key and retires the current keys of its purpose.
+	Rotate(ctx context.Context, input *SigningKey) error
+	// ListValid returns keys not retired before since, newest first.
+	ListValid(ctx context.Context, since time.Time) ([]*SigningKey, error)
+}
+
+type keyRepository struct {
+	db *gorm.DB
+}
+
+func NewKeyRepository(db *gorm.DB) KeyRepository {
+	return &keyRepository{db: db}
+}
+
+func (r *keyRepository) Rotate(ctx context.Context, input *SigningKey) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&SigningKey{}).
+			Where("purpose = ? AND retired_at IS NULL", input.Purpose).
+			Update("retired_at", input.CreatedAt).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(input).Error
+	})
+}
+
+func (r *keyRepository) ListValid(ctx context.Context, since time.Time) (keys []*SigningKey, err error) {
+	err = r.db.WithContext(ctx).
+		Where("retired_at IS NULL OR retired_at > ?", since).
+		Order("created_at DESC").
+		Find(&keys).Error
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
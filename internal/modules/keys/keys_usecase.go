@@ -0,0 +1,86 @@
+package keys
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/codepnw/go-authen-system/config"
+	"github.com/codepnw/go-authen-system/internal/modules/audit"
+	"github.com/codepnw/go-authen-system/internal/utils/security"
+)
+
+type KeyUsecase interface {
+	Rotate(ctx context.Context, purpose string) (*SigningKey, error)
+	Load(ctx context.Context) ([]config.JWTKey, error)
+}
+
+type keyUsecase struct {
+	repo     KeyRepository
+	recorder audit.Recorder
+}
+
+func NewKeyUsecase(repo KeyRepository, recorder audit.Recorder) KeyUsecase {
+	return &keyUsecase{
+		repo:     repo,
+		recorder: recorder,
+	}
+}
+
+// Rotate creates a new signing key for purpose. Running servers pick it up on
+// their next start.
+func (uc *keyUsecase) Rotate(ctx context.Context, purpose string) (*SigningKey, error) {
+	if purpose != security.KeyPurposeAccess && purpose != security.KeyPurposeRefresh {
+		return nil, fmt.Errorf("unknown key purpose %q", purpose)
+	}
+
+	id, err := security.RandomToken(8)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := security.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{
+		ID:        id,
+		Purpose:   purpose,
+		Secret:    secret,
+		CreatedAt: time.Now(),
+	}
+
+	if err = uc.repo.Rotate(ctx, key); err != nil {
+		return nil, err
+	}
+
+	uc.recorder.Record(ctx, &audit.Event{
+		Type:    audit.EventKeyRotate,
+		Outcome: audit.OutcomeSuccess,
+		Metadata: audit.Metadata{
+			"kid":     key.ID,
+			"purpose": key.Purpose,
+		},
+	})
+	return key, nil
+}
+
+// Load returns the keys tokens may still be signed with. A key retired longer
+// ago than the refresh token lifetime can not have signed a live token.
+func (uc *keyUsecase) Load(ctx context.Context) ([]config.JWTKey, error) {
+	found, err := uc.repo.ListValid(ctx, time.Now().Add(-security.RefreshTokenDuration))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]config.JWTKey, 0, len(found))
+	for _, k := range found {
+		keys = append(keys, config.JWTKey{
+			ID:      k.ID,
+			Purpose: k.Purpose,
+			Secret:  k.Secret,
+		})
+	}
+	return keys, nil
+}
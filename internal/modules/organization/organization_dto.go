@@ -0,0 +1,36 @@
+package organization
+
+import (
+	"time"
+
+	"github.com/codepnw/go-authen-system/internal/modules/user"
+)
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name" validate:"required"`
+	Slug string `json:"slug" validate:"required,min=2,max=64,alphanum"`
+}
+
+type AddMemberRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"required,oneof=owner admin member"`
+}
+
+type UpdateMemberRequest struct {
+	Role string `json:"role" validate:"required,oneof=owner admin member"`
+}
+
+type MemberResponseDTO struct {
+	User     *user.User `json:"user"`
+	Role     string     `json:"role"`
+	JoinedAt time.Time  `json:"joined_at"`
+}
+
+type InviteRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"required,oneof=owner admin member"`
+}
+
+type InvitationTokenRequest struct {
+	Token string `json:"token" validate:"required"`
+}
@@ -0,0 +1,55 @@
+package organization
+
+import "time"
+
+// Roles a user can hold inside an organization
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+type Organization struct {
+	ID        int64      `json:"id" gorm:"primaryKey"`
+	Name      string     `json:"name" gorm:"not null"`
+	Slug      string     `json:"slug" gorm:"unique;not null"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// Membership links a user to an organization with a per-org role.
+type Membership struct {
+	ID             int64         `json:"id" gorm:"primaryKey"`
+	OrganizationID int64         `json:"organization_id" gorm:"not null;uniqueIndex:idx_memberships_org_user"`
+	UserID         int64         `json:"user_id" gorm:"not null;uniqueIndex:idx_memberships_org_user"`
+	Role           string        `json:"role" gorm:"not null;default:member"`
+	CreatedAt      time.Time     `json:"created_at"`
+	Organization   *Organization `json:"organization,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+}
+
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationDeclined = "declined"
+	InvitationRevoked  = "revoked"
+)
+
+// Invitation asks someone, by email, to join an organization. Nonce is
+// embedded in the signed invite token and rotated on resend.
+type Invitation struct {
+	ID             int64         `json:"id" gorm:"primaryKey"`
+	OrganizationID int64         `json:"organization_id" gorm:"not null;index"`
+	Email          string        `json:"email" gorm:"not null;index"`
+	Role           string        `json:"role" gorm:"not null;default:member"`
+	Status         string        `json:"status" gorm:"not null;default:pending"`
+	InvitedBy      int64         `json:"invited_by" gorm:"not null"`
+	Nonce          string        `json:"-" gorm:"not null"`
+	ExpiresAt      time.Time     `json:"expires_at"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      *time.Time    `json:"updated_at"`
+	Organization   *Organization `json:"organization,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+}
+
+func (i *Invitation) IsExpired() bool {
+	return time.Now().After(i.ExpiresAt)
+}
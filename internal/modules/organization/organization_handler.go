@@ -0,0 +1,368 @@
+package organization
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/codepnw/go-authen-system/internal/middleware"
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+	"github.com/codepnw/go-authen-system/internal/utils/response"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type organizationHandler struct {
+	validate *validator.Validate
+	uc       OrganizationUsecase
+}
+
+func NewOrganizationHandler(uc OrganizationUsecase) *organizationHandler {
+	return &organizationHandler{
+		validate: validator.New(),
+		uc:       uc,
+	}
+}
+
+func (h *organizationHandler) Create(c *gin.Context) {
+	actor, ok := middleware.CurrentUser(c)
+	if !ok {
+		response.Unauthorized(c, errs.ErrInvalidToken)
+		return
+	}
+
+	req := new(CreateOrganizationRequest)
+
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	org, err := h.uc.Create(c, actor.ID, req)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Created(c, org)
+}
+
+// ListMine returns the organizations of the current user with their role.
+func (h *organizationHandler) ListMine(c *gin.Context) {
+	actor, ok := middleware.CurrentUser(c)
+	if !ok {
+		response.Unauthorized(c, errs.ErrInvalidToken)
+		return
+	}
+
+	memberships, err := h.uc.ListUserMemberships(c, actor.ID)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, "", memberships)
+}
+
+func (h *organizationHandler) ListMembers(c *gin.Context) {
+	actor, orgID, ok := h.orgParams(c)
+	if !ok {
+		return
+	}
+
+	members, err := h.uc.ListMembers(c, actor, orgID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response.Success(c, "", members)
+}
+
+func (h *organizationHandler) GetMember(c *gin.Context) {
+	actor, orgID, ok := h.orgParams(c)
+	if !ok {
+		return
+	}
+
+	userID, err := getIntParamID(c.Param("userID"))
+	if err != nil {
+		response.BadRequest(c, "invalid user id", err)
+		return
+	}
+
+	member, err := h.uc.GetMember(c, actor, orgID, userID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response.Success(c, "", member)
+}
+
+func (h *organizationHandler) AddMember(c *gin.Context) {
+	actor, orgID, ok := h.orgParams(c)
+	if !ok {
+		return
+	}
+
+	req := new(AddMemberRequest)
+
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	invitation, err := h.uc.AddMember(c, actor, orgID, req)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response.Created(c, invitation)
+}
+
+func (h *organizationHandler) UpdateMember(c *gin.Context) {
+	actor, orgID, ok := h.orgParams(c)
+	if !ok {
+		return
+	}
+
+	userID, err := getIntParamID(c.Param("userID"))
+	if err != nil {
+		response.BadRequest(c, "invalid user id", err)
+		return
+	}
+
+	req := new(UpdateMemberRequest)
+
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err = h.uc.UpdateMember(c, actor, orgID, userID, req); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response.Success(c, "member updated", nil)
+}
+
+func (h *organizationHandler) RemoveMember(c *gin.Context) {
+	actor, orgID, ok := h.orgParams(c)
+	if !ok {
+		return
+	}
+
+	userID, err := getIntParamID(c.Param("userID"))
+	if err != nil {
+		response.BadRequest(c, "invalid user id", err)
+		return
+	}
+
+	if err = h.uc.RemoveMember(c, actor, orgID, userID); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response.Success(c, "member removed", nil)
+}
+
+func (h *organizationHandler) Invite(c *gin.Context) {
+	actor, orgID, ok := h.orgParams(c)
+	if !ok {
+		return
+	}
+
+	req := new(InviteRequest)
+
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	invitation, err := h.uc.Invite(c, actor, orgID, req)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response.Created(c, invitation)
+}
+
+// ListInvitations defaults to pending invitations, ?status= selects others.
+func (h *organizationHandler) ListInvitations(c *gin.Context) {
+	actor, orgID, ok := h.orgParams(c)
+	if !ok {
+		return
+	}
+
+	status := c.DefaultQuery("status", InvitationPending)
+	if status == "all" {
+		status = ""
+	}
+
+	invitations, err := h.uc.ListInvitations(c, actor, orgID, status)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response.Success(c, "", invitations)
+}
+
+func (h *organizationHandler) ResendInvitation(c *gin.Context) {
+	actor, orgID, ok := h.orgParams(c)
+	if !ok {
+		return
+	}
+
+	invitationID, err := getIntParamID(c.Param("invitationID"))
+	if err != nil {
+		response.BadRequest(c, "invalid invitation id", err)
+		return
+	}
+
+	if err = h.uc.ResendInvitation(c, actor, orgID, invitationID); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response.Success(c, "invitation resent", nil)
+}
+
+func (h *organizationHandler) RevokeInvitation(c *gin.Context) {
+	actor, orgID, ok := h.orgParams(c)
+	if !ok {
+		return
+	}
+
+	invitationID, err := getIntParamID(c.Param("invitationID"))
+	if err != nil {
+		response.BadRequest(c, "invalid invitation id", err)
+		return
+	}
+
+	if err = h.uc.RevokeInvitation(c, actor, orgID, invitationID); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response.Success(c, "invitation revoked", nil)
+}
+
+// GetInvitation lets an invitee preview an invitation before answering it.
+func (h *organizationHandler) GetInvitation(c *gin.Context) {
+	invitation, err := h.uc.GetInvitationByToken(c, c.Query("token"))
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response.Success(c, "", invitation)
+}
+
+func (h *organizationHandler) AcceptInvitation(c *gin.Context) {
+	current, ok := middleware.CurrentUser(c)
+	if !ok {
+		response.Unauthorized(c, errs.ErrInvalidToken)
+		return
+	}
+
+	req := new(InvitationTokenRequest)
+
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	membership, err := h.uc.AcceptInvitation(c, req.Token, current.ID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response.Success(c, "invitation accepted", membership)
+}
+
+func (h *organizationHandler) DeclineInvitation(c *gin.Context) {
+	req := new(InvitationTokenRequest)
+
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.uc.DeclineInvitation(c, req.Token); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response.Success(c, "invitation declined", nil)
+}
+
+// orgParams writes the error response itself when it returns false.
+func (h *organizationHandler) orgParams(c *gin.Context) (actorID, orgID int64, ok bool) {
+	actor, ok := middleware.CurrentUser(c)
+	if !ok {
+		response.Unauthorized(c, errs.ErrInvalidToken)
+		return 0, 0, false
+	}
+
+	orgID, err := getIntParamID(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid id", err)
+		return 0, 0, false
+	}
+
+	return actor.ID, orgID, true
+}
+
+func handleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errs.ErrNotOrgMember), errors.Is(err, errs.ErrOrgPermissionDenied):
+		response.Forbidden(c, err)
+	case errors.Is(err, errs.ErrInvitationEmail):
+		response.Forbidden(c, err)
+	case errors.Is(err, errs.ErrLastOrgOwner),
+		errors.Is(err, errs.ErrAlreadyOrgMember),
+		errors.Is(err, errs.ErrInvalidInvitation):
+		response.BadRequest(c, "", err)
+	default:
+		response.InternalServerError(c, err)
+	}
+}
+
+func getIntParamID(key string) (int64, error) {
+	return strconv.ParseInt(key, 10, 64)
+}
@@ -0,0 +1,219 @@
+package organization
+
+import (
+	"context"
+	"errors"
+
+	"github.com/codepnw/go-authen-system/internal/utils/transaction"
+	"gorm.io/gorm"
+)
+
+type OrganizationRepository interface {
+	Create(ctx context.Context, input *Organization, owner *Membership) (*Organization, error)
+	FindByID(ctx context.Context, id int64) (*Organization, error)
+	FindBySlug(ctx context.Context, slug string) (*Organization, error)
+	FindMembership(ctx context.Context, orgID, userID int64) (*Membership, error)
+	ListMemberships(ctx context.Context, orgID int64) ([]*Membership, error)
+	ListUserMemberships(ctx context.Context, userID int64) ([]*Membership, error)
+	CreateMembership(ctx context.Context, input *Membership) error
+	UpdateMembership(ctx context.Context, input *Membership) error
+	DeleteMembership(ctx context.Context, orgID, userID int64) error
+	CountMembersWithRole(ctx context.Context, orgID int64, role string) (int64, error)
+
+	CreateInvitation(ctx context.Context, input *Invitation) error
+	FindInvitation(ctx context.Context, id int64) (*Invitation, error)
+	FindPendingInvitation(ctx context.Context, orgID int64, email string) (*Invitation, error)
+	ListInvitations(ctx context.Context, orgID int64, status string) ([]*Invitation, error)
+	UpdateInvitation(ctx context.Context, input *Invitation) error
+	AcceptInvitation(ctx context.Context, input *Invitation, membership *Membership) error
+}
+
+type organizationRepository struct {
+	db *gorm.DB
+}
+
+func NewOrganizationRepository(db *gorm.DB) OrganizationRepository {
+	return &organizationRepository{db: db}
+}
+
+// Create stores the organization together with its first owner.
+func (r *organizationRepository) Create(ctx context.Context, input *Organization, owner *Membership) (*Organization, error) {
+	err := transaction.DB(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(input).Error; err != nil {
+			return err
+		}
+
+		owner.OrganizationID = input.ID
+		return tx.Create(owner).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return input, nil
+}
+
+func (r *organizationRepository) FindByID(ctx context.Context, id int64) (org *Organization, err error) {
+	if err = transaction.DB(ctx, r.db).First(&org, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+func (r *organizationRepository) FindBySlug(ctx context.Context, slug string) (org *Organization, err error) {
+	err = transaction.DB(ctx, r.db).First(&org, "slug = ?", slug).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return org, nil
+}
+
+func (r *organizationRepository) FindMembership(ctx context.Context, orgID, userID int64) (membership *Membership, err error) {
+	err = transaction.DB(ctx, r.db).
+		Preload("Organization").
+		First(&membership, "organization_id = ? AND user_id = ?", orgID, userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return membership, nil
+}
+
+func (r *organizationRepository) ListMemberships(ctx context.Context, orgID int64) (memberships []*Membership, err error) {
+	err = transaction.DB(ctx, r.db).Where("organization_id = ?", orgID).Order("id").Find(&memberships).Error
+	if err != nil {
+		return nil, err
+	}
+	return memberships, nil
+}
+
+func (r *organizationRepository) ListUserMemberships(ctx context.Context, userID int64) (memberships []*Membership, err error) {
+	err = transaction.DB(ctx, r.db).
+		Preload("Organization").
+		Where("user_id = ?", userID).
+		Order("id").
+		Find(&memberships).Error
+	if err != nil {
+		return nil, err
+	}
+	return memberships, nil
+}
+
+func (r *organizationRepository) CreateMembership(ctx context.Context, input *Membership) error {
+	return transaction.DB(ctx, r.db).Create(input).Error
+}
+
+func (r *organizationRepository) UpdateMembership(ctx context.Context, input *Membership) error {
+	res := transaction.DB(ctx, r.db).
+		Model(&Membership{}).
+		Where("organization_id = ? AND user_id = ?", input.OrganizationID, input.UserID).
+		Update("role", input.Role)
+	if res.Error != nil {
+		return res.Error
+	}
+
+	rows := res.RowsAffected
+	if rows == 0 {
+		return errors.New("membership not found")
+	}
+
+	return nil
+}
+
+func (r *organizationRepository) DeleteMembership(ctx context.Context, orgID, userID int64) error {
+	res := transaction.DB(ctx, r.db).Delete(&Membership{}, "organization_id = ? AND user_id = ?", orgID, userID)
+	if res.Error != nil {
+		return res.Error
+	}
+
+	rows := res.RowsAffected
+	if rows == 0 {
+		return errors.New("membership not found")
+	}
+
+	return nil
+}
+
+func (r *organizationRepository) CountMembersWithRole(ctx context.Context, orgID int64, role string) (count int64, err error) {
+	err = transaction.DB(ctx, r.db).
+		Model(&Membership{}).
+		Where("organization_id = ? AND role = ?", orgID, role).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *organizationRepository) CreateInvitation(ctx context.Context, input *Invitation) error {
+	return transaction.DB(ctx, r.db).Create(input).Error
+}
+
+func (r *organizationRepository) FindInvitation(ctx context.Context, id int64) (invitation *Invitation, err error) {
+	err = transaction.DB(ctx, r.db).Preload("Organization").First(&invitation, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+func (r *organizationRepository) FindPendingInvitation(ctx context.Context, orgID int64, email string) (invitation *Invitation, err error) {
+	err = transaction.DB(ctx, r.db).
+		First(&invitation, "organization_id = ? AND email = ? AND status = ?", orgID, email, InvitationPending).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+func (r *organizationRepository) ListInvitations(ctx context.Context, orgID int64, status string) (invitations []*Invitation, err error) {
+	query := transaction.DB(ctx, r.db).Where("organization_id = ?", orgID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err = query.Order("id").Find(&invitations).Error; err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+func (r *organizationRepository) UpdateInvitation(ctx context.Context, input *Invitation) error {
+	res := transaction.DB(ctx, r.db).Omit("Organization").Save(input)
+	if res.Error != nil {
+		return res.Error
+	}
+
+	rows := res.RowsAffected
+	if rows == 0 {
+		return errors.New("invitation not found")
+	}
+
+	return nil
+}
+
+// AcceptInvitation marks the invitation accepted and creates the membership
+// in one transaction.
+func (r *organizationRepository) AcceptInvitation(ctx context.Context, input *Invitation, membership *Membership) error {
+	return transaction.DB(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&Invitation{}).
+			Where("id = ? AND status = ?", input.ID, InvitationPending).
+			Updates(map[string]any{"status": InvitationAccepted, "updated_at": input.UpdatedAt})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("invitation is no longer pending")
+		}
+
+		return tx.Create(membership).Error
+	})
+}
@@ -0,0 +1,563 @@
+package organization
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/codepnw/go-authen-system/config"
+	"github.com/codepnw/go-authen-system/internal/modules/audit"
+	"github.com/codepnw/go-authen-system/internal/modules/user"
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+	"github.com/codepnw/go-authen-system/internal/utils/security"
+	"github.com/codepnw/go-authen-system/pkg/logger"
+	"github.com/codepnw/go-authen-system/pkg/mailer"
+)
+
+const (
+	queryTimeout       = time.Second * 5
+	invitationDuration = time.Hour * 24 * 7
+)
+
+type OrganizationUsecase interface {
+	Create(ctx context.Context, userID int64, req *CreateOrganizationRequest) (*Organization, error)
+	GetMembership(ctx context.Context, orgID, userID int64) (*Membership, error)
+	ListUserMemberships(ctx context.Context, userID int64) ([]*Membership, error)
+	ListMembers(ctx context.Context, actorID, orgID int64) ([]*MemberResponseDTO, error)
+	GetMember(ctx context.Context, actorID, orgID, userID int64) (*MemberResponseDTO, error)
+	AddMember(ctx context.Context, actorID, orgID int64, req *AddMemberRequest) (*Invitation, error)
+	UpdateMember(ctx context.Context, actorID, orgID, userID int64, req *UpdateMemberRequest) error
+	RemoveMember(ctx context.Context, actorID, orgID, userID int64) error
+
+	Invite(ctx context.Context, actorID, orgID int64, req *InviteRequest) (*Invitation, error)
+	ListInvitations(ctx context.Context, actorID, orgID int64, status string) ([]*Invitation, error)
+	ResendInvitation(ctx context.Context, actorID, orgID, invitationID int64) error
+	RevokeInvitation(ctx context.Context, actorID, orgID, invitationID int64) error
+	GetInvitationByToken(ctx context.Context, token string) (*Invitation, error)
+	AcceptInvitation(ctx context.Context, token string, userID int64) (*Membership, error)
+	DeclineInvitation(ctx context.Context, token string) error
+}
+
+type organizationUsecase struct {
+	repo        OrganizationRepository
+	userUsecase user.UserUsecase
+	mailer      mailer.Mailer
+	recorder    audit.Recorder
+	tokenConfig *security.TokenConfig
+	baseURL     string
+}
+
+func NewOrganizationUsecase(cfg *config.Config, repo OrganizationRepository, userUsecase user.UserUsecase, mail mailer.Mailer, recorder audit.Recorder) OrganizationUsecase {
+	return &organizationUsecase{
+		repo:        repo,
+		userUsecase: userUsecase,
+		mailer:      mail,
+		recorder:    recorder,
+		tokenConfig: security.NewJWTToken(cfg),
+		baseURL:     strings.TrimRight(cfg.AppBaseURL, "/"),
+	}
+}
+
+func (uc *organizationUsecase) Create(ctx context.Context, userID int64, req *CreateOrganizationRequest) (*Organization, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	// Check Slug
+	found, err := uc.repo.FindBySlug(ctx, req.Slug)
+	if err != nil {
+		return nil, err
+	}
+	if found != nil {
+		return nil, errors.New("slug already exists")
+	}
+
+	org, err := uc.repo.Create(ctx, &Organization{
+		Name: req.Name,
+		Slug: req.Slug,
+	}, &Membership{
+		UserID: userID,
+		Role:   RoleOwner,
+	})
+	if err != nil {
+		logger.Error("ORG-CREATE-001", "create organization failed", err)
+		return nil, err
+	}
+
+	logger.Info("ORG-CREATE-002", "organization created", org)
+	uc.record(ctx, audit.EventOrganization, org.ID, org.ID, audit.KindOrganization, audit.Metadata{"action": "create"})
+	return org, nil
+}
+
+// GetMembership returns errs.ErrNotOrgMember when the user does not belong to
+// the organization.
+func (uc *organizationUsecase) GetMembership(ctx context.Context, orgID, userID int64) (*Membership, error) {
+	membership, err := uc.repo.FindMembership(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if membership == nil {
+		return nil, errs.ErrNotOrgMember
+	}
+
+	return membership, nil
+}
+
+func (uc *organizationUsecase) ListUserMemberships(ctx context.Context, userID int64) ([]*Membership, error) {
+	return uc.repo.ListUserMemberships(ctx, userID)
+}
+
+func (uc *organizationUsecase) ListMembers(ctx context.Context, actorID, orgID int64) ([]*MemberResponseDTO, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	if _, err := uc.requireRole(ctx, orgID, actorID); err != nil {
+		return nil, err
+	}
+
+	memberships, err := uc.repo.ListMemberships(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := uc.userUsecase.GetTenantUsers(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int64]*user.User, len(users))
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+
+	members := make([]*MemberResponseDTO, 0, len(memberships))
+	for _, m := range memberships {
+		members = append(members, &MemberResponseDTO{
+			User:     byID[m.UserID],
+			Role:     m.Role,
+			JoinedAt: m.CreatedAt,
+		})
+	}
+
+	return members, nil
+}
+
+func (uc *organizationUsecase) GetMember(ctx context.Context, actorID, orgID, userID int64) (*MemberResponseDTO, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	if _, err := uc.requireRole(ctx, orgID, actorID); err != nil {
+		return nil, err
+	}
+
+	membership, err := uc.GetMembership(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := uc.userUsecase.GetTenantUser(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MemberResponseDTO{
+		User:     u,
+		Role:     membership.Role,
+		JoinedAt: membership.CreatedAt,
+	}, nil
+}
+
+// AddMember invites the user behind the email. Nobody joins an organization
+// without accepting, existing accounts get the same invitation as new ones.
+func (uc *organizationUsecase) AddMember(ctx context.Context, actorID, orgID int64, req *AddMemberRequest) (*Invitation, error) {
+	return uc.Invite(ctx, actorID, orgID, &InviteRequest{
+		Email: req.Email,
+		Role:  req.Role,
+	})
+}
+
+func (uc *organizationUsecase) UpdateMember(ctx context.Context, actorID, orgID, userID int64, req *UpdateMemberRequest) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	if err := uc.canGrant(ctx, orgID, actorID, req.Role); err != nil {
+		return err
+	}
+
+	membership, err := uc.GetMembership(ctx, orgID, userID)
+	if err != nil {
+		return err
+	}
+
+	// Only owners change the role of an owner
+	if err = uc.canGrant(ctx, orgID, actorID, membership.Role); err != nil {
+		return err
+	}
+
+	// Demoting the last owner would orphan the organization
+	if req.Role != RoleOwner {
+		if err = uc.keepOwner(ctx, membership); err != nil {
+			return err
+		}
+	}
+
+	previous := membership.Role
+	membership.Role = req.Role
+	if err = uc.repo.UpdateMembership(ctx, membership); err != nil {
+		logger.Error("ORG-MEMBER-003", "update membership failed", err)
+		return err
+	}
+
+	logger.Info("ORG-MEMBER-004", "member role changed", membership)
+	uc.record(ctx, audit.EventOrganizationMember, orgID, userID, audit.KindUser, audit.Metadata{"action": "role_change", "from": previous, "to": req.Role})
+	return nil
+}
+
+// RemoveMember lets admins remove members, owners remove owners and any
+// member leave on their own.
+func (uc *organizationUsecase) RemoveMember(ctx context.Context, actorID, orgID, userID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	membership, err := uc.GetMembership(ctx, orgID, userID)
+	if err != nil {
+		return err
+	}
+
+	if actorID != userID {
+		if err = uc.canGrant(ctx, orgID, actorID, membership.Role); err != nil {
+			return err
+		}
+	}
+
+	if err = uc.keepOwner(ctx, membership); err != nil {
+		return err
+	}
+
+	if err = uc.repo.DeleteMembership(ctx, orgID, userID); err != nil {
+		logger.Error("ORG-MEMBER-005", "delete membership failed", err)
+		return err
+	}
+
+	logger.Info("ORG-MEMBER-006", "member removed", membership)
+	uc.record(ctx, audit.EventOrganizationMember, orgID, userID, audit.KindUser, audit.Metadata{"action": "remove", "role": membership.Role})
+	return nil
+}
+
+func (uc *organizationUsecase) Invite(ctx context.Context, actorID, orgID int64, req *InviteRequest) (*Invitation, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	if err := uc.canGrant(ctx, orgID, actorID, req.Role); err != nil {
+		return nil, err
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+
+	// Existing Member
+	invitee, err := uc.userUsecase.GetUserByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if invitee != nil {
+		membership, err := uc.repo.FindMembership(ctx, orgID, invitee.ID)
+		if err != nil {
+			return nil, err
+		}
+		if membership != nil {
+			return nil, errs.ErrAlreadyOrgMember
+		}
+	}
+
+	// Pending Invitation
+	found, err := uc.repo.FindPendingInvitation(ctx, orgID, email)
+	if err != nil {
+		return nil, err
+	}
+	if found != nil {
+		return nil, errors.New("invitation already pending, resend it instead")
+	}
+
+	nonce, err := security.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	invitation := &Invitation{
+		OrganizationID: orgID,
+		Email:          email,
+		Role:           req.Role,
+		Status:         InvitationPending,
+		InvitedBy:      actorID,
+		Nonce:          nonce,
+		ExpiresAt:      time.Now().Add(invitationDuration),
+	}
+	if err = uc.repo.CreateInvitation(ctx, invitation); err != nil {
+		logger.Error("ORG-INVITE-001", "create invitation failed", err)
+		return nil, err
+	}
+
+	// Delivery problems should not lose the invitation, it can be resent
+	if err = uc.sendInvitation(ctx, invitation); err != nil {
+		logger.Error("ORG-INVITE-002", "send invitation failed", err)
+	}
+
+	logger.Info("ORG-INVITE-003", "invitation created", invitation)
+	uc.record(ctx, audit.EventOrganizationInvite, orgID, invitation.ID, audit.KindInvitation, audit.Metadata{"action": "create", "role": invitation.Role})
+	return invitation, nil
+}
+
+func (uc *organizationUsecase) ListInvitations(ctx context.Context, actorID, orgID int64, status string) ([]*Invitation, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	if _, err := uc.requireRole(ctx, orgID, actorID, RoleOwner, RoleAdmin); err != nil {
+		return nil, err
+	}
+
+	return uc.repo.ListInvitations(ctx, orgID, status)
+}
+
+// ResendInvitation rotates the nonce and expiry, so links sent earlier stop
+// working.
+func (uc *organizationUsecase) ResendInvitation(ctx context.Context, actorID, orgID, invitationID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	invitation, err := uc.pendingInvitation(ctx, actorID, orgID, invitationID)
+	if err != nil {
+		return err
+	}
+
+	nonce, err := security.RandomToken(16)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	invitation.Nonce = nonce
+	invitation.ExpiresAt = now.Add(invitationDuration)
+	invitation.UpdatedAt = &now
+
+	if err = uc.repo.UpdateInvitation(ctx, invitation); err != nil {
+		logger.Error("ORG-INVITE-004", "update invitation failed", err)
+		return err
+	}
+
+	if err = uc.sendInvitation(ctx, invitation); err != nil {
+		logger.Error("ORG-INVITE-005", "send invitation failed", err)
+		return err
+	}
+
+	logger.Info("ORG-INVITE-006", "invitation resent", invitation)
+	uc.record(ctx, audit.EventOrganizationInvite, invitation.OrganizationID, invitation.ID, audit.KindInvitation, audit.Metadata{"action": "resend"})
+	return nil
+}
+
+func (uc *organizationUsecase) RevokeInvitation(ctx context.Context, actorID, orgID, invitationID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	invitation, err := uc.pendingInvitation(ctx, actorID, orgID, invitationID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	invitation.Status = InvitationRevoked
+	invitation.UpdatedAt = &now
+
+	if err = uc.repo.UpdateInvitation(ctx, invitation); err != nil {
+		logger.Error("ORG-INVITE-007", "revoke invitation failed", err)
+		return err
+	}
+
+	logger.Info("ORG-INVITE-008", "invitation revoked", invitation)
+	uc.record(ctx, audit.EventOrganizationInvite, invitation.OrganizationID, invitation.ID, audit.KindInvitation, audit.Metadata{"action": "revoke"})
+	return nil
+}
+
+// GetInvitationByToken resolves a pending, unexpired invitation from its link.
+func (uc *organizationUsecase) GetInvitationByToken(ctx context.Context, token string) (*Invitation, error) {
+	action, err := uc.tokenConfig.VerifyActionToken(token, security.PurposeInvitation)
+	if err != nil {
+		return nil, errs.ErrInvalidInvitation
+	}
+
+	invitation, err := uc.repo.FindInvitation(ctx, action.Subject)
+	if err != nil {
+		return nil, errs.ErrInvalidInvitation
+	}
+
+	if invitation.Nonce != action.Nonce || invitation.Status != InvitationPending || invitation.IsExpired() {
+		return nil, errs.ErrInvalidInvitation
+	}
+
+	return invitation, nil
+}
+
+func (uc *organizationUsecase) AcceptInvitation(ctx context.Context, token string, userID int64) (*Membership, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	invitation, err := uc.GetInvitationByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := uc.userUsecase.GetProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(u.Email, invitation.Email) {
+		return nil, errs.ErrInvitationEmail
+	}
+
+	now := time.Now()
+	invitation.UpdatedAt = &now
+
+	membership := &Membership{
+		OrganizationID: invitation.OrganizationID,
+		UserID:         u.ID,
+		Role:           invitation.Role,
+	}
+	if err = uc.repo.AcceptInvitation(ctx, invitation, membership); err != nil {
+		logger.Error("ORG-INVITE-009", "accept invitation failed", err)
+		return nil, err
+	}
+
+	logger.Info("ORG-INVITE-010", "invitation accepted", invitation)
+	uc.record(ctx, audit.EventOrganizationInvite, invitation.OrganizationID, invitation.ID, audit.KindInvitation, audit.Metadata{"action": "accept"})
+	return membership, nil
+}
+
+func (uc *organizationUsecase) DeclineInvitation(ctx context.Context, token string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	invitation, err := uc.GetInvitationByToken(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	invitation.Status = InvitationDeclined
+	invitation.UpdatedAt = &now
+
+	if err = uc.repo.UpdateInvitation(ctx, invitation); err != nil {
+		logger.Error("ORG-INVITE-011", "decline invitation failed", err)
+		return err
+	}
+
+	logger.Info("ORG-INVITE-012", "invitation declined", invitation)
+	uc.record(ctx, audit.EventOrganizationInvite, invitation.OrganizationID, invitation.ID, audit.KindInvitation, audit.Metadata{"action": "decline"})
+	return nil
+}
+
+// ------------- Private -------------
+func (uc *organizationUsecase) record(ctx context.Context, eventType string, orgID, targetID int64, targetType string, metadata audit.Metadata) {
+	metadata["organization_id"] = orgID
+	uc.recorder.Record(ctx, &audit.Event{
+		Type:       eventType,
+		TargetID:   targetID,
+		TargetType: targetType,
+		Outcome:    audit.OutcomeSuccess,
+		Metadata:   metadata,
+	})
+}
+
+func (uc *organizationUsecase) pendingInvitation(ctx context.Context, actorID, orgID, invitationID int64) (*Invitation, error) {
+	if _, err := uc.requireRole(ctx, orgID, actorID, RoleOwner, RoleAdmin); err != nil {
+		return nil, err
+	}
+
+	invitation, err := uc.repo.FindInvitation(ctx, invitationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if invitation.OrganizationID != orgID {
+		return nil, errors.New("invitation not found")
+	}
+	if invitation.Status != InvitationPending {
+		return nil, errors.New("invitation is no longer pending")
+	}
+
+	return invitation, nil
+}
+
+func (uc *organizationUsecase) sendInvitation(ctx context.Context, invitation *Invitation) error {
+	org, err := uc.repo.FindByID(ctx, invitation.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	token, err := uc.tokenConfig.GenerateActionToken(&security.ActionToken{
+		Purpose: security.PurposeInvitation,
+		Subject: invitation.ID,
+		Nonce:   invitation.Nonce,
+	}, time.Until(invitation.ExpiresAt))
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/invitations?token=%s", uc.baseURL, url.QueryEscape(token))
+
+	return uc.mailer.Send(ctx, &mailer.Message{
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("You are invited to join %s", org.Name),
+		Body: fmt.Sprintf(
+			"You have been invited to join %s as %s.\n\nAccept or decline the invitation here:\n%s\n\nThis link expires on %s.",
+			org.Name,
+			invitation.Role,
+			link,
+			invitation.ExpiresAt.Format(time.RFC1123),
+		),
+	})
+}
+
+// requireRole checks the actor is a member and, when roles are given, holds
+// one of them.
+func (uc *organizationUsecase) requireRole(ctx context.Context, orgID, actorID int64, roles ...string) (*Membership, error) {
+	membership, err := uc.GetMembership(ctx, orgID, actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(roles) > 0 && !slices.Contains(roles, membership.Role) {
+		return nil, errs.ErrOrgPermissionDenied
+	}
+
+	return membership, nil
+}
+
+// canGrant allows admins to manage members and admins, owners only to
+// hand out ownership and to manage other owners.
+func (uc *organizationUsecase) canGrant(ctx context.Context, orgID, actorID int64, role string) error {
+	if role == RoleOwner {
+		_, err := uc.requireRole(ctx, orgID, actorID, RoleOwner)
+		return err
+	}
+
+	_, err := uc.requireRole(ctx, orgID, actorID, RoleOwner, RoleAdmin)
+	return err
+}
+
+func (uc *organizationUsecase) keepOwner(ctx context.Context, membership *Membership) error {
+	if membership.Role != RoleOwner {
+		return nil
+	}
+
+	owners, err := uc.repo.CountMembersWithRole(ctx, membership.OrganizationID, RoleOwner)
+	if err != nil {
+		return err
+	}
+	if owners <= 1 {
+		return errs.ErrLastOrgOwner
+	}
+
+	return nil
+}
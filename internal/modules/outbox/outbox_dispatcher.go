@@ -0,0 +1,117 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/codepnw/go-authen-system/pkg/logger"
+)
+
+const (
+	pendingBatch    = 100
+	defaultInterval = time.Second
+
+	retryBaseDelay = time.Second
+	retryMaxDelay  = time.Minute * 5
+)
+
+// Dispatcher publishes outbox messages to every sink. A message is marked
+// published only once all sinks accepted it, otherwise it is retried with
+// backoff and later messages of the same aggregate wait behind it.
+type Dispatcher struct {
+	repo     OutboxRepository
+	sinks    []Sink
+	interval time.Duration
+}
+
+func NewDispatcher(repo OutboxRepository, interval time.Duration, sinks ...Sink) *Dispatcher {
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+
+	return &Dispatcher{
+		repo:     repo,
+		sinks:    sinks,
+		interval: interval,
+	}
+}
+
+// Run polls the outbox until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.Dispatch(ctx)
+		}
+	}
+}
+
+// Dispatch makes one pass over the pending messages.
+func (d *Dispatcher) Dispatch(ctx context.Context) {
+	messages, err := d.repo.ListPending(ctx, pendingBatch)
+	if err != nil {
+		logger.Error("OUTBOX-001", "list pending messages failed", err)
+		return
+	}
+
+	now := time.Now()
+	blocked := make(map[string]bool)
+
+	for _, msg := range messages {
+		key := msg.Key()
+		if blocked[key] {
+			continue
+		}
+
+		if msg.NextAttemptAt != nil && msg.NextAttemptAt.After(now) {
+			blocked[key] = true
+			continue
+		}
+
+		if err = d.send(ctx, msg); err != nil {
+			blocked[key] = true
+			d.retry(ctx, msg, err)
+			continue
+		}
+
+		if err = d.repo.MarkPublished(ctx, msg.ID, time.Now()); err != nil {
+			// Left pending, the sinks will see it again
+			logger.Error("OUTBOX-002", "mark message published failed", err)
+			blocked[key] = true
+		}
+	}
+}
+
+// -------- Private ----------
+func (d *Dispatcher) send(ctx context.Context, msg *Message) error {
+	for _, sink := range d.sinks {
+		if err := sink.Send(ctx, msg); err != nil {
+			return fmt.Errorf("%s sink: %w", sink.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (d *Dispatcher) retry(ctx context.Context, msg *Message, cause error) {
+	msg.Attempts++
+	msg.LastError = cause.Error()
+
+	delay := retryMaxDelay
+	if msg.Attempts < 20 {
+		delay = min(retryBaseDelay<<(msg.Attempts-1), retryMaxDelay)
+	}
+	next := time.Now().Add(delay)
+	msg.NextAttemptAt = &next
+
+	logger.Error("OUTBOX-003", "publish message failed", fmt.Errorf("message %d: %w", msg.ID, cause))
+
+	if err := d.repo.Update(ctx, msg); err != nil {
+		logger.Error("OUTBOX-004", "update message failed", err)
+	}
+}
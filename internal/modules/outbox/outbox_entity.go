@@ -0,0 +1,51 @@
+package outbox
+
+import (
+	"strconv"
+	"time"
+)
+
+const AggregateUser = "user"
+
+// Message is a domain event waiting in the outbox table until every sink
+// has accepted it.
+type Message struct {
+	ID            int64      `json:"id" gorm:"primaryKey"`
+	AggregateType string     `json:"aggregate_type" gorm:"not null;index:idx_outbox_aggregate"`
+	AggregateID   int64      `json:"aggregate_id" gorm:"not null;index:idx_outbox_aggregate"`
+	EventType     string     `json:"event_type" gorm:"not null"`
+	Payload       string     `json:"payload" gorm:"type:text;not null"`
+	Attempts      int        `json:"attempts" gorm:"not null;default:0"`
+	LastError     string     `json:"last_error"`
+	NextAttemptAt *time.Time `json:"next_attempt_at"`
+	PublishedAt   *time.Time `json:"published_at" gorm:"index"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+func (Message) TableName() string {
+	return "outbox_messages"
+}
+
+// Key identifies the aggregate, messages sharing a key are published in order.
+func (m *Message) Key() string {
+	return m.AggregateType + ":" + strconv.FormatInt(m.AggregateID, 10)
+}
+
+// Event is what a usecase hands to a repository to be written with its
+// state change. Data is encoded as JSON at write time, so IDs assigned by
+// the same insert are included.
+type Event struct {
+	AggregateType string
+	AggregateID   int64
+	Type          string
+	Data          any
+}
+
+func NewEvent(aggregateType string, aggregateID int64, eventType string, data any) *Event {
+	return &Event{
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		Type:          eventType,
+		Data:          data,
+	}
+}
@@ -0,0 +1,44 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type OutboxRepository interface {
+	ListPending(ctx context.Context, limit int) ([]*Message, error)
+	MarkPublished(ctx context.Context, id int64, at time.Time) error
+	Update(ctx context.Context, input *Message) error
+}
+
+type outboxRepository struct {
+	db *gorm.DB
+}
+
+func NewOutboxRepository(db *gorm.DB) OutboxRepository {
+	return &outboxRepository{db: db}
+}
+
+// ListPending returns unpublished messages in write order, including those
+// still waiting for a retry so the dispatcher can hold back their aggregate.
+func (r *outboxRepository) ListPending(ctx context.Context, limit int) (messages []*Message, err error) {
+	err = r.db.WithContext(ctx).
+		Where("published_at IS NULL").
+		Order("id").
+		Limit(limit).
+		Find(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (r *outboxRepository) MarkPublished(ctx context.Context, id int64, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&Message{}).Where("id = ?", id).Update("published_at", at).Error
+}
+
+func (r *outboxRepository) Update(ctx context.Context, input *Message) error {
+	return r.db.WithContext(ctx).Save(input).Error
+}
@@ -0,0 +1,99 @@
+package outbox
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/codepnw/go-authen-system/pkg/logger"
+)
+
+// Sink receives published outbox messages. Delivery is at-least-once, a sink
+// may see the same message again after a failure and should dedupe on ID.
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, msg *Message) error
+}
+
+// ---------- Log ----------
+
+type logSink struct{}
+
+// NewLogSink writes every message to the application log.
+func NewLogSink() Sink {
+	return &logSink{}
+}
+
+func (s *logSink) Name() string {
+	return "log"
+}
+
+func (s *logSink) Send(ctx context.Context, msg *Message) error {
+	logger.Info("OUTBOX-LOG-001", "outbox message", msg)
+	return nil
+}
+
+// ---------- Memory ----------
+
+// MemorySink keeps messages in memory, for tests and demos.
+type MemorySink struct {
+	mu       sync.Mutex
+	messages []*Message
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+func (s *MemorySink) Name() string {
+	return "memory"
+}
+
+func (s *MemorySink) Send(ctx context.Context, msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *msg
+	s.messages = append(s.messages, &copied)
+	return nil
+}
+
+// Messages returns a snapshot of everything received so far.
+func (s *MemorySink) Messages() []*Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*Message(nil), s.messages...)
+}
+
+// ---------- Broker ----------
+
+// BrokerClient is the subset of a NATS or Kafka producer the outbox needs.
+// Key carries the aggregate so Kafka keeps each aggregate on one partition.
+type BrokerClient interface {
+	Publish(ctx context.Context, subject, key string, data []byte, headers map[string]string) error
+}
+
+type brokerSink struct {
+	client BrokerClient
+	prefix string
+}
+
+// NewBrokerSink publishes each message to "<prefix><event type>".
+func NewBrokerSink(client BrokerClient, prefix string) Sink {
+	return &brokerSink{client: client, prefix: prefix}
+}
+
+func (s *brokerSink) Name() string {
+	return "broker"
+}
+
+func (s *brokerSink) Send(ctx context.Context, msg *Message) error {
+	headers := map[string]string{
+		"message-id":     strconv.FormatInt(msg.ID, 10),
+		"event-type":     msg.EventType,
+		"aggregate-type": msg.AggregateType,
+		"aggregate-id":   strconv.FormatInt(msg.AggregateID, 10),
+	}
+	return s.client.Publish(ctx, s.prefix+msg.EventType, msg.Key(), []byte(msg.Payload), headers)
+}
@@ -0,0 +1,50 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/codepnw/go-authen-system/internal/utils/transaction"
+	"gorm.io/gorm"
+)
+
+// Writer stores events for repositories that do not keep their state in the
+// database, like the in-memory ones. Their events can not share a
+// transaction with the state change.
+type Writer func(ctx context.Context, events ...*Event) error
+
+// NewWriter writes through the transaction in ctx when there is one.
+func NewWriter(db *gorm.DB) Writer {
+	return func(ctx context.Context, events ...*Event) error {
+		return Write(transaction.DB(ctx, db), events...)
+	}
+}
+
+// Write stores events through tx so they commit or roll back together with
+// the state change that produced them.
+func Write(tx *gorm.DB, events ...*Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	messages := make([]*Message, 0, len(events))
+
+	for _, e := range events {
+		payload, err := json.Marshal(e.Data)
+		if err != nil {
+			return err
+		}
+
+		messages = append(messages, &Message{
+			AggregateType: e.AggregateType,
+			AggregateID:   e.AggregateID,
+			EventType:     e.Type,
+			Payload:       string(payload),
+			CreatedAt:     now,
+		})
+	}
+
+	return tx.Create(&messages).Error
+}
@@ -0,0 +1,11 @@
+package passwordreset
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token           string `json:"token" validate:"required"`
+	Password        string `json:"password" validate:"required,min=4"`
+	ConfirmPassword string `json:"confirm_password" validate:"required,eqfield=Password"`
+}
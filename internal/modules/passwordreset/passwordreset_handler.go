@@ -0,0 +1,70 @@
+package passwordreset
+
+import (
+	"errors"
+
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+	"github.com/codepnw/go-authen-system/internal/utils/response"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type passwordResetHandler struct {
+	validate *validator.Validate
+	uc       PasswordResetUsecase
+}
+
+func NewPasswordResetHandler(uc PasswordResetUsecase) *passwordResetHandler {
+	return &passwordResetHandler{
+		validate: validator.New(),
+		uc:       uc,
+	}
+}
+
+// Forgot answers the same whether or not the email has an account.
+func (h *passwordResetHandler) Forgot(c *gin.Context) {
+	req := new(ForgotPasswordRequest)
+
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.uc.Request(c, req.Email); err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, "if the email belongs to an account, a reset link was sent", nil)
+}
+
+func (h *passwordResetHandler) Reset(c *gin.Context) {
+	req := new(ResetPasswordRequest)
+
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	err := h.uc.Reset(c, req)
+	switch {
+	case errors.Is(err, errs.ErrInvalidResetLink):
+		response.BadRequest(c, "", err)
+	case errors.Is(err, errs.ErrAccountDisabled):
+		response.Forbidden(c, err)
+	case err != nil:
+		response.InternalServerError(c, err)
+	default:
+		response.Success(c, "password reset", nil)
+	}
+}
@@ -0,0 +1,152 @@
+package passwordreset
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/codepnw/go-authen-system/config"
+	"github.com/codepnw/go-authen-system/internal/modules/user"
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+	"github.com/codepnw/go-authen-system/internal/utils/security"
+	"github.com/codepnw/go-authen-system/pkg/logger"
+	"github.com/codepnw/go-authen-system/pkg/mailer"
+)
+
+const (
+	queryTimeout          = time.Second * 5
+	passwordResetDuration = time.Hour
+)
+
+type PasswordResetUsecase interface {
+	// Request mails a reset link. Unknown addresses are not an error, the
+	// answer must not tell which emails have an account.
+	Request(ctx context.Context, email string) error
+	Reset(ctx context.Context, req *ResetPasswordRequest) error
+}
+
+// SessionRevoker signs a user out everywhere, it is implemented by
+// auth.AuthUsecase.
+type SessionRevoker interface {
+	RevokeSessions(ctx context.Context, userID int64, reason string) (int64, error)
+}
+
+type passwordResetUsecase struct {
+	userUsecase user.UserUsecase
+	sessions    SessionRevoker
+	mailer      mailer.Mailer
+	tokenConfig *security.TokenConfig
+	secretKey   string
+	baseURL     string
+}
+
+func NewPasswordResetUsecase(cfg *config.Config, userUsecase user.UserUsecase, sessions SessionRevoker, mail mailer.Mailer) PasswordResetUsecase {
+	return &passwordResetUsecase{
+		userUsecase: userUsecase,
+		sessions:    sessions,
+		mailer:      mail,
+		tokenConfig: security.NewJWTToken(cfg),
+		secretKey:   cfg.JWTSecretKey,
+		baseURL:     strings.TrimRight(cfg.AppBaseURL, "/"),
+	}
+}
+
+func (uc *passwordResetUsecase) Request(ctx context.Context, email string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	u, err := uc.userUsecase.GetUserByEmail(ctx, strings.TrimSpace(email))
+	if err != nil {
+		return err
+	}
+	if u == nil || !u.IsActive() {
+		logger.Info("PASSWORD-RESET-001", "password reset for unknown or inactive account", nil)
+		return nil
+	}
+
+	token, err := uc.tokenConfig.GenerateActionToken(&security.ActionToken{
+		Purpose: security.PurposePasswordReset,
+		Subject: u.ID,
+		Nonce:   uc.nonce(u),
+	}, passwordResetDuration)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/password/reset?token=%s", uc.baseURL, url.QueryEscape(token))
+
+	err = uc.mailer.Send(ctx, &mailer.Message{
+		To:      u.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"A password reset was requested for your account.\n\nChoose a new password here:\n%s\n\nThis link expires in %s and works once. If you did not ask for it, ignore this email.",
+			link,
+			passwordResetDuration,
+		),
+	})
+	if err != nil {
+		logger.Error("PASSWORD-RESET-002", "send password reset failed", err)
+		return err
+	}
+
+	logger.Info("PASSWORD-RESET-003", "password reset requested", map[string]any{"user_id": u.ID})
+	return nil
+}
+
+// Reset sets the new password and signs the user out everywhere. The link
+// stops working once the password changed.
+func (uc *passwordResetUsecase) Reset(ctx context.Context, req *ResetPasswordRequest) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	action, err := uc.tokenConfig.VerifyActionToken(req.Token, security.PurposePasswordReset)
+	if err != nil {
+		return errs.ErrInvalidResetLink
+	}
+
+	u, err := uc.userUsecase.GetProfile(ctx, action.Subject)
+	if err != nil || u.IsDeleted() {
+		return errs.ErrInvalidResetLink
+	}
+	if !hmac.Equal([]byte(action.Nonce), []byte(uc.nonce(u))) {
+		return errs.ErrInvalidResetLink
+	}
+	if !u.IsActive() {
+		return errs.ErrAccountDisabled
+	}
+
+	if err = uc.userUsecase.ResetPassword(ctx, u.ID, req.Password); err != nil {
+		logger.Error("PASSWORD-RESET-004", "reset password failed", err)
+		return err
+	}
+
+	if _, err = uc.sessions.RevokeSessions(ctx, u.ID, "password_reset"); err != nil {
+		logger.Error("PASSWORD-RESET-005", "revoke sessions failed", err)
+		return err
+	}
+
+	// The password is changed, a lost notice is only logged
+	err = uc.mailer.Send(ctx, &mailer.Message{
+		To:      u.Email,
+		Subject: "Your password was changed",
+		Body:    "The password of your account was just reset and all sessions were signed out.\n\nIf this was not you, reset your password again and contact support.",
+	})
+	if err != nil {
+		logger.Error("PASSWORD-RESET-006", "send password changed notice failed", err)
+	}
+
+	logger.Info("PASSWORD-RESET-007", "password reset", map[string]any{"user_id": u.ID})
+	return nil
+}
+
+// nonce ties a link to the current password hash, so it works only once
+// and only until the password changes by any other way.
+func (uc *passwordResetUsecase) nonce(u *user.User) string {
+	mac := hmac.New(sha256.New, []byte(uc.secretKey))
+	mac.Write([]byte("password_reset:" + u.Password))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
@@ -0,0 +1,53 @@
+package privacy
+
+import (
+	"time"
+
+	"github.com/codepnw/go-authen-system/internal/modules/audit"
+	"github.com/codepnw/go-authen-system/internal/modules/emailchange"
+	"github.com/codepnw/go-authen-system/internal/modules/federation"
+	"github.com/codepnw/go-authen-system/internal/modules/group"
+	"github.com/codepnw/go-authen-system/internal/modules/organization"
+	"github.com/codepnw/go-authen-system/internal/modules/user"
+)
+
+// ExportDTO is everything stored about a user. Each field becomes one file
+// of the export archive.
+type ExportDTO struct {
+	Manifest     *ManifestDTO               `json:"manifest"`
+	Profile      *user.User                 `json:"profile"`
+	Sessions     []*SessionDTO              `json:"sessions"`
+	EmailChanges []*emailchange.EmailChange `json:"email_changes"`
+	Identities   []*federation.Identity     `json:"identities"`
+	Memberships  []*organization.Membership `json:"memberships"`
+	Invitations  []*organization.Invitation `json:"invitations"`
+	Groups       []*group.GroupMember       `json:"groups"`
+	AuditEvents  []*audit.Event             `json:"audit_events"`
+	ErasureJobs  []*ErasureJob              `json:"erasure_jobs"`
+
+	// Nothing records consents yet, the section is always present so the
+	// archive layout stays stable.
+	Consents []any `json:"consents"`
+}
+
+type ManifestDTO struct {
+	UserID      int64     `json:"user_id"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Format      string    `json:"format"`
+}
+
+// SessionDTO describes a refresh token without the token itself.
+type SessionDTO struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ErasureRequest confirms the caller's own erasure.
+type ErasureRequest struct {
+	Password string `json:"password"`
+}
+
+type ExportRequest struct {
+	Format string `form:"format" validate:"omitempty,oneof=zip json"`
+}
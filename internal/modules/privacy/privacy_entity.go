@@ -0,0 +1,77 @@
+package privacy
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Erasure job states
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+// Why the erasure was started
+const (
+	ReasonRequest     = "request"
+	ReasonGracePeriod = "grace_period_ended"
+)
+
+// ErasureJob tracks the erasure of one user's personal data across every table.
+type ErasureJob struct {
+	ID          int64      `json:"id" gorm:"primaryKey"`
+	UserID      int64      `json:"user_id" gorm:"not null;index"`
+	Reason      string     `json:"reason" gorm:"not null"`
+	RequestedBy int64      `json:"requested_by,omitempty"`
+	Status      string     `json:"status" gorm:"not null;default:pending;index"`
+	Steps       Counts     `json:"steps,omitempty" gorm:"type:text"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+func (ErasureJob) TableName() string {
+	return "erasure_jobs"
+}
+
+func (j *ErasureJob) IsOpen() bool {
+	return j.Status == JobPending || j.Status == JobRunning
+}
+
+// Counts holds the rows each erasure step changed, stored as JSON text.
+type Counts map[string]int64
+
+func (c Counts) Value() (driver.Value, error) {
+	if len(c) == 0 {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (c *Counts) Scan(value any) error {
+	var b []byte
+
+	switch v := value.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return errors.New("privacy: unsupported counts type")
+	}
+
+	return json.Unmarshal(b, c)
+}
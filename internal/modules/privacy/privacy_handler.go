@@ -0,0 +1,233 @@
+package privacy
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/codepnw/go-authen-system/internal/middleware"
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+	"github.com/codepnw/go-authen-system/internal/utils/response"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// Reauthenticator confirms the caller owns the account, it is implemented
+// by federation.FederationUsecase.
+type Reauthenticator interface {
+	Reauthenticate(ctx context.Context, userID int64, password string) error
+}
+
+type privacyHandler struct {
+	validate *validator.Validate
+	uc       PrivacyUsecase
+	reauth   Reauthenticator
+}
+
+func NewPrivacyHandler(uc PrivacyUsecase, reauth Reauthenticator) *privacyHandler {
+	return &privacyHandler{
+		validate: validator.New(),
+		uc:       uc,
+		reauth:   reauth,
+	}
+}
+
+// ExportMe downloads everything stored about the caller.
+func (h *privacyHandler) ExportMe(c *gin.Context) {
+	current, ok := middleware.CurrentUser(c)
+	if !ok {
+		response.Unauthorized(c, errs.ErrInvalidToken)
+		return
+	}
+
+	h.export(c, current.ID)
+}
+
+// Export lets an admin answer an access request on behalf of a user.
+func (h *privacyHandler) Export(c *gin.Context) {
+	id, err := getIntParamID(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid id", err)
+		return
+	}
+
+	h.export(c, id)
+}
+
+// RequestMyErasure erases the caller's account without a grace period, so
+// a stolen access token is not enough. Accounts with a password confirm it,
+// others must have signed in through a linked provider a moment ago.
+func (h *privacyHandler) RequestMyErasure(c *gin.Context) {
+	current, ok := middleware.CurrentUser(c)
+	if !ok {
+		response.Unauthorized(c, errs.ErrInvalidToken)
+		return
+	}
+
+	req := new(ErasureRequest)
+
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	err := h.reauth.Reauthenticate(c, current.ID, req.Password)
+	if errors.Is(err, errs.ErrReauthRequired) {
+		response.Forbidden(c, err)
+		return
+	}
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	h.requestErasure(c, current.ID)
+}
+
+func (h *privacyHandler) GetMyErasure(c *gin.Context) {
+	current, ok := middleware.CurrentUser(c)
+	if !ok {
+		response.Unauthorized(c, errs.ErrInvalidToken)
+		return
+	}
+
+	jobs, err := h.uc.ListJobs(c, current.ID)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, "", jobs)
+}
+
+func (h *privacyHandler) RequestErasure(c *gin.Context) {
+	id, err := getIntParamID(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid id", err)
+		return
+	}
+
+	h.requestErasure(c, id)
+}
+
+func (h *privacyHandler) GetJob(c *gin.Context) {
+	id, err := getIntParamID(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid id", err)
+		return
+	}
+
+	job, err := h.uc.GetJob(c, id)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, "", job)
+}
+
+func (h *privacyHandler) export(c *gin.Context, userID int64) {
+	req := new(ExportRequest)
+
+	if err := c.ShouldBindQuery(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	data, err := h.uc.Export(c, userID)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	filename := fmt.Sprintf("user-%d-export-%s", userID, time.Now().UTC().Format("20060102T150405Z"))
+
+	if req.Format == "json" {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.json", filename))
+		c.Header("Content-Type", "application/json")
+		c.Status(http.StatusOK)
+
+		if err = json.NewEncoder(c.Writer).Encode(data); err != nil {
+			_ = c.Error(err)
+		}
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.zip", filename))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+
+	if err = writeArchive(c.Writer, data); err != nil {
+		_ = c.Error(err)
+	}
+}
+
+func (h *privacyHandler) requestErasure(c *gin.Context, userID int64) {
+	job, err := h.uc.RequestErasure(c, userID, ReasonRequest)
+	if errors.Is(err, errs.ErrAccountDeleted) {
+		response.Conflict(c, err)
+		return
+	}
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "erasure requested", "data": job})
+}
+
+// writeArchive writes one JSON file per section of the export.
+func writeArchive(w io.Writer, data *ExportDTO) error {
+	files := []struct {
+		name string
+		data any
+	}{
+		{"manifest.json", data.Manifest},
+		{"profile.json", data.Profile},
+		{"sessions.json", data.Sessions},
+		{"email_changes.json", data.EmailChanges},
+		{"memberships.json", data.Memberships},
+		{"invitations.json", data.Invitations},
+		{"groups.json", data.Groups},
+		{"audit_events.json", data.AuditEvents},
+		{"erasure_jobs.json", data.ErasureJobs},
+		{"consents.json", data.Consents},
+		{"identities.json", data.Identities},
+	}
+
+	zw := zip.NewWriter(w)
+
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     f.name,
+			Method:   zip.Deflate,
+			Modified: data.Manifest.GeneratedAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(f.data); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func getIntParamID(key string) (int64, error) {
+	return strconv.ParseInt(key, 10, 64)
+}
@@ -0,0 +1,199 @@
+package privacy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/codepnw/go-authen-system/internal/modules/emailchange"
+	"github.com/codepnw/go-authen-system/internal/modules/federation"
+	"github.com/codepnw/go-authen-system/internal/modules/group"
+	"github.com/codepnw/go-authen-system/internal/modules/organization"
+	"github.com/codepnw/go-authen-system/internal/modules/outbox"
+	"github.com/codepnw/go-authen-system/internal/modules/webhook"
+	"github.com/codepnw/go-authen-system/internal/utils/transaction"
+	"gorm.io/gorm"
+)
+
+// Payload left on webhook deliveries of erased users
+const redactedPayload = `{"redacted":true}`
+
+type PrivacyRepository interface {
+	CreateJob(ctx context.Context, input *ErasureJob) error
+	FindJob(ctx context.Context, id int64) (*ErasureJob, error)
+	ListJobs(ctx context.Context, userID int64) ([]*ErasureJob, error)
+	// ClaimJob moves the oldest pending job to running, nil when there is none.
+	ClaimJob(ctx context.Context) (*ErasureJob, error)
+	UpdateJob(ctx context.Context, input *ErasureJob) error
+	// ResetRunningJobs requeues jobs left running by a stopped process.
+	ResetRunningJobs(ctx context.Context) error
+
+	ListMemberships(ctx context.Context, userID int64) ([]*organization.Membership, error)
+	ListInvitations(ctx context.Context, email string) ([]*organization.Invitation, error)
+	ListGroupMemberships(ctx context.Context, userID int64) ([]*group.GroupMember, error)
+	ListEmailChanges(ctx context.Context, userID int64) ([]*emailchange.EmailChange, error)
+	ListIdentities(ctx context.Context, userID int64) ([]*federation.Identity, error)
+
+	DeleteMemberships(ctx context.Context, userID int64) (int64, error)
+	DeleteInvitations(ctx context.Context, email string) (int64, error)
+	DeleteGroupMemberships(ctx context.Context, userID int64) (int64, error)
+	DeleteEmailChanges(ctx context.Context, userID int64) (int64, error)
+	DeleteIdentities(ctx context.Context, userID int64) (int64, error)
+	DeletePublishedEvents(ctx context.Context, userID int64) (int64, error)
+	RedactDeliveries(ctx context.Context, email string) (int64, error)
+}
+
+type privacyRepository struct {
+	db *gorm.DB
+}
+
+func NewPrivacyRepository(db *gorm.DB) PrivacyRepository {
+	return &privacyRepository{db: db}
+}
+
+func (r *privacyRepository) CreateJob(ctx context.Context, input *ErasureJob) error {
+	return transaction.DB(ctx, r.db).Create(input).Error
+}
+
+func (r *privacyRepository) FindJob(ctx context.Context, id int64) (job *ErasureJob, err error) {
+	if err = transaction.DB(ctx, r.db).First(&job, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (r *privacyRepository) ListJobs(ctx context.Context, userID int64) (jobs []*ErasureJob, err error) {
+	err = transaction.DB(ctx, r.db).Where("user_id = ?", userID).Order("id DESC").Find(&jobs).Error
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// ClaimJob only takes a job another instance did not take first.
+func (r *privacyRepository) ClaimJob(ctx context.Context) (*ErasureJob, error) {
+	db := transaction.DB(ctx, r.db)
+
+	for {
+		job := new(ErasureJob)
+		err := db.Where("status = ?", JobPending).Order("id").Take(job).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		res := db.Model(&ErasureJob{}).
+			Where("id = ? AND status = ?", job.ID, JobPending).
+			Updates(map[string]any{"status": JobRunning, "started_at": now})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 1 {
+			job.Status = JobRunning
+			job.StartedAt = &now
+			return job, nil
+		}
+	}
+}
+
+func (r *privacyRepository) UpdateJob(ctx context.Context, input *ErasureJob) error {
+	return transaction.DB(ctx, r.db).Save(input).Error
+}
+
+func (r *privacyRepository) ResetRunningJobs(ctx context.Context) error {
+	return transaction.DB(ctx, r.db).Model(&ErasureJob{}).
+		Where("status = ?", JobRunning).
+		Update("status", JobPending).Error
+}
+
+func (r *privacyRepository) ListMemberships(ctx context.Context, userID int64) (memberships []*organization.Membership, err error) {
+	err = transaction.DB(ctx, r.db).Preload("Organization").Where("user_id = ?", userID).Order("id").Find(&memberships).Error
+	if err != nil {
+		return nil, err
+	}
+	return memberships, nil
+}
+
+func (r *privacyRepository) ListInvitations(ctx context.Context, email string) (invitations []*organization.Invitation, err error) {
+	err = transaction.DB(ctx, r.db).Preload("Organization").Where("email = ?", email).Order("id").Find(&invitations).Error
+	if err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+func (r *privacyRepository) ListGroupMemberships(ctx context.Context, userID int64) (members []*group.GroupMember, err error) {
+	err = transaction.DB(ctx, r.db).Where("user_id = ?", userID).Order("id").Find(&members).Error
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func (r *privacyRepository) ListEmailChanges(ctx context.Context, userID int64) (changes []*emailchange.EmailChange, err error) {
+	err = transaction.DB(ctx, r.db).Where("user_id = ?", userID).Order("id").Find(&changes).Error
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func (r *privacyRepository) ListIdentities(ctx context.Context, userID int64) (identities []*federation.Identity, err error) {
+	err = transaction.DB(ctx, r.db).Where("user_id = ?", userID).Order("id").Find(&identities).Error
+	if err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+func (r *privacyRepository) DeleteMemberships(ctx context.Context, userID int64) (int64, error) {
+	res := transaction.DB(ctx, r.db).Delete(&organization.Membership{}, "user_id = ?", userID)
+	return res.RowsAffected, res.Error
+}
+
+func (r *privacyRepository) DeleteInvitations(ctx context.Context, email string) (int64, error) {
+	res := transaction.DB(ctx, r.db).Delete(&organization.Invitation{}, "email = ?", email)
+	return res.RowsAffected, res.Error
+}
+
+func (r *privacyRepository) DeleteGroupMemberships(ctx context.Context, userID int64) (int64, error) {
+	res := transaction.DB(ctx, r.db).Delete(&group.GroupMember{}, "user_id = ?", userID)
+	return res.RowsAffected, res.Error
+}
+
+func (r *privacyRepository) DeleteEmailChanges(ctx context.Context, userID int64) (int64, error) {
+	res := transaction.DB(ctx, r.db).Delete(&emailchange.EmailChange{}, "user_id = ?", userID)
+	return res.RowsAffected, res.Error
+}
+
+func (r *privacyRepository) DeleteIdentities(ctx context.Context, userID int64) (int64, error) {
+	res := transaction.DB(ctx, r.db).Delete(&federation.Identity{}, "user_id = ?", userID)
+	return res.RowsAffected, res.Error
+}
+
+// DeletePublishedEvents drops outbox messages about the user that every sink
+// already accepted, pending ones must still be delivered.
+func (r *privacyRepository) DeletePublishedEvents(ctx context.Context, userID int64) (int64, error) {
+	res := transaction.DB(ctx, r.db).Delete(&outbox.Message{},
+		"aggregate_type = ? AND aggregate_id = ? AND published_at IS NOT NULL", outbox.AggregateUser, userID,
+	)
+	return res.RowsAffected, res.Error
+}
+
+// RedactDeliveries replaces the payload of finished webhook deliveries that
+// mention the email. The delivery log itself is kept.
+func (r *privacyRepository) RedactDeliveries(ctx context.Context, email string) (int64, error) {
+	res := transaction.DB(ctx, r.db).Model(&webhook.Delivery{}).
+		Where("status IN ? AND payload LIKE ? ESCAPE '\\'", []string{webhook.DeliverySucceeded, webhook.DeliveryDead}, "%"+likeEscape(email)+"%").
+		Update("payload", redactedPayload)
+	return res.RowsAffected, res.Error
+}
+
+// likeEscape escapes the LIKE wildcards in s, the pattern must use ESCAPE '\'.
+func likeEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
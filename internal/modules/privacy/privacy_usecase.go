@@ -0,0 +1,359 @@
+package privacy
+
+import (
+	"context"
+	"time"
+
+	"github.com/codepnw/go-authen-system/internal/modules/audit"
+	"github.com/codepnw/go-authen-system/internal/modules/auth"
+	"github.com/codepnw/go-authen-system/internal/modules/user"
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+	"github.com/codepnw/go-authen-system/internal/utils/security"
+	"github.com/codepnw/go-authen-system/pkg/logger"
+)
+
+const (
+	queryTimeout = time.Second * 5
+
+	// Accounts past their grace period queued per scheduling round
+	scheduleBatch = 100
+)
+
+// SessionLister lists the refresh tokens of a user, it is implemented by
+// auth.AuthRepository.
+type SessionLister interface {
+	ListRefreshTokens(ctx context.Context, userID int64) ([]*auth.RefreshToken, error)
+}
+
+// AvatarRemover deletes the uploaded avatar files of a user, it is
+// implemented by avatar.AvatarUsecase.
+type AvatarRemover interface {
+	RemoveFiles(ctx context.Context, u *user.User) (int64, error)
+}
+
+type PrivacyUsecase interface {
+	Export(ctx context.Context, userID int64) (*ExportDTO, error)
+	RequestErasure(ctx context.Context, userID int64, reason string) (*ErasureJob, error)
+	GetJob(ctx context.Context, id int64) (*ErasureJob, error)
+	ListJobs(ctx context.Context, userID int64) ([]*ErasureJob, error)
+	ScheduleDue(ctx context.Context) (int, error)
+	RunPending(ctx context.Context) (int, error)
+	RequeueInterrupted(ctx context.Context) error
+}
+
+type privacyUsecase struct {
+	repo         PrivacyRepository
+	userUsecase  user.UserUsecase
+	sessions     SessionLister
+	avatars      AvatarRemover
+	auditUsecase audit.AuditUsecase
+	recorder     audit.Recorder
+}
+
+func NewPrivacyUsecase(
+	repo PrivacyRepository,
+	userUsecase user.UserUsecase,
+	sessions SessionLister,
+	avatars AvatarRemover,
+	auditUsecase audit.AuditUsecase,
+	recorder audit.Recorder,
+) PrivacyUsecase {
+	return &privacyUsecase{
+		repo:         repo,
+		userUsecase:  userUsecase,
+		sessions:     sessions,
+		avatars:      avatars,
+		auditUsecase: auditUsecase,
+		recorder:     recorder,
+	}
+}
+
+// Export collects everything stored about the user.
+func (uc *privacyUsecase) Export(ctx context.Context, userID int64) (*ExportDTO, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout*6)
+	defer cancel()
+
+	profile, err := uc.userUsecase.GetProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &ExportDTO{
+		Manifest: &ManifestDTO{
+			UserID:      userID,
+			GeneratedAt: time.Now().UTC(),
+			Format:      "json",
+		},
+		Profile:  profile,
+		Sessions: []*SessionDTO{},
+		Consents: []any{},
+	}
+
+	tokens, err := uc.sessions.ListRefreshTokens(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tokens {
+		export.Sessions = append(export.Sessions, &SessionDTO{ID: t.ID, CreatedAt: t.CreatedAt, ExpiresAt: t.ExpiresAt})
+	}
+
+	if export.EmailChanges, err = uc.repo.ListEmailChanges(ctx, userID); err != nil {
+		return nil, err
+	}
+	if export.Identities, err = uc.repo.ListIdentities(ctx, userID); err != nil {
+		return nil, err
+	}
+	if export.Memberships, err = uc.repo.ListMemberships(ctx, userID); err != nil {
+		return nil, err
+	}
+	if export.Invitations, err = uc.repo.ListInvitations(ctx, profile.Email); err != nil {
+		return nil, err
+	}
+	if export.Groups, err = uc.repo.ListGroupMemberships(ctx, userID); err != nil {
+		return nil, err
+	}
+	if export.AuditEvents, err = uc.auditUsecase.Export(ctx, &audit.ListAuditRequest{UserID: userID}); err != nil {
+		return nil, err
+	}
+	if export.ErasureJobs, err = uc.repo.ListJobs(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	uc.recorder.Record(ctx, &audit.Event{
+		Type:       audit.EventUserExport,
+		TargetID:   userID,
+		TargetType: audit.KindUser,
+		Outcome:    audit.OutcomeSuccess,
+	})
+	return export, nil
+}
+
+// RequestErasure queues the erasure of the user. A job already waiting or
+// running for the user is returned instead of queueing another.
+func (uc *privacyUsecase) RequestErasure(ctx context.Context, userID int64, reason string) (*ErasureJob, error) {
+	job, _, err := uc.queue(ctx, userID, reason)
+	return job, err
+}
+
+func (uc *privacyUsecase) queue(ctx context.Context, userID int64, reason string) (*ErasureJob, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	found, err := uc.userUsecase.GetProfile(ctx, userID)
+	if err != nil {
+		return nil, false, err
+	}
+	if found.IsDeleted() {
+		return nil, false, errs.ErrAccountDeleted
+	}
+
+	jobs, err := uc.repo.ListJobs(ctx, userID)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, job := range jobs {
+		if job.IsOpen() {
+			return job, false, nil
+		}
+	}
+
+	job := &ErasureJob{
+		UserID: userID,
+		Reason: reason,
+		Status: JobPending,
+	}
+	if actor, ok := security.UserFromContext(ctx); ok && actor.Type == security.PrincipalUser {
+		job.RequestedBy = actor.ID
+		if actor.IsImpersonated() {
+			job.RequestedBy = actor.Actor.ID
+		}
+	}
+
+	if err = uc.repo.CreateJob(ctx, job); err != nil {
+		logger.Error("ERASURE-001", "create erasure job failed", err)
+		return nil, false, err
+	}
+
+	uc.recorder.Record(ctx, &audit.Event{
+		Type:       audit.EventUserErase,
+		TargetID:   userID,
+		TargetType: audit.KindUser,
+		Outcome:    audit.OutcomeSuccess,
+		Metadata:   audit.Metadata{"job_id": job.ID, "reason": reason, "status": JobPending},
+	})
+	return job, true, nil
+}
+
+func (uc *privacyUsecase) GetJob(ctx context.Context, id int64) (*ErasureJob, error) {
+	return uc.repo.FindJob(ctx, id)
+}
+
+func (uc *privacyUsecase) ListJobs(ctx context.Context, userID int64) ([]*ErasureJob, error) {
+	return uc.repo.ListJobs(ctx, userID)
+}
+
+// ScheduleDue queues erasure for accounts whose deletion grace period ended.
+func (uc *privacyUsecase) ScheduleDue(ctx context.Context) (int, error) {
+	users, err := uc.userUsecase.ListDueForPurge(ctx, scheduleBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, u := range users {
+		_, created, err := uc.queue(ctx, u.ID, ReasonGracePeriod)
+		if err != nil {
+			return queued, err
+		}
+		if created {
+			queued++
+		}
+	}
+	return queued, nil
+}
+
+// RequeueInterrupted puts jobs left running by a stopped process back in
+// the queue.
+func (uc *privacyUsecase) RequeueInterrupted(ctx context.Context) error {
+	return uc.repo.ResetRunningJobs(ctx)
+}
+
+// RunPending runs queued jobs one after another until none is left.
+func (uc *privacyUsecase) RunPending(ctx context.Context) (int, error) {
+	ran := 0
+
+	for {
+		job, err := uc.repo.ClaimJob(ctx)
+		if err != nil || job == nil {
+			return ran, err
+		}
+
+		uc.run(ctx, job)
+		ran++
+	}
+}
+
+// run erases the user step by step. Every step can run again, a failed job
+// is finished by requesting erasure once more.
+func (uc *privacyUsecase) run(ctx context.Context, job *ErasureJob) {
+	job.Steps = Counts{}
+
+	err := uc.erase(ctx, job)
+
+	now := time.Now()
+	job.CompletedAt = &now
+	job.Status = JobCompleted
+	outcome := audit.OutcomeSuccess
+
+	if err != nil {
+		logger.Error("ERASURE-002", "erasure job failed", err)
+		job.Status = JobFailed
+		job.Error = err.Error()
+		outcome = audit.OutcomeFailure
+	}
+
+	if err := uc.repo.UpdateJob(ctx, job); err != nil {
+		logger.Error("ERASURE-003", "update erasure job failed", err)
+	}
+
+	logger.Info("ERASURE-004", "erasure job finished", map[string]any{
+		"job_id":  job.ID,
+		"user_id": job.UserID,
+		"status":  job.Status,
+		"steps":   job.Steps,
+	})
+	uc.recorder.Record(ctx, &audit.Event{
+		Type:       audit.EventUserErase,
+		TargetID:   job.UserID,
+		TargetType: audit.KindUser,
+		Outcome:    outcome,
+		Reason:     job.Error,
+		Metadata:   audit.Metadata{"job_id": job.ID, "status": job.Status},
+	})
+}
+
+func (uc *privacyUsecase) erase(ctx context.Context, job *ErasureJob) error {
+	found, err := uc.userUsecase.GetProfile(ctx, job.UserID)
+	if err != nil {
+		return err
+	}
+
+	// A deleted account has no email left to match by
+	email := ""
+	if !found.IsDeleted() {
+		email = found.Email
+	}
+
+	// Audit records stay, pseudonymized, before the email is gone
+	pseudonymized, err := uc.auditUsecase.Pseudonymize(ctx, job.UserID, email, user.PseudonymEmail(job.UserID))
+	if err != nil {
+		return err
+	}
+	job.Steps["audit_events"] = pseudonymized.Events
+
+	if email != "" {
+		if job.Steps["invitations"], err = uc.repo.DeleteInvitations(ctx, email); err != nil {
+			return err
+		}
+		if job.Steps["webhook_deliveries"], err = uc.repo.RedactDeliveries(ctx, email); err != nil {
+			return err
+		}
+	}
+
+	if job.Steps["avatar_files"], err = uc.avatars.RemoveFiles(ctx, found); err != nil {
+		return err
+	}
+	if job.Steps["email_changes"], err = uc.repo.DeleteEmailChanges(ctx, job.UserID); err != nil {
+		return err
+	}
+	if job.Steps["identities"], err = uc.repo.DeleteIdentities(ctx, job.UserID); err != nil {
+		return err
+	}
+	if job.Steps["memberships"], err = uc.repo.DeleteMemberships(ctx, job.UserID); err != nil {
+		return err
+	}
+	if job.Steps["group_memberships"], err = uc.repo.DeleteGroupMemberships(ctx, job.UserID); err != nil {
+		return err
+	}
+	if job.Steps["outbox_messages"], err = uc.repo.DeletePublishedEvents(ctx, job.UserID); err != nil {
+		return err
+	}
+
+	// Last, so a failed job can still find the email when run again
+	return uc.userUsecase.EraseUser(ctx, job.UserID)
+}
+
+// RunErasure queues accounts past their grace period every scheduleInterval
+// and runs queued jobs every pollInterval until ctx is done. A zero
+// scheduleInterval only runs jobs that were requested.
+func RunErasure(ctx context.Context, uc PrivacyUsecase, pollInterval, scheduleInterval time.Duration) {
+	if err := uc.RequeueInterrupted(ctx); err != nil {
+		logger.Error("ERASURE-005", "requeue running jobs failed", err)
+	}
+
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+
+	// A nil channel never fires
+	var due <-chan time.Time
+	if scheduleInterval > 0 {
+		schedule := time.NewTicker(scheduleInterval)
+		defer schedule.Stop()
+		due = schedule.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-due:
+			if _, err := uc.ScheduleDue(ctx); err != nil {
+				logger.Error("ERASURE-006", "schedule due erasures failed", err)
+			}
+		case <-poll.C:
+			if _, err := uc.RunPending(ctx); err != nil {
+				logger.Error("ERASURE-007", "run erasure jobs failed", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package serviceaccount
+
+type CreateServiceAccountRequest struct {
+	Name        string `json:"name" validate:"required"`
+	Description string `json:"description"`
+	OwnerID     *int64 `json:"owner_id" validate:"required_without=Team"`
+	Team        string `json:"team" validate:"required_without=OwnerID"`
+	Role        string `json:"role" validate:"omitempty,oneof=user admin"`
+}
+
+// CredentialsResponseDTO is the only place the plain client secret is returned.
+type CredentialsResponseDTO struct {
+	ServiceAccount *ServiceAccount `json:"service_account"`
+	ClientID       string          `json:"client_id"`
+	ClientSecret   string          `json:"client_secret"`
+}
+
+type TokenRequestDTO struct {
+	GrantType    string `json:"grant_type" validate:"required,eq=client_credentials"`
+	ClientID     string `json:"client_id" validate:"required"`
+	ClientSecret string `json:"client_secret" validate:"required"`
+}
+
+type TokenResponseDTO struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
@@ -0,0 +1,19 @@
+package serviceaccount
+
+import "time"
+
+// ServiceAccount is a non-human principal. It has no password and can only
+// authenticate with its client credentials.
+type ServiceAccount struct {
+	ID           int64      `json:"id" gorm:"primaryKey"`
+	Name         string     `json:"name" gorm:"unique;not null"`
+	Description  string     `json:"description"`
+	OwnerID      *int64     `json:"owner_id"`
+	Team         string     `json:"team"`
+	Role         string     `json:"role" gorm:"not null;default:user"`
+	ClientID     string     `json:"client_id" gorm:"unique;not null"`
+	ClientSecret string     `json:"-" gorm:"not null"`
+	Disabled     bool       `json:"disabled" gorm:"not null;default:false"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    *time.Time `json:"updated_at"`
+}
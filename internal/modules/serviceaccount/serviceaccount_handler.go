@@ -0,0 +1,135 @@
+package serviceaccount
+
+import (
+	"strconv"
+
+	"github.com/codepnw/go-authen-system/internal/utils/response"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type serviceAccountHandler struct {
+	validate *validator.Validate
+	uc       ServiceAccountUsecase
+}
+
+func NewServiceAccountHandler(uc ServiceAccountUsecase) *serviceAccountHandler {
+	return &serviceAccountHandler{
+		validate: validator.New(),
+		uc:       uc,
+	}
+}
+
+func (h *serviceAccountHandler) Create(c *gin.Context) {
+	req := new(CreateServiceAccountRequest)
+
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	data, err := h.uc.Create(c, req)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Created(c, data)
+}
+
+func (h *serviceAccountHandler) List(c *gin.Context) {
+	accounts, err := h.uc.List(c)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, "", accounts)
+}
+
+func (h *serviceAccountHandler) GetByID(c *gin.Context) {
+	id, err := getIntParamID(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid id", err)
+		return
+	}
+
+	account, err := h.uc.GetByID(c, id)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, "", account)
+}
+
+func (h *serviceAccountHandler) Disable(c *gin.Context) {
+	h.setDisabled(c, true, "service account disabled")
+}
+
+func (h *serviceAccountHandler) Enable(c *gin.Context) {
+	h.setDisabled(c, false, "service account enabled")
+}
+
+func (h *serviceAccountHandler) RotateCredentials(c *gin.Context) {
+	id, err := getIntParamID(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid id", err)
+		return
+	}
+
+	data, err := h.uc.RotateCredentials(c, id)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, "credentials rotated", data)
+}
+
+// Token implements the client credentials grant.
+func (h *serviceAccountHandler) Token(c *gin.Context) {
+	req := new(TokenRequestDTO)
+
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	data, err := h.uc.Token(c, req)
+	if err != nil {
+		response.Unauthorized(c, err)
+		return
+	}
+
+	response.Success(c, "", data)
+}
+
+func (h *serviceAccountHandler) setDisabled(c *gin.Context, disabled bool, message string) {
+	id, err := getIntParamID(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid id", err)
+		return
+	}
+
+	if err = h.uc.SetDisabled(c, id, disabled); err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, message, nil)
+}
+
+func getIntParamID(key string) (int64, error) {
+	return strconv.ParseInt(key, 10, 64)
+}
@@ -0,0 +1,71 @@
+package serviceaccount
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+type ServiceAccountRepository interface {
+	Create(ctx context.Context, input *ServiceAccount) (*ServiceAccount, error)
+	FindByID(ctx context.Context, id int64) (*ServiceAccount, error)
+	FindByClientID(ctx context.Context, clientID string) (*ServiceAccount, error)
+	List(ctx context.Context) ([]*ServiceAccount, error)
+	Update(ctx context.Context, input *ServiceAccount) error
+}
+
+type serviceAccountRepository struct {
+	db *gorm.DB
+}
+
+func NewServiceAccountRepository(db *gorm.DB) ServiceAccountRepository {
+	return &serviceAccountRepository{db: db}
+}
+
+func (r *serviceAccountRepository) Create(ctx context.Context, input *ServiceAccount) (*ServiceAccount, error) {
+	if err := r.db.WithContext(ctx).Create(input).Error; err != nil {
+		return nil, err
+	}
+	return input, nil
+}
+
+func (r *serviceAccountRepository) FindByID(ctx context.Context, id int64) (account *ServiceAccount, err error) {
+	if err = r.db.WithContext(ctx).First(&account, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+func (r *serviceAccountRepository) FindByClientID(ctx context.Context, clientID string) (account *ServiceAccount, err error) {
+	err = r.db.WithContext(ctx).First(&account, "client_id = ?", clientID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return account, nil
+}
+
+func (r *serviceAccountRepository) List(ctx context.Context) (accounts []*ServiceAccount, err error) {
+	if err = r.db.WithContext(ctx).Order("id").Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+func (r *serviceAccountRepository) Update(ctx context.Context, input *ServiceAccount) error {
+	res := r.db.WithContext(ctx).Save(input)
+	if res.Error != nil {
+		return res.Error
+	}
+
+	rows := res.RowsAffected
+	if rows == 0 {
+		return errors.New("service account not found")
+	}
+
+	return nil
+}
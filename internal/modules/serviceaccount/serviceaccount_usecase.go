@@ -0,0 +1,263 @@
+package serviceaccount
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/codepnw/go-authen-system/config"
+	"github.com/codepnw/go-authen-system/internal/modules/audit"
+	"github.com/codepnw/go-authen-system/internal/modules/user"
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+	"github.com/codepnw/go-authen-system/internal/utils/security"
+	"github.com/codepnw/go-authen-system/pkg/logger"
+)
+
+const (
+	queryTimeout = time.Second * 5
+	clientIDSize = 12
+	secretSize   = 32
+)
+
+type ServiceAccountUsecase interface {
+	Create(ctx context.Context, req *CreateServiceAccountRequest) (*CredentialsResponseDTO, error)
+	GetByID(ctx context.Context, id int64) (*ServiceAccount, error)
+	List(ctx context.Context) ([]*ServiceAccount, error)
+	SetDisabled(ctx context.Context, id int64, disabled bool) error
+	RotateCredentials(ctx context.Context, id int64) (*CredentialsResponseDTO, error)
+	Token(ctx context.Context, req *TokenRequestDTO) (*TokenResponseDTO, error)
+}
+
+type serviceAccountUsecase struct {
+	repo        ServiceAccountRepository
+	userUsecase user.UserUsecase
+	recorder    audit.Recorder
+	tokenConfig *security.TokenConfig
+}
+
+func NewServiceAccountUsecase(cfg *config.Config, repo ServiceAccountRepository, userUsecase user.UserUsecase, recorder audit.Recorder) ServiceAccountUsecase {
+	return &serviceAccountUsecase{
+		repo:        repo,
+		userUsecase: userUsecase,
+		recorder:    recorder,
+		tokenConfig: security.NewJWTToken(cfg),
+	}
+}
+
+func (uc *serviceAccountUsecase) Create(ctx context.Context, req *CreateServiceAccountRequest) (*CredentialsResponseDTO, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	// Check Owner
+	if req.OwnerID != nil {
+		if _, err := uc.userUsecase.GetProfile(ctx, *req.OwnerID); err != nil {
+			logger.Error("SVC-CREATE-001", "get owner failed", err)
+			return nil, errors.New("owner not found")
+		}
+	}
+
+	clientID, secret, hashedSecret, err := uc.newCredentials()
+	if err != nil {
+		logger.Error("SVC-CREATE-002", "generate credentials failed", err)
+		return nil, err
+	}
+
+	role := req.Role
+	if role == "" {
+		role = security.RoleUser
+	}
+
+	account, err := uc.repo.Create(ctx, &ServiceAccount{
+		Name:         req.Name,
+		Description:  req.Description,
+		OwnerID:      req.OwnerID,
+		Team:         req.Team,
+		Role:         role,
+		ClientID:     clientID,
+		ClientSecret: hashedSecret,
+	})
+	if err != nil {
+		logger.Error("SVC-CREATE-003", "create service account failed", err)
+		return nil, err
+	}
+
+	logger.Info("SVC-CREATE-004", "service account created", account)
+	uc.record(ctx, account.ID, "create")
+	return uc.credentialsResponse(account, secret), nil
+}
+
+func (uc *serviceAccountUsecase) GetByID(ctx context.Context, id int64) (*ServiceAccount, error) {
+	return uc.repo.FindByID(ctx, id)
+}
+
+func (uc *serviceAccountUsecase) List(ctx context.Context) ([]*ServiceAccount, error) {
+	return uc.repo.List(ctx)
+}
+
+// SetDisabled blocks new tokens for the account. Tokens already issued stay
+// valid until they expire, which is bounded by security.ServiceTokenDuration.
+func (uc *serviceAccountUsecase) SetDisabled(ctx context.Context, id int64, disabled bool) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	account, err := uc.repo.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	account.Disabled = disabled
+	account.UpdatedAt = &now
+
+	if err = uc.repo.Update(ctx, account); err != nil {
+		logger.Error("SVC-DISABLE-001", "update service account failed", err)
+		return err
+	}
+
+	logger.Info("SVC-DISABLE-002", "service account status changed", account)
+	if disabled {
+		uc.record(ctx, account.ID, "disable")
+	} else {
+		uc.record(ctx, account.ID, "enable")
+	}
+	return nil
+}
+
+func (uc *serviceAccountUsecase) RotateCredentials(ctx context.Context, id int64) (*CredentialsResponseDTO, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	account, err := uc.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	_, secret, hashedSecret, err := uc.newCredentials()
+	if err != nil {
+		logger.Error("SVC-ROTATE-001", "generate credentials failed", err)
+		return nil, err
+	}
+
+	// Client ID stays stable, only the secret changes
+	now := time.Now()
+	account.ClientSecret = hashedSecret
+	account.UpdatedAt = &now
+
+	if err = uc.repo.Update(ctx, account); err != nil {
+		logger.Error("SVC-ROTATE-002", "update service account failed", err)
+		return nil, err
+	}
+
+	logger.Info("SVC-ROTATE-003", "service account credentials rotated", account)
+	uc.record(ctx, account.ID, "rotate")
+	return uc.credentialsResponse(account, secret), nil
+}
+
+func (uc *serviceAccountUsecase) Token(ctx context.Context, req *TokenRequestDTO) (*TokenResponseDTO, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	account, err := uc.repo.FindByClientID(ctx, req.ClientID)
+	if err != nil {
+		logger.Error("SVC-TOKEN-001", "get service account failed", err)
+		return nil, errs.ErrInvalidClientCredentials
+	}
+	if account == nil {
+		logger.Error("SVC-TOKEN-002", "service account not found", errs.ErrInvalidClientCredentials)
+		uc.recordToken(ctx, account, "unknown client", req.ClientID)
+		return nil, errs.ErrInvalidClientCredentials
+	}
+
+	if ok := security.VerifyPassword(account.ClientSecret, req.ClientSecret); !ok {
+		logger.Error("SVC-TOKEN-003", "verify client secret failed", errs.ErrInvalidClientCredentials)
+		uc.recordToken(ctx, account, "invalid client secret", req.ClientID)
+		return nil, errs.ErrInvalidClientCredentials
+	}
+
+	if account.Disabled {
+		logger.Error("SVC-TOKEN-004", "service account disabled", errs.ErrServiceAccountDisabled)
+		uc.recordToken(ctx, account, "service account disabled", req.ClientID)
+		return nil, errs.ErrServiceAccountDisabled
+	}
+
+	accessToken, err := uc.tokenConfig.GenerateServiceToken(&security.TokenUser{
+		ID:   account.ID,
+		Role: account.Role,
+		Type: security.PrincipalService,
+	})
+	if err != nil {
+		logger.Error("SVC-TOKEN-005", "generate token failed", err)
+		return nil, errs.ErrGenerateToken
+	}
+
+	logger.Info("SVC-TOKEN-006", "service account token issued", account)
+	uc.recordToken(ctx, account, "", req.ClientID)
+	return &TokenResponseDTO{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(security.ServiceTokenDuration.Seconds()),
+	}, nil
+}
+
+// ------------- Private -------------
+func (uc *serviceAccountUsecase) record(ctx context.Context, id int64, action string) {
+	uc.recorder.Record(ctx, &audit.Event{
+		Type:       audit.EventServiceAccount,
+		TargetID:   id,
+		TargetType: audit.KindServiceAccount,
+		Outcome:    audit.OutcomeSuccess,
+		Metadata:   audit.Metadata{"action": action},
+	})
+}
+
+// recordToken stores a client credentials attempt, an empty reason means
+// success. The service account acts on its own behalf.
+func (uc *serviceAccountUsecase) recordToken(ctx context.Context, account *ServiceAccount, reason, clientID string) {
+	event := &audit.Event{
+		Type:      audit.EventClientCredentials,
+		ActorType: audit.KindAnonymous,
+		Outcome:   audit.OutcomeSuccess,
+		Metadata:  audit.Metadata{"client_id": clientID},
+	}
+
+	if account != nil {
+		event.TargetID = account.ID
+		event.TargetType = audit.KindServiceAccount
+	}
+
+	if reason != "" {
+		event.Outcome = audit.OutcomeFailure
+		event.Reason = reason
+	} else {
+		event.ActorID = account.ID
+		event.ActorType = audit.KindService
+	}
+
+	uc.recorder.Record(ctx, event)
+}
+func (uc *serviceAccountUsecase) newCredentials() (clientID, secret, hashedSecret string, err error) {
+	clientID, err = security.RandomToken(clientIDSize)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	secret, err = security.RandomToken(secretSize)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	hashedSecret, err = security.HashPassword(secret)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	return "svc_" + clientID, secret, hashedSecret, nil
+}
+
+func (uc *serviceAccountUsecase) credentialsResponse(account *ServiceAccount, secret string) *CredentialsResponseDTO {
+	return &CredentialsResponseDTO{
+		ServiceAccount: account,
+		ClientID:       account.ClientID,
+		ClientSecret:   secret,
+	}
+}
@@ -1,13 +1,79 @@
 package user
 
+import "time"
+
 type CreateUserRequest struct {
 	Username        string `json:"username" validate:"required"`
 	Email           string `json:"email" validate:"required"`
 	Password        string `json:"password" validate:"required,min=4"`
 	ConfirmPassword string `json:"confirm_password" validate:"required"`
+	// Set by callers that already proved the address, never by clients
+	EmailVerified bool `json:"-"`
+}
+
+// ProvisionUserRequest creates the account of a federated identity. The
+// username is a suggestion, a free variant is used when it is taken.
+type ProvisionUserRequest struct {
+	Username    string
+	Email       string
+	DisplayName string
+	AvatarURL   string
 }
 
+// UpdateUserRequest holds the fields an update may set. The email changes
+// through the confirmed email change flow instead.
 type UpdateUserRequest struct {
 	Username *string `json:"username"`
-	Email    *string `json:"email"`
+	UpdateProfileRequest
+}
+
+// UpdateProfileRequest sets the fields present, an empty string clears a
+// standard field and a null attribute is removed.
+type UpdateProfileRequest struct {
+	DisplayName *string        `json:"display_name" validate:"omitempty,max=100"`
+	AvatarURL   *string        `json:"avatar_url" validate:"omitempty,url,max=2048"`
+	Locale      *string        `json:"locale" validate:"omitempty,bcp47_language_tag"`
+	TimeZone    *string        `json:"time_zone" validate:"omitempty,timezone"`
+	Phone       *string        `json:"phone" validate:"omitempty,e164"`
+	Attributes  map[string]any `json:"attributes"`
+}
+
+// ListUsersRequest filters GET /admin/users. Email and username match by
+// prefix, the created range includes from and excludes to.
+type ListUsersRequest struct {
+	Limit       int        `form:"limit" validate:"omitempty,min=1,max=100"`
+	Cursor      string     `form:"cursor"`
+	Email       string     `form:"email"`
+	Username    string     `form:"username"`
+	CreatedFrom *time.Time `form:"created_from" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedTo   *time.Time `form:"created_to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Status      string     `form:"status"`
+	Role        string     `form:"role"`
+	Sort        string     `form:"sort"`
+}
+
+type ListUsersResponseDTO struct {
+	Users      []*User `json:"users"`
+	Limit      int     `json:"limit"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+type SearchUsersRequest struct {
+	Q     string `form:"q" validate:"required,min=2,max=100"`
+	Limit int    `form:"limit" validate:"omitempty,min=1,max=50"`
+}
+
+type SearchResultDTO struct {
+	User    *User            `json:"user"`
+	Score   float64          `json:"score"`
+	Matches []*FieldMatchDTO `json:"matches"`
+}
+
+// FieldMatchDTO names a field that matched. Ranges are byte offsets of the
+// search terms found literally in Value, fuzzy matches may have none.
+type FieldMatchDTO struct {
+	Field  string   `json:"field"`
+	Value  string   `json:"value"`
+	Score  float64  `json:"score"`
+	Ranges [][2]int `json:"ranges,omitempty"`
 }
@@ -1,12 +1,75 @@
 package user
 
-import "time"
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Account states, only active accounts can sign in. Pending deletion
+// accounts are purged into deleted tombstones once their grace period ends.
+const (
+	StatusActive          = "active"
+	StatusSuspended       = "suspended"
+	StatusDeactivated     = "deactivated"
+	StatusPendingDeletion = "pending_deletion"
+	StatusDeleted         = "deleted"
+)
+
+var statuses = []string{
+	StatusActive,
+	StatusSuspended,
+	StatusDeactivated,
+	StatusPendingDeletion,
+	StatusDeleted,
+}
 
 type User struct {
-	ID        int64      `json:"id" gorm:"primaryKey"`
-	Username  string     `json:"username" gorm:"unique;not null"`
-	Email     string     `json:"email" gorm:"unique;not null"`
-	Password  string     `json:"-"`
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedAt *time.Time `json:"updated_at"`
+	ID              int64          `json:"id" gorm:"primaryKey"`
+	Username        string         `json:"username" gorm:"unique;not null"`
+	Email           string         `json:"email" gorm:"unique;not null"`
+	EmailVerifiedAt *time.Time     `json:"email_verified_at,omitempty"`
+	Password        string         `json:"-"`
+	Role            string         `json:"role" gorm:"not null;default:user"`
+	DisplayName     string         `json:"display_name,omitempty"`
+	AvatarURL       string         `json:"avatar_url,omitempty"`
+	Avatars         AvatarVariants `json:"avatars,omitempty" gorm:"type:text;not null"`
+	AvatarKey       string         `json:"-"`
+	Locale          string         `json:"locale,omitempty"`
+	TimeZone        string         `json:"time_zone,omitempty"`
+	Phone           string         `json:"phone,omitempty"`
+	Attributes      Attributes     `json:"attributes,omitempty" gorm:"type:text;not null"`
+	Status          string         `json:"status" gorm:"not null;default:active"`
+	StatusChangedAt *time.Time     `json:"status_changed_at,omitempty"`
+	PurgeAfter      *time.Time     `json:"purge_after,omitempty"`
+	Version         int64          `json:"version" gorm:"not null;default:1"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       *time.Time     `json:"updated_at"`
+}
+
+// ETag is the entity tag of the user's current version.
+func (u *User) ETag() string {
+	return fmt.Sprintf(`"%d"`, u.Version)
+}
+
+func (u *User) IsActive() bool {
+	return u.Status == "" || u.Status == StatusActive
+}
+
+func (u *User) IsDeleted() bool {
+	return u.Status == StatusDeleted
+}
+
+func IsKnownStatus(status string) bool {
+	return slices.Contains(statuses, status)
+}
+
+// PseudonymUsername and PseudonymEmail replace the personal data of an
+// erased account, they stay unique and identify nothing but the ID.
+func PseudonymUsername(id int64) string {
+	return fmt.Sprintf("deleted-%d", id)
+}
+
+func PseudonymEmail(id int64) string {
+	return fmt.Sprintf("deleted-%d@invalid", id)
 }
@@ -1,8 +1,12 @@
 package user
 
 import (
+	"errors"
 	"strconv"
+	"strings"
 
+	"github.com/codepnw/go-authen-system/internal/middleware"
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
 	"github.com/codepnw/go-authen-system/internal/utils/response"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
@@ -57,11 +61,28 @@ func (h *userHandler) GetProfile(c *gin.Context) {
 		return
 	}
 
+	c.Header("ETag", user.ETag())
 	response.Success(c, "", user)
 }
 
 func (h *userHandler) GetUsers(c *gin.Context) {
-	users, err := h.uc.GetUsers(c)
+	req := new(ListUsersRequest)
+
+	if err := c.ShouldBindQuery(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	users, err := h.uc.GetUsers(c, req)
+	if errors.Is(err, errs.ErrInvalidCursor) || errors.Is(err, errs.ErrInvalidSort) || errors.Is(err, errs.ErrInvalidFilter) {
+		response.BadRequest(c, "", err)
+		return
+	}
 	if err != nil {
 		response.InternalServerError(c, err)
 		return
@@ -70,6 +91,31 @@ func (h *userHandler) GetUsers(c *gin.Context) {
 	response.Success(c, "", users)
 }
 
+func (h *userHandler) SearchUsers(c *gin.Context) {
+	req := new(SearchUsersRequest)
+
+	if err := c.ShouldBindQuery(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	results, err := h.uc.SearchUsers(c, req)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, "", results)
+}
+
+// UpdateUser is the admin edit, it may set every profile field. It changes
+// only the fields in the body. The If-Match header must carry the ETag of the
+// user as last read, a stale one gets 412.
 func (h *userHandler) UpdateUser(c *gin.Context) {
 	id, err := getIntParamID(c.Param("id"))
 	if err != nil {
@@ -77,6 +123,11 @@ func (h *userHandler) UpdateUser(c *gin.Context) {
 		return
 	}
 
+	version, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
 	req := new(UpdateUserRequest)
 
 	if err := c.ShouldBindJSON(req); err != nil {
@@ -90,29 +141,213 @@ func (h *userHandler) UpdateUser(c *gin.Context) {
 	}
 
 	// Update User
-	if err = h.uc.UpdateUser(c, id, req); err != nil {
+	user, err := h.uc.UpdateUser(c, id, version, req)
+	if err != nil {
+		updateError(c, err)
+		return
+	}
+
+	c.Header("ETag", user.ETag())
+	response.Success(c, "user updated", user)
+}
+
+// GetMyProfile returns the caller's profile without private attributes.
+func (h *userHandler) GetMyProfile(c *gin.Context) {
+	current, ok := middleware.CurrentUser(c)
+	if !ok {
+		response.Unauthorized(c, errs.ErrInvalidToken)
+		return
+	}
+
+	user, err := h.uc.GetOwnProfile(c, current.ID)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	c.Header("ETag", user.ETag())
+	response.Success(c, "", user)
+}
+
+// UpdateMyProfile changes the caller's profile fields and user editable
+// attributes, with the same If-Match rules as UpdateUser.
+func (h *userHandler) UpdateMyProfile(c *gin.Context) {
+	current, ok := middleware.CurrentUser(c)
+	if !ok {
+		response.Unauthorized(c, errs.ErrInvalidToken)
+		return
+	}
+
+	version, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	req := new(UpdateProfileRequest)
+
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	user, err := h.uc.UpdateOwnProfile(c, current.ID, version, req)
+	if err != nil {
+		updateError(c, err)
+		return
+	}
+
+	c.Header("ETag", user.ETag())
+	response.Success(c, "profile updated", user)
+}
+
+func (h *userHandler) GetProfileSchema(c *gin.Context) {
+	schema, err := h.uc.GetProfileSchema(c)
+	if err != nil {
 		response.InternalServerError(c, err)
 		return
 	}
 
-	response.Success(c, "user updated", nil)
+	response.Success(c, "", schema)
+}
+
+// UpdateProfileSchema replaces the attribute schema, the body is the JSON
+// Schema document itself.
+func (h *userHandler) UpdateProfileSchema(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	parsed, err := ParseAttributeSchema(body)
+	if err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	schema, err := h.uc.UpdateProfileSchema(c, parsed)
+	if errors.Is(err, errs.ErrInvalidSchema) {
+		response.BadRequest(c, "", err)
+		return
+	}
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, "profile schema updated", schema)
 }
 
 func (h *userHandler) DeleteUser(c *gin.Context) {
+	h.setStatus(c, StatusPendingDeletion, "user scheduled for deletion")
+}
+
+func (h *userHandler) RestoreUser(c *gin.Context) {
+	h.setStatus(c, StatusActive, "user restored")
+}
+
+func (h *userHandler) SuspendUser(c *gin.Context) {
+	h.setStatus(c, StatusSuspended, "user suspended")
+}
+
+func (h *userHandler) DeactivateUser(c *gin.Context) {
+	h.setStatus(c, StatusDeactivated, "user deactivated")
+}
+
+// DeactivateMe lets users close their own account, signing them out everywhere.
+func (h *userHandler) DeactivateMe(c *gin.Context) {
+	h.setOwnStatus(c, StatusDeactivated, "account deactivated")
+}
+
+// DeleteMe schedules the caller's account for deletion.
+func (h *userHandler) DeleteMe(c *gin.Context) {
+	h.setOwnStatus(c, StatusPendingDeletion, "account scheduled for deletion")
+}
+
+func (h *userHandler) setStatus(c *gin.Context, status, message string) {
 	id, err := getIntParamID(c.Param("id"))
 	if err != nil {
 		response.BadRequest(c, "invalid id", err)
 		return
 	}
 
-	if err = h.uc.DeleteUser(c, id); err != nil {
+	h.changeStatus(c, id, status, message)
+}
+
+func (h *userHandler) setOwnStatus(c *gin.Context, status, message string) {
+	current, ok := middleware.CurrentUser(c)
+	if !ok {
+		response.Unauthorized(c, errs.ErrInvalidToken)
+		return
+	}
+
+	h.changeStatus(c, current.ID, status, message)
+}
+
+func (h *userHandler) changeStatus(c *gin.Context, id int64, status, message string) {
+	err := h.uc.SetStatus(c, id, status)
+	if errors.Is(err, errs.ErrAccountDeleted) || errors.Is(err, errs.ErrStatusTransition) || errors.Is(err, errs.ErrVersionConflict) {
+		response.Conflict(c, err)
+		return
+	}
+	if err != nil {
 		response.InternalServerError(c, err)
 		return
 	}
 
-	response.Success(c, "user deleted", nil)
+	response.Success(c, message, nil)
+}
+
+// ifMatchVersion reads the version the client last saw from If-Match and
+// answers 428 or 412 itself when it cannot.
+func ifMatchVersion(c *gin.Context) (int64, bool) {
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" {
+		response.PreconditionRequired(c, errs.ErrIfMatchRequired)
+		return 0, false
+	}
+
+	version, ok := parseETag(ifMatch)
+	if !ok {
+		response.PreconditionFailed(c, errs.ErrVersionConflict)
+		return 0, false
+	}
+	return version, true
+}
+
+func updateError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errs.ErrVersionConflict):
+		response.PreconditionFailed(c, err)
+	case errors.Is(err, errs.ErrAccountDeleted):
+		response.Conflict(c, err)
+	case errors.Is(err, errs.ErrInvalidProfile):
+		response.BadRequest(c, "", err)
+	default:
+		response.InternalServerError(c, err)
+	}
 }
 
 func getIntParamID(key string) (int64, error) {
 	return strconv.ParseInt(key, 10, 64)
 }
+
+// parseETag reads the version from an entity tag made by User.ETag. Weak
+// tags never match, If-Match compares strongly.
+func parseETag(tag string) (int64, bool) {
+	tag = strings.TrimSpace(tag)
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+
+	version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return version, true
+}
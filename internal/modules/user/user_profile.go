@@ -0,0 +1,474 @@
+package user
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"regexp"
+	"slices"
+	"time"
+	"unicode/utf8"
+
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+	"github.com/codepnw/go-authen-system/internal/utils/security"
+)
+
+// Who may read and write a custom attribute. Users read user and admin
+// attributes but only write user ones, private attributes are for admins.
+const (
+	VisibilityUser    = "user"
+	VisibilityAdmin   = "admin"
+	VisibilityPrivate = "private"
+)
+
+// Attribute types, a subset of the JSON Schema types.
+const (
+	TypeString  = "string"
+	TypeNumber  = "number"
+	TypeInteger = "integer"
+	TypeBoolean = "boolean"
+	TypeArray   = "array"
+)
+
+// Standard profile fields, custom attributes cannot reuse their names.
+var profileFields = []string{"display_name", "avatar_url", "locale", "time_zone", "phone"}
+
+// profileAccess is the level a profile is read or written at.
+type profileAccess int
+
+const (
+	accessOwner profileAccess = iota
+	accessAdmin
+)
+
+// ProfileSchema is one version of the admin managed attribute schema, the
+// newest row is the current one.
+type ProfileSchema struct {
+	ID        int64            `json:"version" gorm:"primaryKey"`
+	Schema    *AttributeSchema `json:"schema" gorm:"column:document;type:text;not null"`
+	CreatedBy int64            `json:"created_by,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+func (ProfileSchema) TableName() string {
+	return "profile_schemas"
+}
+
+// AttributeSchema describes the custom attributes as a JSON Schema object.
+// Properties carry x-visibility, x-claims maps token claims to standard
+// fields or attributes.
+type AttributeSchema struct {
+	Type       string                        `json:"type,omitempty"`
+	Properties map[string]*AttributeProperty `json:"properties"`
+	Claims     map[string]string             `json:"x-claims,omitempty"`
+}
+
+type AttributeProperty struct {
+	Type        string             `json:"type"`
+	Title       string             `json:"title,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Enum        []any              `json:"enum,omitempty"`
+	MinLength   *int               `json:"minLength,omitempty"`
+	MaxLength   *int               `json:"maxLength,omitempty"`
+	Pattern     string             `json:"pattern,omitempty"`
+	Minimum     *float64           `json:"minimum,omitempty"`
+	Maximum     *float64           `json:"maximum,omitempty"`
+	MaxItems    *int               `json:"maxItems,omitempty"`
+	Items       *AttributeProperty `json:"items,omitempty"`
+	Visibility  string             `json:"x-visibility,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// ParseAttributeSchema decodes and checks a schema document. Keywords the
+// validator does not implement are rejected rather than ignored.
+func ParseAttributeSchema(data []byte) (*AttributeSchema, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	schema := new(AttributeSchema)
+	if err := dec.Decode(schema); err != nil {
+		return nil, fmt.Errorf("%w: %v", errs.ErrInvalidSchema, err)
+	}
+	if err := schema.compile(); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+func emptySchema() *AttributeSchema {
+	return &AttributeSchema{Type: "object", Properties: map[string]*AttributeProperty{}}
+}
+
+func (s *AttributeSchema) compile() error {
+	if s.Type != "" && s.Type != "object" {
+		return fmt.Errorf("%w: type must be object", errs.ErrInvalidSchema)
+	}
+	if s.Properties == nil {
+		s.Properties = map[string]*AttributeProperty{}
+	}
+
+	for name, prop := range s.Properties {
+		if slices.Contains(profileFields, name) {
+			return fmt.Errorf("%w: %q is a standard profile field", errs.ErrInvalidSchema, name)
+		}
+		if prop == nil {
+			return fmt.Errorf("%w: %q has no definition", errs.ErrInvalidSchema, name)
+		}
+		if prop.Visibility == "" {
+			prop.Visibility = VisibilityAdmin
+		}
+		if !slices.Contains([]string{VisibilityUser, VisibilityAdmin, VisibilityPrivate}, prop.Visibility) {
+			return fmt.Errorf("%w: %q has unknown visibility %q", errs.ErrInvalidSchema, name, prop.Visibility)
+		}
+		if err := prop.compile(name, true); err != nil {
+			return err
+		}
+	}
+
+	for claim, field := range s.Claims {
+		if security.IsReservedClaim(claim) {
+			return fmt.Errorf("%w: claim %q is reserved", errs.ErrInvalidSchema, claim)
+		}
+		if slices.Contains(profileFields, field) {
+			continue
+		}
+
+		prop, ok := s.Properties[field]
+		if !ok {
+			return fmt.Errorf("%w: claim %q maps unknown field %q", errs.ErrInvalidSchema, claim, field)
+		}
+		if prop.Visibility == VisibilityPrivate {
+			return fmt.Errorf("%w: claim %q maps private attribute %q", errs.ErrInvalidSchema, claim, field)
+		}
+	}
+	return nil
+}
+
+func (p *AttributeProperty) compile(name string, top bool) error {
+	switch p.Type {
+	case TypeString, TypeNumber, TypeInteger, TypeBoolean:
+	case TypeArray:
+		if !top {
+			return fmt.Errorf("%w: %q cannot nest arrays", errs.ErrInvalidSchema, name)
+		}
+		if p.Items == nil {
+			return fmt.Errorf("%w: array %q needs items", errs.ErrInvalidSchema, name)
+		}
+		if err := p.Items.compile(name, false); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: %q has unsupported type %q", errs.ErrInvalidSchema, name, p.Type)
+	}
+
+	if p.Pattern != "" {
+		pattern, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return fmt.Errorf("%w: %q has invalid pattern: %v", errs.ErrInvalidSchema, name, err)
+		}
+		p.pattern = pattern
+	}
+
+	for _, v := range p.Enum {
+		if err := p.checkType(name, v); err != nil {
+			return fmt.Errorf("%w: %q enum: %v", errs.ErrInvalidSchema, name, err)
+		}
+	}
+	return nil
+}
+
+// validate checks a decoded JSON value against the property.
+func (p *AttributeProperty) validate(name string, value any) error {
+	if err := p.checkType(name, value); err != nil {
+		return fmt.Errorf("%w: %v", errs.ErrInvalidProfile, err)
+	}
+
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: attribute %q %s", errs.ErrInvalidProfile, name, fmt.Sprintf(format, args...))
+	}
+
+	if len(p.Enum) > 0 && !slices.ContainsFunc(p.Enum, func(v any) bool { return jsonEqual(v, value) }) {
+		return invalid("is not one of the allowed values")
+	}
+
+	switch v := value.(type) {
+	case string:
+		n := utf8.RuneCountInString(v)
+		if p.MinLength != nil && n < *p.MinLength {
+			return invalid("is shorter than %d", *p.MinLength)
+		}
+		if p.MaxLength != nil && n > *p.MaxLength {
+			return invalid("is longer than %d", *p.MaxLength)
+		}
+		if p.pattern != nil && !p.pattern.MatchString(v) {
+			return invalid("does not match %s", p.Pattern)
+		}
+	case float64:
+		if p.Minimum != nil && v < *p.Minimum {
+			return invalid("is below %v", *p.Minimum)
+		}
+		if p.Maximum != nil && v > *p.Maximum {
+			return invalid("is above %v", *p.Maximum)
+		}
+	case []any:
+		if p.MaxItems != nil && len(v) > *p.MaxItems {
+			return invalid("has more than %d items", *p.MaxItems)
+		}
+		for _, item := range v {
+			if err := p.Items.validate(name, item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *AttributeProperty) checkType(name string, value any) error {
+	ok := false
+
+	switch p.Type {
+	case TypeString:
+		_, ok = value.(string)
+	case TypeNumber:
+		_, ok = value.(float64)
+	case TypeInteger:
+		f, isNumber := value.(float64)
+		ok = isNumber && f == math.Trunc(f)
+	case TypeBoolean:
+		_, ok = value.(bool)
+	case TypeArray:
+		_, ok = value.([]any)
+	}
+
+	if !ok {
+		return fmt.Errorf("attribute %q must be of type %s", name, p.Type)
+	}
+	return nil
+}
+
+func (p *AttributeProperty) readable(access profileAccess) bool {
+	return access == accessAdmin || p.Visibility != VisibilityPrivate
+}
+
+func (p *AttributeProperty) writable(access profileAccess) bool {
+	return access == accessAdmin || p.Visibility == VisibilityUser
+}
+
+// Value and Scan store the schema as JSON text.
+func (s AttributeSchema) Value() (driver.Value, error) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (s *AttributeSchema) Scan(value any) error {
+	var b []byte
+
+	switch v := value.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return errors.New("user: unsupported schema type")
+	}
+
+	if err := json.Unmarshal(b, s); err != nil {
+		return err
+	}
+	return s.compile()
+}
+
+// Attributes holds the custom profile attributes, stored as a JSON object.
+type Attributes map[string]any
+
+func (a Attributes) Value() (driver.Value, error) {
+	if len(a) == 0 {
+		return "{}", nil
+	}
+
+	b, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (a *Attributes) Scan(value any) error {
+	var b []byte
+
+	switch v := value.(type) {
+	case nil:
+		*a = nil
+		return nil
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return errors.New("user: unsupported attributes type")
+	}
+
+	return json.Unmarshal(b, a)
+}
+
+// AvatarVariants maps the resized variants of an uploaded avatar to their
+// URLs, stored as a JSON object.
+type AvatarVariants map[string]string
+
+func (v AvatarVariants) Value() (driver.Value, error) {
+	if len(v) == 0 {
+		return "{}", nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (v *AvatarVariants) Scan(value any) error {
+	var b []byte
+
+	switch val := value.(type) {
+	case nil:
+		*v = nil
+		return nil
+	case string:
+		b = []byte(val)
+	case []byte:
+		b = val
+	default:
+		return errors.New("user: unsupported avatars type")
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+// applyProfile sets the fields present in req on u and returns the names of
+// the changed User fields and of the changed profile fields. Attributes set
+// to null are removed.
+func applyProfile(u *User, req *UpdateProfileRequest, schema *AttributeSchema, access profileAccess) (fields, changed []string, err error) {
+	set := func(dst *string, value *string, field, name string) {
+		if value != nil && *value != *dst {
+			*dst = *value
+			fields = append(fields, field)
+			changed = append(changed, name)
+		}
+	}
+	set(&u.DisplayName, req.DisplayName, "DisplayName", "display_name")
+	set(&u.AvatarURL, req.AvatarURL, "AvatarURL", "avatar_url")
+	// Uploaded variants no longer match an avatar set by URL, the files stay
+	// under AvatarKey until the next upload or erasure removes them
+	if slices.Contains(fields, "AvatarURL") && len(u.Avatars) > 0 {
+		u.Avatars = nil
+		fields = append(fields, "Avatars")
+	}
+	set(&u.Locale, req.Locale, "Locale", "locale")
+	set(&u.TimeZone, req.TimeZone, "TimeZone", "time_zone")
+	set(&u.Phone, req.Phone, "Phone", "phone")
+
+	if len(req.Attributes) == 0 {
+		return fields, changed, nil
+	}
+
+	attributes := maps.Clone(u.Attributes)
+	if attributes == nil {
+		attributes = Attributes{}
+	}
+	modified := false
+
+	for _, name := range slices.Sorted(maps.Keys(req.Attributes)) {
+		value := req.Attributes[name]
+
+		prop, ok := schema.Properties[name]
+		if !ok || !prop.readable(access) {
+			return nil, nil, fmt.Errorf("%w: unknown attribute %q", errs.ErrInvalidProfile, name)
+		}
+		if !prop.writable(access) {
+			return nil, nil, fmt.Errorf("%w: attribute %q is read-only", errs.ErrInvalidProfile, name)
+		}
+
+		if value == nil {
+			if _, ok := attributes[name]; ok {
+				delete(attributes, name)
+				changed = append(changed, "attributes."+name)
+				modified = true
+			}
+			continue
+		}
+
+		if err := prop.validate(name, value); err != nil {
+			return nil, nil, err
+		}
+		old, ok := attributes[name]
+		if ok && jsonEqual(old, value) {
+			continue
+		}
+		attributes[name] = value
+		changed = append(changed, "attributes."+name)
+		modified = true
+	}
+
+	if modified {
+		u.Attributes = attributes
+		fields = append(fields, "Attributes")
+	}
+	return fields, changed, nil
+}
+
+// ownerView returns a copy of u without the attributes its owner may not read.
+func ownerView(u *User, schema *AttributeSchema) *User {
+	view := *u
+	view.Attributes = Attributes{}
+
+	for name, value := range u.Attributes {
+		if prop, ok := schema.Properties[name]; ok && prop.readable(accessOwner) {
+			view.Attributes[name] = value
+		}
+	}
+	return &view
+}
+
+// profileClaims resolves the x-claims mapping for u, empty values are left out.
+func profileClaims(u *User, schema *AttributeSchema) map[string]any {
+	claims := make(map[string]any, len(schema.Claims))
+
+	for claim, field := range schema.Claims {
+		var value any
+
+		switch field {
+		case "display_name":
+			value = u.DisplayName
+		case "avatar_url":
+			value = u.AvatarURL
+		case "locale":
+			value = u.Locale
+		case "time_zone":
+			value = u.TimeZone
+		case "phone":
+			value = u.Phone
+		default:
+			value = u.Attributes[field]
+		}
+
+		if value != nil && value != "" {
+			claims[claim] = value
+		}
+	}
+	return claims
+}
+
+func jsonEqual(a, b any) bool {
+	x, errA := json.Marshal(a)
+	y, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(x, y)
+}
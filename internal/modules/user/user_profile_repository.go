@@ -0,0 +1,40 @@
+package user
+
+import (
+	"context"
+	"errors"
+
+	"github.com/codepnw/go-authen-system/internal/utils/transaction"
+	"gorm.io/gorm"
+)
+
+// ProfileSchemaRepository keeps every version of the attribute schema. It is
+// backed by the database with every storage driver.
+type ProfileSchemaRepository interface {
+	// Current returns the newest schema, nil when none was saved yet.
+	Current(ctx context.Context) (*ProfileSchema, error)
+	Create(ctx context.Context, input *ProfileSchema) error
+}
+
+type profileSchemaRepository struct {
+	db *gorm.DB
+}
+
+func NewProfileSchemaRepository(db *gorm.DB) ProfileSchemaRepository {
+	return &profileSchemaRepository{db: db}
+}
+
+func (r *profileSchemaRepository) Current(ctx context.Context) (schema *ProfileSchema, err error) {
+	err = transaction.DB(ctx, r.db).Order("id DESC").First(&schema).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+func (r *profileSchemaRepository) Create(ctx context.Context, input *ProfileSchema) error {
+	return transaction.DB(ctx, r.db).Create(input).Error
+}
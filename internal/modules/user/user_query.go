@@ -0,0 +1,205 @@
+package user
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 100
+)
+
+// Sort fields accepted by GET /admin/users, "-" in front sorts descending.
+// Ties are broken by id in the same direction.
+var sortFields = []string{"id", "created_at", "username", "email"}
+
+// UserQuery is a validated ListUsersRequest with its cursor decoded.
+type UserQuery struct {
+	EmailPrefix    string
+	UsernamePrefix string
+	CreatedFrom    *time.Time
+	CreatedTo      *time.Time
+	Status         string
+	Role           string
+
+	SortField string
+	Desc      bool
+	After     *Cursor
+	Limit     int
+}
+
+// Cursor is the position after the last user of a page. It is bound to the
+// sort it was issued for.
+type Cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v,omitempty"`
+	ID    int64  `json:"id"`
+}
+
+func (c *Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errs.ErrInvalidCursor
+	}
+
+	c := new(Cursor)
+	if err = json.Unmarshal(b, c); err != nil || c.ID == 0 {
+		return nil, errs.ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// NewUserQuery applies defaults and validates the sort and cursor.
+func NewUserQuery(req *ListUsersRequest) (*UserQuery, error) {
+	q := &UserQuery{
+		EmailPrefix:    strings.ToLower(req.Email),
+		UsernamePrefix: strings.ToLower(req.Username),
+		CreatedFrom:    utc(req.CreatedFrom),
+		CreatedTo:      utc(req.CreatedTo),
+		Status:         req.Status,
+		Role:           req.Role,
+		SortField:      "id",
+		Limit:          req.Limit,
+	}
+
+	if q.Limit <= 0 {
+		q.Limit = defaultListLimit
+	}
+	q.Limit = min(q.Limit, maxListLimit)
+
+	if req.Sort != "" {
+		q.SortField = strings.TrimPrefix(req.Sort, "-")
+		q.Desc = strings.HasPrefix(req.Sort, "-")
+	}
+	if !slices.Contains(sortFields, q.SortField) {
+		return nil, errs.ErrInvalidSort
+	}
+	if q.Status != "" && !IsKnownStatus(q.Status) {
+		return nil, fmt.Errorf("%w: unknown status %q", errs.ErrInvalidFilter, q.Status)
+	}
+
+	if req.Cursor != "" {
+		cursor, err := DecodeCursor(req.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Sort != q.sort() {
+			return nil, errs.ErrInvalidCursor
+		}
+		if q.SortField == "created_at" {
+			if _, err = time.Parse(time.RFC3339Nano, cursor.Value); err != nil {
+				return nil, errs.ErrInvalidCursor
+			}
+		}
+		q.After = cursor
+	}
+
+	return q, nil
+}
+
+// CursorAfter returns the cursor continuing after u.
+func (q *UserQuery) CursorAfter(u *User) *Cursor {
+	return &Cursor{Sort: q.sort(), Value: q.sortValue(u), ID: u.ID}
+}
+
+// Timestamps are stored in UTC, SQLite compares them as text.
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// afterValue is the cursor value typed for comparison with the sort column.
+func (q *UserQuery) afterValue() any {
+	if q.SortField == "created_at" {
+		t, _ := time.Parse(time.RFC3339Nano, q.After.Value)
+		return t
+	}
+	return q.After.Value
+}
+
+func (q *UserQuery) sort() string {
+	if q.Desc {
+		return "-" + q.SortField
+	}
+	return q.SortField
+}
+
+func (q *UserQuery) sortValue(u *User) string {
+	switch q.SortField {
+	case "created_at":
+		return u.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case "username":
+		return u.Username
+	case "email":
+		return u.Email
+	}
+	return strconv.FormatInt(u.ID, 10)
+}
+
+// likeEscape escapes LIKE wildcards, patterns use ESCAPE '\'.
+func likeEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func likePrefix(prefix string) string {
+	return likeEscape(prefix) + "%"
+}
+
+// matches applies the filters and the cursor to one user, for the memory
+// repository.
+func (q *UserQuery) matches(u *User) bool {
+	switch {
+	case q.EmailPrefix != "" && !strings.HasPrefix(strings.ToLower(u.Email), q.EmailPrefix),
+		q.UsernamePrefix != "" && !strings.HasPrefix(strings.ToLower(u.Username), q.UsernamePrefix),
+		q.CreatedFrom != nil && u.CreatedAt.Before(*q.CreatedFrom),
+		q.CreatedTo != nil && !u.CreatedAt.Before(*q.CreatedTo),
+		q.Status != "" && u.Status != q.Status,
+		q.Role != "" && u.Role != q.Role:
+		return false
+	}
+
+	if q.After == nil {
+		return true
+	}
+	return q.compare(u, q.sortValue(u), q.After) > 0
+}
+
+// compare orders u, whose sort value is value, against the cursor position
+// in the direction of the sort.
+func (q *UserQuery) compare(u *User, value string, after *Cursor) int {
+	var c int
+
+	switch q.SortField {
+	case "id":
+	case "created_at":
+		t, _ := time.Parse(time.RFC3339Nano, after.Value)
+		c = u.CreatedAt.Compare(t)
+	default:
+		c = strings.Compare(value, after.Value)
+	}
+	if c == 0 {
+		c = cmp.Compare(u.ID, after.ID)
+	}
+
+	if q.Desc {
+		return -c
+	}
+	return c
+}
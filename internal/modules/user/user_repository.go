@@ -3,51 +3,90 @@ package user
 import (
 	"context"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/codepnw/go-authen-system/internal/modules/outbox"
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+	"github.com/codepnw/go-authen-system/internal/utils/transaction"
 	"gorm.io/gorm"
 )
 
 type UserRepository interface {
-	Create(ctx context.Context, input *User) (*User, error)
+	Create(ctx context.Context, input *User, events ...*outbox.Event) (*User, error)
 	FindByID(ctx context.Context, id int64) (*User, error)
 	FindByEmail(ctx context.Context, email string) (*User, error)
-	ListUsers(ctx context.Context) ([]*User, error)
-	Update(ctx context.Context, input *User) error
-	Delete(ctx context.Context, id int64) error
+	// ListUsers returns up to query.Limit users after query.After.
+	ListUsers(ctx context.Context, query *UserQuery) ([]*User, error)
+	ListUsersByTenant(ctx context.Context, tenantID int64) ([]*User, error)
+	FindByIDInTenant(ctx context.Context, tenantID, id int64) (*User, error)
+	// Update writes the named fields of input when the stored version still
+	// equals input.Version, then bumps the version and UpdatedAt. Otherwise
+	// it returns errs.ErrVersionConflict.
+	Update(ctx context.Context, input *User, fields []string, events ...*outbox.Event) error
+	// ListPurgeable returns up to limit accounts pending deletion whose grace
+	// period ended before the given time.
+	ListPurgeable(ctx context.Context, before time.Time, limit int) ([]*User, error)
+	Delete(ctx context.Context, id int64, events ...*outbox.Event) error
 }
 
 type userRepository struct {
 	db *gorm.DB
+
+	trigramOnce sync.Once
+	trigram     bool
 }
 
 func NewUserRepository(db *gorm.DB) UserRepository {
 	return &userRepository{db: db}
 }
 
-func (u *userRepository) Create(ctx context.Context, user *User) (*User, error) {
-	err := u.db.WithContext(ctx).Create(&user).Error
+// Create inserts the user and its outbox events in one transaction. Events
+// without an aggregate ID get the new user's ID.
+func (u *userRepository) Create(ctx context.Context, user *User, events ...*outbox.Event) (*User, error) {
+	if user.Version == 0 {
+		user.Version = 1
+	}
+
+	err := transaction.DB(ctx, u.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+
+		for _, e := range events {
+			if e.AggregateID == 0 {
+				e.AggregateID = user.ID
+			}
+		}
+		return outbox.Write(tx, events...)
+	})
 	if err != nil {
 		return nil, err
 	}
 	return user, nil
 }
 
-func (u *userRepository) Delete(ctx context.Context, id int64) error {
-	res := u.db.WithContext(ctx).Delete(&User{}, id)
-	if res.Error != nil {
-		return res.Error
-	}
+func (u *userRepository) Delete(ctx context.Context, id int64, events ...*outbox.Event) error {
+	return transaction.DB(ctx, u.db).Transaction(func(tx *gorm.DB) error {
+		res := tx.Delete(&User{}, id)
+		if res.Error != nil {
+			return res.Error
+		}
 
-	rows := res.RowsAffected
-	if rows == 0 {
-		return errors.New("user not found")
-	}
+		rows := res.RowsAffected
+		if rows == 0 {
+			return errors.New("user not found")
+		}
 
-	return nil
+		return outbox.Write(tx, events...)
+	})
 }
 
 func (u *userRepository) FindByEmail(ctx context.Context, email string) (user *User, err error) {
-	err = u.db.WithContext(ctx).First(&user, "email = ?", email).Error
+	err = transaction.DB(ctx, u.db).First(&user, "email = ?", email).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, nil
 	}
@@ -58,31 +97,216 @@ func (u *userRepository) FindByEmail(ctx context.Context, email string) (user *U
 	return user, nil
 }
 
-func (u *userRepository) ListUsers(ctx context.Context) (users []*User, err error) {
-	if err = u.db.WithContext(ctx).Find(&users).Error; err != nil {
+func (u *userRepository) ListUsers(ctx context.Context, query *UserQuery) (users []*User, err error) {
+	tx := transaction.DB(ctx, u.db).Model(&User{})
+
+	if query.EmailPrefix != "" {
+		tx = tx.Where(`LOWER(email) LIKE ? ESCAPE '\'`, likePrefix(query.EmailPrefix))
+	}
+	if query.UsernamePrefix != "" {
+		tx = tx.Where(`LOWER(username) LIKE ? ESCAPE '\'`, likePrefix(query.UsernamePrefix))
+	}
+	if query.CreatedFrom != nil {
+		tx = tx.Where("created_at >= ?", *query.CreatedFrom)
+	}
+	if query.CreatedTo != nil {
+		tx = tx.Where("created_at < ?", *query.CreatedTo)
+	}
+	if query.Status != "" {
+		tx = tx.Where("status = ?", query.Status)
+	}
+	if query.Role != "" {
+		tx = tx.Where("role = ?", query.Role)
+	}
+
+	// Keyset pagination, the sort field is whitelisted by NewUserQuery
+	dir, op := "ASC", ">"
+	if query.Desc {
+		dir, op = "DESC", "<"
+	}
+
+	if query.After != nil {
+		if query.SortField == "id" {
+			tx = tx.Where("id "+op+" ?", query.After.ID)
+		} else {
+			value := query.afterValue()
+			tx = tx.Where(
+				fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", query.SortField, op),
+				value, value, query.After.ID,
+			)
+		}
+	}
+
+	if query.SortField != "id" {
+		tx = tx.Order(query.SortField + " " + dir)
+	}
+	tx = tx.Order("id " + dir)
+
+	if err = tx.Limit(query.Limit).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (u *userRepository) ListPurgeable(ctx context.Context, before time.Time, limit int) (users []*User, err error) {
+	err = transaction.DB(ctx, u.db).
+		Where("status = ? AND purge_after <= ?", StatusPendingDeletion, before).
+		Order("purge_after, id").
+		Limit(limit).
+		Find(&users).Error
+	if err != nil {
 		return nil, err
 	}
 	return users, nil
 }
 
-func (u *userRepository) FindByID(ctx context.Context, id int64) (user *User, err error) {
-	res := u.db.WithContext(ctx).First(&user, "id = ?", id)
+// ListUsersByTenant returns the users holding a membership in the organization.
+func (u *userRepository) ListUsersByTenant(ctx context.Context, tenantID int64) (users []*User, err error) {
+	err = u.tenantScope(ctx, tenantID).Order("users.id").Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (u *userRepository) FindByIDInTenant(ctx context.Context, tenantID, id int64) (user *User, err error) {
+	res := u.tenantScope(ctx, tenantID).First(&user, "users.id = ?", id)
 	if res.Error != nil {
 		return nil, res.Error
 	}
 	return user, nil
 }
 
-func (u *userRepository) Update(ctx context.Context, input *User) error {
-	res := u.db.WithContext(ctx).Save(&input)
+func (u *userRepository) FindByID(ctx context.Context, id int64) (user *User, err error) {
+	res := transaction.DB(ctx, u.db).First(&user, "id = ?", id)
 	if res.Error != nil {
-		return res.Error
+		return nil, res.Error
 	}
+	return user, nil
+}
 
-	rows := res.RowsAffected
-	if rows == 0 {
-		return errors.New("user not found")
+func (u *userRepository) Update(ctx context.Context, input *User, fields []string, events ...*outbox.Event) error {
+	now := time.Now()
+	next := *input
+	next.Version++
+	next.UpdatedAt = &now
+
+	err := transaction.DB(ctx, u.db).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&next).
+			Where("version = ?", input.Version).
+			Select(append(slices.Clone(fields), "Version", "UpdatedAt")).
+			Updates(&next)
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if res.RowsAffected == 0 {
+			var count int64
+			if err := tx.Model(&User{}).Where("id = ?", input.ID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return errors.New("user not found")
+			}
+			return errs.ErrVersionConflict
+		}
+
+		return outbox.Write(tx, events...)
+	})
+	if err != nil {
+		return err
 	}
 
+	input.Version = next.Version
+	input.UpdatedAt = next.UpdatedAt
 	return nil
 }
+
+func (u *userRepository) tenantScope(ctx context.Context, tenantID int64) *gorm.DB {
+	return transaction.DB(ctx, u.db).
+		Joins("JOIN memberships ON memberships.user_id = users.id").
+		Where("memberships.organization_id = ?", tenantID)
+}
+
+// Full-text document over the search fields, matches idx_users_search.
+const searchDocument = `to_tsvector('simple', username || ' ' || email || ' ' || display_name)`
+
+// searchRow is a user with the rank Postgres gave it.
+type searchRow struct {
+	User
+	Rank float64
+}
+
+// SearchUsers ranks with full-text search and, when pg_trgm is installed,
+// trigram similarity. Other databases use the in-memory matcher.
+func (u *userRepository) SearchUsers(ctx context.Context, term string, limit int) ([]*SearchResultDTO, error) {
+	if u.db.Dialector.Name() != "postgres" {
+		return nil, errs.ErrSearchUnsupported
+	}
+
+	term = strings.ToLower(strings.TrimSpace(term))
+	args := map[string]any{
+		"term":     term,
+		"prefix":   likePrefix(term),
+		"contains": "%" + likeEscape(term) + "%",
+		"limit":    limit,
+	}
+
+	scores := []string{
+		`CASE WHEN LOWER(username) = @term OR LOWER(email) = @term OR LOWER(display_name) = @term THEN 1.0
+			WHEN LOWER(username) LIKE @prefix ESCAPE '\' OR LOWER(email) LIKE @prefix ESCAPE '\'
+				OR LOWER(display_name) LIKE @prefix ESCAPE '\' THEN 0.9
+			WHEN LOWER(username) LIKE @contains ESCAPE '\' OR LOWER(email) LIKE @contains ESCAPE '\'
+				OR LOWER(display_name) LIKE @contains ESCAPE '\' THEN 0.75
+			ELSE 0 END`,
+		`ts_rank(` + searchDocument + `, plainto_tsquery('simple', @term))`,
+	}
+	conditions := []string{
+		`LOWER(username) LIKE @contains ESCAPE '\'`,
+		`LOWER(email) LIKE @contains ESCAPE '\'`,
+		`LOWER(display_name) LIKE @contains ESCAPE '\'`,
+		searchDocument + ` @@ plainto_tsquery('simple', @term)`,
+	}
+
+	if u.hasTrigram(ctx) {
+		scores = append(scores,
+			"similarity(LOWER(username), @term)", "similarity(LOWER(email), @term)", "similarity(LOWER(display_name), @term)")
+		conditions = append(conditions, "LOWER(username) % @term", "LOWER(email) % @term", "LOWER(display_name) % @term")
+	}
+
+	query := "SELECT users.*, GREATEST(" + strings.Join(scores, ", ") + ") AS rank FROM users" +
+		" WHERE " + strings.Join(conditions, " OR ") +
+		" ORDER BY rank DESC, id LIMIT @limit"
+
+	var rows []*searchRow
+	if err := transaction.DB(ctx, u.db).Raw(query, args).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	results := make([]*SearchResultDTO, 0, len(rows))
+	for _, row := range rows {
+		user := row.User
+		_, matches := matchUser(&user, term)
+
+		results = append(results, &SearchResultDTO{
+			User:    &user,
+			Score:   row.Rank,
+			Matches: matches,
+		})
+	}
+	return results, nil
+}
+
+// hasTrigram reports whether the pg_trgm extension is installed, migration
+// 0004 installs it where the database role is allowed to.
+func (u *userRepository) hasTrigram(ctx context.Context) bool {
+	u.trigramOnce.Do(func() {
+		err := u.db.WithContext(ctx).
+			Raw("SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm')").
+			Scan(&u.trigram).Error
+		if err != nil {
+			u.trigram = false
+		}
+	})
+	return u.trigram
+}
@@ -0,0 +1,252 @@
+package user
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/codepnw/go-authen-system/internal/modules/outbox"
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+	"gorm.io/gorm"
+)
+
+// TenantMembers lists the IDs of the users in an organization. The memory
+// repository has no memberships table to join.
+type TenantMembers func(ctx context.Context, tenantID int64) ([]int64, error)
+
+type memoryUserRepository struct {
+	mu     sync.RWMutex
+	users  map[int64]*User
+	nextID int64
+
+	members TenantMembers
+	events  outbox.Writer
+}
+
+// NewMemoryUserRepository keeps users in process memory, for tests and demos.
+// Writes do not take part in transactions. Both arguments may be nil, then
+// tenants are empty and events are dropped.
+func NewMemoryUserRepository(members TenantMembers, events outbox.Writer) UserRepository {
+	return &memoryUserRepository{
+		users:   make(map[int64]*User),
+		members: members,
+		events:  events,
+	}
+}
+
+func (r *memoryUserRepository) Create(ctx context.Context, user *User, events ...*outbox.Event) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkUnique(user); err != nil {
+		return nil, err
+	}
+
+	r.nextID++
+	user.ID = r.nextID
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+	if user.Role == "" {
+		user.Role = "user"
+	}
+	if user.Status == "" {
+		user.Status = StatusActive
+	}
+	if user.Version == 0 {
+		user.Version = 1
+	}
+	r.users[user.ID] = clone(user)
+
+	for _, e := range events {
+		if e.AggregateID == 0 {
+			e.AggregateID = user.ID
+		}
+	}
+	return user, r.write(ctx, events)
+}
+
+func (r *memoryUserRepository) FindByID(ctx context.Context, id int64) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return clone(user), nil
+}
+
+func (r *memoryUserRepository) FindByEmail(ctx context.Context, email string) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if user.Email == email {
+			return clone(user), nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryUserRepository) ListUsers(ctx context.Context, query *UserQuery) ([]*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]*User, 0, len(r.users))
+	for _, user := range r.users {
+		if query.matches(user) {
+			users = append(users, clone(user))
+		}
+	}
+
+	slices.SortFunc(users, func(a, b *User) int {
+		return query.compare(a, query.sortValue(a), query.CursorAfter(b))
+	})
+
+	return users[:min(len(users), query.Limit)], nil
+}
+
+func (r *memoryUserRepository) ListUsersByTenant(ctx context.Context, tenantID int64) ([]*User, error) {
+	ids, err := r.tenantMembers(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]*User, 0, len(ids))
+	for _, id := range ids {
+		if user, ok := r.users[id]; ok {
+			users = append(users, clone(user))
+		}
+	}
+	sortByID(users)
+
+	return users, nil
+}
+
+func (r *memoryUserRepository) FindByIDInTenant(ctx context.Context, tenantID, id int64) (*User, error) {
+	ids, err := r.tenantMembers(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(ids, id) {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	return r.FindByID(ctx, id)
+}
+
+func (r *memoryUserRepository) Update(ctx context.Context, input *User, fields []string, events ...*outbox.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[input.ID]
+	if !ok {
+		return errors.New("user not found")
+	}
+	if stored.Version != input.Version {
+		return errs.ErrVersionConflict
+	}
+
+	next := clone(stored)
+	src, dst := reflect.ValueOf(input).Elem(), reflect.ValueOf(next).Elem()
+	for _, name := range fields {
+		field := dst.FieldByName(name)
+		if !field.IsValid() {
+			return fmt.Errorf("unknown user field %q", name)
+		}
+		field.Set(src.FieldByName(name))
+	}
+
+	now := time.Now()
+	next.Version++
+	next.UpdatedAt = &now
+
+	if err := r.checkUnique(next); err != nil {
+		return err
+	}
+
+	r.users[input.ID] = next
+	input.Version = next.Version
+	input.UpdatedAt = next.UpdatedAt
+	return r.write(ctx, events)
+}
+
+func (r *memoryUserRepository) ListPurgeable(ctx context.Context, before time.Time, limit int) ([]*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var users []*User
+	for _, user := range r.users {
+		if user.Status == StatusPendingDeletion && user.PurgeAfter != nil && !user.PurgeAfter.After(before) {
+			users = append(users, clone(user))
+		}
+	}
+
+	slices.SortFunc(users, func(a, b *User) int {
+		return cmp.Or(a.PurgeAfter.Compare(*b.PurgeAfter), cmp.Compare(a.ID, b.ID))
+	})
+	return users[:min(len(users), limit)], nil
+}
+
+func (r *memoryUserRepository) Delete(ctx context.Context, id int64, events ...*outbox.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[id]; !ok {
+		return errors.New("user not found")
+	}
+
+	delete(r.users, id)
+	return r.write(ctx, events)
+}
+
+// checkUnique mirrors the unique constraints of the users table.
+func (r *memoryUserRepository) checkUnique(input *User) error {
+	for _, user := range r.users {
+		if user.ID == input.ID {
+			continue
+		}
+		if user.Email == input.Email {
+			return errors.New("duplicate key: email")
+		}
+		if user.Username == input.Username {
+			return errors.New("duplicate key: username")
+		}
+	}
+	return nil
+}
+
+func (r *memoryUserRepository) tenantMembers(ctx context.Context, tenantID int64) ([]int64, error) {
+	if r.members == nil {
+		return nil, nil
+	}
+	return r.members(ctx, tenantID)
+}
+
+func (r *memoryUserRepository) write(ctx context.Context, events []*outbox.Event) error {
+	if r.events == nil || len(events) == 0 {
+		return nil
+	}
+	return r.events(ctx, events...)
+}
+
+// clone keeps callers from mutating the stored user.
+func clone(user *User) *User {
+	c := *user
+	return &c
+}
+
+func sortByID(users []*User) {
+	slices.SortFunc(users, func(a, b *User) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+}
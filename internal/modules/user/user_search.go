@@ -0,0 +1,143 @@
+package user
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+)
+
+const defaultSearchLimit = 20
+
+// searchFields are matched by GET /admin/users/search, in display order.
+var searchFields = []string{"username", "email", "display_name"}
+
+// Scores of the in-memory matcher. Fuzzy matches score their trigram
+// similarity scaled below any literal match.
+const (
+	scoreExact     = 1.0
+	scorePrefix    = 0.9
+	scoreSubstring = 0.75
+	scoreFuzzy     = 0.7
+
+	// minSimilarity matches the pg_trgm default threshold
+	minSimilarity = 0.3
+)
+
+// UserSearcher is implemented by repositories that rank matches in the
+// database. They return errs.ErrSearchUnsupported to fall back to the
+// in-memory matcher.
+type UserSearcher interface {
+	SearchUsers(ctx context.Context, term string, limit int) ([]*SearchResultDTO, error)
+}
+
+func (u *User) searchValue(field string) string {
+	switch field {
+	case "username":
+		return u.Username
+	case "email":
+		return u.Email
+	case "display_name":
+		return u.DisplayName
+	}
+	return ""
+}
+
+// matchUser scores every search field of u against term and returns the
+// best score with the fields that matched.
+func matchUser(u *User, term string) (float64, []*FieldMatchDTO) {
+	term = strings.ToLower(strings.TrimSpace(term))
+	tokens := strings.Fields(term)
+
+	var best float64
+	var matches []*FieldMatchDTO
+
+	for _, field := range searchFields {
+		value := u.searchValue(field)
+		if value == "" {
+			continue
+		}
+
+		score, ranges := matchField(strings.ToLower(value), term, tokens)
+		if score == 0 {
+			continue
+		}
+
+		best = max(best, score)
+		matches = append(matches, &FieldMatchDTO{
+			Field:  field,
+			Value:  value,
+			Score:  score,
+			Ranges: ranges,
+		})
+	}
+
+	return best, matches
+}
+
+func matchField(value, term string, tokens []string) (float64, [][2]int) {
+	var score float64
+
+	switch {
+	case value == term:
+		score = scoreExact
+	case strings.HasPrefix(value, term):
+		score = scorePrefix
+	case strings.Contains(value, term):
+		score = scoreSubstring
+	default:
+		if sim := similarity(value, term); sim >= minSimilarity {
+			score = scoreFuzzy * sim
+		}
+	}
+
+	// Highlight every token found literally, even in a fuzzy match
+	var ranges [][2]int
+	for _, token := range tokens {
+		for from := 0; from < len(value); {
+			i := strings.Index(value[from:], token)
+			if i < 0 {
+				break
+			}
+			ranges = append(ranges, [2]int{from + i, from + i + len(token)})
+			from += i + len(token)
+		}
+	}
+	if score == 0 && len(ranges) > 0 {
+		score = scoreSubstring / 2
+	}
+
+	slices.SortFunc(ranges, func(a, b [2]int) int { return cmp.Compare(a[0], b[0]) })
+	return score, ranges
+}
+
+// similarity is the trigram similarity of pg_trgm: shared trigrams over all
+// distinct trigrams of both words, each padded with blanks.
+func similarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for t := range ta {
+		if _, ok := tb[t]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(ta)+len(tb)-shared)
+}
+
+func trigrams(s string) map[string]struct{} {
+	set := make(map[string]struct{})
+
+	for _, word := range strings.FieldsFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r > 127)
+	}) {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = struct{}{}
+		}
+	}
+	return set
+}
@@ -1,28 +1,83 @@
 package user
 
 import (
+	"cmp"
 	"context"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/codepnw/go-authen-system/config"
+	"github.com/codepnw/go-authen-system/internal/modules/audit"
+	"github.com/codepnw/go-authen-system/internal/modules/outbox"
+	"github.com/codepnw/go-authen-system/internal/modules/webhook"
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
 	"github.com/codepnw/go-authen-system/internal/utils/security"
+	"github.com/codepnw/go-authen-system/internal/utils/transaction"
 )
 
 type UserUsecase interface {
 	CreateUser(ctx context.Context, req *CreateUserRequest) (*User, error)
+	ProvisionUser(ctx context.Context, req *ProvisionUserRequest) (*User, error)
 	GetProfile(ctx context.Context, id int64) (*User, error)
-	GetUsers(ctx context.Context) ([]*User, error)
+	GetUsers(ctx context.Context, req *ListUsersRequest) (*ListUsersResponseDTO, error)
+	SearchUsers(ctx context.Context, req *SearchUsersRequest) ([]*SearchResultDTO, error)
+	GetTenantUsers(ctx context.Context, tenantID int64) ([]*User, error)
+	GetTenantUser(ctx context.Context, tenantID, id int64) (*User, error)
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
-	UpdateUser(ctx context.Context, id int64, req *UpdateUserRequest) error
+	UpdateUser(ctx context.Context, id, version int64, req *UpdateUserRequest) (*User, error)
+	ChangeEmail(ctx context.Context, id int64, email string) (*User, error)
+	GetOwnProfile(ctx context.Context, id int64) (*User, error)
+	SetAvatar(ctx context.Context, id int64, key, url string, variants AvatarVariants) (*User, error)
+	UpdateOwnProfile(ctx context.Context, id, version int64, req *UpdateProfileRequest) (*User, error)
+	OwnerView(ctx context.Context, user *User) (*User, error)
+	ProfileClaims(ctx context.Context, user *User) (map[string]any, error)
+	GetProfileSchema(ctx context.Context) (*ProfileSchema, error)
+	UpdateProfileSchema(ctx context.Context, schema *AttributeSchema) (*ProfileSchema, error)
 	DeleteUser(ctx context.Context, id int64) error
+	RestoreUser(ctx context.Context, id int64) error
+	ListDueForPurge(ctx context.Context, limit int) ([]*User, error)
+	EraseUser(ctx context.Context, id int64) error
+	CheckActive(ctx context.Context, id int64) error
+	SetRole(ctx context.Context, id int64, role string) error
+	SetStatus(ctx context.Context, id int64, status string) error
+	ResetPassword(ctx context.Context, id int64, password string) error
+}
+
+// SessionStore drops the refresh tokens of a user, it is implemented by
+// auth.AuthRepository.
+type SessionStore interface {
+	DeleteRefreshToken(ctx context.Context, userID int64, events ...*outbox.Event) (int64, error)
 }
 
 type userUsecase struct {
-	repo UserRepository
+	tx       transaction.Manager
+	repo     UserRepository
+	schemas  ProfileSchemaRepository
+	sessions SessionStore
+	recorder audit.Recorder
+
+	gracePeriod time.Duration
 }
 
-func NewUserUsecase(repo UserRepository) UserUsecase {
-	return &userUsecase{repo: repo}
+func NewUserUsecase(
+	cfg *config.Config,
+	tx transaction.Manager,
+	repo UserRepository,
+	schemas ProfileSchemaRepository,
+	sessions SessionStore,
+	recorder audit.Recorder,
+) UserUsecase {
+	return &userUsecase{
+		tx:          tx,
+		repo:        repo,
+		schemas:     schemas,
+		sessions:    sessions,
+		recorder:    recorder,
+		gracePeriod: cfg.UserDeletionGracePeriod,
+	}
 }
 
 func (uc *userUsecase) CreateUser(ctx context.Context, req *CreateUserRequest) (*User, error) {
@@ -49,10 +104,18 @@ func (uc *userUsecase) CreateUser(ctx context.Context, req *CreateUserRequest) (
 		Username: req.Username,
 		Email:    req.Email,
 		Password: hashedPassword,
+		Role:     security.RoleUser,
+		Status:   StatusActive,
+	}
+	if req.EmailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
 	}
 
-	// Create User
-	created, err := uc.repo.Create(ctx, user)
+	// Create User, the event payload is encoded after the insert assigns the ID
+	created, err := uc.repo.Create(ctx, user,
+		outbox.NewEvent(outbox.AggregateUser, 0, webhook.EventUserRegistered, map[string]any{"user": user}),
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -60,10 +123,126 @@ func (uc *userUsecase) CreateUser(ctx context.Context, req *CreateUserRequest) (
 	return created, nil
 }
 
+// ProvisionUser creates an account without a password, its owner signs in
+// through an identity provider.
+func (uc *userUsecase) ProvisionUser(ctx context.Context, req *ProvisionUserRequest) (*User, error) {
+	found, err := uc.repo.FindByEmail(ctx, req.Email)
+	if err != nil {
+		return nil, err
+	}
+	if found != nil {
+		return nil, errs.ErrEmailTaken
+	}
+
+	username, err := uc.freeUsername(ctx, req.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	// The provider verified the email
+	now := time.Now()
+	user := &User{
+		Username:        username,
+		Email:           req.Email,
+		EmailVerifiedAt: &now,
+		Role:            security.RoleUser,
+		Status:          StatusActive,
+		DisplayName:     req.DisplayName,
+		AvatarURL:       req.AvatarURL,
+	}
+
+	created, err := uc.repo.Create(ctx, user,
+		outbox.NewEvent(outbox.AggregateUser, 0, webhook.EventUserRegistered, map[string]any{"user": user}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// DeleteUser schedules the account for deletion. It can be restored until
+// the grace period ends, then it is erased.
 func (uc *userUsecase) DeleteUser(ctx context.Context, id int64) error {
-	if err := uc.repo.Delete(ctx, id); err != nil {
+	return uc.SetStatus(ctx, id, StatusPendingDeletion)
+}
+
+// RestoreUser reactivates a suspended, deactivated or pending deletion account.
+func (uc *userUsecase) RestoreUser(ctx context.Context, id int64) error {
+	return uc.SetStatus(ctx, id, StatusActive)
+}
+
+// ListDueForPurge returns accounts pending deletion whose grace period ended.
+func (uc *userUsecase) ListDueForPurge(ctx context.Context, limit int) ([]*User, error) {
+	return uc.repo.ListPurgeable(ctx, time.Now(), limit)
+}
+
+// EraseUser turns the account into a deleted tombstone and deletes its
+// sessions. The row is kept, anonymized, so audit records and outbox events
+// still resolve the ID. Erasing a deleted account does nothing.
+func (uc *userUsecase) EraseUser(ctx context.Context, id int64) error {
+	user, err := uc.repo.FindByID(ctx, id)
+	if err != nil {
 		return err
 	}
+	if user.IsDeleted() {
+		return nil
+	}
+
+	now := time.Now()
+	user.Username = PseudonymUsername(user.ID)
+	user.Email = PseudonymEmail(user.ID)
+	user.EmailVerifiedAt = nil
+	user.Password = ""
+	user.DisplayName = ""
+	user.AvatarURL = ""
+	user.Avatars = nil
+	user.AvatarKey = ""
+	user.Locale = ""
+	user.TimeZone = ""
+	user.Phone = ""
+	user.Attributes = nil
+	user.Status = StatusDeleted
+	user.StatusChangedAt = &now
+	user.PurgeAfter = nil
+
+	err = uc.tx.Do(ctx, func(ctx context.Context) error {
+		// Subscribers know the user by ID, the event carries no personal data
+		deleted := outbox.NewEvent(outbox.AggregateUser, user.ID, webhook.EventUserDeleted, map[string]any{"user_id": user.ID})
+		fields := []string{
+			"Username", "Email", "EmailVerifiedAt", "Password", "DisplayName", "AvatarURL", "Avatars", "AvatarKey", "Locale", "TimeZone", "Phone", "Attributes",
+			"Status", "StatusChangedAt", "PurgeAfter",
+		}
+		if err := uc.repo.Update(ctx, user, fields, deleted); err != nil {
+			return err
+		}
+
+		_, err := uc.sessions.DeleteRefreshToken(ctx, user.ID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	uc.recorder.Record(ctx, &audit.Event{
+		Type:       audit.EventUserDelete,
+		TargetID:   user.ID,
+		TargetType: audit.KindUser,
+		Outcome:    audit.OutcomeSuccess,
+		Metadata:   audit.Metadata{"erased": true},
+	})
+	return nil
+}
+
+// CheckActive returns errs.ErrAccountDisabled unless the account may sign in.
+func (uc *userUsecase) CheckActive(ctx context.Context, id int64) error {
+	user, err := uc.repo.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !user.IsActive() {
+		return errs.ErrAccountDisabled
+	}
 	return nil
 }
 
@@ -75,38 +254,491 @@ func (uc *userUsecase) GetProfile(ctx context.Context, id int64) (*User, error)
 	return user, nil
 }
 
-func (uc *userUsecase) GetUsers(ctx context.Context) ([]*User, error) {
-	users, err := uc.repo.ListUsers(ctx)
+func (uc *userUsecase) GetUsers(ctx context.Context, req *ListUsersRequest) (*ListUsersResponseDTO, error) {
+	query, err := NewUserQuery(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// One extra row tells whether there is a next page
+	page := *query
+	page.Limit++
+
+	users, err := uc.repo.ListUsers(ctx, &page)
 	if err != nil {
 		return nil, err
 	}
-	return users, nil
+
+	res := &ListUsersResponseDTO{
+		Users: users,
+		Limit: query.Limit,
+	}
+
+	if len(users) > query.Limit {
+		res.Users = users[:query.Limit]
+		res.NextCursor = query.CursorAfter(res.Users[query.Limit-1]).Encode()
+	}
+	return res, nil
+}
+
+// SearchUsers ranks users by how well their fields match the term. Backends
+// without search support are scanned and matched in memory.
+func (uc *userUsecase) SearchUsers(ctx context.Context, req *SearchUsersRequest) ([]*SearchResultDTO, error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+
+	if searcher, ok := uc.repo.(UserSearcher); ok {
+		results, err := searcher.SearchUsers(ctx, req.Q, limit)
+		if !errors.Is(err, errs.ErrSearchUnsupported) {
+			return results, err
+		}
+	}
+
+	return uc.searchScan(ctx, req.Q, limit)
+}
+
+func (uc *userUsecase) searchScan(ctx context.Context, term string, limit int) ([]*SearchResultDTO, error) {
+	query, err := NewUserQuery(&ListUsersRequest{Limit: maxListLimit})
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*SearchResultDTO
+
+	for {
+		users, err := uc.repo.ListUsers(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, u := range users {
+			if score, matches := matchUser(u, term); score > 0 {
+				results = append(results, &SearchResultDTO{User: u, Score: score, Matches: matches})
+			}
+		}
+
+		if len(users) < query.Limit {
+			break
+		}
+		query.After = query.CursorAfter(users[len(users)-1])
+	}
+
+	slices.SortStableFunc(results, func(a, b *SearchResultDTO) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	return results[:min(len(results), limit)], nil
+}
+
+func (uc *userUsecase) GetTenantUsers(ctx context.Context, tenantID int64) ([]*User, error) {
+	return uc.repo.ListUsersByTenant(ctx, tenantID)
+}
+
+func (uc *userUsecase) GetTenantUser(ctx context.Context, tenantID, id int64) (*User, error) {
+	return uc.repo.FindByIDInTenant(ctx, tenantID, id)
 }
 
 func (uc *userUsecase) GetUserByEmail(ctx context.Context, email string) (*User, error) {
 	return uc.repo.FindByEmail(ctx, email)
 }
 
-func (uc *userUsecase) UpdateUser(ctx context.Context, id int64, req *UpdateUserRequest) error {
+// UpdateUser applies the fields set in req to the user read at version,
+// errs.ErrVersionConflict means someone else changed the user since. Admins
+// may write every attribute.
+func (uc *userUsecase) UpdateUser(ctx context.Context, id, version int64, req *UpdateUserRequest) (*User, error) {
+	user, err := uc.findVersion(ctx, id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := uc.currentSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, changed, err := applyProfile(user, &req.UpdateProfileRequest, schema, accessAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Username != nil && *req.Username != user.Username {
+		user.Username = *req.Username
+		changed = append(changed, "username")
+		fields = append(fields, "Username")
+	}
+
+	if err = uc.saveProfile(ctx, user, fields, changed); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetOwnProfile returns the user as its owner sees it, without private
+// attributes.
+func (uc *userUsecase) GetOwnProfile(ctx context.Context, id int64) (*User, error) {
+	user, err := uc.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return uc.OwnerView(ctx, user)
+}
+
+// UpdateOwnProfile applies the owner's changes, only user editable
+// attributes may be set.
+func (uc *userUsecase) UpdateOwnProfile(ctx context.Context, id, version int64, req *UpdateProfileRequest) (*User, error) {
+	user, err := uc.findVersion(ctx, id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := uc.currentSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, changed, err := applyProfile(user, req, schema, accessOwner)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = uc.saveProfile(ctx, user, fields, changed); err != nil {
+		return nil, err
+	}
+	return ownerView(user, schema), nil
+}
+
+// SetAvatar points the user at an uploaded avatar. key is the blob key
+// prefix of its files, url the variant shown by default.
+func (uc *userUsecase) SetAvatar(ctx context.Context, id int64, key, url string, variants AvatarVariants) (*User, error) {
+	user, err := uc.findLive(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	user.AvatarURL = url
+	user.Avatars = variants
+	user.AvatarKey = key
+
+	if err = uc.saveProfile(ctx, user, []string{"AvatarURL", "Avatars", "AvatarKey"}, []string{"avatar"}); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// OwnerView returns a copy of user without the attributes it may not read.
+func (uc *userUsecase) OwnerView(ctx context.Context, user *User) (*User, error) {
+	schema, err := uc.currentSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ownerView(user, schema), nil
+}
+
+// ProfileClaims returns the token claims the schema maps profile fields to.
+func (uc *userUsecase) ProfileClaims(ctx context.Context, user *User) (map[string]any, error) {
+	schema, err := uc.currentSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return profileClaims(user, schema), nil
+}
+
+// GetProfileSchema returns the current schema, version zero when no schema
+// was saved yet.
+func (uc *userUsecase) GetProfileSchema(ctx context.Context) (*ProfileSchema, error) {
+	current, err := uc.schemas.Current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		current = &ProfileSchema{Schema: emptySchema()}
+	}
+	return current, nil
+}
+
+// UpdateProfileSchema saves a new schema version. Stored attributes are kept,
+// those no longer in the schema are only visible to admins.
+func (uc *userUsecase) UpdateProfileSchema(ctx context.Context, schema *AttributeSchema) (*ProfileSchema, error) {
+	if err := schema.compile(); err != nil {
+		return nil, err
+	}
+
+	created := &ProfileSchema{Schema: schema}
+	if actor, ok := security.UserFromContext(ctx); ok && actor.Type == security.PrincipalUser {
+		created.CreatedBy = actor.ID
+	}
+
+	if err := uc.schemas.Create(ctx, created); err != nil {
+		return nil, err
+	}
+
+	uc.recorder.Record(ctx, &audit.Event{
+		Type:     audit.EventProfileSchema,
+		Outcome:  audit.OutcomeSuccess,
+		Metadata: audit.Metadata{"version": created.ID, "attributes": len(schema.Properties), "claims": len(schema.Claims)},
+	})
+	return created, nil
+}
+
+// ChangeEmail swaps in a confirmed address. The unique constraint on email
+// still guards against a concurrent swap to the same address.
+func (uc *userUsecase) ChangeEmail(ctx context.Context, id int64, email string) (*User, error) {
+	user, err := uc.findLive(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user.Email == email {
+		return nil, errs.ErrEmailUnchanged
+	}
+
+	taken, err := uc.repo.FindByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if taken != nil {
+		return nil, errs.ErrEmailTaken
+	}
+
+	// The change was confirmed through a link sent to the new address
+	now := time.Now()
+	previousEmail := user.Email
+	user.Email = email
+	user.EmailVerifiedAt = &now
+
+	changed := outbox.NewEvent(outbox.AggregateUser, user.ID, webhook.EventUserEmailChanged, map[string]any{
+		"user":           user,
+		"previous_email": previousEmail,
+	})
+	if err = uc.repo.Update(ctx, user, []string{"Email", "EmailVerifiedAt"}, changed); err != nil {
+		return nil, err
+	}
+
+	uc.recorder.Record(ctx, &audit.Event{
+		Type:       audit.EventUserUpdate,
+		TargetID:   user.ID,
+		TargetType: audit.KindUser,
+		Outcome:    audit.OutcomeSuccess,
+		Metadata:   audit.Metadata{"fields": []string{"email"}, "version": user.Version},
+	})
+	return user, nil
+}
+
+func (uc *userUsecase) SetRole(ctx context.Context, id int64, role string) error {
+	if !security.IsKnownRole(role) {
+		return errs.ErrUnknownRole
+	}
+
+	user, err := uc.findLive(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	previous := user.Role
+	user.Role = role
+
+	if err = uc.repo.Update(ctx, user, []string{"Role"}); err != nil {
+		return err
+	}
+
+	uc.recorder.Record(ctx, &audit.Event{
+		Type:       audit.EventRoleGrant,
+		TargetID:   user.ID,
+		TargetType: audit.KindUser,
+		Outcome:    audit.OutcomeSuccess,
+		Metadata:   audit.Metadata{"role": role, "previous_role": previous},
+	})
+	return nil
+}
+
+// SetStatus moves the account to another state. Leaving the active state
+// revokes every session in the same transaction, deleted accounts are final
+// and only EraseUser deletes.
+func (uc *userUsecase) SetStatus(ctx context.Context, id int64, status string) error {
+	if !IsKnownStatus(status) {
+		return fmt.Errorf("unknown status %q", status)
+	}
+	if status == StatusDeleted {
+		return errs.ErrStatusTransition
+	}
+
 	user, err := uc.repo.FindByID(ctx, id)
 	if err != nil {
 		return err
 	}
+	if user.IsDeleted() {
+		return errs.ErrAccountDeleted
+	}
 
-	if req.Email != nil {
-		user.Email = *req.Email
+	previous := user.Status
+	if previous == status {
+		return nil
 	}
 
-	if req.Username != nil {
-		user.Username = *req.Username
+	now := time.Now()
+	user.Status = status
+	user.StatusChangedAt = &now
+
+	user.PurgeAfter = nil
+	if status == StatusPendingDeletion {
+		purgeAfter := now.Add(uc.gracePeriod)
+		user.PurgeAfter = &purgeAfter
 	}
 
+	var revoked int64
+	err = uc.tx.Do(ctx, func(ctx context.Context) error {
+		changed := outbox.NewEvent(outbox.AggregateUser, user.ID, webhook.EventUserStatusChanged, map[string]any{
+			"user":            user,
+			"previous_status": previous,
+		})
+		if err := uc.repo.Update(ctx, user, []string{"Status", "StatusChangedAt", "PurgeAfter"}, changed); err != nil {
+			return err
+		}
+
+		if user.IsActive() {
+			return nil
+		}
+
+		var err error
+		revoked, err = uc.sessions.DeleteRefreshToken(ctx, user.ID,
+			outbox.NewEvent(outbox.AggregateUser, user.ID, webhook.EventSessionsRevoked, map[string]any{
+				"user_id": user.ID,
+				"reason":  "account_" + status,
+			}),
+		)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	metadata := audit.Metadata{"status": status, "previous_status": previous}
+	if !user.IsActive() {
+		metadata["sessions_revoked"] = revoked
+	}
+	if user.PurgeAfter != nil {
+		metadata["purge_after"] = user.PurgeAfter
+	}
+
+	uc.recorder.Record(ctx, &audit.Event{
+		Type:       audit.EventUserStatus,
+		TargetID:   user.ID,
+		TargetType: audit.KindUser,
+		Outcome:    audit.OutcomeSuccess,
+		Metadata:   metadata,
+	})
+	return nil
+}
+
+func (uc *userUsecase) ResetPassword(ctx context.Context, id int64, password string) error {
+	user, err := uc.findLive(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := security.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	user.Password = hashedPassword
+
+	// The reset link was sent to the email
 	now := time.Now()
-	user.UpdatedAt = &now
+	user.EmailVerifiedAt = &now
 
-	if err = uc.repo.Update(ctx, user); err != nil {
+	if err = uc.repo.Update(ctx, user, []string{"Password", "EmailVerifiedAt"}); err != nil {
 		return err
 	}
 
+	uc.recorder.Record(ctx, &audit.Event{
+		Type:       audit.EventPasswordChange,
+		TargetID:   user.ID,
+		TargetType: audit.KindUser,
+		Outcome:    audit.OutcomeSuccess,
+		Metadata:   audit.Metadata{"via": "reset"},
+	})
 	return nil
 }
+
+// freeUsername returns name, or name with a random suffix when it is taken.
+func (uc *userUsecase) freeUsername(ctx context.Context, name string) (string, error) {
+	if name == "" {
+		name = "user"
+	}
+
+	// The name itself sorts first among the names it prefixes
+	query, err := NewUserQuery(&ListUsersRequest{Username: name, Sort: "username", Limit: 1})
+	if err != nil {
+		return "", err
+	}
+	taken, err := uc.repo.ListUsers(ctx, query)
+	if err != nil {
+		return "", err
+	}
+	if len(taken) == 0 || !strings.EqualFold(taken[0].Username, name) {
+		return name, nil
+	}
+
+	suffix, err := security.RandomToken(3)
+	if err != nil {
+		return "", err
+	}
+	return name + "-" + suffix, nil
+}
+
+// findVersion loads a live user and checks it is still at version.
+func (uc *userUsecase) findVersion(ctx context.Context, id, version int64) (*User, error) {
+	user, err := uc.findLive(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user.Version != version {
+		return nil, errs.ErrVersionConflict
+	}
+	return user, nil
+}
+
+// saveProfile writes the changed fields, nothing when none changed. The
+// audit event names the fields but leaves out their values.
+func (uc *userUsecase) saveProfile(ctx context.Context, user *User, fields, changed []string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	if err := uc.repo.Update(ctx, user, fields); err != nil {
+		return err
+	}
+
+	uc.recorder.Record(ctx, &audit.Event{
+		Type:       audit.EventUserUpdate,
+		TargetID:   user.ID,
+		TargetType: audit.KindUser,
+		Outcome:    audit.OutcomeSuccess,
+		Metadata:   audit.Metadata{"fields": changed, "version": user.Version},
+	})
+	return nil
+}
+
+func (uc *userUsecase) currentSchema(ctx context.Context) (*AttributeSchema, error) {
+	current, err := uc.schemas.Current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		return emptySchema(), nil
+	}
+	return current.Schema, nil
+}
+
+// findLive loads a user that can still be changed, deleted accounts are
+// anonymized tombstones.
+func (uc *userUsecase) findLive(ctx context.Context, id int64) (*User, error) {
+	user, err := uc.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsDeleted() {
+		return nil, errs.ErrAccountDeleted
+	}
+	return user, nil
+}
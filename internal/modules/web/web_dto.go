@@ -0,0 +1,49 @@
+package web
+
+// LoginForm also lists the identity providers users can sign in with.
+type LoginForm struct {
+	Email     string   `form:"email" validate:"required,email"`
+	Password  string   `form:"password" validate:"required"`
+	Next      string   `form:"next"`
+	Providers []string `form:"-"`
+}
+
+type RegisterForm struct {
+	Username        string `form:"username" validate:"required"`
+	Email           string `form:"email" validate:"required,email"`
+	Password        string `form:"password" validate:"required,min=4"`
+	ConfirmPassword string `form:"confirm_password" validate:"required,eqfield=Password"`
+}
+
+type ForgotPasswordForm struct {
+	Email string `form:"email" validate:"required,email"`
+}
+
+type ResetPasswordForm struct {
+	Token           string `form:"token" validate:"required"`
+	Password        string `form:"password" validate:"required,min=4"`
+	ConfirmPassword string `form:"confirm_password" validate:"required,eqfield=Password"`
+}
+
+// TokenForm submits the token of an email link.
+type TokenForm struct {
+	Token string `form:"token" validate:"required"`
+}
+
+// ProfileForm sends every field, an empty one clears it. Version is the
+// version the form was rendered from. The rules are those of
+// user.UpdateProfileRequest.
+type ProfileForm struct {
+	Version     int64  `form:"version" validate:"required"`
+	DisplayName string `form:"display_name" validate:"omitempty,max=100"`
+	Locale      string `form:"locale" validate:"omitempty,bcp47_language_tag"`
+	TimeZone    string `form:"time_zone" validate:"omitempty,timezone"`
+	Phone       string `form:"phone" validate:"omitempty,e164"`
+}
+
+// EmailLink is the data of the email link pages.
+type EmailLink struct {
+	Action string
+	Token  string
+	Cancel bool
+}
@@ -0,0 +1,502 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/codepnw/go-authen-system/config"
+	"github.com/codepnw/go-authen-system/internal/middleware"
+	"github.com/codepnw/go-authen-system/internal/modules/auth"
+	"github.com/codepnw/go-authen-system/internal/modules/emailchange"
+	"github.com/codepnw/go-authen-system/internal/modules/passwordreset"
+	"github.com/codepnw/go-authen-system/internal/modules/user"
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+	"github.com/codepnw/go-authen-system/internal/utils/security"
+	"github.com/codepnw/go-authen-system/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+const formExpired = "The form expired, please submit it again."
+
+// webHandler serves the hosted pages. They run on the browser session of
+// /auth/session and call the same usecases as the JSON API.
+type webHandler struct {
+	cfg          *config.Config
+	pages        *renderer
+	authUsecase  auth.AuthUsecase
+	userUsecase  user.UserUsecase
+	resetUsecase passwordreset.PasswordResetUsecase
+	emailUsecase emailchange.EmailChangeUsecase
+	tokenConfig  *security.TokenConfig
+	validate     *validator.Validate
+}
+
+func NewWebHandler(
+	cfg *config.Config,
+	authUsecase auth.AuthUsecase,
+	userUsecase user.UserUsecase,
+	resetUsecase passwordreset.PasswordResetUsecase,
+	emailUsecase emailchange.EmailChangeUsecase,
+) (*webHandler, error) {
+	pages, err := newRenderer(cfg.WebTemplatesDir, cfg.WebTitle)
+	if err != nil {
+		return nil, err
+	}
+
+	// Messages name the form fields the way the page labels them
+	validate := validator.New()
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := field.Tag.Get("form")
+		if name == "" {
+			name, _, _ = strings.Cut(field.Tag.Get("json"), ",")
+		}
+		return strings.ReplaceAll(name, "_", " ")
+	})
+
+	return &webHandler{
+		cfg:          cfg,
+		pages:        pages,
+		authUsecase:  authUsecase,
+		userUsecase:  userUsecase,
+		resetUsecase: resetUsecase,
+		emailUsecase: emailUsecase,
+		tokenConfig:  security.NewJWTToken(cfg),
+		validate:     validate,
+	}, nil
+}
+
+func (h *webHandler) LoginPage(c *gin.Context) {
+	if _, ok := h.sessionUser(c); ok {
+		c.Redirect(http.StatusSeeOther, safeNext(c.Query("next")))
+		return
+	}
+
+	h.form(c, http.StatusOK, pageLogin, "Sign in", &LoginForm{Next: c.Query("next"), Providers: h.providers()}, "")
+}
+
+func (h *webHandler) Login(c *gin.Context) {
+	form := &LoginForm{Providers: h.providers()}
+	if !h.bind(c, pageLogin, "Sign in", form) {
+		return
+	}
+
+	h.shortLived(c)
+	result, err := h.authUsecase.Login(c, &auth.LoginRequestDTO{
+		Email:    form.Email,
+		Password: form.Password,
+	})
+	form.Password = ""
+	switch {
+	case errors.Is(err, errs.ErrInvalidEmailOrPassword):
+		h.form(c, http.StatusUnauthorized, pageLogin, "Sign in", form, "Invalid email or password.")
+		return
+	case errors.Is(err, errs.ErrAccountDisabled):
+		h.form(c, http.StatusForbidden, pageLogin, "Sign in", form, "This account is disabled.")
+		return
+	case err != nil:
+		h.internalError(c)
+		return
+	}
+
+	if err = h.start(c, result); err != nil {
+		h.internalError(c)
+		return
+	}
+	c.Redirect(http.StatusSeeOther, safeNext(form.Next))
+}
+
+func (h *webHandler) RegisterPage(c *gin.Context) {
+	h.form(c, http.StatusOK, pageRegister, "Create account", &RegisterForm{}, "")
+}
+
+func (h *webHandler) Register(c *gin.Context) {
+	form := new(RegisterForm)
+	if !h.bind(c, pageRegister, "Create account", form) {
+		return
+	}
+
+	h.shortLived(c)
+	result, err := h.authUsecase.Register(c, &user.CreateUserRequest{
+		Username:        form.Username,
+		Email:           form.Email,
+		Password:        form.Password,
+		ConfirmPassword: form.ConfirmPassword,
+	})
+	if err != nil {
+		logger.Error("WEB-001", "register failed", err)
+		form.Password, form.ConfirmPassword = "", ""
+		h.form(c, http.StatusBadRequest, pageRegister, "Create account", form, "The account could not be created, the email may already be in use.")
+		return
+	}
+
+	if err = h.start(c, result); err != nil {
+		h.internalError(c)
+		return
+	}
+	c.Redirect(http.StatusSeeOther, homePath)
+}
+
+func (h *webHandler) ForgotPasswordPage(c *gin.Context) {
+	h.form(c, http.StatusOK, pageForgotPassword, "Forgot password", &ForgotPasswordForm{}, "")
+}
+
+func (h *webHandler) ForgotPassword(c *gin.Context) {
+	form := new(ForgotPasswordForm)
+	if !h.bind(c, pageForgotPassword, "Forgot password", form) {
+		return
+	}
+
+	if err := h.resetUsecase.Request(c, form.Email); err != nil {
+		h.internalError(c)
+		return
+	}
+
+	h.message(c, http.StatusOK, "Check your email", "If the email belongs to an account, a link to reset the password is on its way.")
+}
+
+func (h *webHandler) ResetPasswordPage(c *gin.Context) {
+	h.form(c, http.StatusOK, pageResetPassword, "Reset password", &ResetPasswordForm{Token: c.Query("token")}, "")
+}
+
+func (h *webHandler) ResetPassword(c *gin.Context) {
+	form := new(ResetPasswordForm)
+	if !h.bind(c, pageResetPassword, "Reset password", form) {
+		return
+	}
+
+	err := h.resetUsecase.Reset(c, &passwordreset.ResetPasswordRequest{
+		Token:           form.Token,
+		Password:        form.Password,
+		ConfirmPassword: form.ConfirmPassword,
+	})
+	switch {
+	case errors.Is(err, errs.ErrInvalidResetLink):
+		h.message(c, http.StatusBadRequest, "Link expired", "This reset link is invalid or was already used, request a new one.")
+		return
+	case errors.Is(err, errs.ErrAccountDisabled):
+		h.message(c, http.StatusForbidden, "Account disabled", "This account is disabled.")
+		return
+	case err != nil:
+		h.internalError(c)
+		return
+	}
+
+	// Every session was revoked, this browser's included
+	middleware.ClearSessionCookies(c, h.cfg)
+	h.message(c, http.StatusOK, "Password changed", "Your password was changed, sign in with the new one.")
+}
+
+// EmailLinkPage asks before following an email change link, mail scanners
+// opening the link must not confirm or cancel the change.
+func (h *webHandler) EmailLinkPage(cancel bool) gin.HandlerFunc {
+	data := &EmailLink{Action: "/email/confirm"}
+	title := "Confirm email address"
+	if cancel {
+		data = &EmailLink{Action: "/email/cancel", Cancel: true}
+		title = "Cancel email change"
+	}
+
+	return func(c *gin.Context) {
+		link := *data
+		link.Token = c.Query("token")
+
+		token, err := h.formToken(c)
+		if err != nil {
+			h.internalError(c)
+			return
+		}
+		h.pages.render(c, http.StatusOK, pageVerifyEmail, h.page(c, title, token, &link, ""))
+	}
+}
+
+func (h *webHandler) ConfirmEmail(c *gin.Context) {
+	form := new(TokenForm)
+	if !h.bindLink(c, form) {
+		return
+	}
+
+	u, err := h.emailUsecase.Confirm(c, form.Token)
+	if err != nil {
+		h.emailLinkError(c, err)
+		return
+	}
+
+	h.message(c, http.StatusOK, "Email address confirmed", "Your account email is now "+u.Email+".")
+}
+
+func (h *webHandler) CancelEmail(c *gin.Context) {
+	form := new(TokenForm)
+	if !h.bindLink(c, form) {
+		return
+	}
+
+	if err := h.emailUsecase.Cancel(c, form.Token); err != nil {
+		h.emailLinkError(c, err)
+		return
+	}
+
+	h.message(c, http.StatusOK, "Email change cancelled", "Your account email stays the same. If you did not ask for the change, change your password.")
+}
+
+func (h *webHandler) Account(c *gin.Context) {
+	current, _ := middleware.CurrentUser(c)
+
+	u, err := h.userUsecase.GetOwnProfile(c, current.ID)
+	if err != nil {
+		h.internalError(c)
+		return
+	}
+
+	h.account(c, http.StatusOK, u, nil, "", "")
+}
+
+func (h *webHandler) UpdateAccount(c *gin.Context) {
+	current, _ := middleware.CurrentUser(c)
+
+	form := new(ProfileForm)
+	if err := c.ShouldBind(form); err != nil {
+		h.message(c, http.StatusBadRequest, "Invalid form", "The form could not be read.")
+		return
+	}
+
+	u, err := h.userUsecase.GetOwnProfile(c, current.ID)
+	if err != nil {
+		h.internalError(c)
+		return
+	}
+
+	// Invalid input is shown again as it was typed
+	if err = h.validate.Struct(form); err != nil {
+		h.account(c, http.StatusBadRequest, u, form, "", validationMessage(err))
+		return
+	}
+
+	updated, err := h.userUsecase.UpdateOwnProfile(c, current.ID, form.Version, &user.UpdateProfileRequest{
+		DisplayName: &form.DisplayName,
+		Locale:      &form.Locale,
+		TimeZone:    &form.TimeZone,
+		Phone:       &form.Phone,
+	})
+	switch {
+	case errors.Is(err, errs.ErrVersionConflict):
+		h.account(c, http.StatusConflict, u, nil, "", "Your profile changed in the meantime, review it and save again.")
+	case errors.Is(err, errs.ErrInvalidProfile):
+		h.account(c, http.StatusBadRequest, u, form, "", "The profile is not valid.")
+	case err != nil:
+		h.internalError(c)
+	default:
+		h.account(c, http.StatusOK, updated, nil, "Your profile was saved.", "")
+	}
+}
+
+func (h *webHandler) Sessions(c *gin.Context) {
+	h.sessions(c, http.StatusOK, "", "")
+}
+
+// RevokeSession signs out one device. Revoking the current session is the
+// same as signing out.
+func (h *webHandler) RevokeSession(c *gin.Context) {
+	current, _ := middleware.CurrentUser(c)
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err == nil {
+		err = h.authUsecase.Logout(c, current.ID, id)
+	}
+	if err != nil {
+		h.sessions(c, http.StatusNotFound, "", "The session has already ended.")
+		return
+	}
+
+	if id == current.SessionID {
+		middleware.ClearSessionCookies(c, h.cfg)
+		c.Redirect(http.StatusSeeOther, "/login")
+		return
+	}
+	h.sessions(c, http.StatusOK, "The session was signed out.", "")
+}
+
+// RevokeSessions signs the user out on every device, this one included.
+func (h *webHandler) RevokeSessions(c *gin.Context) {
+	current, _ := middleware.CurrentUser(c)
+
+	if _, err := h.authUsecase.RevokeSessions(c, current.ID, "user"); err != nil {
+		h.internalError(c)
+		return
+	}
+
+	middleware.ClearSessionCookies(c, h.cfg)
+	c.Redirect(http.StatusSeeOther, "/login")
+}
+
+func (h *webHandler) Logout(c *gin.Context) {
+	current, _ := middleware.CurrentUser(c)
+
+	// Having no session left is not worth an error page
+	if err := h.authUsecase.Logout(c, current.ID, current.SessionID); err != nil {
+		logger.Error("WEB-002", "logout failed", err)
+	}
+
+	middleware.ClearSessionCookies(c, h.cfg)
+	c.Redirect(http.StatusSeeOther, "/login")
+}
+
+// ------------- Private -------------
+func (h *webHandler) page(c *gin.Context, title, csrfToken string, data any, notice string) *Page {
+	_, signedIn := middleware.CurrentUser(c)
+	if signedIn && csrfToken == "" {
+		csrfToken, _ = c.Cookie(middleware.CSRFCookie)
+	}
+	return &Page{
+		Title:     title,
+		SignedIn:  signedIn,
+		CSRFField: middleware.CSRFField,
+		CSRFToken: csrfToken,
+		Notice:    notice,
+		Data:      data,
+	}
+}
+
+// providers are the names of the configured identity providers.
+func (h *webHandler) providers() []string {
+	names := make([]string, 0, len(h.cfg.OAuthProviders))
+	for _, p := range h.cfg.OAuthProviders {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// form renders a public form page, a non empty problem is shown above it.
+func (h *webHandler) form(c *gin.Context, status int, name, title string, form any, problem string) {
+	token, err := h.formToken(c)
+	if err != nil {
+		h.internalError(c)
+		return
+	}
+
+	page := h.page(c, title, token, nil, "")
+	page.Form = form
+	page.Error = problem
+	h.pages.render(c, status, name, page)
+}
+
+// bind reads and validates a public form, showing it again on failure.
+func (h *webHandler) bind(c *gin.Context, name, title string, form any) bool {
+	if err := h.verifyForm(c); err != nil {
+		h.form(c, http.StatusForbidden, name, title, form, formExpired)
+		return false
+	}
+
+	if err := c.ShouldBind(form); err != nil {
+		h.form(c, http.StatusBadRequest, name, title, form, "The form could not be read.")
+		return false
+	}
+
+	if err := h.validate.Struct(form); err != nil {
+		h.form(c, http.StatusBadRequest, name, title, form, validationMessage(err))
+		return false
+	}
+	return true
+}
+
+func (h *webHandler) bindLink(c *gin.Context, form *TokenForm) bool {
+	if err := h.verifyForm(c); err != nil {
+		h.message(c, http.StatusForbidden, "Form expired", formExpired)
+		return false
+	}
+
+	if err := c.ShouldBind(form); err != nil || h.validate.Struct(form) != nil {
+		h.message(c, http.StatusBadRequest, "Invalid link", "The link is incomplete, open it again from the email.")
+		return false
+	}
+	return true
+}
+
+func (h *webHandler) emailLinkError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errs.ErrInvalidEmailLink), errors.Is(err, errs.ErrEmailUnchanged):
+		h.message(c, http.StatusBadRequest, "Link expired", "This link is invalid, expired or was already used.")
+	case errors.Is(err, errs.ErrEmailTaken):
+		h.message(c, http.StatusConflict, "Email in use", "Another account uses this email address by now.")
+	case errors.Is(err, errs.ErrAccountDeleted):
+		h.message(c, http.StatusConflict, "Account deleted", "The account of this link is deleted.")
+	default:
+		h.internalError(c)
+	}
+}
+
+// account renders the profile form, filled from u unless form is given.
+func (h *webHandler) account(c *gin.Context, status int, u *user.User, form *ProfileForm, notice, problem string) {
+	if form == nil {
+		form = &ProfileForm{
+			Version:     u.Version,
+			DisplayName: u.DisplayName,
+			Locale:      u.Locale,
+			TimeZone:    u.TimeZone,
+			Phone:       u.Phone,
+		}
+	}
+
+	page := h.page(c, "Account", "", u, notice)
+	page.Form = form
+	page.Error = problem
+	h.pages.render(c, status, pageAccount, page)
+}
+
+func (h *webHandler) sessions(c *gin.Context, status int, notice, problem string) {
+	current, _ := middleware.CurrentUser(c)
+
+	sessions, err := h.authUsecase.ListSessions(c, current.ID, current.SessionID)
+	if err != nil {
+		h.internalError(c)
+		return
+	}
+
+	page := h.page(c, "Sessions", "", sessions, notice)
+	page.Error = problem
+	h.pages.render(c, status, pageSessions, page)
+}
+
+func (h *webHandler) message(c *gin.Context, status int, title, text string) {
+	page := h.page(c, title, "", nil, "")
+	if status >= http.StatusBadRequest {
+		page.Error = text
+	} else {
+		page.Notice = text
+	}
+	h.pages.render(c, status, pageMessage, page)
+}
+
+func (h *webHandler) internalError(c *gin.Context) {
+	h.message(c, http.StatusInternalServerError, "Something went wrong", "Something went wrong on our side, please try again later.")
+}
+
+// validationMessage turns validator errors into a sentence per field.
+func validationMessage(err error) string {
+	var fields validator.ValidationErrors
+	if !errors.As(err, &fields) {
+		return "The form is not valid."
+	}
+
+	messages := make([]string, 0, len(fields))
+	for _, field := range fields {
+		name := field.Field()
+		if name != "" {
+			name = strings.ToUpper(name[:1]) + name[1:]
+		}
+		switch field.Tag() {
+		case "required":
+			messages = append(messages, name+" is required.")
+		case "eqfield":
+			messages = append(messages, name+" does not match.")
+		case "min":
+			messages = append(messages, name+" must be at least "+field.Param()+" characters.")
+		default:
+			messages = append(messages, name+" is not valid.")
+		}
+	}
+	return strings.Join(messages, " ")
+}
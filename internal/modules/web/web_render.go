@@ -0,0 +1,84 @@
+package web
+
+import (
+	"fmt"
+	"html/template"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+)
+
+// Pages are rendered inside layout.html, each file defines the "content"
+// block. A theme replaces the files in web.templates_dir.
+const (
+	pageLogin          = "login"
+	pageRegister       = "register"
+	pageForgotPassword = "forgot_password"
+	pageResetPassword  = "reset_password"
+	pageVerifyEmail    = "verify_email"
+	pageAccount        = "account"
+	pageSessions       = "sessions"
+	pageMessage        = "message"
+)
+
+var pages = []string{
+	pageLogin,
+	pageRegister,
+	pageForgotPassword,
+	pageResetPassword,
+	pageVerifyEmail,
+	pageAccount,
+	pageSessions,
+	pageMessage,
+}
+
+// Page is the data every template receives. Form holds the submitted
+// values of a form shown again, Data what the page displays.
+type Page struct {
+	AppTitle  string
+	Title     string
+	SignedIn  bool
+	CSRFField string
+	CSRFToken string
+	Error     string
+	Notice    string
+	Form      any
+	Data      any
+}
+
+type renderer struct {
+	pages map[string]*template.Template
+	title string
+}
+
+// newRenderer parses every page at startup, a broken theme fails fast.
+func newRenderer(dir, title string) (*renderer, error) {
+	layout, err := template.ParseFiles(filepath.Join(dir, "layout.html"))
+	if err != nil {
+		return nil, fmt.Errorf("parse layout: %w", err)
+	}
+
+	r := &renderer{
+		pages: make(map[string]*template.Template, len(pages)),
+		title: title,
+	}
+	for _, name := range pages {
+		page, err := layout.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if _, err = page.ParseFiles(filepath.Join(dir, name+".html")); err != nil {
+			return nil, fmt.Errorf("parse page %s: %w", name, err)
+		}
+		r.pages[name] = page
+	}
+
+	return r, nil
+}
+
+func (r *renderer) render(c *gin.Context, status int, name string, page *Page) {
+	page.AppTitle = r.title
+	c.Header("Cache-Control", "no-store")
+	c.Render(status, render.HTML{Template: r.pages[name], Name: "layout", Data: page})
+}
@@ -0,0 +1,174 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/codepnw/go-authen-system/internal/middleware"
+	"github.com/codepnw/go-authen-system/internal/modules/auth"
+	"github.com/codepnw/go-authen-system/internal/utils/security"
+	"github.com/gin-gonic/gin"
+)
+
+// RefreshPath renews an expired page session. It lies below
+// middleware.RefreshCookiePath, the only path the refresh cookie reaches.
+const RefreshPath = middleware.RefreshCookiePath + "/page"
+
+// The page signed in users land on
+const homePath = "/account"
+
+// RequireSession lets signed in users through and sends everyone else to
+// the sign in page, through RefreshPath when the session can be renewed.
+// Forms must carry the CSRF token of the session.
+func (h *webHandler) RequireSession(c *gin.Context) {
+	current, ok := h.sessionUser(c)
+	if !ok {
+		next := homePath
+		if c.Request.Method == http.MethodGet {
+			next = c.Request.URL.RequestURI()
+		}
+		c.Redirect(http.StatusSeeOther, RefreshPath+"?next="+url.QueryEscape(next))
+		c.Abort()
+		return
+	}
+
+	if err := h.userUsecase.CheckActive(c, current.ID); err != nil {
+		middleware.ClearSessionCookies(c, h.cfg)
+		c.Redirect(http.StatusSeeOther, "/login")
+		c.Abort()
+		return
+	}
+
+	if err := middleware.VerifyCSRF(c, h.cfg, current.ID); err != nil {
+		h.message(c, http.StatusForbidden, "Form expired", "The form expired, go back and submit it again.")
+		c.Abort()
+		return
+	}
+
+	c.Set(middleware.UserContextKey, current)
+	c.Request = c.Request.WithContext(security.ContextWithUser(c.Request.Context(), current))
+	c.Next()
+}
+
+// Refresh renews the session with the refresh cookie and returns to the
+// page that needed it. It only extends the caller's own session, so unlike
+// the JSON endpoint it works for a plain GET redirect.
+func (h *webHandler) Refresh(c *gin.Context) {
+	next := safeNext(c.Query("next"))
+
+	refreshToken, err := c.Cookie(middleware.RefreshCookie)
+	if err != nil || refreshToken == "" {
+		h.signIn(c, next)
+		return
+	}
+
+	claims, err := h.tokenConfig.VerifyRefreshToken(refreshToken)
+	if err != nil {
+		h.signIn(c, next)
+		return
+	}
+
+	h.shortLived(c)
+	accessToken, newRefreshToken, err := h.authUsecase.RefreshToken(c, refreshToken)
+	if err != nil {
+		h.signIn(c, next)
+		return
+	}
+
+	csrfToken, err := h.csrfToken(c, claims.ID)
+	if err != nil {
+		h.internalError(c)
+		return
+	}
+
+	middleware.SetSessionCookies(c, h.cfg, &middleware.SessionTokens{
+		AccessToken:  accessToken,
+		RefreshToken: newRefreshToken,
+		CSRFToken:    csrfToken,
+	})
+	c.Redirect(http.StatusSeeOther, next)
+}
+
+// start stores the tokens of a new session with a fresh CSRF token.
+func (h *webHandler) start(c *gin.Context, result *auth.AuthResponseDTO) error {
+	csrfToken, err := security.CSRFToken(h.cfg.JWTSecretKey, result.User.ID)
+	if err != nil {
+		return err
+	}
+
+	middleware.SetSessionCookies(c, h.cfg, &middleware.SessionTokens{
+		AccessToken:  result.AccessToken,
+		RefreshToken: result.RefreshToken,
+		CSRFToken:    csrfToken,
+	})
+	return nil
+}
+
+// sessionUser returns the user of a valid session cookie. Impersonation
+// tokens never come from cookies, they are refused all the same.
+func (h *webHandler) sessionUser(c *gin.Context) (*security.TokenUser, bool) {
+	token, err := c.Cookie(middleware.SessionCookie)
+	if err != nil || token == "" {
+		return nil, false
+	}
+
+	current, err := h.tokenConfig.VerifyAccessToken(token)
+	if err != nil || current.Type != security.PrincipalUser || current.IsImpersonated() {
+		return nil, false
+	}
+	return current, true
+}
+
+// formToken returns the CSRF token for a public form. Signed in users keep
+// the token of their session, others get one bound to no subject.
+func (h *webHandler) formToken(c *gin.Context) (string, error) {
+	var subject int64
+	if current, ok := h.sessionUser(c); ok {
+		subject = current.ID
+	}
+	return h.csrfToken(c, subject)
+}
+
+// verifyForm checks the CSRF token of a public form, see formToken.
+func (h *webHandler) verifyForm(c *gin.Context) error {
+	if current, ok := h.sessionUser(c); ok {
+		if middleware.VerifyCSRF(c, h.cfg, current.ID) == nil {
+			return nil
+		}
+	}
+	return middleware.VerifyCSRF(c, h.cfg, 0)
+}
+
+// csrfToken reuses the CSRF cookie while it belongs to subject, so forms in
+// other tabs stay valid, and stores a new token otherwise.
+func (h *webHandler) csrfToken(c *gin.Context, subject int64) (string, error) {
+	if cookie, err := c.Cookie(middleware.CSRFCookie); err == nil && security.VerifyCSRFToken(h.cfg.JWTSecretKey, cookie, subject) {
+		return cookie, nil
+	}
+
+	token, err := security.CSRFToken(h.cfg.JWTSecretKey, subject)
+	if err != nil {
+		return "", err
+	}
+	middleware.SetCSRFCookie(c, h.cfg, token)
+	return token, nil
+}
+
+// shortLived makes the usecase issue session length access tokens.
+func (h *webHandler) shortLived(c *gin.Context) {
+	c.Request = c.Request.WithContext(security.ContextWithAccessTTL(c.Request.Context(), h.cfg.SessionAccessTTL))
+}
+
+func (h *webHandler) signIn(c *gin.Context, next string) {
+	middleware.ClearSessionCookies(c, h.cfg)
+	c.Redirect(http.StatusSeeOther, "/login?next="+url.QueryEscape(next))
+}
+
+// safeNext keeps redirects on this site.
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return homePath
+	}
+	return next
+}
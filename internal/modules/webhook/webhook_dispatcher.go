@@ -0,0 +1,238 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/codepnw/go-authen-system/internal/modules/outbox"
+	"github.com/codepnw/go-authen-system/pkg/logger"
+	"gorm.io/gorm"
+)
+
+const (
+	dueBatch       = 50
+	pollInterval   = time.Second * 5
+	requestTimeout = time.Second * 10
+	responseLimit  = 1024
+
+	// Retry delays double from retryBaseDelay, the last attempt lands about
+	// an hour after the first failure.
+	MaxAttempts    = 8
+	retryBaseDelay = time.Second * 30
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEventID    = "X-Webhook-ID"
+	HeaderEventType  = "X-Webhook-Event"
+	HeaderDeliveryID = "X-Webhook-Delivery"
+	HeaderTimestamp  = "X-Webhook-Timestamp"
+	HeaderSignature  = "X-Webhook-Signature"
+)
+
+// Dispatcher is the outbox sink for webhooks. It turns outbox messages into
+// deliveries and sends due deliveries in the background.
+type Dispatcher struct {
+	repo   WebhookRepository
+	client *http.Client
+}
+
+func NewDispatcher(repo WebhookRepository) *Dispatcher {
+	return &Dispatcher{
+		repo:   repo,
+		client: &http.Client{Timeout: requestTimeout},
+	}
+}
+
+func (d *Dispatcher) Name() string {
+	return "webhook"
+}
+
+// Send creates one delivery per matching subscription. The outbox may hand
+// over the same message again, deliveries already created for it are kept.
+func (d *Dispatcher) Send(ctx context.Context, msg *outbox.Message) error {
+	eventID := "evt_" + strconv.FormatInt(msg.ID, 10)
+
+	exists, err := d.repo.HasDeliveries(ctx, eventID)
+	if err != nil || exists {
+		return err
+	}
+
+	subs, err := d.repo.ListActiveSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(&EventPayload{
+		ID:        eventID,
+		Type:      msg.EventType,
+		CreatedAt: msg.CreatedAt.UTC(),
+		Data:      json.RawMessage(msg.Payload),
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	deliveries := make([]*Delivery, 0, len(subs))
+
+	for _, sub := range subs {
+		if !sub.Matches(msg.EventType) {
+			continue
+		}
+		deliveries = append(deliveries, &Delivery{
+			SubscriptionID: sub.ID,
+			EventID:        eventID,
+			EventType:      msg.EventType,
+			Payload:        string(payload),
+			Status:         DeliveryPending,
+			NextAttemptAt:  &now,
+		})
+	}
+
+	return d.repo.CreateDeliveries(ctx, deliveries)
+}
+
+// Run sends due deliveries until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.deliverDue(ctx)
+		}
+	}
+}
+
+// Sign returns the hex HMAC-SHA256 of "<timestamp>.<body>" under secret.
+// Subscribers recompute it to authenticate the payload.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// -------- Private ----------
+func (d *Dispatcher) deliverDue(ctx context.Context) {
+	deliveries, err := d.repo.ListDueDeliveries(ctx, time.Now(), dueBatch)
+	if err != nil {
+		logger.Error("WEBHOOK-001", "list due deliveries failed", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		d.attempt(ctx, delivery)
+	}
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, delivery *Delivery) {
+	sub, err := d.repo.FindSubscription(ctx, delivery.SubscriptionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		d.finish(ctx, delivery, DeliveryDead, 0, "subscription deleted")
+		return
+	}
+	if err != nil {
+		logger.Error("WEBHOOK-002", "find subscription failed", err)
+		return
+	}
+	if !sub.Active {
+		d.finish(ctx, delivery, DeliveryDead, 0, "subscription disabled")
+		return
+	}
+
+	start := time.Now()
+	statusCode, body, sendErr := d.send(ctx, sub, delivery)
+
+	attempt := &DeliveryAttempt{
+		DeliveryID: delivery.ID,
+		StatusCode: statusCode,
+		Response:   body,
+		DurationMS: time.Since(start).Milliseconds(),
+		CreatedAt:  start,
+	}
+	if sendErr != nil {
+		attempt.Error = sendErr.Error()
+	}
+	if err = d.repo.CreateAttempt(ctx, attempt); err != nil {
+		logger.Error("WEBHOOK-003", "log delivery attempt failed", err)
+	}
+
+	delivery.Attempts++
+
+	if sendErr == nil {
+		d.finish(ctx, delivery, DeliverySucceeded, statusCode, "")
+		return
+	}
+
+	if delivery.Attempts >= MaxAttempts {
+		logger.Error("WEBHOOK-004", "webhook delivery dead-lettered", fmt.Errorf("delivery %d: %w", delivery.ID, sendErr))
+		d.finish(ctx, delivery, DeliveryDead, statusCode, sendErr.Error())
+		return
+	}
+
+	next := time.Now().Add(retryBaseDelay << (delivery.Attempts - 1))
+	delivery.NextAttemptAt = &next
+	d.finish(ctx, delivery, DeliveryRetrying, statusCode, sendErr.Error())
+}
+
+// send POSTs the payload, any non 2xx response counts as a failure.
+func (d *Dispatcher) send(ctx context.Context, sub *Subscription, delivery *Delivery) (int, string, error) {
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEventID, delivery.EventID)
+	req.Header.Set(HeaderEventType, delivery.EventType)
+	req.Header.Set(HeaderDeliveryID, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, "sha256="+Sign(sub.Secret, timestamp, body))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer res.Body.Close()
+
+	snippet, _ := io.ReadAll(io.LimitReader(res.Body, responseLimit))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, string(snippet), fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return res.StatusCode, string(snippet), nil
+}
+
+func (d *Dispatcher) finish(ctx context.Context, delivery *Delivery, status string, statusCode int, lastError string) {
+	now := time.Now()
+
+	delivery.Status = status
+	delivery.LastStatusCode = statusCode
+	delivery.LastError = lastError
+	delivery.UpdatedAt = &now
+	if status != DeliveryRetrying {
+		delivery.NextAttemptAt = nil
+	}
+
+	if err := d.repo.UpdateDelivery(ctx, delivery); err != nil {
+		logger.Error("WEBHOOK-005", "update delivery failed", err)
+	}
+}
@@ -0,0 +1,39 @@
+package webhook
+
+import "time"
+
+type CreateSubscriptionRequest struct {
+	URL         string   `json:"url" validate:"required,url"`
+	Description string   `json:"description"`
+	EventTypes  []string `json:"event_types" validate:"required,min=1,dive,required"`
+}
+
+type UpdateSubscriptionRequest struct {
+	URL         *string  `json:"url" validate:"omitempty,url"`
+	Description *string  `json:"description"`
+	EventTypes  []string `json:"event_types" validate:"omitempty,min=1,dive,required"`
+	Active      *bool    `json:"active"`
+}
+
+// SubscriptionSecretDTO is the only place the signing secret is returned.
+type SubscriptionSecretDTO struct {
+	Subscription *Subscription `json:"subscription"`
+	Secret       string        `json:"secret"`
+}
+
+type ListDeliveriesRequest struct {
+	Status string `form:"status" validate:"omitempty,oneof=pending succeeded retrying dead"`
+}
+
+type DeliveryDetailDTO struct {
+	Delivery *Delivery          `json:"delivery"`
+	Attempts []*DeliveryAttempt `json:"attempts"`
+}
+
+// EventPayload is the JSON body POSTed to subscribers.
+type EventPayload struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
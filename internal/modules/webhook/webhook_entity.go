@@ -0,0 +1,117 @@
+package webhook
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+)
+
+// Identity lifecycle events subscribers can listen to
+const (
+	EventUserRegistered    = "user.registered"
+	EventUserEmailChanged  = "user.email_changed"
+	EventUserStatusChanged = "user.status_changed"
+	EventUserDeleted       = "user.deleted"
+	EventSessionsRevoked   = "user.sessions_revoked"
+)
+
+var EventTypes = []string{
+	EventUserRegistered,
+	EventUserEmailChanged,
+	EventUserStatusChanged,
+	EventUserDeleted,
+	EventSessionsRevoked,
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryRetrying  = "retrying"
+	DeliveryDead      = "dead"
+)
+
+type Subscription struct {
+	ID          int64      `json:"id" gorm:"primaryKey"`
+	URL         string     `json:"url" gorm:"not null"`
+	Description string     `json:"description"`
+	EventTypes  StringList `json:"event_types" gorm:"type:text;not null"`
+	Secret      string     `json:"-" gorm:"not null"`
+	Active      bool       `json:"active" gorm:"not null;default:true"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   *time.Time `json:"updated_at"`
+}
+
+func (s *Subscription) Matches(eventType string) bool {
+	return s.Active && slices.Contains(s.EventTypes, eventType)
+}
+
+// Delivery is one event sent to one subscription, retried until it succeeds
+// or runs out of attempts and goes to the dead-letter state.
+type Delivery struct {
+	ID             int64      `json:"id" gorm:"primaryKey"`
+	SubscriptionID int64      `json:"subscription_id" gorm:"not null;index"`
+	EventID        string     `json:"event_id" gorm:"not null;index"`
+	EventType      string     `json:"event_type" gorm:"not null"`
+	Payload        string     `json:"payload" gorm:"type:text;not null"`
+	Status         string     `json:"status" gorm:"not null;index"`
+	Attempts       int        `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at" gorm:"index"`
+	LastStatusCode int        `json:"last_status_code"`
+	LastError      string     `json:"last_error"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      *time.Time `json:"updated_at"`
+}
+
+func (Delivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// DeliveryAttempt logs a single HTTP call made for a delivery.
+type DeliveryAttempt struct {
+	ID         int64     `json:"id" gorm:"primaryKey"`
+	DeliveryID int64     `json:"delivery_id" gorm:"not null;index"`
+	StatusCode int       `json:"status_code"`
+	Error      string    `json:"error,omitempty"`
+	Response   string    `json:"response,omitempty" gorm:"type:text"`
+	DurationMS int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (DeliveryAttempt) TableName() string {
+	return "webhook_delivery_attempts"
+}
+
+func (Subscription) TableName() string {
+	return "webhook_subscriptions"
+}
+
+// StringList is stored as JSON text so it works on every storage backend.
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	b, err := json.Marshal([]string(l))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (l *StringList) Scan(value any) error {
+	var b []byte
+
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return errors.New("webhook: unsupported string list type")
+	}
+
+	return json.Unmarshal(b, l)
+}
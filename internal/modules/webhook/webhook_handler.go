@@ -0,0 +1,203 @@
+package webhook
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+	"github.com/codepnw/go-authen-system/internal/utils/response"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type webhookHandler struct {
+	validate *validator.Validate
+	uc       WebhookUsecase
+}
+
+func NewWebhookHandler(uc WebhookUsecase) *webhookHandler {
+	return &webhookHandler{
+		validate: validator.New(),
+		uc:       uc,
+	}
+}
+
+func (h *webhookHandler) CreateSubscription(c *gin.Context) {
+	req := new(CreateSubscriptionRequest)
+
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	data, err := h.uc.CreateSubscription(c, req)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response.Created(c, data)
+}
+
+func (h *webhookHandler) ListSubscriptions(c *gin.Context) {
+	subs, err := h.uc.ListSubscriptions(c)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, "", subs)
+}
+
+func (h *webhookHandler) GetSubscription(c *gin.Context) {
+	id, err := getIntParamID(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid id", err)
+		return
+	}
+
+	sub, err := h.uc.GetSubscription(c, id)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, "", sub)
+}
+
+func (h *webhookHandler) UpdateSubscription(c *gin.Context) {
+	id, err := getIntParamID(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid id", err)
+		return
+	}
+
+	req := new(UpdateSubscriptionRequest)
+
+	if err := c.ShouldBindJSON(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	sub, err := h.uc.UpdateSubscription(c, id, req)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response.Success(c, "subscription updated", sub)
+}
+
+func (h *webhookHandler) DeleteSubscription(c *gin.Context) {
+	id, err := getIntParamID(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid id", err)
+		return
+	}
+
+	if err = h.uc.DeleteSubscription(c, id); err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, "subscription deleted", nil)
+}
+
+func (h *webhookHandler) RotateSecret(c *gin.Context) {
+	id, err := getIntParamID(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid id", err)
+		return
+	}
+
+	data, err := h.uc.RotateSecret(c, id)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, "secret rotated", data)
+}
+
+func (h *webhookHandler) ListDeliveries(c *gin.Context) {
+	id, err := getIntParamID(c.Param("id"))
+	if err != nil {
+		response.BadRequest(c, "invalid id", err)
+		return
+	}
+
+	req := new(ListDeliveriesRequest)
+
+	if err := c.ShouldBindQuery(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.BadRequest(c, "", err)
+		return
+	}
+
+	deliveries, err := h.uc.ListDeliveries(c, id, req)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, "", deliveries)
+}
+
+func (h *webhookHandler) GetDelivery(c *gin.Context) {
+	id, err := getIntParamID(c.Param("deliveryID"))
+	if err != nil {
+		response.BadRequest(c, "invalid id", err)
+		return
+	}
+
+	data, err := h.uc.GetDelivery(c, id)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, "", data)
+}
+
+func (h *webhookHandler) Redeliver(c *gin.Context) {
+	id, err := getIntParamID(c.Param("deliveryID"))
+	if err != nil {
+		response.BadRequest(c, "invalid id", err)
+		return
+	}
+
+	delivery, err := h.uc.Redeliver(c, id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response.Success(c, "delivery queued", delivery)
+}
+
+func handleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errs.ErrUnknownWebhookEvent), errors.Is(err, errs.ErrDeliveryInProgress):
+		response.BadRequest(c, "", err)
+	default:
+		response.InternalServerError(c, err)
+	}
+}
+
+func getIntParamID(key string) (int64, error) {
+	return strconv.ParseInt(key, 10, 64)
+}
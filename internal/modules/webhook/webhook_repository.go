@@ -0,0 +1,144 @@
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type WebhookRepository interface {
+	CreateSubscription(ctx context.Context, input *Subscription) error
+	FindSubscription(ctx context.Context, id int64) (*Subscription, error)
+	ListSubscriptions(ctx context.Context) ([]*Subscription, error)
+	ListActiveSubscriptions(ctx context.Context) ([]*Subscription, error)
+	UpdateSubscription(ctx context.Context, input *Subscription) error
+	DeleteSubscription(ctx context.Context, id int64) error
+
+	CreateDeliveries(ctx context.Context, input []*Delivery) error
+	HasDeliveries(ctx context.Context, eventID string) (bool, error)
+	FindDelivery(ctx context.Context, id int64) (*Delivery, error)
+	ListDeliveries(ctx context.Context, subscriptionID int64, status string) ([]*Delivery, error)
+	ListDueDeliveries(ctx context.Context, now time.Time, limit int) ([]*Delivery, error)
+	UpdateDelivery(ctx context.Context, input *Delivery) error
+
+	CreateAttempt(ctx context.Context, input *DeliveryAttempt) error
+	ListAttempts(ctx context.Context, deliveryID int64) ([]*DeliveryAttempt, error)
+}
+
+type webhookRepository struct {
+	db *gorm.DB
+}
+
+func NewWebhookRepository(db *gorm.DB) WebhookRepository {
+	return &webhookRepository{db: db}
+}
+
+func (r *webhookRepository) CreateSubscription(ctx context.Context, input *Subscription) error {
+	return r.db.WithContext(ctx).Create(input).Error
+}
+
+func (r *webhookRepository) FindSubscription(ctx context.Context, id int64) (sub *Subscription, err error) {
+	if err = r.db.WithContext(ctx).First(&sub, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (r *webhookRepository) ListSubscriptions(ctx context.Context) (subs []*Subscription, err error) {
+	if err = r.db.WithContext(ctx).Order("id").Find(&subs).Error; err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+func (r *webhookRepository) ListActiveSubscriptions(ctx context.Context) (subs []*Subscription, err error) {
+	if err = r.db.WithContext(ctx).Where("active = ?", true).Order("id").Find(&subs).Error; err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+func (r *webhookRepository) UpdateSubscription(ctx context.Context, input *Subscription) error {
+	res := r.db.WithContext(ctx).Save(input)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *webhookRepository) DeleteSubscription(ctx context.Context, id int64) error {
+	res := r.db.WithContext(ctx).Delete(&Subscription{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *webhookRepository) CreateDeliveries(ctx context.Context, input []*Delivery) error {
+	if len(input) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Create(&input).Error
+}
+
+func (r *webhookRepository) HasDeliveries(ctx context.Context, eventID string) (bool, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&Delivery{}).Where("event_id = ?", eventID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *webhookRepository) FindDelivery(ctx context.Context, id int64) (delivery *Delivery, err error) {
+	if err = r.db.WithContext(ctx).First(&delivery, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+func (r *webhookRepository) ListDeliveries(ctx context.Context, subscriptionID int64, status string) (deliveries []*Delivery, err error) {
+	tx := r.db.WithContext(ctx).Where("subscription_id = ?", subscriptionID)
+	if status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+
+	if err = tx.Order("id DESC").Find(&deliveries).Error; err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// ListDueDeliveries returns deliveries waiting for their next attempt, oldest first.
+func (r *webhookRepository) ListDueDeliveries(ctx context.Context, now time.Time, limit int) (deliveries []*Delivery, err error) {
+	err = r.db.WithContext(ctx).
+		Where("status IN ? AND next_attempt_at <= ?", []string{DeliveryPending, DeliveryRetrying}, now).
+		Order("next_attempt_at, id").
+		Limit(limit).
+		Find(&deliveries).Error
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (r *webhookRepository) UpdateDelivery(ctx context.Context, input *Delivery) error {
+	return r.db.WithContext(ctx).Save(input).Error
+}
+
+func (r *webhookRepository) CreateAttempt(ctx context.Context, input *DeliveryAttempt) error {
+	return r.db.WithContext(ctx).Create(input).Error
+}
+
+func (r *webhookRepository) ListAttempts(ctx context.Context, deliveryID int64) (attempts []*DeliveryAttempt, err error) {
+	if err = r.db.WithContext(ctx).Where("delivery_id = ?", deliveryID).Order("id").Find(&attempts).Error; err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
@@ -0,0 +1,191 @@
+package webhook
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+	"github.com/codepnw/go-authen-system/internal/utils/security"
+	"github.com/codepnw/go-authen-system/pkg/logger"
+)
+
+const secretSize = 32
+
+type WebhookUsecase interface {
+	CreateSubscription(ctx context.Context, req *CreateSubscriptionRequest) (*SubscriptionSecretDTO, error)
+	ListSubscriptions(ctx context.Context) ([]*Subscription, error)
+	GetSubscription(ctx context.Context, id int64) (*Subscription, error)
+	UpdateSubscription(ctx context.Context, id int64, req *UpdateSubscriptionRequest) (*Subscription, error)
+	DeleteSubscription(ctx context.Context, id int64) error
+	RotateSecret(ctx context.Context, id int64) (*SubscriptionSecretDTO, error)
+
+	ListDeliveries(ctx context.Context, subscriptionID int64, req *ListDeliveriesRequest) ([]*Delivery, error)
+	GetDelivery(ctx context.Context, id int64) (*DeliveryDetailDTO, error)
+	Redeliver(ctx context.Context, id int64) (*Delivery, error)
+}
+
+type webhookUsecase struct {
+	repo WebhookRepository
+}
+
+func NewWebhookUsecase(repo WebhookRepository) WebhookUsecase {
+	return &webhookUsecase{repo: repo}
+}
+
+func (uc *webhookUsecase) CreateSubscription(ctx context.Context, req *CreateSubscriptionRequest) (*SubscriptionSecretDTO, error) {
+	if err := validateEventTypes(req.EventTypes); err != nil {
+		return nil, err
+	}
+
+	secret, err := security.RandomToken(secretSize)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &Subscription{
+		URL:         req.URL,
+		Description: req.Description,
+		EventTypes:  req.EventTypes,
+		Secret:      secret,
+		Active:      true,
+	}
+	if err = uc.repo.CreateSubscription(ctx, sub); err != nil {
+		logger.Error("WEBHOOK-SUB-001", "create subscription failed", err)
+		return nil, err
+	}
+
+	logger.Info("WEBHOOK-SUB-002", "webhook subscription created", sub)
+	return &SubscriptionSecretDTO{Subscription: sub, Secret: secret}, nil
+}
+
+func (uc *webhookUsecase) ListSubscriptions(ctx context.Context) ([]*Subscription, error) {
+	return uc.repo.ListSubscriptions(ctx)
+}
+
+func (uc *webhookUsecase) GetSubscription(ctx context.Context, id int64) (*Subscription, error) {
+	return uc.repo.FindSubscription(ctx, id)
+}
+
+func (uc *webhookUsecase) UpdateSubscription(ctx context.Context, id int64, req *UpdateSubscriptionRequest) (*Subscription, error) {
+	sub, err := uc.repo.FindSubscription(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.URL != nil {
+		sub.URL = *req.URL
+	}
+	if req.Description != nil {
+		sub.Description = *req.Description
+	}
+	if req.EventTypes != nil {
+		if err = validateEventTypes(req.EventTypes); err != nil {
+			return nil, err
+		}
+		sub.EventTypes = req.EventTypes
+	}
+	if req.Active != nil {
+		sub.Active = *req.Active
+	}
+
+	now := time.Now()
+	sub.UpdatedAt = &now
+
+	if err = uc.repo.UpdateSubscription(ctx, sub); err != nil {
+		logger.Error("WEBHOOK-SUB-003", "update subscription failed", err)
+		return nil, err
+	}
+
+	logger.Info("WEBHOOK-SUB-004", "webhook subscription updated", sub)
+	return sub, nil
+}
+
+func (uc *webhookUsecase) DeleteSubscription(ctx context.Context, id int64) error {
+	if err := uc.repo.DeleteSubscription(ctx, id); err != nil {
+		logger.Error("WEBHOOK-SUB-005", "delete subscription failed", err)
+		return err
+	}
+
+	logger.Info("WEBHOOK-SUB-006", "webhook subscription deleted", id)
+	return nil
+}
+
+func (uc *webhookUsecase) RotateSecret(ctx context.Context, id int64) (*SubscriptionSecretDTO, error) {
+	sub, err := uc.repo.FindSubscription(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := security.RandomToken(secretSize)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	sub.Secret = secret
+	sub.UpdatedAt = &now
+
+	if err = uc.repo.UpdateSubscription(ctx, sub); err != nil {
+		logger.Error("WEBHOOK-SUB-007", "rotate subscription secret failed", err)
+		return nil, err
+	}
+
+	logger.Info("WEBHOOK-SUB-008", "webhook subscription secret rotated", sub)
+	return &SubscriptionSecretDTO{Subscription: sub, Secret: secret}, nil
+}
+
+func (uc *webhookUsecase) ListDeliveries(ctx context.Context, subscriptionID int64, req *ListDeliveriesRequest) ([]*Delivery, error) {
+	return uc.repo.ListDeliveries(ctx, subscriptionID, req.Status)
+}
+
+func (uc *webhookUsecase) GetDelivery(ctx context.Context, id int64) (*DeliveryDetailDTO, error) {
+	delivery, err := uc.repo.FindDelivery(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts, err := uc.repo.ListAttempts(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeliveryDetailDTO{Delivery: delivery, Attempts: attempts}, nil
+}
+
+// Redeliver queues a finished delivery again with a fresh retry budget. The
+// dispatcher picks it up on its next poll.
+func (uc *webhookUsecase) Redeliver(ctx context.Context, id int64) (*Delivery, error) {
+	delivery, err := uc.repo.FindDelivery(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if delivery.Status == DeliveryPending || delivery.Status == DeliveryRetrying {
+		return nil, errs.ErrDeliveryInProgress
+	}
+
+	now := time.Now()
+	delivery.Status = DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = &now
+	delivery.UpdatedAt = &now
+
+	if err = uc.repo.UpdateDelivery(ctx, delivery); err != nil {
+		logger.Error("WEBHOOK-REDELIVER-001", "redeliver failed", err)
+		return nil, err
+	}
+
+	logger.Info("WEBHOOK-REDELIVER-002", "delivery queued for redelivery", delivery.ID)
+	return delivery, nil
+}
+
+// ------------- Private -------------
+func validateEventTypes(types []string) error {
+	for _, t := range types {
+		if !slices.Contains(EventTypes, t) {
+			return errs.ErrUnknownWebhookEvent
+		}
+	}
+	return nil
+}
@@ -5,16 +5,36 @@ import (
 
 	"github.com/codepnw/go-authen-system/config"
 	"github.com/codepnw/go-authen-system/internal/middleware"
+	"github.com/codepnw/go-authen-system/internal/modules/audit"
 	"github.com/codepnw/go-authen-system/internal/modules/auth"
+	"github.com/codepnw/go-authen-system/internal/modules/avatar"
+	"github.com/codepnw/go-authen-system/internal/modules/emailchange"
+	"github.com/codepnw/go-authen-system/internal/modules/federation"
+	"github.com/codepnw/go-authen-system/internal/modules/group"
+	"github.com/codepnw/go-authen-system/internal/modules/organization"
+	"github.com/codepnw/go-authen-system/internal/modules/passwordreset"
+	"github.com/codepnw/go-authen-system/internal/modules/privacy"
+	"github.com/codepnw/go-authen-system/internal/modules/serviceaccount"
 	"github.com/codepnw/go-authen-system/internal/modules/user"
+	"github.com/codepnw/go-authen-system/internal/modules/web"
+	"github.com/codepnw/go-authen-system/internal/modules/webhook"
+	"github.com/codepnw/go-authen-system/internal/utils/security"
+	"github.com/codepnw/go-authen-system/internal/utils/transaction"
+	"github.com/codepnw/go-authen-system/pkg/blob"
+	"github.com/codepnw/go-authen-system/pkg/mailer"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
 type setupRoutes struct {
-	router *gin.Engine
-	db     *gorm.DB
-	cfg    *config.Config
+	router   *gin.Engine
+	db       *gorm.DB
+	users    user.UserRepository
+	tokens   auth.AuthRepository
+	cfg      *config.Config
+	mailer   mailer.Mailer
+	blobs    blob.Store
+	recorder audit.Recorder
 }
 
 func (r *setupRoutes) healthCheck() {
@@ -24,35 +44,356 @@ func (r *setupRoutes) healthCheck() {
 }
 
 func (r *setupRoutes) userRoutes() {
-	repo := user.NewUserRepository(r.db)
-	uc := user.NewUserUsecase(repo)
+	uc := r.userUsecase()
 	hdl := user.NewUserHandler(uc)
 
-	user := r.router.Group("/users")
+	// Self service, deactivated and deleted accounts are restored by an admin.
+	// Impersonation tokens may only read, see middleware.AuthMiddleware
+	me := r.router.Group("/users/me",
+		r.authenticate(),
+		middleware.RequirePrincipal(security.PrincipalUser),
+	)
+	me.POST("/deactivate", hdl.DeactivateMe)
+	me.DELETE("", hdl.DeleteMe)
+	me.GET("/profile", hdl.GetMyProfile)
+	me.PATCH("/profile", hdl.UpdateMyProfile)
 
-	user.POST("/", hdl.CreateUser)
-	user.GET("/", hdl.GetUsers)
-	user.GET("/:id", hdl.GetProfile)
-	user.PATCH("/:id", hdl.UpdateUser)
-	user.DELETE("/:id", hdl.DeleteUser)
+	// Admin
+	admin := r.adminGroup(security.PermUsersRead)
+	admin.GET("/users", hdl.GetUsers)
+	admin.GET("/users/:id", hdl.GetProfile)
+	admin.GET("/users/search", hdl.SearchUsers)
+	admin.GET("/profile-schema", hdl.GetProfileSchema)
+
+	write := r.adminGroup(security.PermUsersWrite)
+	write.POST("/users", hdl.CreateUser)
+	write.PATCH("/users/:id", hdl.UpdateUser)
+	write.POST("/users/:id/suspend", hdl.SuspendUser)
+	write.POST("/users/:id/deactivate", hdl.DeactivateUser)
+	write.POST("/users/:id/restore", hdl.RestoreUser)
+	write.DELETE("/users/:id", hdl.DeleteUser)
+	write.PUT("/profile-schema", hdl.UpdateProfileSchema)
 }
 
 func (r *setupRoutes) authRoutes() {
-	userRepo := user.NewUserRepository(r.db)
-	userUsecase := user.NewUserUsecase(userRepo)
-
-	authRepo := auth.NewAuthRepository(r.db)
-	authUsecase := auth.NewAuthUsecase(r.cfg, authRepo, userUsecase)
+	authUsecase := r.authUsecase()
 	authHandler := auth.NewAuthHandler(authUsecase)
+	sessionHandler := auth.NewSessionHandler(r.cfg, authUsecase)
 
 	// Public
 	auth := r.router.Group("/auth")
 	auth.POST("/register", authHandler.Register)
 	auth.POST("/login", authHandler.Login)
+	r.router.POST("/invitations/register", authHandler.RegisterWithInvitation)
 
 	// Private
-	private := auth.Use(middleware.AuthMiddleware(r.cfg))
+	private := auth.Use(r.authenticate())
 	private.GET("/profile", authHandler.Profile)
-	private.POST("/refresh-token", authHandler.RefreshToken)
-	private.GET("/logout", authHandler.Logout)
+
+	// Sessions belong to human users only
+	session := private.Use(
+		middleware.RequirePrincipal(security.PrincipalUser),
+		middleware.DenyImpersonation(),
+	)
+	session.POST("/refresh-token", authHandler.RefreshToken)
+	session.GET("/logout", authHandler.Logout)
+	session.POST("/switch-tenant", authHandler.SwitchTenant)
+	session.GET("/sessions", authHandler.Sessions)
+
+	// Browser sessions, the tokens live in cookies
+	if r.cfg.SessionCookies {
+		cookies := r.router.Group("/auth/session")
+		cookies.POST("/login", sessionHandler.Login)
+		cookies.POST("/refresh", sessionHandler.Refresh)
+
+		signedIn := cookies.Group("",
+			r.authenticate(),
+			middleware.RequirePrincipal(security.PrincipalUser),
+			middleware.DenyImpersonation(),
+		)
+		signedIn.POST("/switch-tenant", sessionHandler.SwitchTenant)
+		signedIn.POST("/logout", sessionHandler.Logout)
+	}
+
+	// Admin
+	admin := r.adminGroup(security.PermUsersImpersonate)
+	admin.POST("/users/:id/impersonate", authHandler.Impersonate)
+}
+
+func (r *setupRoutes) groupRoutes() {
+	userUsecase := r.userUsecase()
+
+	repo := group.NewGroupRepository(r.db)
+	uc := group.NewGroupUsecase(repo, userUsecase, r.recorder)
+	hdl := group.NewGroupHandler(uc)
+
+	admin := r.adminGroup(security.PermGroupsManage)
+
+	groups := admin.Group("/groups")
+	groups.POST("/", hdl.Create)
+	groups.GET("/", hdl.List)
+	groups.GET("/:id", hdl.Get)
+	groups.DELETE("/:id", hdl.Delete)
+	groups.POST("/:id/members", hdl.AddMember)
+	groups.DELETE("/:id/members/users/:userID", hdl.RemoveUser)
+	groups.DELETE("/:id/members/groups/:groupID", hdl.RemoveSubgroup)
+	groups.POST("/:id/roles", hdl.GrantRole)
+	groups.DELETE("/:id/roles/:role", hdl.RevokeRole)
+
+	admin.GET("/users/:id/access", hdl.GetAccess)
+	admin.GET("/users/:id/permissions/:permission/explain", hdl.ExplainPermission)
+}
+
+func (r *setupRoutes) organizationRoutes() {
+	userUsecase := r.userUsecase()
+
+	repo := organization.NewOrganizationRepository(r.db)
+	uc := organization.NewOrganizationUsecase(r.cfg, repo, userUsecase, r.mailer, r.recorder)
+	hdl := organization.NewOrganizationHandler(uc)
+
+	org := r.router.Group("/orgs",
+		r.authenticate(),
+		middleware.RequirePrincipal(security.PrincipalUser),
+	)
+	org.POST("/", hdl.Create)
+	org.GET("/", hdl.ListMine)
+	org.GET("/:id/members", hdl.ListMembers)
+	org.POST("/:id/members", hdl.AddMember)
+	org.GET("/:id/members/:userID", hdl.GetMember)
+	org.PATCH("/:id/members/:userID", hdl.UpdateMember)
+	org.DELETE("/:id/members/:userID", hdl.RemoveMember)
+	org.POST("/:id/invitations", hdl.Invite)
+	org.GET("/:id/invitations", hdl.ListInvitations)
+	org.POST("/:id/invitations/:invitationID/resend", hdl.ResendInvitation)
+	org.DELETE("/:id/invitations/:invitationID", hdl.RevokeInvitation)
+
+	// Invitee, the token proves the email was received
+	invitation := r.router.Group("/invitations")
+	invitation.GET("/", hdl.GetInvitation)
+	invitation.POST("/decline", hdl.DeclineInvitation)
+	invitation.POST("/accept",
+		r.authenticate(),
+		middleware.RequirePrincipal(security.PrincipalUser),
+		hdl.AcceptInvitation,
+	)
+}
+
+func (r *setupRoutes) serviceAccountRoutes() {
+	userUsecase := r.userUsecase()
+
+	repo := serviceaccount.NewServiceAccountRepository(r.db)
+	uc := serviceaccount.NewServiceAccountUsecase(r.cfg, repo, userUsecase, r.recorder)
+	hdl := serviceaccount.NewServiceAccountHandler(uc)
+
+	// Public
+	r.router.POST("/auth/token", hdl.Token)
+
+	// Admin
+	admin := r.adminGroup(security.PermServiceAccountsManage).Group("/service-accounts")
+	admin.POST("/", hdl.Create)
+	admin.GET("/", hdl.List)
+	admin.GET("/:id", hdl.GetByID)
+	admin.POST("/:id/disable", hdl.Disable)
+	admin.POST("/:id/enable", hdl.Enable)
+	admin.POST("/:id/rotate", hdl.RotateCredentials)
+}
+
+func (r *setupRoutes) auditRoutes() {
+	repo := audit.NewAuditRepository(r.db)
+	uc := audit.NewAuditUsecase(r.cfg, repo)
+	hdl := audit.NewAuditHandler(uc)
+
+	admin := r.adminGroup(security.PermAuditRead)
+	admin.GET("/audit", hdl.List)
+	admin.GET("/audit/export", hdl.Export)
+	admin.GET("/audit/verify", hdl.Verify)
+}
+
+func (r *setupRoutes) webhookRoutes() {
+	repo := webhook.NewWebhookRepository(r.db)
+	uc := webhook.NewWebhookUsecase(repo)
+	hdl := webhook.NewWebhookHandler(uc)
+
+	admin := r.adminGroup(security.PermWebhooksManage).Group("/webhooks")
+	admin.POST("/", hdl.CreateSubscription)
+	admin.GET("/", hdl.ListSubscriptions)
+	admin.GET("/:id", hdl.GetSubscription)
+	admin.PATCH("/:id", hdl.UpdateSubscription)
+	admin.DELETE("/:id", hdl.DeleteSubscription)
+	admin.POST("/:id/rotate-secret", hdl.RotateSecret)
+	admin.GET("/:id/deliveries", hdl.ListDeliveries)
+	admin.GET("/deliveries/:deliveryID", hdl.GetDelivery)
+	admin.POST("/deliveries/:deliveryID/redeliver", hdl.Redeliver)
+}
+
+func (r *setupRoutes) emailChangeRoutes() {
+	repo := emailchange.NewEmailChangeRepository(r.db)
+	uc := emailchange.NewEmailChangeUsecase(r.cfg, repo, r.userUsecase(), r.mailer, r.recorder)
+	hdl := emailchange.NewEmailChangeHandler(uc)
+
+	// Public, the links are the proof
+	r.router.POST("/email-change/confirm", hdl.Confirm)
+	r.router.POST("/email-change/cancel", hdl.Cancel)
+
+	me := r.router.Group("/users/me",
+		r.authenticate(),
+		middleware.RequirePrincipal(security.PrincipalUser),
+	)
+	me.POST("/email", hdl.RequestMine)
+	me.GET("/email", hdl.GetMine)
+
+	// Admin
+	r.adminGroup(security.PermUsersWrite).POST("/users/:id/email", hdl.Request)
+}
+
+func (r *setupRoutes) avatarRoutes() {
+	uc := avatar.NewAvatarUsecase(r.cfg, r.blobs, r.userUsecase())
+	hdl := avatar.NewAvatarHandler(uc, r.cfg.AvatarMaxBytes)
+
+	me := r.router.Group("/users/me",
+		r.authenticate(),
+		middleware.RequirePrincipal(security.PrincipalUser),
+		middleware.DenyImpersonation(),
+	)
+	me.PUT("/avatar", hdl.UploadMine)
+
+	// Local files are served here unless blob.public_url points elsewhere
+	if r.cfg.BlobDriver == "local" && r.cfg.BlobPublicURL == "" {
+		r.router.Static("/uploads", r.cfg.BlobLocalDir)
+	}
+}
+
+func (r *setupRoutes) privacyRoutes() {
+	repo := privacy.NewPrivacyRepository(r.db)
+	auditUsecase := audit.NewAuditUsecase(r.cfg, audit.NewAuditRepository(r.db))
+	userUsecase := r.userUsecase()
+	avatars := avatar.NewAvatarUsecase(r.cfg, r.blobs, userUsecase)
+	uc := privacy.NewPrivacyUsecase(repo, userUsecase, r.tokens, avatars, auditUsecase, r.recorder)
+	hdl := privacy.NewPrivacyHandler(uc, r.federationUsecase())
+
+	me := r.router.Group("/users/me",
+		r.authenticate(),
+		middleware.RequirePrincipal(security.PrincipalUser),
+		middleware.DenyImpersonation(),
+	)
+	me.GET("/export", hdl.ExportMe)
+	me.POST("/erasure", hdl.RequestMyErasure)
+	me.GET("/erasure", hdl.GetMyErasure)
+
+	// Admin
+	r.adminGroup(security.PermUsersRead).GET("/users/:id/export", hdl.Export)
+	r.adminGroup(security.PermUsersRead).GET("/erasure-jobs/:id", hdl.GetJob)
+	r.adminGroup(security.PermUsersWrite).POST("/users/:id/erasure", hdl.RequestErasure)
+}
+
+func (r *setupRoutes) passwordResetRoutes() {
+	uc := passwordreset.NewPasswordResetUsecase(r.cfg, r.userUsecase(), r.authUsecase(), r.mailer)
+	hdl := passwordreset.NewPasswordResetHandler(uc)
+
+	// Public, the link is the proof
+	r.router.POST("/auth/password/forgot", hdl.Forgot)
+	r.router.POST("/auth/password/reset", hdl.Reset)
+}
+
+func (r *setupRoutes) federationRoutes() {
+	hdl := federation.NewFederationHandler(r.cfg, r.federationUsecase())
+
+	// Login methods of the caller, linking needs a provider
+	me := r.router.Group("/users/me",
+		r.authenticate(),
+		middleware.RequirePrincipal(security.PrincipalUser),
+	)
+	me.GET("/identities", hdl.ListMine)
+	me.DELETE("/identities/:id", hdl.UnlinkMine)
+
+	if len(r.cfg.OAuthProviders) == 0 {
+		return
+	}
+	me.POST("/identities/:provider", hdl.LinkMine)
+
+	// Public, the provider authenticates the user
+	oauth := r.router.Group(federation.StateCookiePath)
+	oauth.GET("/providers", hdl.Providers)
+	oauth.GET("/:provider/start", hdl.Start)
+	oauth.GET("/:provider/callback", hdl.Callback)
+}
+
+// webRoutes serves the hosted pages. They sign in through the browser
+// session, links in emails lead here.
+func (r *setupRoutes) webRoutes() error {
+	if !r.cfg.WebEnabled {
+		return nil
+	}
+
+	userUsecase := r.userUsecase()
+	authUsecase := r.authUsecase()
+	resetUsecase := passwordreset.NewPasswordResetUsecase(r.cfg, userUsecase, authUsecase, r.mailer)
+	emailUsecase := emailchange.NewEmailChangeUsecase(r.cfg, emailchange.NewEmailChangeRepository(r.db), userUsecase, r.mailer, r.recorder)
+
+	hdl, err := web.NewWebHandler(r.cfg, authUsecase, userUsecase, resetUsecase, emailUsecase)
+	if err != nil {
+		return err
+	}
+
+	if r.cfg.WebStaticDir != "" {
+		r.router.Static("/static", r.cfg.WebStaticDir)
+	}
+
+	// Public
+	r.router.GET("/login", hdl.LoginPage)
+	r.router.POST("/login", hdl.Login)
+	r.router.GET("/register", hdl.RegisterPage)
+	r.router.POST("/register", hdl.Register)
+	r.router.GET("/password/forgot", hdl.ForgotPasswordPage)
+	r.router.POST("/password/forgot", hdl.ForgotPassword)
+	r.router.GET("/password/reset", hdl.ResetPasswordPage)
+	r.router.POST("/password/reset", hdl.ResetPassword)
+	r.router.GET("/email-change/confirm", hdl.EmailLinkPage(false))
+	r.router.GET("/email-change/cancel", hdl.EmailLinkPage(true))
+	r.router.POST("/email/confirm", hdl.ConfirmEmail)
+	r.router.POST("/email/cancel", hdl.CancelEmail)
+	r.router.GET(web.RefreshPath, hdl.Refresh)
+
+	// Signed in
+	account := r.router.Group("", hdl.RequireSession)
+	account.POST("/logout", hdl.Logout)
+	account.GET("/account", hdl.Account)
+	account.POST("/account", hdl.UpdateAccount)
+	account.GET("/account/sessions", hdl.Sessions)
+	account.POST("/account/sessions/revoke", hdl.RevokeSessions)
+	account.POST("/account/sessions/:id/revoke", hdl.RevokeSession)
+
+	return nil
+}
+
+func (r *setupRoutes) federationUsecase() federation.FederationUsecase {
+	return federation.NewFederationUsecase(r.cfg, transaction.NewManager(r.db), federation.NewFederationRepository(r.db), r.userUsecase(), r.authUsecase(), r.mailer, r.recorder)
+}
+
+func (r *setupRoutes) authUsecase() auth.AuthUsecase {
+	userUsecase := r.userUsecase()
+	orgUsecase := organization.NewOrganizationUsecase(r.cfg, organization.NewOrganizationRepository(r.db), userUsecase, r.mailer, r.recorder)
+	groupUsecase := group.NewGroupUsecase(group.NewGroupRepository(r.db), userUsecase, r.recorder)
+
+	return auth.NewAuthUsecase(r.cfg, transaction.NewManager(r.db), r.tokens, userUsecase, orgUsecase, groupUsecase, r.recorder)
+}
+
+func (r *setupRoutes) userUsecase() user.UserUsecase {
+	return user.NewUserUsecase(r.cfg, transaction.NewManager(r.db), r.users, user.NewProfileSchemaRepository(r.db), r.tokens, r.recorder)
+}
+
+// authenticate verifies the access token of a still active account.
+func (r *setupRoutes) authenticate() gin.HandlerFunc {
+	return middleware.AuthMiddleware(r.cfg, r.userUsecase())
+}
+
+// adminGroup serves the admin API to human users only. Service accounts get
+// roles for their own calls, an admin role must not open this API to them.
+func (r *setupRoutes) adminGroup(permission string) *gin.RouterGroup {
+	return r.router.Group("/admin",
+		r.authenticate(),
+		middleware.RequirePrincipal(security.PrincipalUser),
+		middleware.DenyImpersonation(),
+		middleware.RequirePermission(permission),
+	)
 }
@@ -1,19 +1,41 @@
 package server
 
 import (
+	"context"
+	"fmt"
+	"strings"
+
 	"github.com/codepnw/go-authen-system/config"
 	"github.com/codepnw/go-authen-system/internal/db"
 	"github.com/codepnw/go-authen-system/internal/middleware"
+	"github.com/codepnw/go-authen-system/internal/modules/audit"
+	"github.com/codepnw/go-authen-system/internal/modules/avatar"
+	"github.com/codepnw/go-authen-system/internal/modules/keys"
+	"github.com/codepnw/go-authen-system/internal/modules/outbox"
+	"github.com/codepnw/go-authen-system/internal/modules/privacy"
+	"github.com/codepnw/go-authen-system/internal/modules/user"
+	"github.com/codepnw/go-authen-system/internal/modules/webhook"
+	"github.com/codepnw/go-authen-system/internal/storage"
+	"github.com/codepnw/go-authen-system/internal/utils/security"
+	"github.com/codepnw/go-authen-system/internal/utils/transaction"
+	"github.com/codepnw/go-authen-system/pkg/blob"
 	"github.com/codepnw/go-authen-system/pkg/logger"
+	"github.com/codepnw/go-authen-system/pkg/mailer"
 	"github.com/gin-gonic/gin"
 )
 
 func Run(cfg *config.Config) error {
 	// Connect Database
-	db, err := db.NewDatabaseConnection(cfg)
+	store, err := storage.Open(cfg)
 	if err != nil {
 		return err
 	}
+	conn := store.DB
+
+	// Schema must be current, auto_migrate applies pending migrations (development)
+	if err = db.EnsureSchema(context.Background(), conn, storage.AutoMigrate(cfg)); err != nil {
+		return err
+	}
 
 	// Init Logger
 	log, err := logger.Init()
@@ -22,21 +44,136 @@ func Run(cfg *config.Config) error {
 	}
 	defer log.Sync()
 
+	// Init Mailer
+	mail := mailer.NewLogMailer()
+	if cfg.SMTPHost != "" {
+		mail = mailer.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUser, cfg.SMTPPass, cfg.SMTPFrom)
+	}
+
+	// Blob Storage
+	blobs, err := blobStore(cfg)
+	if err != nil {
+		return err
+	}
+
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.Default()
+	// Usecases receive *gin.Context, let it see values on the request context
+	r.ContextWithFallback = true
+
+	// Audit Recorder
+	auditRepo := audit.NewAuditRepository(conn)
+	recorder := audit.NewRecorder(auditRepo)
+
+	// Rotated signing keys, tokens without a kid still verify with the configured keys
+	cfg.JWTKeys, err = keys.NewKeyUsecase(keys.NewKeyRepository(conn), recorder).Load(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if cfg.AuditCheckpointInterval > 0 {
+		go audit.RunCheckpoints(context.Background(), audit.NewAuditUsecase(cfg, auditRepo), cfg.AuditCheckpointInterval)
+	}
+
+	// Erasure jobs, accounts past their deletion grace period are queued too
+	// unless the purge interval is zero
+	if cfg.ErasurePollInterval > 0 {
+		systemCtx := security.ContextWithUser(context.Background(), &security.TokenUser{Type: security.PrincipalSystem})
+		users := user.NewUserUsecase(cfg, transaction.NewManager(conn), store.Users, user.NewProfileSchemaRepository(conn), store.Tokens, recorder)
+		avatars := avatar.NewAvatarUsecase(cfg, blobs, users)
+		privacyUsecase := privacy.NewPrivacyUsecase(privacy.NewPrivacyRepository(conn), users, store.Tokens, avatars, audit.NewAuditUsecase(cfg, auditRepo), recorder)
+		go privacy.RunErasure(systemCtx, privacyUsecase, cfg.ErasurePollInterval, cfg.UserPurgeInterval)
+	}
+
+	// Webhook Deliveries
+	webhooks := webhook.NewDispatcher(webhook.NewWebhookRepository(conn))
+	go webhooks.Run(context.Background())
+
+	// Outbox Dispatcher
+	sinks, err := outboxSinks(cfg, webhooks)
+	if err != nil {
+		return err
+	}
+	go outbox.NewDispatcher(outbox.NewOutboxRepository(conn), cfg.OutboxPollInterval, sinks...).Run(context.Background())
 
 	r.Use(middleware.LoggerMiddleware())
+	r.Use(middleware.RequestInfoMiddleware())
+	r.Use(middleware.ImpersonationAuditMiddleware(recorder))
 	r.LoadHTMLGlob("templates/*.html")
 
 	// Routes Config
 	routes := setupRoutes{
-		router: r,
-		db:     db,
-		cfg:    cfg,
+		router:   r,
+		db:       conn,
+		users:    store.Users,
+		tokens:   store.Tokens,
+		cfg:      cfg,
+		mailer:   mail,
+		blobs:    blobs,
+		recorder: recorder,
 	}
 	routes.healthCheck()
 	routes.userRoutes()
 	routes.authRoutes()
+	routes.organizationRoutes()
+	routes.groupRoutes()
+	routes.serviceAccountRoutes()
+	routes.auditRoutes()
+	routes.webhookRoutes()
+	routes.emailChangeRoutes()
+	routes.avatarRoutes()
+	routes.privacyRoutes()
+	routes.passwordResetRoutes()
+	routes.federationRoutes()
+	if err = routes.webRoutes(); err != nil {
+		return err
+	}
 
 	return r.Run(":" + cfg.AppPort)
 }
+
+// blobStore builds the configured store. Local files are served by the
+// application under /uploads unless blob.public_url points elsewhere.
+func blobStore(cfg *config.Config) (blob.Store, error) {
+	switch cfg.BlobDriver {
+	case "local":
+		publicURL := cfg.BlobPublicURL
+		if publicURL == "" {
+			publicURL = strings.TrimRight(cfg.AppBaseURL, "/") + "/uploads"
+		}
+		return blob.NewLocalStore(cfg.BlobLocalDir, publicURL), nil
+	case "s3":
+		return blob.NewS3Store(blob.S3Config{
+			Endpoint:  cfg.BlobS3Endpoint,
+			Region:    cfg.BlobS3Region,
+			Bucket:    cfg.BlobS3Bucket,
+			AccessKey: cfg.BlobS3AccessKey,
+			SecretKey: cfg.BlobS3SecretKey,
+			PathStyle: cfg.BlobS3PathStyle,
+			PublicURL: cfg.BlobPublicURL,
+		})
+	default:
+		return nil, fmt.Errorf("unknown blob driver %q", cfg.BlobDriver)
+	}
+}
+
+// outboxSinks builds the configured sinks. Broker sinks need a NATS or Kafka
+// client and are wired in code with outbox.NewBrokerSink.
+func outboxSinks(cfg *config.Config, webhooks *webhook.Dispatcher) ([]outbox.Sink, error) {
+	sinks := make([]outbox.Sink, 0, len(cfg.OutboxSinks))
+
+	for _, name := range cfg.OutboxSinks {
+		switch name {
+		case "webhook":
+			sinks = append(sinks, webhooks)
+		case "log":
+			sinks = append(sinks, outbox.NewLogSink())
+		case "memory":
+			sinks = append(sinks, outbox.NewMemorySink())
+		default:
+			return nil, fmt.Errorf("unknown outbox sink %q", name)
+		}
+	}
+
+	return sinks, nil
+}
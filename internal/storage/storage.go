@@ -0,0 +1,69 @@
+// Package storage selects the repository implementations for the configured
+// database driver.
+package storage
+
+import (
+	"context"
+
+	"github.com/codepnw/go-authen-system/config"
+	"github.com/codepnw/go-authen-system/internal/db"
+	"github.com/codepnw/go-authen-system/internal/modules/auth"
+	"github.com/codepnw/go-authen-system/internal/modules/organization"
+	"github.com/codepnw/go-authen-system/internal/modules/outbox"
+	"github.com/codepnw/go-authen-system/internal/modules/user"
+	"gorm.io/gorm"
+)
+
+// Store holds the database and the repositories that have more than one
+// implementation. Every other module is built on DB.
+type Store struct {
+	DB     *gorm.DB
+	Users  user.UserRepository
+	Tokens auth.AuthRepository
+}
+
+func Open(cfg *config.Config) (*Store, error) {
+	conn, err := db.NewDatabaseConnection(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.DBDriver != db.DriverMemory {
+		return &Store{
+			DB:     conn,
+			Users:  user.NewUserRepository(conn),
+			Tokens: auth.NewAuthRepository(conn),
+		}, nil
+	}
+
+	events := outbox.NewWriter(conn)
+
+	return &Store{
+		DB:     conn,
+		Users:  user.NewMemoryUserRepository(tenantMembers(conn), events),
+		Tokens: auth.NewMemoryAuthRepository(events),
+	}, nil
+}
+
+// AutoMigrate reports whether pending migrations are applied at startup. The
+// memory driver starts from an empty database every time.
+func AutoMigrate(cfg *config.Config) bool {
+	return cfg.DBAutoMigrate || cfg.DBDriver == db.DriverMemory
+}
+
+func tenantMembers(conn *gorm.DB) user.TenantMembers {
+	repo := organization.NewOrganizationRepository(conn)
+
+	return func(ctx context.Context, tenantID int64) ([]int64, error) {
+		memberships, err := repo.ListMemberships(ctx, tenantID)
+		if err != nil {
+			return nil, err
+		}
+
+		ids := make([]int64, 0, len(memberships))
+		for _, m := range memberships {
+			ids = append(ids, m.UserID)
+		}
+		return ids, nil
+	}
+}
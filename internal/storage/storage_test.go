@@ -0,0 +1,105 @@
+package storage_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/codepnw/go-authen-system/config"
+	"github.com/codepnw/go-authen-system/internal/db"
+	"github.com/codepnw/go-authen-system/internal/modules/auth"
+	"github.com/codepnw/go-authen-system/internal/modules/user"
+	"github.com/codepnw/go-authen-system/internal/storage"
+	"github.com/codepnw/go-authen-system/internal/storage/storagetest"
+)
+
+func TestMemory(t *testing.T) {
+	testStore(t, func() (*storage.Store, error) {
+		return storage.Open(&config.Config{DBDriver: db.DriverMemory})
+	})
+}
+
+func TestSQLite(t *testing.T) {
+	dir := t.TempDir()
+	n := 0
+
+	testStore(t, func() (*storage.Store, error) {
+		n++
+		return openMigrated(&config.Config{
+			DBDriver: db.DriverSQLite,
+			DBPath:   filepath.Join(dir, fmt.Sprintf("authen-%d.db", n)),
+		})
+	})
+}
+
+// TestPostgres needs a database it may empty, e.g.
+// TEST_DB_HOST=localhost:5432 TEST_DB_USER=postgres TEST_DB_PASS=postgres TEST_DB_NAME=authen_test
+func TestPostgres(t *testing.T) {
+	host := os.Getenv("TEST_DB_HOST")
+	if host == "" {
+		t.Skip("TEST_DB_HOST not set")
+	}
+
+	cfg := &config.Config{
+		DBDriver:  db.DriverPostgres,
+		DBHost:    host,
+		DBUser:    os.Getenv("TEST_DB_USER"),
+		DBPass:    os.Getenv("TEST_DB_PASS"),
+		DBName:    os.Getenv("TEST_DB_NAME"),
+		DBSSLMode: "disable",
+	}
+
+	testStore(t, func() (*storage.Store, error) {
+		s, err := openMigrated(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		err = s.DB.Exec("TRUNCATE users, refresh_tokens, outbox_messages RESTART IDENTITY CASCADE").Error
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	})
+}
+
+// testStore runs the storage contract, open must return an empty store.
+func testStore(t *testing.T, open func() (*storage.Store, error)) {
+	t.Helper()
+
+	err := storagetest.TestUserRepository(func() (user.UserRepository, error) {
+		s, err := open()
+		if err != nil {
+			return nil, err
+		}
+		return s.Users, nil
+	})
+	if err != nil {
+		t.Errorf("users: %v", err)
+	}
+
+	err = storagetest.TestAuthRepository(func() (auth.AuthRepository, error) {
+		s, err := open()
+		if err != nil {
+			return nil, err
+		}
+		return s.Tokens, nil
+	})
+	if err != nil {
+		t.Errorf("tokens: %v", err)
+	}
+}
+
+func openMigrated(cfg *config.Config) (*storage.Store, error) {
+	s, err := storage.Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = db.EnsureSchema(context.Background(), s.DB, true); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
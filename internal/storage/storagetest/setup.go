@@ -0,0 +1,54 @@
+package storagetest
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/codepnw/go-authen-system/config"
+	"github.com/codepnw/go-authen-system/internal/db"
+	"github.com/codepnw/go-authen-system/internal/modules/audit"
+	"github.com/codepnw/go-authen-system/internal/modules/user"
+	"github.com/codepnw/go-authen-system/internal/storage"
+	"github.com/codepnw/go-authen-system/internal/utils/transaction"
+	"github.com/codepnw/go-authen-system/pkg/logger"
+)
+
+// Env is a migrated store and the usecases most modules build on.
+type Env struct {
+	Store    *storage.Store
+	Tx       transaction.Manager
+	Recorder audit.Recorder
+	Users    user.UserUsecase
+}
+
+// Setup prepares an Env for the tests of a module. The memory driver shares
+// its tables between stores, so every test gets its own SQLite file, and
+// the logger writes to ./logs of a temporary working directory.
+func Setup(t *testing.T, cfg *config.Config) *Env {
+	t.Helper()
+
+	t.Chdir(t.TempDir())
+	if _, err := logger.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.DBDriver = db.DriverSQLite
+	cfg.DBPath = filepath.Join(t.TempDir(), "authen.db")
+
+	store, err := storage.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.EnsureSchema(context.Background(), store.DB, true); err != nil {
+		t.Fatal(err)
+	}
+
+	env := &Env{
+		Store:    store,
+		Tx:       transaction.NewManager(store.DB),
+		Recorder: audit.NewRecorder(audit.NewAuditRepository(store.DB)),
+	}
+	env.Users = user.NewUserUsecase(cfg, env.Tx, store.Users, user.NewProfileSchemaRepository(store.DB), store.Tokens, env.Recorder)
+	return env
+}
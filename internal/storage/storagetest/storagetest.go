@@ -0,0 +1,511 @@
+// Package storagetest is the contract every storage backend must satisfy.
+// Like testing/fstest it reports violations as an error, so the same suite
+// runs against the SQL and in-memory repositories. Setup gives module
+// tests a migrated store of their own.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/codepnw/go-authen-system/internal/modules/auth"
+	"github.com/codepnw/go-authen-system/internal/modules/user"
+	"github.com/codepnw/go-authen-system/internal/utils/errs"
+	"gorm.io/gorm"
+)
+
+type contract[R any] struct {
+	name string
+	run  func(ctx context.Context, repo R) error
+}
+
+// TestUserRepository runs every case against a fresh repository from
+// newRepo. Tenant scoped queries depend on memberships and are not covered.
+func TestUserRepository(newRepo func() (user.UserRepository, error)) error {
+	return run(newRepo, userContract)
+}
+
+// TestAuthRepository runs every case against a fresh repository from newRepo.
+func TestAuthRepository(newRepo func() (auth.AuthRepository, error)) error {
+	return run(newRepo, authContract)
+}
+
+var userContract = []contract[user.UserRepository]{
+	{"create assigns an id and defaults", func(ctx context.Context, repo user.UserRepository) error {
+		created, err := repo.Create(ctx, newUser("alice"))
+		if err != nil {
+			return err
+		}
+		if created.ID == 0 {
+			return errors.New("id not assigned")
+		}
+
+		found, err := repo.FindByID(ctx, created.ID)
+		if err != nil {
+			return err
+		}
+		if found.Email != "alice@example.com" || found.Username != "alice" {
+			return fmt.Errorf("found %s <%s>", found.Username, found.Email)
+		}
+		if found.Role != "user" || found.Status != user.StatusActive {
+			return fmt.Errorf("defaults are role %q status %q", found.Role, found.Status)
+		}
+		return nil
+	}},
+
+	{"email and username are unique", func(ctx context.Context, repo user.UserRepository) error {
+		if _, err := repo.Create(ctx, newUser("alice")); err != nil {
+			return err
+		}
+
+		dup := newUser("bob")
+		dup.Email = "alice@example.com"
+		if _, err := repo.Create(ctx, dup); err == nil {
+			return errors.New("duplicate email accepted")
+		}
+
+		dup = newUser("alice")
+		dup.Email = "other@example.com"
+		if _, err := repo.Create(ctx, dup); err == nil {
+			return errors.New("duplicate username accepted")
+		}
+		return nil
+	}},
+
+	{"find by email", func(ctx context.Context, repo user.UserRepository) error {
+		created, err := repo.Create(ctx, newUser("alice"))
+		if err != nil {
+			return err
+		}
+
+		found, err := repo.FindByEmail(ctx, "alice@example.com")
+		if err != nil {
+			return err
+		}
+		if found == nil || found.ID != created.ID {
+			return errors.New("created user not found")
+		}
+
+		missing, err := repo.FindByEmail(ctx, "nobody@example.com")
+		if err != nil || missing != nil {
+			return fmt.Errorf("unknown email returned %v, %v", missing, err)
+		}
+		return nil
+	}},
+
+	{"find by unknown id", func(ctx context.Context, repo user.UserRepository) error {
+		if _, err := repo.FindByID(ctx, 4242); !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("got %v, want gorm.ErrRecordNotFound", err)
+		}
+		return nil
+	}},
+
+	{"list returns every user", func(ctx context.Context, repo user.UserRepository) error {
+		var want []int64
+		for _, name := range []string{"alice", "bob", "carol"} {
+			created, err := repo.Create(ctx, newUser(name))
+			if err != nil {
+				return err
+			}
+			want = append(want, created.ID)
+		}
+
+		users, err := repo.ListUsers(ctx, listAll())
+		if err != nil {
+			return err
+		}
+
+		got := make([]int64, 0, len(users))
+		for _, u := range users {
+			got = append(got, u.ID)
+		}
+		slices.Sort(got)
+
+		if !slices.Equal(got, want) {
+			return fmt.Errorf("listed %v, want %v", got, want)
+		}
+		return nil
+	}},
+
+	{"list pages through a sort with a cursor", func(ctx context.Context, repo user.UserRepository) error {
+		for _, name := range []string{"dave", "alice", "carol", "bob", "erin"} {
+			if _, err := repo.Create(ctx, newUser(name)); err != nil {
+				return err
+			}
+		}
+
+		query, err := user.NewUserQuery(&user.ListUsersRequest{Sort: "-username", Limit: 2})
+		if err != nil {
+			return err
+		}
+
+		var got []string
+		for range 3 {
+			users, err := repo.ListUsers(ctx, query)
+			if err != nil {
+				return err
+			}
+			for _, u := range users {
+				got = append(got, u.Username)
+			}
+			if len(users) == 0 {
+				break
+			}
+			query.After = query.CursorAfter(users[len(users)-1])
+		}
+
+		want := []string{"erin", "dave", "carol", "bob", "alice"}
+		if !slices.Equal(got, want) {
+			return fmt.Errorf("paged %v, want %v", got, want)
+		}
+		return nil
+	}},
+
+	{"list filters by prefix, status and role", func(ctx context.Context, repo user.UserRepository) error {
+		for _, name := range []string{"alice", "alina", "bob", "al_x"} {
+			u := newUser(name)
+			if name == "alina" {
+				u.Role = "admin"
+			}
+			if _, err := repo.Create(ctx, u); err != nil {
+				return err
+			}
+		}
+
+		for _, c := range []struct {
+			req  user.ListUsersRequest
+			want []string
+		}{
+			{user.ListUsersRequest{Username: "AL"}, []string{"alice", "alina", "al_x"}},
+			{user.ListUsersRequest{Email: "al_"}, []string{"al_x"}},
+			{user.ListUsersRequest{Username: "al", Role: "admin"}, []string{"alina"}},
+			{user.ListUsersRequest{Status: user.StatusSuspended}, nil},
+		} {
+			query, err := user.NewUserQuery(&c.req)
+			if err != nil {
+				return err
+			}
+
+			users, err := repo.ListUsers(ctx, query)
+			if err != nil {
+				return err
+			}
+
+			var got []string
+			for _, u := range users {
+				got = append(got, u.Username)
+			}
+			if !slices.Equal(got, c.want) {
+				return fmt.Errorf("%+v listed %v, want %v", c.req, got, c.want)
+			}
+		}
+		return nil
+	}},
+
+	{"update keeps constraints", func(ctx context.Context, repo user.UserRepository) error {
+		alice, err := repo.Create(ctx, newUser("alice"))
+		if err != nil {
+			return err
+		}
+		if _, err = repo.Create(ctx, newUser("bob")); err != nil {
+			return err
+		}
+
+		alice.Username = "alicia"
+		if err = repo.Update(ctx, alice, []string{"Username"}); err != nil {
+			return err
+		}
+
+		found, err := repo.FindByID(ctx, alice.ID)
+		if err != nil {
+			return err
+		}
+		if found.Username != "alicia" {
+			return fmt.Errorf("username is %q after update", found.Username)
+		}
+
+		found.Email = "bob@example.com"
+		if err = repo.Update(ctx, found, []string{"Email"}); err == nil {
+			return errors.New("update to a taken email accepted")
+		}
+		return nil
+	}},
+
+	{"update is partial and versioned", func(ctx context.Context, repo user.UserRepository) error {
+		created, err := repo.Create(ctx, newUser("alice"))
+		if err != nil {
+			return err
+		}
+		if created.Version != 1 {
+			return fmt.Errorf("created at version %d", created.Version)
+		}
+
+		stale, err := repo.FindByID(ctx, created.ID)
+		if err != nil {
+			return err
+		}
+
+		// Only the named fields are written
+		created.Email = "alicia@example.com"
+		created.Username = "ignored"
+		if err = repo.Update(ctx, created, []string{"Email"}); err != nil {
+			return err
+		}
+		if created.Version != 2 {
+			return fmt.Errorf("version is %d after update", created.Version)
+		}
+
+		found, err := repo.FindByID(ctx, created.ID)
+		if err != nil {
+			return err
+		}
+		if found.Email != "alicia@example.com" || found.Username != "alice" || found.Version != 2 {
+			return fmt.Errorf("found %s <%s> at version %d", found.Username, found.Email, found.Version)
+		}
+
+		stale.Role = "admin"
+		if err = repo.Update(ctx, stale, []string{"Role"}); !errors.Is(err, errs.ErrVersionConflict) {
+			return fmt.Errorf("stale update returned %v", err)
+		}
+		return nil
+	}},
+
+	{"list purgeable accounts", func(ctx context.Context, repo user.UserRepository) error {
+		now := time.Now().UTC().Truncate(time.Second)
+
+		for i, name := range []string{"due", "early", "later", "active"} {
+			u, err := repo.Create(ctx, newUser(name))
+			if err != nil {
+				return err
+			}
+
+			purgeAfter := now.Add(time.Duration(i-1) * time.Hour)
+			u.PurgeAfter = &purgeAfter
+			if name != "active" {
+				u.Status = user.StatusPendingDeletion
+			}
+			if err = repo.Update(ctx, u, []string{"Status", "PurgeAfter"}); err != nil {
+				return err
+			}
+		}
+		want := []string{"due", "early"}
+
+		users, err := repo.ListPurgeable(ctx, now, 10)
+		if err != nil {
+			return err
+		}
+
+		var got []string
+		for _, u := range users {
+			got = append(got, u.Username)
+		}
+		if !slices.Equal(got, want) {
+			return fmt.Errorf("purgeable %v, want %v", got, want)
+		}
+
+		if users, err = repo.ListPurgeable(ctx, now, 1); err != nil || len(users) != 1 {
+			return fmt.Errorf("limit 1 returned %d users, %v", len(users), err)
+		}
+		return nil
+	}},
+
+	{"delete", func(ctx context.Context, repo user.UserRepository) error {
+		created, err := repo.Create(ctx, newUser("alice"))
+		if err != nil {
+			return err
+		}
+
+		if err = repo.Delete(ctx, created.ID); err != nil {
+			return err
+		}
+		if _, err = repo.FindByID(ctx, created.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("deleted user found, %v", err)
+		}
+		if err = repo.Delete(ctx, created.ID); err == nil {
+			return errors.New("deleting a missing user succeeded")
+		}
+		return nil
+	}},
+}
+
+var authContract = []contract[auth.AuthRepository]{
+	{"saved token is valid until it expires", func(ctx context.Context, repo auth.AuthRepository) error {
+		if err := repo.SaveRefreshToken(ctx, newToken(1, "live", time.Hour)); err != nil {
+			return err
+		}
+		if err := repo.SaveRefreshToken(ctx, newToken(1, "expired", -time.Hour)); err != nil {
+			return err
+		}
+
+		found, err := repo.FindRefreshToken(ctx, "live")
+		if err != nil {
+			return err
+		}
+		if found == nil || found.UserID != 1 || found.ID == 0 {
+			return fmt.Errorf("live token found as %+v", found)
+		}
+		if live(ctx, repo, "expired") {
+			return errors.New("expired token accepted")
+		}
+		if live(ctx, repo, "unknown") {
+			return errors.New("unknown token accepted")
+		}
+		return nil
+	}},
+
+	{"update replaces the presented token only", func(ctx context.Context, repo auth.AuthRepository) error {
+		for _, token := range []*auth.RefreshToken{
+			newToken(1, "old", time.Hour),
+			newToken(1, "other device", time.Hour),
+		} {
+			if err := repo.SaveRefreshToken(ctx, token); err != nil {
+				return err
+			}
+		}
+		if err := repo.UpdateRefreshToken(ctx, "old", newToken(1, "new", time.Hour)); err != nil {
+			return err
+		}
+
+		if live(ctx, repo, "old") || !live(ctx, repo, "new") {
+			return errors.New("token not replaced")
+		}
+		if !live(ctx, repo, "other device") {
+			return errors.New("other session replaced")
+		}
+
+		// A rotated token can not be rotated again
+		if err := repo.UpdateRefreshToken(ctx, "old", newToken(1, "again", time.Hour)); err == nil {
+			return errors.New("update with a rotated token succeeded")
+		}
+		if err := repo.UpdateRefreshToken(ctx, "new", newToken(2, "other", time.Hour)); err == nil {
+			return errors.New("update of another user's session succeeded")
+		}
+		return nil
+	}},
+
+	{"list returns the sessions of the user", func(ctx context.Context, repo auth.AuthRepository) error {
+		for _, token := range []*auth.RefreshToken{
+			newToken(1, "first", time.Hour),
+			newToken(2, "other", time.Hour),
+			newToken(1, "second", time.Hour),
+		} {
+			if err := repo.SaveRefreshToken(ctx, token); err != nil {
+				return err
+			}
+		}
+
+		tokens, err := repo.ListRefreshTokens(ctx, 1)
+		if err != nil {
+			return err
+		}
+
+		var got []string
+		for _, token := range tokens {
+			got = append(got, token.RefreshToken)
+		}
+		if !slices.Equal(got, []string{"first", "second"}) {
+			return fmt.Errorf("listed %v, want [first second]", got)
+		}
+		return nil
+	}},
+
+	{"delete removes every session of the user", func(ctx context.Context, repo auth.AuthRepository) error {
+		for _, token := range []*auth.RefreshToken{
+			newToken(1, "first", time.Hour),
+			newToken(1, "second", time.Hour),
+			newToken(2, "kept", time.Hour),
+		} {
+			if err := repo.SaveRefreshToken(ctx, token); err != nil {
+				return err
+			}
+		}
+
+		rows, err := repo.DeleteRefreshToken(ctx, 1)
+		if err != nil {
+			return err
+		}
+		if rows != 2 {
+			return fmt.Errorf("deleted %d sessions, want 2", rows)
+		}
+		if live(ctx, repo, "first") || !live(ctx, repo, "kept") {
+			return errors.New("wrong sessions deleted")
+		}
+
+		if rows, err = repo.DeleteRefreshToken(ctx, 1); err != nil || rows != 0 {
+			return fmt.Errorf("second delete returned %d, %v", rows, err)
+		}
+		return nil
+	}},
+
+	{"delete session removes that session only", func(ctx context.Context, repo auth.AuthRepository) error {
+		ended := newToken(1, "ended", time.Hour)
+		for _, token := range []*auth.RefreshToken{
+			ended,
+			newToken(1, "other device", time.Hour),
+		} {
+			if err := repo.SaveRefreshToken(ctx, token); err != nil {
+				return err
+			}
+		}
+
+		// Session IDs are checked against the user
+		rows, err := repo.DeleteSession(ctx, 2, ended.ID)
+		if err != nil || rows != 0 {
+			return fmt.Errorf("delete as another user returned %d, %v", rows, err)
+		}
+
+		if rows, err = repo.DeleteSession(ctx, 1, ended.ID); err != nil || rows != 1 {
+			return fmt.Errorf("delete returned %d, %v", rows, err)
+		}
+		if live(ctx, repo, "ended") || !live(ctx, repo, "other device") {
+			return errors.New("wrong sessions deleted")
+		}
+		return nil
+	}},
+}
+
+func run[R any](newRepo func() (R, error), cases []contract[R]) error {
+	var errs []error
+
+	for _, c := range cases {
+		repo, err := newRepo()
+		if err == nil {
+			err = c.run(context.Background(), repo)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func listAll() *user.UserQuery {
+	query, _ := user.NewUserQuery(&user.ListUsersRequest{Limit: 100})
+	return query
+}
+
+func newUser(name string) *user.User {
+	return &user.User{
+		Username: name,
+		Email:    name + "@example.com",
+		Password: "hashed",
+	}
+}
+
+// live reports whether the token is a session that has not expired.
+func live(ctx context.Context, repo auth.AuthRepository, token string) bool {
+	found, err := repo.FindRefreshToken(ctx, token)
+	return err == nil && found != nil
+}
+
+func newToken(userID int64, token string, ttl time.Duration) *auth.RefreshToken {
+	return &auth.RefreshToken{
+		UserID:       userID,
+		RefreshToken: token,
+		ExpiresAt:    time.Now().Add(ttl),
+	}
+}
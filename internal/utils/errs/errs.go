@@ -3,8 +3,68 @@ package errs
 import "errors"
 
 var (
-	ErrInvalidEmailOrPassword = errors.New("auth: invalid email or password")
-	ErrGenerateToken          = errors.New("auth: generate token failed")
-	ErrInvalidToken           = errors.New("auth: invalid token")
-	ErrSaveToken              = errors.New("auth: save token failed")
+	ErrInvalidEmailOrPassword   = errors.New("auth: invalid email or password")
+	ErrGenerateToken            = errors.New("auth: generate token failed")
+	ErrInvalidToken             = errors.New("auth: invalid token")
+	ErrSaveToken                = errors.New("auth: save token failed")
+	ErrInvalidClientCredentials = errors.New("auth: invalid client credentials")
+	ErrServiceAccountDisabled   = errors.New("auth: service account is disabled")
+	ErrImpersonationNotAllowed  = errors.New("auth: impersonation not allowed")
+	ErrAccountDisabled          = errors.New("auth: account is disabled")
+	ErrInvalidCSRFToken         = errors.New("auth: missing or invalid CSRF token")
+	ErrInvalidResetLink         = errors.New("auth: invalid or expired password reset link")
+)
+
+var (
+	ErrNotOrgMember        = errors.New("organization: not a member")
+	ErrOrgPermissionDenied = errors.New("organization: permission denied")
+	ErrLastOrgOwner        = errors.New("organization: cannot remove the last owner")
+	ErrAlreadyOrgMember    = errors.New("organization: already a member")
+	ErrInvalidInvitation   = errors.New("organization: invalid or expired invitation")
+	ErrInvitationEmail     = errors.New("organization: invitation was sent to another email")
+)
+
+var (
+	ErrAccountDeleted   = errors.New("user: account is deleted")
+	ErrStatusTransition = errors.New("user: status change not allowed")
+	ErrVersionConflict  = errors.New("user: modified since it was read")
+	ErrIfMatchRequired  = errors.New("user: If-Match header is required")
+	ErrEmailTaken       = errors.New("user: email is already in use")
+	ErrEmailUnchanged   = errors.New("user: new email is the current email")
+	ErrInvalidEmailLink = errors.New("user: invalid or expired email change link")
+	ErrInvalidProfile   = errors.New("user: invalid profile")
+	ErrInvalidSchema    = errors.New("user: invalid profile schema")
+	ErrAvatarTooLarge   = errors.New("user: avatar file is too large")
+	ErrAvatarType       = errors.New("user: avatar must be a JPEG, PNG or GIF image")
+	ErrInvalidAvatar    = errors.New("user: avatar is not a readable image")
+)
+
+var (
+	ErrUnknownProvider    = errors.New("federation: unknown identity provider")
+	ErrInvalidOAuthState  = errors.New("federation: invalid or expired sign in attempt")
+	ErrProviderSignIn     = errors.New("federation: identity provider sign in failed")
+	ErrIdentityNotLinked  = errors.New("federation: identity is not linked to an account")
+	ErrIdentityEmailTaken = errors.New("federation: an account with this email exists, sign in to link the identity")
+	ErrIdentityLinked     = errors.New("federation: identity is linked to another account")
+	ErrIdentityNotFound   = errors.New("federation: identity not found")
+	ErrReauthRequired     = errors.New("federation: confirm your password or sign in again first")
+	ErrLastLoginMethod    = errors.New("federation: cannot remove the last way to sign in")
+)
+
+var (
+	ErrGroupCycle  = errors.New("group: membership would create a cycle")
+	ErrUnknownRole = errors.New("group: unknown role")
+)
+
+var (
+	ErrUnknownWebhookEvent = errors.New("webhook: unknown event type")
+	ErrDeliveryInProgress  = errors.New("webhook: delivery is still in progress")
+)
+
+var (
+	ErrInvalidCursor = errors.New("list: invalid cursor")
+	ErrInvalidSort   = errors.New("list: invalid sort field")
+	ErrInvalidFilter = errors.New("list: invalid filter")
+
+	ErrSearchUnsupported = errors.New("search: not supported by the storage backend")
 )
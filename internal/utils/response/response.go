@@ -22,6 +22,34 @@ func Unauthorized(c *gin.Context, err error) {
 	c.JSON(http.StatusUnauthorized, gin.H{"message": "unauthorized", "error": err.Error()})
 }
 
+func Forbidden(c *gin.Context, err error) {
+	c.JSON(http.StatusForbidden, gin.H{"message": "forbidden", "error": err.Error()})
+}
+
+func NotFound(c *gin.Context, err error) {
+	c.JSON(http.StatusNotFound, gin.H{"message": "not found", "error": err.Error()})
+}
+
+func Conflict(c *gin.Context, err error) {
+	c.JSON(http.StatusConflict, gin.H{"message": "conflict", "error": err.Error()})
+}
+
+func PreconditionFailed(c *gin.Context, err error) {
+	c.JSON(http.StatusPreconditionFailed, gin.H{"message": "precondition failed", "error": err.Error()})
+}
+
+func PreconditionRequired(c *gin.Context, err error) {
+	c.JSON(http.StatusPreconditionRequired, gin.H{"message": "precondition required", "error": err.Error()})
+}
+
+func RequestEntityTooLarge(c *gin.Context, err error) {
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{"message": "request entity too large", "error": err.Error()})
+}
+
+func UnsupportedMediaType(c *gin.Context, err error) {
+	c.JSON(http.StatusUnsupportedMediaType, gin.H{"message": "unsupported media type", "error": err.Error()})
+}
+
 func InternalServerError(c *gin.Context, err error) {
 	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 }
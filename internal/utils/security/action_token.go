@@ -0,0 +1,74 @@
+package security
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Purposes of single-use action tokens such as invitation links.
+const (
+	PurposeInvitation        = "invitation"
+	PurposeEmailChange       = "email_change"
+	PurposeEmailChangeCancel = "email_change_cancel"
+	PurposePasswordReset     = "password_reset"
+)
+
+// ActionToken is a signed, expiring link token. Nonce is stored next to the
+// subject so a newer token can invalidate older ones.
+type ActionToken struct {
+	Purpose string
+	Subject int64
+	Nonce   string
+}
+
+func (t *TokenConfig) GenerateActionToken(input *ActionToken, duration time.Duration) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"purpose": input.Purpose,
+		"sub":     input.Subject,
+		"nonce":   input.Nonce,
+		"exp":     time.Now().Add(duration).Unix(),
+	})
+
+	tokenStr, err := token.SignedString([]byte(t.SecretKey))
+	if err != nil {
+		return "", fmt.Errorf("sign token failed: %w", err)
+	}
+
+	return tokenStr, nil
+}
+
+func (t *TokenConfig) VerifyActionToken(tokenString, purpose string) (*ActionToken, error) {
+	key := []byte(t.SecretKey)
+
+	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (any, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unknow signing method: %v", t.Header)
+		}
+		return key, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	if p, _ := claims["purpose"].(string); p != purpose {
+		return nil, errors.New("invalid token purpose")
+	}
+
+	sub, ok := claims["sub"].(float64)
+	if !ok {
+		return nil, errors.New("invalid token subject")
+	}
+
+	action := &ActionToken{Purpose: purpose, Subject: int64(sub)}
+	action.Nonce, _ = claims["nonce"].(string)
+
+	return action, nil
+}
@@ -0,0 +1,36 @@
+package security
+
+import (
+	"context"
+	"time"
+)
+
+type userContextKey struct{}
+
+type accessTTLContextKey struct{}
+
+// ContextWithUser makes the authenticated principal available to code that
+// only sees a context.Context, such as usecases and the audit recorder.
+func ContextWithUser(ctx context.Context, user *TokenUser) context.Context {
+	return context.WithValue(ctx, userContextKey{}, user)
+}
+
+func UserFromContext(ctx context.Context) (*TokenUser, bool) {
+	user, ok := ctx.Value(userContextKey{}).(*TokenUser)
+	return user, ok
+}
+
+// ContextWithAccessTTL asks for access tokens valid for ttl instead of
+// AccessTokenDuration, see AccessTTLFromContext.
+func ContextWithAccessTTL(ctx context.Context, ttl time.Duration) context.Context {
+	return context.WithValue(ctx, accessTTLContextKey{}, ttl)
+}
+
+// AccessTTLFromContext returns the requested access token lifetime,
+// AccessTokenDuration when none was requested.
+func AccessTTLFromContext(ctx context.Context) time.Duration {
+	if ttl, ok := ctx.Value(accessTTLContextKey{}).(time.Duration); ok && ttl > 0 {
+		return ttl
+	}
+	return AccessTokenDuration
+}
@@ -3,80 +3,251 @@ package security
 import (
 	"errors"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/codepnw/go-authen-system/config"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-const RefreshTokenDuration time.Duration = time.Hour * 24 * 7
+const (
+	AccessTokenDuration  time.Duration = time.Hour * 24
+	RefreshTokenDuration time.Duration = time.Hour * 24 * 7
+	ServiceTokenDuration time.Duration = time.Hour
+
+	ImpersonationTokenDuration time.Duration = time.Minute * 15
+)
+
+// ScopeImpersonation marks tokens issued to an admin acting as another user.
+const ScopeImpersonation = "impersonation"
+
+// Signing key purposes, access and refresh tokens never share a key.
+const (
+	KeyPurposeAccess  = "access"
+	KeyPurposeRefresh = "refresh"
+)
 
 type TokenConfig struct {
 	SecretKey  string
 	RefreshKey string
+
+	// Rotated keys, the first key of each purpose signs new tokens and the
+	// rest only verify. Without any, the configured keys above are used.
+	accessKeys  []config.JWTKey
+	refreshKeys []config.JWTKey
 }
 
 type generateTokenParams struct {
-	ID       int64
-	Email    string
-	Role     string
-	Key      string
-	Duration time.Duration
+	ID         int64
+	Email      string
+	Role       string
+	Roles      []string
+	Type       string
+	Scope      string
+	Actor      *TokenActor
+	TenantID   int64
+	TenantRole string
+	SessionID  int64
+	TokenID    string
+	Claims     map[string]any
+	Purpose    string
+	Duration   time.Duration
 }
 
 type TokenUser struct {
 	ID    int64
 	Email string
 	Role  string
+	Roles []string
+	Type  string
+	Scope string
+	Actor *TokenActor
+
+	// Tenant the token is bound to, zero when not tenant scoped
+	TenantID   int64
+	TenantRole string
+
+	// Refresh token session an access token belongs to, zero for tokens
+	// without one, e.g. service and impersonation tokens
+	SessionID int64
+
+	// Profile claims added to access tokens, never read back on verify
+	Claims map[string]any
+}
+
+// TokenActor is the principal really acting behind an impersonation token,
+// carried in the "act" claim (RFC 8693).
+type TokenActor struct {
+	ID    int64  `json:"id"`
+	Email string `json:"email"`
+}
+
+// reservedClaims are set by generateToken or by the JWT spec, profile
+// claims cannot replace them.
+var reservedClaims = []string{
+	"user_id", "email", "role", "roles", "type", "scope", "tenant_id", "tenant_role", "act", "sid", "purpose", "nonce",
+	"iss", "sub", "aud", "exp", "nbf", "iat", "jti",
+}
+
+func IsReservedClaim(name string) bool {
+	return slices.Contains(reservedClaims, name)
+}
+
+func (u *TokenUser) IsImpersonated() bool {
+	return u.Actor != nil
+}
+
+func (u *TokenUser) HasRole(role string) bool {
+	return u.Role == role || slices.Contains(u.Roles, role)
+}
+
+func (u *TokenUser) HasPermission(permission string) bool {
+	return HasPermission(append([]string{u.Role}, u.Roles...), permission)
 }
 
 func NewJWTToken(cfg *config.Config) *TokenConfig {
-	return &TokenConfig{
+	t := &TokenConfig{
 		SecretKey:  cfg.JWTSecretKey,
 		RefreshKey: cfg.JWTRefreshKey,
 	}
+
+	for _, key := range cfg.JWTKeys {
+		switch key.Purpose {
+		case KeyPurposeAccess:
+			t.accessKeys = append(t.accessKeys, key)
+		case KeyPurposeRefresh:
+			t.refreshKeys = append(t.refreshKeys, key)
+		}
+	}
+
+	return t
 }
 
 func (t *TokenConfig) GenerateAccessToken(user *TokenUser) (string, error) {
-	duration := time.Hour * 24
+	return t.GenerateAccessTokenFor(user, AccessTokenDuration)
+}
+
+// GenerateAccessTokenFor issues an access token valid for duration, browser
+// sessions use short lived ones.
+func (t *TokenConfig) GenerateAccessTokenFor(user *TokenUser, duration time.Duration) (string, error) {
+	return t.generateToken(&generateTokenParams{
+		ID:         user.ID,
+		Email:      user.Email,
+		Role:       user.Role,
+		Roles:      user.Roles,
+		Type:       PrincipalUser,
+		TenantID:   user.TenantID,
+		TenantRole: user.TenantRole,
+		SessionID:  user.SessionID,
+		Claims:     user.Claims,
+		Purpose:    KeyPurposeAccess,
+		Duration:   duration,
+	})
+}
+
+// GenerateRefreshToken issues a refresh token with a random ID, so two
+// sessions started in the same second never share a token.
+func (t *TokenConfig) GenerateRefreshToken(user *TokenUser) (string, error) {
+	tokenID, err := RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	return t.generateToken(&generateTokenParams{
+		ID:         user.ID,
+		Email:      user.Email,
+		Role:       user.Role,
+		Roles:      user.Roles,
+		Type:       PrincipalUser,
+		TenantID:   user.TenantID,
+		TenantRole: user.TenantRole,
+		TokenID:    tokenID,
+		Purpose:    KeyPurposeRefresh,
+		Duration:   RefreshTokenDuration,
+	})
+}
 
+// GenerateServiceToken issues a short-lived access token for a service account.
+// Service accounts never receive refresh tokens.
+func (t *TokenConfig) GenerateServiceToken(user *TokenUser) (string, error) {
 	return t.generateToken(&generateTokenParams{
 		ID:       user.ID,
 		Email:    user.Email,
 		Role:     user.Role,
-		Key:      t.SecretKey,
-		Duration: duration,
+		Type:     PrincipalService,
+		Purpose:  KeyPurposeAccess,
+		Duration: ServiceTokenDuration,
 	})
 }
 
-func (t *TokenConfig) GenerateRefreshToken(user *TokenUser) (string, error) {
+// GenerateImpersonationToken issues a short-lived access token for the target
+// user that also names the admin acting on their behalf.
+func (t *TokenConfig) GenerateImpersonationToken(user *TokenUser, actor *TokenActor) (string, error) {
 	return t.generateToken(&generateTokenParams{
 		ID:       user.ID,
 		Email:    user.Email,
 		Role:     user.Role,
-		Key:      t.RefreshKey,
-		Duration: RefreshTokenDuration,
+		Roles:    user.Roles,
+		Type:     PrincipalUser,
+		Scope:    ScopeImpersonation,
+		Actor:    actor,
+		Claims:   user.Claims,
+		Purpose:  KeyPurposeAccess,
+		Duration: ImpersonationTokenDuration,
 	})
 }
 
 func (t *TokenConfig) VerifyAccessToken(accessToken string) (*TokenUser, error) {
-	return t.verifyToken(accessToken, t.SecretKey)
+	return t.verifyToken(accessToken, KeyPurposeAccess)
 }
 
 func (t *TokenConfig) VerifyRefreshToken(refreshToken string) (*TokenUser, error) {
-	return t.verifyToken(refreshToken, t.RefreshKey)
+	return t.verifyToken(refreshToken, KeyPurposeRefresh)
 }
 
 // -------- Private ----------
 func (t *TokenConfig) generateToken(input *generateTokenParams) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	claims := jwt.MapClaims{
 		"user_id": input.ID,
 		"email":   input.Email,
 		"role":    input.Role,
+		"roles":   input.Roles,
+		"type":    input.Type,
 		"exp":     time.Now().Add(input.Duration).Unix(),
-	})
+	}
+	for name, value := range input.Claims {
+		if !IsReservedClaim(name) {
+			claims[name] = value
+		}
+	}
+	if input.Scope != "" {
+		claims["scope"] = input.Scope
+	}
+	if input.TenantID != 0 {
+		claims["tenant_id"] = input.TenantID
+		claims["tenant_role"] = input.TenantRole
+	}
+	if input.TokenID != "" {
+		claims["jti"] = input.TokenID
+	}
+	if input.SessionID != 0 {
+		claims["sid"] = input.SessionID
+	}
+	if input.Actor != nil {
+		claims["act"] = map[string]any{
+			"sub":   input.Actor.ID,
+			"email": input.Actor.Email,
+		}
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	kid, key := t.signingKey(input.Purpose)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
 
-	tokenStr, err := token.SignedString([]byte(input.Key))
+	tokenStr, err := token.SignedString([]byte(key))
 	if err != nil {
 		return "", fmt.Errorf("sign token failed: %w", err)
 	}
@@ -84,12 +255,14 @@ func (t *TokenConfig) generateToken(input *generateTokenParams) (string, error)
 	return tokenStr, nil
 }
 
-func (t *TokenConfig) verifyToken(tokenString, key string) (*TokenUser, error) {
-	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (any, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unknow signing method: %v", t.Header)
+func (t *TokenConfig) verifyToken(tokenString, purpose string) (*TokenUser, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unknow signing method: %v", token.Header)
 		}
-		return []byte(key), nil
+
+		kid, _ := token.Header["kid"].(string)
+		return t.verifyKey(purpose, kid)
 	})
 	if err != nil {
 		return nil, err
@@ -103,6 +276,11 @@ func (t *TokenConfig) verifyToken(tokenString, key string) (*TokenUser, error) {
 		return nil, errors.New("verification failed")
 	}
 
+	// Action tokens share the secret key but are never access tokens
+	if _, ok := claims["purpose"]; ok {
+		return nil, errors.New("invalid token")
+	}
+
 	if float64(time.Now().Unix()) > claims["exp"].(float64) {
 		return nil, errors.New("token is expired")
 	}
@@ -112,5 +290,74 @@ func (t *TokenConfig) verifyToken(tokenString, key string) (*TokenUser, error) {
 	user.Email = claims["email"].(string)
 	user.Role = claims["role"].(string)
 
+	if roles, ok := claims["roles"].([]any); ok {
+		for _, r := range roles {
+			if role, ok := r.(string); ok {
+				user.Roles = append(user.Roles, role)
+			}
+		}
+	}
+	if len(user.Roles) == 0 {
+		user.Roles = []string{user.Role}
+	}
+
+	// Tokens issued before principal types existed are user tokens
+	user.Type, _ = claims["type"].(string)
+	if user.Type == "" {
+		user.Type = PrincipalUser
+	}
+	user.Scope, _ = claims["scope"].(string)
+
+	if tenantID, ok := claims["tenant_id"].(float64); ok {
+		user.TenantID = int64(tenantID)
+		user.TenantRole, _ = claims["tenant_role"].(string)
+	}
+
+	if sid, ok := claims["sid"].(float64); ok {
+		user.SessionID = int64(sid)
+	}
+
+	if act, ok := claims["act"].(map[string]any); ok {
+		actor := new(TokenActor)
+		if sub, ok := act["sub"].(float64); ok {
+			actor.ID = int64(sub)
+		}
+		actor.Email, _ = act["email"].(string)
+		user.Actor = actor
+	}
+
 	return user, nil
 }
+
+// signingKey returns the newest rotated key for purpose, or the configured
+// key with an empty kid.
+func (t *TokenConfig) signingKey(purpose string) (string, string) {
+	keys, legacy := t.keys(purpose)
+	if len(keys) > 0 {
+		return keys[0].ID, keys[0].Secret
+	}
+	return "", legacy
+}
+
+// verifyKey resolves the key a token was signed with. Tokens without a kid
+// predate key rotation and use the configured key.
+func (t *TokenConfig) verifyKey(purpose, kid string) ([]byte, error) {
+	keys, legacy := t.keys(purpose)
+	if kid == "" {
+		return []byte(legacy), nil
+	}
+
+	for _, key := range keys {
+		if key.ID == kid {
+			return []byte(key.Secret), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (t *TokenConfig) keys(purpose string) ([]config.JWTKey, string) {
+	if purpose == KeyPurposeRefresh {
+		return t.refreshKeys, t.RefreshKey
+	}
+	return t.accessKeys, t.SecretKey
+}
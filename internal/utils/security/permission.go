@@ -0,0 +1,78 @@
+package security
+
+import (
+	"slices"
+	"sort"
+)
+
+const (
+	PermUsersRead             = "users:read"
+	PermUsersWrite            = "users:write"
+	PermUsersImpersonate      = "users:impersonate"
+	PermGroupsManage          = "groups:manage"
+	PermServiceAccountsManage = "service_accounts:manage"
+	PermAuditRead             = "audit:read"
+	PermWebhooksManage        = "webhooks:manage"
+)
+
+var rolePermissions = map[string][]string{
+	RoleUser:    {},
+	RoleSupport: {PermUsersRead, PermUsersImpersonate},
+	RoleAdmin: {
+		PermUsersRead,
+		PermUsersWrite,
+		PermUsersImpersonate,
+		PermGroupsManage,
+		PermServiceAccountsManage,
+		PermAuditRead,
+		PermWebhooksManage,
+	},
+}
+
+// rolePrecedence picks the single "role" claim, highest first.
+var rolePrecedence = []string{RoleAdmin, RoleSupport, RoleUser}
+
+func IsKnownRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+func RoleGrants(role, permission string) bool {
+	return slices.Contains(rolePermissions[role], permission)
+}
+
+// Permissions returns the sorted union of permissions granted by roles.
+func Permissions(roles []string) []string {
+	set := make(map[string]struct{})
+	for _, role := range roles {
+		for _, p := range rolePermissions[role] {
+			set[p] = struct{}{}
+		}
+	}
+
+	perms := make([]string, 0, len(set))
+	for p := range set {
+		perms = append(perms, p)
+	}
+	sort.Strings(perms)
+
+	return perms
+}
+
+func HasPermission(roles []string, permission string) bool {
+	for _, role := range roles {
+		if RoleGrants(role, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+func PrimaryRole(roles []string) string {
+	for _, role := range rolePrecedence {
+		if slices.Contains(roles, role) {
+			return role
+		}
+	}
+	return RoleUser
+}
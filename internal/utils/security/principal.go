@@ -0,0 +1,14 @@
+package security
+
+// Principal types carried in the token "type" claim.
+const (
+	PrincipalUser    = "user"
+	PrincipalService = "service"
+	PrincipalSystem  = "system"
+)
+
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
@@ -0,0 +1,69 @@
+package transaction
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+type txContextKey struct{}
+
+// unit is the transaction carried by the context and the callbacks waiting
+// for it to end.
+type unit struct {
+	tx       *gorm.DB
+	onFinish []func(committed bool)
+}
+
+// Manager runs a unit of work. Repositories that read their handle through
+// DB take part in the transaction carried by the context.
+type Manager interface {
+	Do(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type manager struct {
+	db *gorm.DB
+}
+
+func NewManager(db *gorm.DB) Manager {
+	return &manager{db: db}
+}
+
+// Do commits when fn returns nil and rolls back otherwise. A nested Do joins
+// the outer transaction.
+func (m *manager) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txContextKey{}).(*unit); ok {
+		return fn(ctx)
+	}
+
+	u := new(unit)
+
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		u.tx = tx
+		return fn(context.WithValue(ctx, txContextKey{}, u))
+	})
+
+	for _, f := range u.onFinish {
+		f(err == nil)
+	}
+	return err
+}
+
+// DB returns the transaction in ctx, or db when there is none.
+func DB(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if u, ok := ctx.Value(txContextKey{}).(*unit); ok {
+		return u.tx.WithContext(ctx)
+	}
+	return db.WithContext(ctx)
+}
+
+// OnFinish runs fn once the transaction in ctx has committed or rolled back.
+// Without a transaction fn runs at once as committed. Writes that must not
+// wait on the transaction's locks, like audit records, go through here.
+func OnFinish(ctx context.Context, fn func(committed bool)) {
+	if u, ok := ctx.Value(txContextKey{}).(*unit); ok {
+		u.onFinish = append(u.onFinish, fn)
+		return
+	}
+	fn(true)
+}
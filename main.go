@@ -2,20 +2,13 @@ package main
 
 import (
 	"log"
+	"os"
 
-	"github.com/codepnw/go-authen-system/config"
-	"github.com/codepnw/go-authen-system/internal/server"
+	"github.com/codepnw/go-authen-system/internal/cli"
 )
 
-const configFileName = "config"
-
 func main() {
-	cfg, err := config.InitConfig(configFileName)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	if err = server.Run(cfg); err != nil {
+	if err := cli.Run(os.Args[1:]); err != nil {
 		log.Fatal(err)
 	}
 }